@@ -0,0 +1,66 @@
+package cmpt
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// newMemberBloom builds the Bloom filter of a cluster's member tx hashes
+func newMemberBloom(txs []*types.Transaction) *types.Bloom {
+	bloom := new(types.Bloom)
+	for _, tx := range txs {
+		bloom.Add(tx.Hash().Bytes())
+	}
+	return bloom
+}
+
+// MightContain reports whether the cluster may hold the given transaction.
+// False positives are possible, false negatives are not. Leaves inserted as raw
+// values carry no filter and never match.
+func (h *HashNode) MightContain(txHash common.Hash) bool {
+	return h.Bloom != nil && h.Bloom.Test(txHash.Bytes())
+}
+
+// FindCluster returns the prefix of the cluster holding the given transaction.
+// Only clusters whose Bloom filter matches are decoded to rule out false positives.
+func (t *Trie) FindCluster(txHash common.Hash) ([]byte, error) {
+	var candidates []*HashNode
+	collectCandidates(t.Root, txHash, &candidates)
+	for _, leaf := range candidates {
+		value, err := t.loadValue(leaf)
+		if err != nil {
+			return nil, err
+		}
+		encoded, err := splitClusterValue(value)
+		if err != nil {
+			return nil, err
+		}
+		for _, txData := range encoded {
+			if crypto.Keccak256Hash(txData) == txHash {
+				return leaf.Key, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("transaction %s not found in any cluster", txHash.Hex())
+}
+
+// collectCandidates gathers the leaves whose Bloom filter matches txHash
+func collectCandidates(node TrieNode, txHash common.Hash, leaves *[]*HashNode) {
+	switch n := node.(type) {
+	case *HashNode:
+		if n.MightContain(txHash) {
+			*leaves = append(*leaves, n)
+		}
+	case *ShortNode:
+		collectCandidates(n.Val, txHash, leaves)
+	case *FullNode:
+		for _, child := range n.Children {
+			if child != nil {
+				collectCandidates(child, txHash, leaves)
+			}
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package cmpt
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// ClusterCommitment is what a cluster leaf commits to besides its key prefix.
+// It lets a verifier check that a served cluster body is complete and untampered
+// without decoding every transaction in it.
+type ClusterCommitment struct {
+	MemberCount uint64      // Number of transactions in the cluster
+	MemberRoot  common.Hash // Binary Merkle root of the member transaction hashes
+	ValueHash   common.Hash // Hash of the packed cluster value
+}
+
+// EncodeClusterValue packs cluster members as an RLP list of their binary
+// encodings, so members can be split (and hashed) without decoding them
+func EncodeClusterValue(txs []*types.Transaction) ([]byte, error) {
+	encoded := make([][]byte, len(txs))
+	for i, tx := range txs {
+		txData, err := tx.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		encoded[i] = txData
+	}
+	return rlp.EncodeToBytes(encoded)
+}
+
+// splitClusterValue splits a packed cluster value into its member encodings
+func splitClusterValue(value []byte) ([][]byte, error) {
+	var encoded [][]byte
+	if err := rlp.DecodeBytes(value, &encoded); err != nil {
+		return nil, fmt.Errorf("malformed cluster value: %w", err)
+	}
+	return encoded, nil
+}
+
+// DecodeClusterValue unpacks a cluster value produced by EncodeClusterValue
+func DecodeClusterValue(value []byte) ([]*types.Transaction, error) {
+	encoded, err := splitClusterValue(value)
+	if err != nil {
+		return nil, err
+	}
+	txs := make([]*types.Transaction, len(encoded))
+	for i, txData := range encoded {
+		txs[i] = new(types.Transaction)
+		if err := txs[i].UnmarshalBinary(txData); err != nil {
+			return nil, fmt.Errorf("malformed cluster member %d: %w", i, err)
+		}
+	}
+	return txs, nil
+}
+
+// NewClusterCommitment computes the commitment of a packed cluster value. An
+// optional hasher replaces the default Keccak256 for the value and member tree.
+func NewClusterCommitment(value []byte, hasher ...Hasher) (ClusterCommitment, error) {
+	hash := pickHasher(hasher)
+	encoded, err := splitClusterValue(value)
+	if err != nil {
+		return ClusterCommitment{}, err
+	}
+	// Member hashes are transaction hashes, which are always Keccak256 of the binary encoding
+	members := make([]common.Hash, len(encoded))
+	for i, txData := range encoded {
+		members[i] = crypto.Keccak256Hash(txData)
+	}
+	return ClusterCommitment{
+		MemberCount: uint64(len(members)),
+		MemberRoot:  memberRoot(hash, members),
+		ValueHash:   hash(value),
+	}, nil
+}
+
+// Verify checks a served cluster body against the commitment, using the optional
+// hasher the commitment was built with
+func (c ClusterCommitment) Verify(value []byte, hasher ...Hasher) error {
+	hash := pickHasher(hasher)
+	if hash(value) != c.ValueHash {
+		return fmt.Errorf("cluster value hash mismatch")
+	}
+	served, err := NewClusterCommitment(value, hash)
+	if err != nil {
+		return err
+	}
+	if served.MemberCount != c.MemberCount {
+		return fmt.Errorf("cluster member count mismatch: have %d, want %d", served.MemberCount, c.MemberCount)
+	}
+	if served.MemberRoot != c.MemberRoot {
+		return fmt.Errorf("cluster member root mismatch")
+	}
+	return nil
+}
+
+// VerifyClusterBody checks a served cluster body against a proven cluster leaf
+// commitment, e.g. one taken from a verified multiproof, using the optional
+// hasher the commitment was built with. The body must decode into valid
+// transactions whose hashes equal claimedMembers in order, so a truncated or
+// padded body is rejected even before its value hash is compared.
+func VerifyClusterBody(commitment ClusterCommitment, body []byte, claimedMembers []common.Hash, hasher ...Hasher) error {
+	hash := pickHasher(hasher)
+	txs, err := DecodeClusterValue(body)
+	if err != nil {
+		return err
+	}
+	switch {
+	case uint64(len(txs)) < commitment.MemberCount:
+		return fmt.Errorf("cluster body truncated: have %d members, want %d", len(txs), commitment.MemberCount)
+	case uint64(len(txs)) > commitment.MemberCount:
+		return fmt.Errorf("cluster body padded: have %d members, want %d", len(txs), commitment.MemberCount)
+	case len(claimedMembers) != len(txs):
+		return fmt.Errorf("claimed %d members, body holds %d", len(claimedMembers), len(txs))
+	}
+	members := make([]common.Hash, len(txs))
+	for i, tx := range txs {
+		members[i] = tx.Hash()
+		if members[i] != claimedMembers[i] {
+			return fmt.Errorf("member %d is %s, claimed %s", i, members[i].Hex(), claimedMembers[i].Hex())
+		}
+	}
+	if memberRoot(hash, members) != commitment.MemberRoot {
+		return fmt.Errorf("cluster member root mismatch")
+	}
+	if hash(body) != commitment.ValueHash {
+		return fmt.Errorf("cluster value hash mismatch")
+	}
+	return nil
+}
+
+// memberRoot computes the binary Merkle root of member hashes, duplicating the
+// last node of odd-sized levels. An empty cluster has the zero root.
+func memberRoot(hash Hasher, members []common.Hash) common.Hash {
+	if len(members) == 0 {
+		return common.Hash{}
+	}
+	level := append([]common.Hash{}, members...)
+	for len(level) > 1 {
+		var next []common.Hash
+		for i := 0; i < len(level); i += 2 {
+			right := level[i]
+			if i+1 < len(level) {
+				right = level[i+1]
+			}
+			next = append(next, hash(level[i].Bytes(), right.Bytes()))
+		}
+		level = next
+	}
+	return level[0]
+}
+
+// hashLeaf computes the hash of a cluster leaf from its prefix nibbles and commitment
+func hashLeaf(hash Hasher, pre []byte, c ClusterCommitment) common.Hash {
+	var count [8]byte
+	binary.BigEndian.PutUint64(count[:], c.MemberCount)
+	return hash(pre, count[:], c.MemberRoot.Bytes(), c.ValueHash.Bytes())
+}
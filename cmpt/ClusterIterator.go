@@ -0,0 +1,65 @@
+package cmpt
+
+import "github.com/ethereum/go-ethereum/common"
+
+// ClusterInfo describes one cluster leaf as yielded by ClusterIterator
+type ClusterInfo struct {
+	Prefix      []byte      // Cluster prefix
+	MemberCount uint64      // Number of member transactions
+	ValueBytes  int         // Byte length of the packed cluster value
+	LeafHash    common.Hash // Leaf hash, valid once the trie has been hashed
+}
+
+// ClusterIterator walks the cluster leaves of a trie in ascending key order.
+// It reads only leaf metadata, so cluster values held in a store are not loaded.
+type ClusterIterator struct {
+	stack []TrieNode
+	info  ClusterInfo
+}
+
+// NewClusterIterator returns an iterator positioned before the first cluster
+func (t *Trie) NewClusterIterator() *ClusterIterator {
+	it := &ClusterIterator{}
+	if t.Root != nil {
+		it.stack = append(it.stack, t.Root)
+	}
+	return it
+}
+
+// Next advances to the next cluster and reports whether one exists
+func (it *ClusterIterator) Next() bool {
+	for len(it.stack) > 0 {
+		node := it.stack[len(it.stack)-1]
+		it.stack = it.stack[:len(it.stack)-1]
+
+		switch n := node.(type) {
+		case *HashNode:
+			it.info = ClusterInfo{
+				Prefix:      n.Key,
+				MemberCount: n.MemberCount,
+				ValueBytes:  n.Size,
+				LeafHash:    n.Hash,
+			}
+			return true
+		case *ShortNode:
+			it.stack = append(it.stack, n.Val)
+		case *FullNode:
+			// Push in reverse so the smallest nibble pops first. A key ending at
+			// this branch (child 16) sorts before all keys extending it.
+			for i := 15; i >= 0; i-- {
+				if n.Children[i] != nil {
+					it.stack = append(it.stack, n.Children[i])
+				}
+			}
+			if n.Children[16] != nil {
+				it.stack = append(it.stack, n.Children[16])
+			}
+		}
+	}
+	return false
+}
+
+// Cluster returns the cluster the iterator is positioned at
+func (it *ClusterIterator) Cluster() ClusterInfo {
+	return it.info
+}
@@ -0,0 +1,99 @@
+package cmpt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// clusterValuePrefix namespaces cluster values inside a shared key-value store
+var clusterValuePrefix = []byte("cmpt-c")
+
+// ClusterStore is the backend used to keep packed cluster values out of memory.
+// Any ethdb.KeyValueStore (LevelDB, Pebble, memorydb) satisfies it.
+type ClusterStore interface {
+	ethdb.KeyValueReader
+	ethdb.KeyValueWriter
+}
+
+// WithStore keeps cluster values in the given store instead of in the trie leaves.
+// Leaves retain only the value hash, and values are loaded lazily when needed.
+func WithStore(store ClusterStore) TrieOption {
+	return func(t *Trie) {
+		t.store = store
+	}
+}
+
+// clusterStoreKey returns the store key for the cluster with the given prefix
+func clusterStoreKey(prefix []byte) []byte {
+	return append(append([]byte{}, clusterValuePrefix...), prefix...)
+}
+
+// Get returns the packed value of the cluster with the given prefix, loading it
+// from the cluster store if the leaf does not hold it in memory
+func (t *Trie) Get(prefix []byte) ([]byte, error) {
+	leaf := t.findLeaf(t.Root, prefix)
+	if leaf == nil {
+		return nil, fmt.Errorf("cluster %x not found", prefix)
+	}
+	return t.loadValue(leaf)
+}
+
+// GetCluster returns the decoded member transactions of the cluster with the given prefix
+func (t *Trie) GetCluster(prefix []byte) ([]*types.Transaction, error) {
+	value, err := t.Get(prefix)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeClusterValue(value)
+}
+
+// loadValue returns a leaf's value, reading and checking it against the leaf's
+// value hash when it lives in the cluster store
+func (t *Trie) loadValue(leaf *HashNode) ([]byte, error) {
+	if leaf.Value != nil || t.store == nil {
+		return leaf.Value, nil
+	}
+	value, err := t.store.Get(clusterStoreKey(leaf.Key))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load cluster %x: %w", leaf.Key, err)
+	}
+	if t.hasher(value) != leaf.ValueHash {
+		return nil, errors.New("stored cluster value does not match leaf commitment")
+	}
+	return value, nil
+}
+
+// findLeaf returns the leaf of the subtree holding the given full key,
+// following the key's nibbles from node down as insert does
+func (t *Trie) findLeaf(node TrieNode, key []byte) *HashNode {
+	nibbles, err := t.keyNibbles(key)
+	if err != nil {
+		return nil
+	}
+	for node != nil {
+		switch n := node.(type) {
+		case *HashNode:
+			if bytes.Equal(n.Pre, nibbles) && bytes.Equal(n.Key, key) {
+				return n
+			}
+			return nil
+		case *ShortNode:
+			if !bytes.HasPrefix(nibbles, n.Key) {
+				return nil
+			}
+			nibbles = nibbles[len(n.Key):]
+			node = n.Val
+		case *FullNode:
+			var slot int
+			slot, nibbles = branchSlot(nibbles)
+			node = n.Children[slot]
+		default:
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package cmpt
+
+import (
+	"container/heap"
+	"errors"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// ClusterStrategy decides which cluster a transaction belongs to by returning
+// the cluster prefix used as its trie key
+type ClusterStrategy interface {
+	ClusterKey(tx *types.Transaction) ([]byte, error)
+}
+
+// ClusterStrategyFunc adapts an ordinary function to the ClusterStrategy interface
+type ClusterStrategyFunc func(tx *types.Transaction) ([]byte, error)
+
+// ClusterKey calls f(tx)
+func (f ClusterStrategyFunc) ClusterKey(tx *types.Transaction) ([]byte, error) {
+	return f(tx)
+}
+
+// SenderStrategy clusters transactions by the leading bytes of their sender address
+type SenderStrategy struct {
+	Signer types.Signer // Signer used to recover senders
+	Length int          // Number of address bytes used as prefix (1 to 20)
+}
+
+// ClusterKey returns the first Length bytes of the transaction sender
+func (s *SenderStrategy) ClusterKey(tx *types.Transaction) ([]byte, error) {
+	if s.Length <= 0 || s.Length > common.AddressLength {
+		return nil, errors.New("sender prefix length must be between 1 and 20")
+	}
+	from, err := types.Sender(s.Signer, tx)
+	if err != nil {
+		return nil, err
+	}
+	return from.Bytes()[:s.Length], nil
+}
+
+// Tags of the clusters produced by DestinationStrategy
+const (
+	CreationTag byte = 0x00 // Contract creations (no destination)
+	CallTag     byte = 0x01 // Calls and transfers, followed by the destination prefix
+)
+
+// DestinationStrategy clusters transactions by the leading bytes of their
+// destination, putting all contract creations into one bucket. It serves
+// light clients verifying all transactions touching a given contract.
+type DestinationStrategy struct {
+	Length int // Number of address bytes used as prefix (1 to 20)
+}
+
+// ClusterKey returns CallTag followed by the first Length bytes of the
+// destination, or CreationTag alone for contract creations
+func (s *DestinationStrategy) ClusterKey(tx *types.Transaction) ([]byte, error) {
+	if tx.To() == nil {
+		return []byte{CreationTag}, nil
+	}
+	return s.KeyFor(*tx.To())
+}
+
+// KeyFor returns the cluster key holding the transactions sent to addr
+func (s *DestinationStrategy) KeyFor(addr common.Address) ([]byte, error) {
+	if s.Length <= 0 || s.Length > common.AddressLength {
+		return nil, errors.New("destination prefix length must be between 1 and 20")
+	}
+	return append([]byte{CallTag}, addr.Bytes()[:s.Length]...), nil
+}
+
+// FeeBandStrategy clusters transactions into fee percentile bands. Band 0 holds
+// the highest-paying transactions, so the top-of-block segment proposers and
+// builders care about forms one compact cluster.
+type FeeBandStrategy struct {
+	BaseFee *big.Int   // Base fee used for effective tips; nil uses the gas price
+	Bounds  []*big.Int // Descending lower fee bound of each band but the last
+}
+
+// NewFeeBandStrategy derives band bounds splitting the sample transactions into
+// the given number of equally populated fee bands
+func NewFeeBandStrategy(sample []*types.Transaction, bands int, baseFee *big.Int) (*FeeBandStrategy, error) {
+	if bands <= 0 || bands > 256 {
+		return nil, errors.New("band count must be between 1 and 256")
+	}
+	if len(sample) < bands {
+		return nil, errors.New("sample smaller than the band count")
+	}
+	s := &FeeBandStrategy{BaseFee: baseFee}
+	fees := make([]*big.Int, len(sample))
+	for i, tx := range sample {
+		fee, err := s.fee(tx)
+		if err != nil {
+			return nil, err
+		}
+		fees[i] = fee
+	}
+	sort.Slice(fees, func(i, j int) bool { return fees[i].Cmp(fees[j]) > 0 })
+	for i := 1; i < bands; i++ {
+		s.Bounds = append(s.Bounds, fees[i*len(fees)/bands-1])
+	}
+	return s, nil
+}
+
+// fee returns the per-gas fee the transaction pays to the block producer
+func (s *FeeBandStrategy) fee(tx *types.Transaction) (*big.Int, error) {
+	if s.BaseFee == nil {
+		return tx.GasPrice(), nil
+	}
+	return tx.EffectiveGasTip(s.BaseFee)
+}
+
+// ClusterKey returns the one-byte index of the transaction's fee band
+func (s *FeeBandStrategy) ClusterKey(tx *types.Transaction) ([]byte, error) {
+	fee, err := s.fee(tx)
+	if err != nil {
+		return nil, err
+	}
+	for i, bound := range s.Bounds {
+		if fee.Cmp(bound) >= 0 {
+			return []byte{byte(i)}, nil
+		}
+	}
+	return []byte{byte(len(s.Bounds))}, nil
+}
+
+// ClusterTransactions groups transactions into the clusters map expected by BuildCMPTTree
+func ClusterTransactions(txs []*types.Transaction, strategy ClusterStrategy) (map[string][]*types.Transaction, error) {
+	clusters := make(map[string][]*types.Transaction)
+	for _, tx := range txs {
+		key, err := strategy.ClusterKey(tx)
+		if err != nil {
+			return nil, err
+		}
+		clusters[string(key)] = append(clusters[string(key)], tx)
+	}
+	return clusters, nil
+}
+
+// SizeBalancedClusters splits transactions into clusterCount clusters of nearly
+// equal encoded size rather than equal member count. Transactions are placed
+// largest first into the currently smallest cluster, so large calldata
+// transactions end up in low-cardinality clusters and the worst-case cluster
+// download stays close to the average. Cluster i is keyed by i in big-endian.
+func SizeBalancedClusters(txs []*types.Transaction, clusterCount int) (map[string][]*types.Transaction, error) {
+	if clusterCount <= 0 || clusterCount > 1<<16 {
+		return nil, errors.New("cluster count must be between 1 and 65536")
+	}
+	width := 1
+	if clusterCount > 1<<8 {
+		width = 2
+	}
+
+	sorted := append([]*types.Transaction{}, txs...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Size() > sorted[j].Size() })
+
+	bins := make(sizeBins, clusterCount)
+	for i := range bins {
+		bins[i] = &sizeBin{index: i}
+	}
+	heap.Init(&bins)
+	for _, tx := range sorted {
+		bin := bins[0]
+		bin.txs = append(bin.txs, tx)
+		bin.size += tx.Size()
+		heap.Fix(&bins, 0)
+	}
+
+	clusters := make(map[string][]*types.Transaction, clusterCount)
+	for _, bin := range bins {
+		if len(bin.txs) == 0 {
+			continue
+		}
+		key := make([]byte, width)
+		for i := 0; i < width; i++ {
+			key[width-1-i] = byte(bin.index >> (8 * i))
+		}
+		clusters[string(key)] = bin.txs
+	}
+	return clusters, nil
+}
+
+// sizeBin is one cluster being filled by SizeBalancedClusters
+type sizeBin struct {
+	index int
+	size  uint64
+	txs   []*types.Transaction
+}
+
+// sizeBins is a min-heap of clusters ordered by size, then index
+type sizeBins []*sizeBin
+
+func (b sizeBins) Len() int { return len(b) }
+func (b sizeBins) Less(i, j int) bool {
+	if b[i].size != b[j].size {
+		return b[i].size < b[j].size
+	}
+	return b[i].index < b[j].index
+}
+func (b sizeBins) Swap(i, j int)       { b[i], b[j] = b[j], b[i] }
+func (b *sizeBins) Push(x interface{}) { *b = append(*b, x.(*sizeBin)) }
+func (b *sizeBins) Pop() interface{} {
+	old := *b
+	bin := old[len(old)-1]
+	*b = old[:len(old)-1]
+	return bin
+}
@@ -0,0 +1,169 @@
+package cmpt
+
+import (
+	"slices"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// BlockRecord summarizes how one block changed the clustered trie
+type BlockRecord struct {
+	Number          uint64        // Position of the block in the chain
+	Root            common.Hash   // Trie root after the block
+	TxCount         int           // Transactions in the block
+	NewClusters     int           // Clusters created by the block
+	UpdatedClusters int           // Existing clusters that received transactions
+	WitnessBytes    int           // Bytes needed to verify every cluster touched by the block
+	WitnessDelta    int           // Change of WitnessBytes relative to the previous block
+	RehashedNodes   int           // Hashes recomputed; untouched subtrees reuse cached hashes
+	Duration        time.Duration // Time spent routing, updating and hashing
+}
+
+// ClusteredChain carries clusters across blocks. Each block's transactions are
+// routed to existing or new clusters and the trie is updated in place, modelling
+// the steady state of a chain instead of one-shot builds.
+type ClusteredChain struct {
+	Strategy ClusterStrategy // Routes transactions to clusters
+	Trie     *Trie           // Trie holding the current clusters
+	Blocks   []BlockRecord   // Per-block results, in block order
+
+	clusters map[string][]*types.Transaction // Members of every cluster
+}
+
+// NewClusteredChain creates an empty chain routing transactions with strategy
+func NewClusteredChain(strategy ClusterStrategy, opts ...TrieOption) *ClusteredChain {
+	return &ClusteredChain{
+		Strategy: strategy,
+		Trie:     NewTrie(opts...),
+		clusters: make(map[string][]*types.Transaction),
+	}
+}
+
+// ClusterCount returns the number of clusters created so far
+func (c *ClusteredChain) ClusterCount() int {
+	return len(c.clusters)
+}
+
+// AddBlock routes the block's transactions to their clusters, rewrites every
+// touched cluster leaf, rehashes the trie and records the block's results. On
+// failure the chain is left as it was before the block.
+func (c *ClusteredChain) AddBlock(txs []*types.Transaction) (BlockRecord, error) {
+	startTime := time.Now()
+
+	// Route all transactions first so a routing failure leaves the chain untouched
+	touched := make(map[string][]*types.Transaction)
+	for _, tx := range txs {
+		key, err := c.Strategy.ClusterKey(tx)
+		if err != nil {
+			return BlockRecord{}, err
+		}
+		touched[string(key)] = append(touched[string(key)], tx)
+	}
+
+	// Clusters are written to a copy of the trie, swapped in once all succeed
+	trie := c.Trie.Copy()
+	updated := make(map[string][]*types.Transaction, len(touched))
+	record := BlockRecord{Number: uint64(len(c.Blocks)), TxCount: len(txs)}
+	prefixes := make([][]byte, 0, len(touched))
+	for prefixStr, blockTxs := range touched {
+		if _, exists := c.clusters[prefixStr]; exists {
+			record.UpdatedClusters++
+		} else {
+			record.NewClusters++
+		}
+		// Clip so the append never writes into the slice the old trie shares
+		members := append(slices.Clip(c.clusters[prefixStr]), blockTxs...)
+		size, err := trie.putCluster([]byte(prefixStr), members, true)
+		if err != nil {
+			c.restoreStore(updated)
+			return BlockRecord{}, err
+		}
+		updated[prefixStr] = members
+		prefixes = append(prefixes, []byte(prefixStr))
+		record.WitnessBytes += size
+	}
+	c.Trie = trie
+	for prefixStr, members := range updated {
+		c.clusters[prefixStr] = members
+	}
+
+	c.Trie.fixedPath(c.Trie.Root, []byte{})
+	record.Root, record.RehashedNodes = c.Trie.Rehash()
+
+	// The witness carries the touched cluster bodies plus the sibling hashes
+	record.WitnessBytes += c.Trie.CalculateRequiredHashes2(prefixes) * common.HashLength
+	if len(c.Blocks) > 0 {
+		record.WitnessDelta = record.WitnessBytes - c.Blocks[len(c.Blocks)-1].WitnessBytes
+	}
+	record.Duration = time.Since(startTime)
+
+	c.Blocks = append(c.Blocks, record)
+	return record, nil
+}
+
+// restoreStore undoes the cluster store writes of a failed block. The trie
+// copy is dropped, but it shares the store with the current trie, whose
+// leaves still commit to the previous cluster values.
+func (c *ClusteredChain) restoreStore(written map[string][]*types.Transaction) {
+	if c.Trie.store == nil {
+		return
+	}
+	for prefixStr := range written {
+		key := clusterStoreKey([]byte(prefixStr))
+		members, ok := c.clusters[prefixStr]
+		if !ok {
+			c.Trie.store.Delete(key)
+			continue
+		}
+		if value, err := EncodeClusterValue(members); err == nil {
+			c.Trie.store.Put(key, value)
+		}
+	}
+}
+
+// RemoveTransactions drops the given transactions from their clusters and
+// rewrites the affected leaves. Clusters may be left empty; CollectGarbage
+// removes them. It returns the number of transactions removed.
+func (c *ClusteredChain) RemoveTransactions(txHashes []common.Hash) (int, error) {
+	drop := make(map[common.Hash]struct{}, len(txHashes))
+	for _, h := range txHashes {
+		drop[h] = struct{}{}
+	}
+
+	removed := 0
+	for prefixStr, members := range c.clusters {
+		var kept []*types.Transaction
+		for _, tx := range members {
+			if _, ok := drop[tx.Hash()]; !ok {
+				kept = append(kept, tx)
+			}
+		}
+		if len(kept) == len(members) {
+			continue
+		}
+		if _, err := c.Trie.putCluster([]byte(prefixStr), kept, true); err != nil {
+			return removed, err
+		}
+		removed += len(members) - len(kept)
+		c.clusters[prefixStr] = kept
+	}
+	c.Trie.fixedPath(c.Trie.Root, []byte{})
+	c.Trie.ComputeHash(c.Trie.Root)
+	return removed, nil
+}
+
+// CollectGarbage removes empty clusters from the chain and its trie
+func (c *ClusteredChain) CollectGarbage() (GCStats, error) {
+	stats, err := c.Trie.CollectGarbage()
+	if err != nil {
+		return stats, err
+	}
+	for prefixStr, members := range c.clusters {
+		if len(members) == 0 {
+			delete(c.clusters, prefixStr)
+		}
+	}
+	return stats, nil
+}
@@ -9,7 +9,6 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/crypto"
 )
 
 // TrieNode interface defines basic operations for MPT nodes
@@ -34,7 +33,7 @@ func (f *FullNode) GetHash() common.Hash { return f.HashVal }
 // ShortNode represents a shortcut node that compresses multiple nodes
 type ShortNode struct {
 	Path    []byte
-	Key     []byte
+	Key     []byte // Key segment in nibbles
 	Val     TrieNode
 	Flags   interface{}
 	HashVal common.Hash
@@ -46,11 +45,14 @@ func (s *ShortNode) GetHash() common.Hash { return s.HashVal }
 
 // HashNode represents a leaf node containing hashed data
 type HashNode struct {
-	Pre   []byte
-	Key   []byte
-	Value []byte
-	Hash  common.Hash
-	Path  []byte
+	Pre   []byte       // Remaining key nibbles below the parent branch
+	Key   []byte       // Full cluster prefix
+	Value []byte       // nil when the value lives in the trie's cluster store
+	Size  int          // Byte length of the cluster value
+	Bloom *types.Bloom // Filter of member tx hashes, nil for raw values
+	ClusterCommitment
+	Hash common.Hash
+	Path []byte
 }
 
 func (h *HashNode) GetPath() []byte      { return h.Path }
@@ -59,11 +61,52 @@ func (h *HashNode) GetHash() common.Hash { return h.Hash }
 
 // Trie represents the Merkle Patricia Trie structure
 type Trie struct {
-	Root TrieNode
+	Root    TrieNode
+	store   ClusterStore // Optional backend holding cluster values
+	hasher  Hasher       // Hash function for all commitments
+	index   clusterIndex // Cluster membership of every transaction
+	hexKeys bool         // Cluster keys are hex-prefix encoded nibble prefixes
+
+	recomputed int // Hashes computed by ComputeHash since the last Rehash
+}
+
+// TrieOption configures optional Trie behaviour
+type TrieOption func(*Trie)
+
+// NewTrie creates a new empty clustered trie
+func NewTrie(opts ...TrieOption) *Trie {
+	t := &Trie{hasher: Keccak256Hasher, index: newClusterIndex()}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// Copy returns a deep copy of the trie structure. Byte slices (keys, paths and
+// values) are shared, since the trie never modifies them in place.
+func (t *Trie) Copy() *Trie {
+	return &Trie{Root: copyNode(t.Root), store: t.store, hasher: t.hasher, index: t.index.copy(), hexKeys: t.hexKeys}
 }
 
-func NewTrie() *Trie {
-	return &Trie{}
+// copyNode recursively duplicates a node and all of its descendants
+func copyNode(node TrieNode) TrieNode {
+	switch n := node.(type) {
+	case *HashNode:
+		cp := *n
+		return &cp
+	case *ShortNode:
+		cp := *n
+		cp.Val = copyNode(n.Val)
+		return &cp
+	case *FullNode:
+		cp := *n
+		for i, child := range n.Children {
+			cp.Children[i] = copyNode(child)
+		}
+		return &cp
+	default:
+		return nil
+	}
 }
 
 // keyToNibbles converts a byte slice to its nibble representation
@@ -88,128 +131,130 @@ func nibblesToKey(nibbles []byte) []byte {
 	return key
 }
 
-// Insert adds a key-value pair to the trie
+// nibbleString renders nibbles as a hex string, one character per nibble
+func nibbleString(nibbles []byte) string {
+	const hexChars = "0123456789abcdef"
+	out := make([]byte, len(nibbles))
+	for i, n := range nibbles {
+		out[i] = hexChars[n&0x0F]
+	}
+	return string(out)
+}
+
+// Insert adds a key-value pair to the trie. Keys are raw byte prefixes; the
+// conversion to nibbles is handled internally. The leaf commits only to the
+// value hash; use InsertCluster to commit to cluster members as well.
 func (t *Trie) Insert(key, value []byte) error {
-	if len(key) == 0 {
+	return t.put(t.newLeaf(key, value), value, false)
+}
+
+// Update sets the value stored under key, inserting the key if it is not present
+func (t *Trie) Update(key, value []byte) error {
+	return t.put(t.newLeaf(key, value), value, true)
+}
+
+// InsertCluster packs the transactions of a cluster and inserts them under prefix
+func (t *Trie) InsertCluster(prefix []byte, txs []*types.Transaction) error {
+	_, err := t.putCluster(prefix, txs, false)
+	return err
+}
+
+// UpdateCluster replaces the members of a cluster, inserting it if it is not present
+func (t *Trie) UpdateCluster(prefix []byte, txs []*types.Transaction) error {
+	_, err := t.putCluster(prefix, txs, true)
+	return err
+}
+
+// putCluster packs and stores a cluster, returning the size of its packed value
+func (t *Trie) putCluster(prefix []byte, txs []*types.Transaction, overwrite bool) (int, error) {
+	value, err := EncodeClusterValue(txs)
+	if err != nil {
+		return 0, err
+	}
+	commitment, err := NewClusterCommitment(value, t.hasher)
+	if err != nil {
+		return 0, err
+	}
+	leaf := t.newLeaf(prefix, value)
+	leaf.ClusterCommitment = commitment
+	leaf.Bloom = newMemberBloom(txs)
+	if err := t.put(leaf, value, overwrite); err != nil {
+		return 0, err
+	}
+	hashes := make([]common.Hash, len(txs))
+	for i, tx := range txs {
+		hashes[i] = tx.Hash()
+	}
+	t.index.set(prefix, hashes)
+	return len(value), nil
+}
+
+// put inserts a leaf, replacing an existing one only if overwrite is set
+func (t *Trie) put(leaf *HashNode, value []byte, overwrite bool) error {
+	nibbles, err := t.keyNibbles(leaf.Key)
+	if err != nil {
+		return err
+	}
+	if len(nibbles) == 0 {
 		return errors.New("key cannot be empty")
 	}
-	nibbles := keyToNibbles(key)
-	dirty, newNode, err := t.insert(t.Root, []byte{}, nibbles, value)
+	dirty, newNode, err := t.insert(t.Root, []byte{}, nibbles, leaf, overwrite)
 	if err != nil {
 		return err
 	}
+	if t.store != nil {
+		if err := t.store.Put(clusterStoreKey(leaf.Key), value); err != nil {
+			return err
+		}
+	}
 	if dirty {
 		t.Root = newNode
 	}
+	t.index.remove(leaf.Key)
 	return nil
 }
 
-// insert recursively inserts a key-value pair into the trie
-func (t *Trie) insert(n TrieNode, path, key []byte, value []byte) (bool, TrieNode, error) {
+// insert recursively places leaf below n. path holds the nibbles consumed so far
+// and key the remaining nibbles. Existing nodes are never modified: every node
+// on the insertion path is replaced by a fresh one.
+func (t *Trie) insert(n TrieNode, path, key []byte, leaf *HashNode, overwrite bool) (bool, TrieNode, error) {
 	if n == nil {
-		return true, &HashNode{
-			Pre:   key,
-			Key:   nibblesToKey(append(path, key...)),
-			Value: value,
-			Path:  nibblesToKey(append(path, key...)),
-		}, nil
+		// Reached an empty branch, the leaf covers the remaining nibbles
+		return true, leaf.withPre(key), nil
 	}
 
 	switch node := n.(type) {
 	case *ShortNode:
-		nodeKeyNibbles := keyToNibbles(node.Key)
-		matchlen := prefixLen(key, nodeKeyNibbles)
-
-		switch {
-		case matchlen == len(nodeKeyNibbles):
-			newPath := append(path, nodeKeyNibbles...)
-			dirty, nn, err := t.insert(node.Val, newPath, key[matchlen:], value)
-			if err != nil {
+		matchlen := prefixLen(key, node.Key)
+		if matchlen == len(node.Key) {
+			// Full match with short node key, continue insertion in child
+			dirty, nn, err := t.insert(node.Val, concat(path, node.Key), key[matchlen:], leaf, overwrite)
+			if err != nil || !dirty {
 				return false, n, err
 			}
-			if !dirty {
-				return false, n, nil
-			}
 			return true, &ShortNode{
-				Path:  nibblesToKey(newPath),
+				Path:  nibblesToKey(path),
 				Key:   node.Key,
 				Val:   nn,
 				Flags: t.newFlag(),
 			}, nil
-
-		case matchlen == len(key):
-			branch := &FullNode{}
-			branch.Children[16] = &HashNode{Value: value}
-			branch.Path = nibblesToKey(append(path, key...))
-			if matchlen < len(nodeKeyNibbles) && int(nodeKeyNibbles[matchlen]) < 16 {
-				branch.Children[nodeKeyNibbles[matchlen]] = node
-			} else {
-				return false, nil, fmt.Errorf("invalid nibble value or index out of range")
-			}
-			node.Path = nibblesToKey(append(path, key...))
-			node.Key = nibblesToKey(nodeKeyNibbles[matchlen:])
-			return true, &ShortNode{
-				Path:  nibblesToKey(path),
-				Key:   nibblesToKey(key),
-				Val:   branch,
-				Flags: t.newFlag(),
-			}, nil
-
-		case matchlen == 0:
-			branch := &FullNode{}
-			leaf := &HashNode{
-				Path:  nibblesToKey(append(path, key...)),
-				Value: value,
-				Pre:   key,
-			}
-			branch.Path = nibblesToKey(path)
-			if len(nodeKeyNibbles) > 0 && int(nodeKeyNibbles[0]) < 16 {
-				branch.Children[nodeKeyNibbles[0]] = node
-			} else {
-				return false, nil, fmt.Errorf("invalid nibble value or index out of range")
-			}
-			if len(key) > 0 && int(key[0]) < 16 {
-				branch.Children[key[0]] = leaf
-			} else {
-				return false, nil, fmt.Errorf("invalid nibble value or index out of range")
-			}
-			return true, branch, nil
-
-		default:
-			branch := &FullNode{}
-			branch.Path = nibblesToKey(append(path, key[:matchlen]...))
-			if matchlen < len(nodeKeyNibbles) && int(nodeKeyNibbles[matchlen]) < 16 {
-				branch.Children[nodeKeyNibbles[matchlen]] = node
-			} else {
-				return false, nil, fmt.Errorf("invalid nibble value or index out of range")
-			}
-			leaf := &HashNode{
-				Path:  nibblesToKey(append(path, key[:matchlen]...)),
-				Value: value,
-				Pre:   key[matchlen:],
-			}
-			if matchlen < len(key) && int(key[matchlen]) < 16 {
-				branch.Children[key[matchlen]] = leaf
-			} else {
-				return false, nil, fmt.Errorf("invalid nibble value or index out of range")
-			}
-			node.Key = nibblesToKey(nodeKeyNibbles[matchlen:])
-			return true, &ShortNode{
-				Path:  nibblesToKey(path),
-				Key:   nibblesToKey(key[:matchlen]),
-				Val:   branch,
-				Flags: t.newFlag(),
-			}, nil
 		}
 
+		// Partial match, split the short node at the first differing nibble
+		branch := &FullNode{Path: nibblesToKey(concat(path, key[:matchlen])), Flags: t.newFlag()}
+		branch.Children[node.Key[matchlen]] = t.extend(concat(path, node.Key[:matchlen+1]), node.Key[matchlen+1:], node.Val)
+		slot, rest := branchSlot(key[matchlen:])
+		branch.Children[slot] = leaf.withPre(rest)
+		return true, t.extend(path, key[:matchlen], branch), nil
+
 	case *FullNode:
-		if len(key) == 0 {
-			return false, n, errors.New("empty key")
+		// Continue insertion in the child selected by the next nibble
+		slot, rest := branchSlot(key)
+		childPath := path
+		if slot < 16 {
+			childPath = concat(path, key[:1])
 		}
-		if int(key[0]) >= 16 {
-			return false, n, fmt.Errorf("invalid nibble value: %d", key[0])
-		}
-		dirty, nn, err := t.insert(node.Children[key[0]], append(path, key[0]), key[1:], value)
+		dirty, nn, err := t.insert(node.Children[slot], childPath, rest, leaf, overwrite)
 		if err != nil || !dirty {
 			return false, n, err
 		}
@@ -218,25 +263,81 @@ func (t *Trie) insert(n TrieNode, path, key []byte, value []byte) (bool, TrieNod
 			Flags: t.newFlag(),
 		}
 		copy(newNode.Children[:], node.Children[:])
-		newNode.Children[key[0]] = nn
+		newNode.Children[slot] = nn
 		return true, newNode, nil
 
 	case *HashNode:
-		rn, err := t.resolveAndTrack(node, key, path)
-		if err != nil {
-			return false, nil, err
-		}
-		dirty, nn, err := t.insert(rn, path, key, value)
-		if err != nil || !dirty {
-			return false, rn, err
+		if bytes.Equal(node.Pre, key) {
+			if !overwrite {
+				return false, n, errors.New("node exists")
+			}
+			return true, leaf.withPre(key), nil
 		}
-		return true, nn, nil
+		// Split the existing leaf and the new one below a fresh branch
+		matchlen := prefixLen(key, node.Pre)
+		branch := &FullNode{Path: nibblesToKey(concat(path, key[:matchlen])), Flags: t.newFlag()}
+		oldSlot, oldRest := branchSlot(node.Pre[matchlen:])
+		branch.Children[oldSlot] = node.withPre(oldRest)
+		newSlot, newRest := branchSlot(key[matchlen:])
+		branch.Children[newSlot] = leaf.withPre(newRest)
+		return true, t.extend(path, key[:matchlen], branch), nil
 
 	default:
 		return false, nil, errors.New("invalid node type")
 	}
 }
 
+// extend wraps child in a short node holding key, or returns child itself when key is empty
+func (t *Trie) extend(path, key []byte, child TrieNode) TrieNode {
+	if len(key) == 0 {
+		return child
+	}
+	return &ShortNode{
+		Path:  nibblesToKey(path),
+		Key:   key,
+		Val:   child,
+		Flags: t.newFlag(),
+	}
+}
+
+// branchSlot returns the full node slot selected by the first nibble of key and
+// the nibbles left below it. An exhausted key selects the value slot 16.
+func branchSlot(key []byte) (int, []byte) {
+	if len(key) == 0 {
+		return 16, nil
+	}
+	return int(key[0]), key[1:]
+}
+
+// concat joins two nibble slices into a newly allocated slice
+func concat(a, b []byte) []byte {
+	out := make([]byte, 0, len(a)+len(b))
+	return append(append(out, a...), b...)
+}
+
+// newLeaf creates an unplaced leaf for key. The value is kept in memory only
+// when the trie has no cluster store; its hash is always retained.
+func (t *Trie) newLeaf(key, value []byte) *HashNode {
+	leaf := &HashNode{
+		Key:               key,
+		Size:              len(value),
+		ClusterCommitment: ClusterCommitment{ValueHash: t.hasher(value)},
+		Path:              key,
+	}
+	if t.store == nil {
+		leaf.Value = value
+	}
+	return leaf
+}
+
+// withPre returns a copy of the leaf covering the given remaining nibbles
+func (h *HashNode) withPre(pre []byte) *HashNode {
+	cp := *h
+	cp.Pre = pre
+	cp.Hash = common.Hash{}
+	return &cp
+}
+
 // prefixLen returns the length of the common prefix between two byte slices
 func prefixLen(a, b []byte) int {
 	minLen := len(a)
@@ -251,38 +352,6 @@ func prefixLen(a, b []byte) int {
 	return minLen
 }
 
-// resolveAndTrack processes HashNode during insertion
-func (t *Trie) resolveAndTrack(n *HashNode, key2, path []byte) (TrieNode, error) {
-	l := prefixLen(n.Pre, key2)
-	switch {
-	case l == len(n.Pre):
-		if bytes.Equal(n.Pre, key2) {
-			return nil, errors.New("node exists")
-		}
-		f := &FullNode{}
-		f.Path = nibblesToKey(path)
-		f.Children[16] = &HashNode{Value: n.Value}
-		return f, nil
-	case l != 0:
-		s := &ShortNode{
-			Path: nibblesToKey(path),
-			Key:  nibblesToKey(key2[:l]),
-			Val:  n,
-		}
-		n.Pre = n.Pre[l:]
-		return s, nil
-	default:
-		f := &FullNode{}
-		f.Path = nibblesToKey(path)
-		if len(n.Pre) > 0 && int(n.Pre[0]) < 16 {
-			f.Children[n.Pre[0]] = n
-		} else {
-			f.Children[16] = n
-		}
-		return f, nil
-	}
-}
-
 // fixedPath recursively updates node paths after insertion
 func (t *Trie) fixedPath(node TrieNode, path []byte) {
 	if node == nil {
@@ -294,26 +363,47 @@ func (t *Trie) fixedPath(node TrieNode, path []byte) {
 	case *ShortNode:
 		n.Path = nibblesToKey(path)
 		if n.Val != nil {
-			t.fixedPath(n.Val, append(path, keyToNibbles(n.Key)...))
+			t.fixedPath(n.Val, concat(path, n.Key))
 		}
 	case *FullNode:
 		n.Path = nibblesToKey(path)
 		for i := 0; i < 16; i++ {
 			if n.Children[i] != nil {
-				t.fixedPath(n.Children[i], append(path, byte(i)))
+				t.fixedPath(n.Children[i], concat(path, []byte{byte(i)}))
 			}
 		}
+		if n.Children[16] != nil {
+			t.fixedPath(n.Children[16], path)
+		}
 	}
 }
 
-// newFlag creates a new flag for node (placeholder for future use)
-func (t *Trie) newFlag() interface{} { return nil }
+// nodeFlag caches the state of a node's hash. Nodes are never modified after
+// creation, so a node hashed once keeps a valid HashVal until it is replaced.
+type nodeFlag struct {
+	dirty bool // HashVal has not been computed yet
+}
+
+// newFlag creates the flag of a freshly created node
+func (t *Trie) newFlag() interface{} { return nodeFlag{dirty: true} }
+
+// isDirty reports whether a node's cached hash must be recomputed. Nodes
+// without a flag are treated as dirty.
+func isDirty(flags interface{}, hash common.Hash) bool {
+	flag, ok := flags.(nodeFlag)
+	return !ok || flag.dirty || hash == (common.Hash{})
+}
 
-// CalculateRequiredHashes2 computes the number of required hashes for given cluster keys
-func (t *Trie) CalculateRequiredHashes2(clusterKeys [][]byte) int {
-	if t.Root == nil || len(clusterKeys) == 0 {
+// CalculateRequiredHashes2 computes the number of required hashes for the given
+// cluster prefixes. Prefixes are raw bytes, exactly as passed to Insert.
+func (t *Trie) CalculateRequiredHashes2(clusterPrefixes [][]byte) int {
+	if t.Root == nil || len(clusterPrefixes) == 0 {
 		return 0
 	}
+	clusterKeys := make(map[string]struct{}, len(clusterPrefixes))
+	for _, prefix := range clusterPrefixes {
+		clusterKeys[string(prefix)] = struct{}{}
+	}
 	flags, needs := t.calculateHashes(t.Root, clusterKeys)
 	if flags {
 		return needs
@@ -322,18 +412,13 @@ func (t *Trie) CalculateRequiredHashes2(clusterKeys [][]byte) int {
 }
 
 // calculateHashes recursively determines if nodes require hashing
-func (t *Trie) calculateHashes(node TrieNode, clusterKeys [][]byte) (bool, int) {
+func (t *Trie) calculateHashes(node TrieNode, clusterKeys map[string]struct{}) (bool, int) {
 	if node == nil {
 		return false, 0
 	}
 	if hashNode, ok := node.(*HashNode); ok {
-		nodeKey := keyToNibbles(hashNode.Key)
-		for _, clusterKey := range clusterKeys {
-			if bytes.Equal(nodeKey, clusterKey) {
-				return true, 0
-			}
-		}
-		return false, 0
+		_, present := clusterKeys[string(hashNode.Key)]
+		return present, 0
 	}
 	if shortNode, ok := node.(*ShortNode); ok {
 		return t.calculateHashes(shortNode.Val, clusterKeys)
@@ -342,11 +427,11 @@ func (t *Trie) calculateHashes(node TrieNode, clusterKeys [][]byte) (bool, int)
 		allFalseCount := 0
 		totalNeedSum := 0
 		anyTrueFlag := false
-		for i := 0; i < 16; i++ {
-			if fullNode.Children[i] == nil {
+		for _, child := range fullNode.Children {
+			if child == nil {
 				continue
 			}
-			flag, need := t.calculateHashes(fullNode.Children[i], clusterKeys)
+			flag, need := t.calculateHashes(child, clusterKeys)
 			if flag {
 				anyTrueFlag = true
 				totalNeedSum += need
@@ -361,33 +446,62 @@ func (t *Trie) calculateHashes(node TrieNode, clusterKeys [][]byte) (bool, int)
 	return false, 0
 }
 
+// BuildResult reports the outcome of BuildCMPTTree
+type BuildResult struct {
+	Root     common.Hash      // Root hash after the build
+	Clusters int              // Clusters submitted
+	Inserted int              // Clusters inserted successfully
+	Errors   map[string]error // Insert failures by cluster prefix
+	PackTime time.Duration    // Time spent packing and inserting clusters
+	HashTime time.Duration    // Time spent fixing paths and hashing
+	Duration time.Duration    // Total build time
+}
+
+// Err returns the combined insert failures, or nil if every cluster was inserted
+func (r BuildResult) Err() error {
+	errs := make([]error, 0, len(r.Errors))
+	for prefixStr, err := range r.Errors {
+		errs = append(errs, fmt.Errorf("cluster %x: %w", prefixStr, err))
+	}
+	return errors.Join(errs...)
+}
+
 // BuildCMPTTree constructs a CMPT from transaction clusters
-func BuildCMPTTree(trie *Trie, clusters map[string][]*types.Transaction) (*Trie, time.Duration) {
+func BuildCMPTTree(trie *Trie, clusters map[string][]*types.Transaction) (*Trie, BuildResult) {
+	result := BuildResult{Clusters: len(clusters), Errors: make(map[string]error)}
 	startTime := time.Now()
 
 	for prefixStr, txsInCluster := range clusters {
 		prefix := []byte(prefixStr)
 
-		// Pack all transactions in a cluster into a single value
-		var clusterValue []byte
-		for _, tx := range txsInCluster {
-			txData, _ := tx.MarshalBinary()
-			clusterValue = append(clusterValue, txData...)
-		}
-
-		// Insert using prefix as key and packed data as value
-		if err := trie.Insert(prefix, clusterValue); err != nil {
-			fmt.Printf("Failed to insert cluster: %v\n", err)
+		// Insert using prefix as key and packed members as value
+		if err := trie.InsertCluster(prefix, txsInCluster); err != nil {
+			result.Errors[prefixStr] = err
 			continue
 		}
+		result.Inserted++
 	}
+	result.PackTime = time.Since(startTime)
 
+	hashStart := time.Now()
 	trie.fixedPath(trie.Root, []byte{})
-	trie.ComputeHash(trie.Root)
-	return trie, time.Since(startTime)
+	result.Root = trie.ComputeHash(trie.Root)
+	result.HashTime = time.Since(hashStart)
+	result.Duration = time.Since(startTime)
+	return trie, result
+}
+
+// Rehash hashes the trie and returns the root together with the number of
+// hashes that were recomputed. Subtrees untouched since the previous hashing
+// keep their cached hashes, so an update costs hashes only along changed paths.
+func (t *Trie) Rehash() (common.Hash, int) {
+	t.recomputed = 0
+	root := t.ComputeHash(t.Root)
+	return root, t.recomputed
 }
 
-// ComputeHash recursively computes hashes for all nodes in the trie
+// ComputeHash recursively computes the hash of node, reusing the cached hashes
+// of nodes that have not been replaced since they were last hashed
 func (t *Trie) ComputeHash(node TrieNode) common.Hash {
 	if node == nil {
 		return common.Hash{}
@@ -397,15 +511,23 @@ func (t *Trie) ComputeHash(node TrieNode) common.Hash {
 		if n.Hash != (common.Hash{}) {
 			return n.Hash
 		}
-		data := append(n.Pre, n.Value...)
-		n.Hash = crypto.Keccak256Hash(data)
+		// Leaf commits to its prefix and the cluster commitment, never to the raw value
+		n.Hash = hashLeaf(t.hasher, n.Pre, n.ClusterCommitment)
+		t.recomputed++
 		return n.Hash
 	case *ShortNode:
+		if !isDirty(n.Flags, n.HashVal) {
+			return n.HashVal
+		}
 		childHash := t.ComputeHash(n.Val)
-		data := append(keyToNibbles(n.Key), childHash.Bytes()...)
-		n.HashVal = crypto.Keccak256Hash(data)
-		return crypto.Keccak256Hash(data)
+		n.HashVal = t.hasher(n.Key, childHash.Bytes())
+		n.Flags = nodeFlag{}
+		t.recomputed++
+		return n.HashVal
 	case *FullNode:
+		if !isDirty(n.Flags, n.HashVal) {
+			return n.HashVal
+		}
 		var data []byte
 		for i, child := range n.Children {
 			if child != nil {
@@ -414,7 +536,9 @@ func (t *Trie) ComputeHash(node TrieNode) common.Hash {
 				data = append(data, childHash.Bytes()...)
 			}
 		}
-		n.HashVal = crypto.Keccak256Hash(data)
+		n.HashVal = t.hasher(data)
+		n.Flags = nodeFlag{}
+		t.recomputed++
 		return n.HashVal
 	default:
 		return common.Hash{}
@@ -431,7 +555,7 @@ func (t *Trie) PrintTrie(node TrieNode, indent string) {
 	case *HashNode:
 		fmt.Printf("%sHashNode: Key=%s, Value=%s\n", indent, hex.EncodeToString(n.Key), hex.EncodeToString(n.Value))
 	case *ShortNode:
-		fmt.Printf("%sShortNode: Key=%s\n", indent, hex.EncodeToString(n.Key))
+		fmt.Printf("%sShortNode: Key=%s\n", indent, nibbleString(n.Key))
 		t.PrintTrie(n.Val, indent+"  ")
 	case *FullNode:
 		fmt.Printf("%sFullNode: Path=%s\n", indent, hex.EncodeToString(n.Path))
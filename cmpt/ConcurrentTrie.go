@@ -0,0 +1,58 @@
+package cmpt
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// ConcurrentTrie allows one writer goroutine to add clusters while any number of
+// reader goroutines compute required hashes. Writes are applied to a private copy
+// of the current trie, which is fully hashed before being published as the new
+// root, so readers only ever observe complete, immutable snapshots.
+type ConcurrentTrie struct {
+	mu   sync.Mutex           // Serializes writers
+	root atomic.Pointer[Trie] // Latest published snapshot
+}
+
+// NewConcurrentTrie creates a concurrency-safe CMPT holding an empty snapshot
+func NewConcurrentTrie(opts ...TrieOption) *ConcurrentTrie {
+	c := &ConcurrentTrie{}
+	c.root.Store(NewTrie(opts...))
+	return c
+}
+
+// Snapshot returns the latest published trie. Callers must treat it as read-only.
+func (c *ConcurrentTrie) Snapshot() *Trie {
+	return c.root.Load()
+}
+
+// AddClusters inserts clusters into a copy of the current snapshot and publishes
+// the result, returning the outcome of building the new version
+func (c *ConcurrentTrie) AddClusters(clusters map[string][]*types.Transaction) BuildResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Copy-on-write: readers holding the old snapshot are never disturbed
+	next := c.root.Load().Copy()
+	_, result := BuildCMPTTree(next, clusters)
+	c.root.Store(next)
+	return result
+}
+
+// RootHash returns the root hash of the latest published snapshot
+func (c *ConcurrentTrie) RootHash() common.Hash {
+	snap := c.Snapshot()
+	if snap.Root == nil {
+		return common.Hash{}
+	}
+	return snap.Root.GetHash()
+}
+
+// CalculateRequiredHashes2 computes the number of required hashes for the given
+// cluster keys against the latest published snapshot
+func (c *ConcurrentTrie) CalculateRequiredHashes2(clusterKeys [][]byte) int {
+	return c.Snapshot().CalculateRequiredHashes2(clusterKeys)
+}
@@ -0,0 +1,79 @@
+package cmpt
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// WriteDOT renders the trie as a Graphviz digraph. Cluster leaves are labelled
+// with their prefix, member count and value size, and filled from white to red
+// in proportion to their size relative to the largest cluster, so that cluster
+// skew stands out at a glance.
+func (t *Trie) WriteDOT(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "digraph cmpt {")
+	fmt.Fprintln(bw, "\tnode [fontname=\"monospace\", fontsize=10];")
+	if t.Root != nil {
+		next := 0
+		t.writeDOTNode(bw, t.Root, maxLeafSize(t.Root), &next)
+	}
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
+
+// writeDOTNode writes node and its subtree, returning the id assigned to node
+func (t *Trie) writeDOTNode(w io.Writer, node TrieNode, maxSize int, next *int) int {
+	id := *next
+	*next++
+
+	switch n := node.(type) {
+	case *HashNode:
+		fmt.Fprintf(w, "\tn%d [shape=box, style=filled, fillcolor=\"%s\", label=\"%x\\n%d members\\n%d bytes\"];\n",
+			id, sizeColor(n.Size, maxSize), n.Key, n.MemberCount, n.Size)
+	case *ShortNode:
+		fmt.Fprintf(w, "\tn%d [shape=ellipse, label=\"short\\n%s\"];\n", id, nibbleString(n.Key))
+		child := t.writeDOTNode(w, n.Val, maxSize, next)
+		fmt.Fprintf(w, "\tn%d -> n%d;\n", id, child)
+	case *FullNode:
+		fmt.Fprintf(w, "\tn%d [shape=circle, label=\"full\"];\n", id)
+		for i, c := range n.Children {
+			if c == nil {
+				continue
+			}
+			child := t.writeDOTNode(w, c, maxSize, next)
+			fmt.Fprintf(w, "\tn%d -> n%d [label=\"%x\"];\n", id, child, i)
+		}
+	}
+	return id
+}
+
+// maxLeafSize returns the largest cluster value size below node
+func maxLeafSize(node TrieNode) int {
+	switch n := node.(type) {
+	case *HashNode:
+		return n.Size
+	case *ShortNode:
+		return maxLeafSize(n.Val)
+	case *FullNode:
+		largest := 0
+		for _, child := range n.Children {
+			if child != nil {
+				if size := maxLeafSize(child); size > largest {
+					largest = size
+				}
+			}
+		}
+		return largest
+	}
+	return 0
+}
+
+// sizeColor scales a cluster size onto a white-to-red fill colour
+func sizeColor(size, maxSize int) string {
+	shade := 255
+	if maxSize > 0 {
+		shade = 255 - 255*size/maxSize
+	}
+	return fmt.Sprintf("#ff%02x%02x", shade, shade)
+}
@@ -0,0 +1,62 @@
+package cmpt
+
+import (
+	"errors"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// EpochKey prefixes a cluster prefix with an epoch byte. Clusters created under
+// different clustering policies live in disjoint subtries, so changing the
+// policy never rewrites old clusters and they remain provable.
+func EpochKey(epoch byte, prefix []byte) []byte {
+	return append([]byte{epoch}, prefix...)
+}
+
+// SplitEpochKey separates an epoch-versioned cluster key into its epoch and prefix
+func SplitEpochKey(key []byte) (byte, []byte, error) {
+	if len(key) < 2 {
+		return 0, nil, errors.New("cluster key too short to carry an epoch")
+	}
+	return key[0], key[1:], nil
+}
+
+// EpochStrategy wraps the clustering policy of one epoch, namespacing every
+// cluster key it produces with the epoch byte
+type EpochStrategy struct {
+	Epoch    byte            // Epoch the policy applies to
+	Strategy ClusterStrategy // Clustering policy of the epoch
+}
+
+// ClusterKey returns the inner strategy's key prefixed with the epoch byte
+func (s *EpochStrategy) ClusterKey(tx *types.Transaction) ([]byte, error) {
+	key, err := s.Strategy.ClusterKey(tx)
+	if err != nil {
+		return nil, err
+	}
+	return EpochKey(s.Epoch, key), nil
+}
+
+// GroupByEpoch splits epoch-versioned cluster keys into per-epoch requests
+func GroupByEpoch(keys [][]byte) (map[byte][][]byte, error) {
+	requests := make(map[byte][][]byte)
+	for _, key := range keys {
+		epoch, _, err := SplitEpochKey(key)
+		if err != nil {
+			return nil, err
+		}
+		requests[epoch] = append(requests[epoch], key)
+	}
+	return requests, nil
+}
+
+// EpochRequests translates a set of transactions into the cluster keys to
+// request from each epoch, using the cheapest cover of clusters holding them
+func (t *Trie) EpochRequests(txHashes []common.Hash) (map[byte][][]byte, error) {
+	keys, err := t.CoverTransactions(txHashes)
+	if err != nil {
+		return nil, err
+	}
+	return GroupByEpoch(keys)
+}
@@ -0,0 +1,178 @@
+package cmpt
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// GCStats reports the effect of a garbage collection pass
+type GCStats struct {
+	RemovedClusters int // Empty cluster leaves removed
+	NodesBefore     int // Trie nodes before collection
+	NodesAfter      int // Trie nodes after collection
+	ReclaimedNodes  int // Nodes freed by removing leaves and collapsing branches
+}
+
+// Delete removes the cluster with the given prefix, collapsing branches left
+// with a single child
+func (t *Trie) Delete(key []byte) error {
+	if len(key) == 0 {
+		return errors.New("key cannot be empty")
+	}
+	nibbles, err := t.keyNibbles(key)
+	if err != nil {
+		return err
+	}
+	dirty, newNode, err := t.delete(t.Root, nibbles)
+	if err != nil {
+		return err
+	}
+	if !dirty {
+		return errors.New("key not found")
+	}
+	if t.store != nil {
+		if err := t.store.Delete(clusterStoreKey(key)); err != nil {
+			return err
+		}
+	}
+	t.Root = newNode
+	t.index.remove(key)
+	return nil
+}
+
+// delete recursively removes the leaf for the remaining key nibbles below n.
+// Like insert, it replaces every node on the path instead of modifying it.
+func (t *Trie) delete(n TrieNode, key []byte) (bool, TrieNode, error) {
+	switch node := n.(type) {
+	case nil:
+		return false, nil, nil
+
+	case *HashNode:
+		if !bytes.Equal(node.Pre, key) {
+			return false, n, nil
+		}
+		return true, nil, nil
+
+	case *ShortNode:
+		matchlen := prefixLen(key, node.Key)
+		if matchlen < len(node.Key) {
+			return false, n, nil
+		}
+		dirty, nn, err := t.delete(node.Val, key[matchlen:])
+		if err != nil || !dirty {
+			return false, n, err
+		}
+		// The child collapsed: merge its key into this short node
+		switch child := nn.(type) {
+		case *ShortNode:
+			return true, t.extend(nil, concat(node.Key, child.Key), child.Val), nil
+		case *HashNode:
+			return true, child.withPre(concat(node.Key, child.Pre)), nil
+		default:
+			return true, t.extend(nil, node.Key, nn), nil
+		}
+
+	case *FullNode:
+		slot, rest := branchSlot(key)
+		dirty, nn, err := t.delete(node.Children[slot], rest)
+		if err != nil || !dirty {
+			return false, n, err
+		}
+		newNode := &FullNode{
+			Path:  node.Path,
+			Flags: t.newFlag(),
+		}
+		copy(newNode.Children[:], node.Children[:])
+		newNode.Children[slot] = nn
+
+		// Keep the branch while at least two children remain
+		remaining := -1
+		for i, child := range newNode.Children {
+			if child == nil {
+				continue
+			}
+			if remaining >= 0 {
+				return true, newNode, nil
+			}
+			remaining = i
+		}
+		if remaining == 16 {
+			return true, newNode.Children[16], nil
+		}
+		// Only one child is left, fold the branch nibble into it
+		switch child := newNode.Children[remaining].(type) {
+		case *ShortNode:
+			return true, t.extend(nil, concat([]byte{byte(remaining)}, child.Key), child.Val), nil
+		case *HashNode:
+			return true, child.withPre(concat([]byte{byte(remaining)}, child.Pre)), nil
+		default:
+			return true, t.extend(nil, []byte{byte(remaining)}, child), nil
+		}
+
+	default:
+		return false, nil, errors.New("invalid node type")
+	}
+}
+
+// CollectGarbage removes every cluster leaf without members, collapses the trie
+// and rehashes it, reporting how many nodes were reclaimed
+func (t *Trie) CollectGarbage() (GCStats, error) {
+	stats := GCStats{NodesBefore: countNodes(t.Root)}
+
+	var empty [][]byte
+	t.collectEmptyClusters(t.Root, t.hasher(rlp.EmptyList), &empty)
+	for _, key := range empty {
+		if err := t.Delete(key); err != nil {
+			return stats, err
+		}
+		stats.RemovedClusters++
+	}
+
+	t.fixedPath(t.Root, []byte{})
+	t.ComputeHash(t.Root)
+	stats.NodesAfter = countNodes(t.Root)
+	stats.ReclaimedNodes = stats.NodesBefore - stats.NodesAfter
+	return stats, nil
+}
+
+// collectEmptyClusters gathers the keys of all cluster leaves whose value hash
+// is emptyHash, the hash of a cluster without members
+func (t *Trie) collectEmptyClusters(node TrieNode, emptyHash common.Hash, keys *[][]byte) {
+	switch n := node.(type) {
+	case *HashNode:
+		if n.ValueHash == emptyHash {
+			*keys = append(*keys, n.Key)
+		}
+	case *ShortNode:
+		t.collectEmptyClusters(n.Val, emptyHash, keys)
+	case *FullNode:
+		for _, child := range n.Children {
+			if child != nil {
+				t.collectEmptyClusters(child, emptyHash, keys)
+			}
+		}
+	}
+}
+
+// countNodes returns the number of nodes in the subtree
+func countNodes(node TrieNode) int {
+	switch n := node.(type) {
+	case *HashNode:
+		return 1
+	case *ShortNode:
+		return 1 + countNodes(n.Val)
+	case *FullNode:
+		count := 1
+		for _, child := range n.Children {
+			if child != nil {
+				count += countNodes(child)
+			}
+		}
+		return count
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,49 @@
+package cmpt
+
+import (
+	"crypto/sha256"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"lukechampine.com/blake3"
+)
+
+// Hasher computes the digest of the concatenation of its inputs. It is used for
+// every node, leaf and member-tree hash of the trie.
+type Hasher func(data ...[]byte) common.Hash
+
+// Keccak256Hasher is the default hasher, matching Ethereum's MPT
+var Keccak256Hasher Hasher = crypto.Keccak256Hash
+
+// SHA256Hasher hashes with SHA-256, as used by Bitcoin-style chains
+func SHA256Hasher(data ...[]byte) common.Hash {
+	h := sha256.New()
+	for _, b := range data {
+		h.Write(b)
+	}
+	return common.BytesToHash(h.Sum(nil))
+}
+
+// Blake3Hasher hashes with BLAKE3 using a 32-byte output
+func Blake3Hasher(data ...[]byte) common.Hash {
+	h := blake3.New(common.HashLength, nil)
+	for _, b := range data {
+		h.Write(b)
+	}
+	return common.BytesToHash(h.Sum(nil))
+}
+
+// WithHasher replaces the default Keccak256 hasher of the trie
+func WithHasher(hasher Hasher) TrieOption {
+	return func(t *Trie) {
+		t.hasher = hasher
+	}
+}
+
+// pickHasher returns the optional hasher argument of a verifier, defaulting to Keccak256
+func pickHasher(hashers []Hasher) Hasher {
+	if len(hashers) > 0 && hashers[0] != nil {
+		return hashers[0]
+	}
+	return Keccak256Hasher
+}
@@ -0,0 +1,60 @@
+package cmpt
+
+import "errors"
+
+// HexPrefix encodes a nibble-granular cluster prefix as a cluster key using
+// Ethereum's hex-prefix encoding: the first nibble is 1 for an odd nibble count
+// (followed by the first nibble) and 0 for an even one (followed by padding).
+// Odd-length prefixes such as "abc" let cluster counts grow by 16x per level
+// instead of the 256x forced by byte-aligned prefixes.
+func HexPrefix(nibbles []byte) ([]byte, error) {
+	for _, n := range nibbles {
+		if n > 0x0f {
+			return nil, errors.New("invalid nibble in prefix")
+		}
+	}
+	odd := len(nibbles) % 2
+	key := make([]byte, 1, 1+len(nibbles)/2)
+	if odd == 1 {
+		key[0] = 0x10 | nibbles[0]
+	}
+	for i := odd; i < len(nibbles); i += 2 {
+		key = append(key, nibbles[i]<<4|nibbles[i+1])
+	}
+	return key, nil
+}
+
+// hexPrefixToNibbles decodes a cluster key produced by HexPrefix
+func hexPrefixToNibbles(key []byte) ([]byte, error) {
+	if len(key) == 0 {
+		return nil, errors.New("empty hex-prefix key")
+	}
+	nibbles := keyToNibbles(key)
+	switch nibbles[0] {
+	case 0:
+		if nibbles[1] != 0 {
+			return nil, errors.New("invalid hex-prefix padding")
+		}
+		return nibbles[2:], nil
+	case 1:
+		return nibbles[1:], nil
+	default:
+		return nil, errors.New("invalid hex-prefix flag")
+	}
+}
+
+// WithHexPrefixKeys makes the trie interpret every cluster key as hex-prefix
+// encoded (see HexPrefix), so cluster prefixes may end on any nibble
+func WithHexPrefixKeys() TrieOption {
+	return func(t *Trie) {
+		t.hexKeys = true
+	}
+}
+
+// keyNibbles returns the trie path of a cluster key
+func (t *Trie) keyNibbles(key []byte) ([]byte, error) {
+	if !t.hexKeys {
+		return keyToNibbles(key), nil
+	}
+	return hexPrefixToNibbles(key)
+}
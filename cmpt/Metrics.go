@@ -0,0 +1,105 @@
+package cmpt
+
+import (
+	"errors"
+	"math"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// ClusterQuality scores a clustering so competing strategies can be compared
+type ClusterQuality struct {
+	Clusters        int     // Number of non-empty clusters
+	SizeEntropy     float64 // Shannon entropy (bits) of the member count distribution
+	ByteGini        float64 // Gini coefficient of bytes per cluster (0 = equal, 1 = one cluster holds all)
+	ExpectedTouched float64 // Expected clusters touched by a random k-tx request
+}
+
+// SizeEntropy returns the Shannon entropy in bits of the distribution of
+// transactions over clusters. Higher values mean more evenly sized clusters;
+// the maximum is log2 of the cluster count.
+func SizeEntropy(clusters map[string][]*types.Transaction) float64 {
+	total := 0
+	for _, members := range clusters {
+		total += len(members)
+	}
+	entropy := 0.0
+	for _, members := range clusters {
+		if len(members) == 0 {
+			continue
+		}
+		p := float64(len(members)) / float64(total)
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+// ByteGini returns the Gini coefficient of the encoded bytes per cluster
+func ByteGini(clusters map[string][]*types.Transaction) float64 {
+	sizes := make([]float64, 0, len(clusters))
+	total := 0.0
+	for _, members := range clusters {
+		size := 0.0
+		for _, tx := range members {
+			size += float64(tx.Size())
+		}
+		sizes = append(sizes, size)
+		total += size
+	}
+	if len(sizes) == 0 || total == 0 {
+		return 0
+	}
+	// G = sum_i (2i - n - 1) x_i / (n * sum x) over ascending x
+	sort.Float64s(sizes)
+	n := float64(len(sizes))
+	weighted := 0.0
+	for i, size := range sizes {
+		weighted += (2*float64(i+1) - n - 1) * size
+	}
+	return weighted / (n * total)
+}
+
+// ExpectedClustersTouched returns the expected number of distinct clusters
+// holding a request of k transactions drawn uniformly without replacement.
+// A cluster with n of N transactions is missed with probability C(N-n,k)/C(N,k).
+func ExpectedClustersTouched(clusters map[string][]*types.Transaction, k int) (float64, error) {
+	total := 0
+	for _, members := range clusters {
+		total += len(members)
+	}
+	if k < 0 || k > total {
+		return 0, errors.New("request size out of range")
+	}
+	expected := 0.0
+	for _, members := range clusters {
+		if len(members) == 0 {
+			continue
+		}
+		missed := 1.0
+		for j := 0; j < k && missed > 0; j++ {
+			missed *= float64(total-len(members)-j) / float64(total-j)
+		}
+		expected += 1 - missed
+	}
+	return expected, nil
+}
+
+// ScoreClustering computes all quality metrics of a clustering for k-tx requests
+func ScoreClustering(clusters map[string][]*types.Transaction, k int) (ClusterQuality, error) {
+	touched, err := ExpectedClustersTouched(clusters, k)
+	if err != nil {
+		return ClusterQuality{}, err
+	}
+	quality := ClusterQuality{
+		SizeEntropy:     SizeEntropy(clusters),
+		ByteGini:        ByteGini(clusters),
+		ExpectedTouched: touched,
+	}
+	for _, members := range clusters {
+		if len(members) > 0 {
+			quality.Clusters++
+		}
+	}
+	return quality, nil
+}
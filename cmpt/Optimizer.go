@@ -0,0 +1,209 @@
+package cmpt
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// OptimizerConfig bounds the cluster layouts considered by OptimizeClusters
+type OptimizerConfig struct {
+	MaxProofBytes int // Largest allowed single-cluster proof (body plus sibling hashes)
+	MaxPrefixLen  int // Longest cluster prefix in bytes
+
+	// ClusterCost is the bandwidth charged per cluster, in bytes per request,
+	// e.g. the cluster inventory a client syncs amortized over its requests.
+	// Without it every subtree would be split down to MaxPrefixLen.
+	ClusterCost float64
+}
+
+// ClusterPlan is a prefix-free set of variable-length cluster prefixes chosen by
+// OptimizeClusters. It implements ClusterStrategy on top of the full-key strategy
+// it was optimized for.
+type ClusterPlan struct {
+	Base          ClusterStrategy // Strategy producing the full (longest) keys
+	Prefixes      [][]byte        // Chosen cluster prefixes
+	ExpectedBytes float64         // Expected proof bytes of one request under the access distribution
+	MaxProofBytes int             // Largest proof of any chosen cluster
+
+	maxLen   int
+	clusters map[string]struct{} // Chosen prefixes
+	splits   map[string]struct{} // Prefixes that were split further
+}
+
+// planNode is a candidate cluster during optimization
+type planNode struct {
+	prefix   []byte
+	keys     [][]byte  // Full keys of the transactions below prefix
+	sizes    []int     // Encoded sizes of those transactions
+	weights  []float64 // Access probabilities of those transactions
+	bytes    int       // Total encoded size
+	weight   float64   // Total access probability
+	prefixes [][]byte  // Chosen cluster prefixes below this node
+	splits   [][]byte  // Split prefixes below this node, including itself
+	maxProof int       // Largest proof of the chosen clusters
+}
+
+// OptimizeClusters chooses a prefix length per subtree that minimizes the
+// expected verification bandwidth of a single-transaction request, where each
+// transaction is requested with probability proportional to weights (uniform
+// when nil). The bandwidth of a request is the body of the transaction's cluster
+// plus the sibling hashes on its path, and every cluster adds cfg.ClusterCost.
+// Hot subtrees are therefore split into longer prefixes while cold ones stay
+// coarse, and every chosen cluster must respect cfg.MaxProofBytes.
+func OptimizeClusters(txs []*types.Transaction, base ClusterStrategy, weights map[common.Hash]float64, cfg OptimizerConfig) (*ClusterPlan, error) {
+	if len(txs) == 0 {
+		return nil, errors.New("no transactions to cluster")
+	}
+	if cfg.MaxPrefixLen <= 0 {
+		return nil, errors.New("maximum prefix length must be positive")
+	}
+
+	root := &planNode{}
+	for _, tx := range txs {
+		key, err := base.ClusterKey(tx)
+		if err != nil {
+			return nil, err
+		}
+		weight := 1.0 / float64(len(txs))
+		if weights != nil {
+			weight = weights[tx.Hash()]
+		}
+		size := int(tx.Size())
+		root.keys = append(root.keys, key)
+		root.sizes = append(root.sizes, size)
+		root.weights = append(root.weights, weight)
+		root.bytes += size
+		root.weight += weight
+	}
+	if root.weight <= 0 {
+		return nil, errors.New("access distribution has no weight")
+	}
+	// Normalize to probabilities so ClusterCost is comparable to proof bytes
+	for i := range root.weights {
+		root.weights[i] /= root.weight
+	}
+	root.weight = 1
+
+	// The root itself is never a cluster: keys must be non-empty
+	cost, ok := optimizeSplit(root, 0, cfg)
+	if !ok {
+		return nil, fmt.Errorf("no layout keeps every proof within %d bytes", cfg.MaxProofBytes)
+	}
+
+	plan := &ClusterPlan{
+		Base:          base,
+		Prefixes:      root.prefixes,
+		ExpectedBytes: cost - cfg.ClusterCost*float64(len(root.prefixes)),
+		MaxProofBytes: root.maxProof,
+		maxLen:        cfg.MaxPrefixLen,
+		clusters:      make(map[string]struct{}, len(root.prefixes)),
+		splits:        make(map[string]struct{}, len(root.splits)),
+	}
+	for _, prefix := range root.prefixes {
+		plan.clusters[string(prefix)] = struct{}{}
+	}
+	for _, prefix := range root.splits {
+		plan.splits[string(prefix)] = struct{}{}
+	}
+	return plan, nil
+}
+
+// optimizeNode picks the cheaper of keeping n as one cluster or splitting it.
+// pathHashes is the number of sibling hashes above n. It returns the weighted
+// proof bytes of n's subtree and whether a feasible layout exists.
+func optimizeNode(n *planNode, pathHashes int, cfg OptimizerConfig) (float64, bool) {
+	proof := n.bytes + pathHashes*common.HashLength
+	keepOK := proof <= cfg.MaxProofBytes
+	keepCost := n.weight*float64(proof) + cfg.ClusterCost
+
+	// Keys no longer than the prefix cannot be split any further
+	splittable := len(n.prefix) < cfg.MaxPrefixLen
+	for _, key := range n.keys {
+		if len(key) <= len(n.prefix) {
+			splittable = false
+			break
+		}
+	}
+	if splittable {
+		keep := *n
+		splitCost, splitOK := optimizeSplit(n, pathHashes, cfg)
+		if splitOK && (!keepOK || splitCost < keepCost) {
+			return splitCost, true
+		}
+		*n = keep
+	}
+	n.prefixes = [][]byte{n.prefix}
+	n.splits = nil
+	n.maxProof = proof
+	return keepCost, keepOK
+}
+
+// optimizeSplit partitions n by the next key byte and optimizes every part
+func optimizeSplit(n *planNode, pathHashes int, cfg OptimizerConfig) (float64, bool) {
+	depth := len(n.prefix)
+	var order []byte
+	children := make(map[byte]*planNode)
+	for i, key := range n.keys {
+		if len(key) <= depth {
+			return 0, false
+		}
+		child, ok := children[key[depth]]
+		if !ok {
+			child = &planNode{prefix: append(append([]byte{}, n.prefix...), key[depth])}
+			children[key[depth]] = child
+			order = append(order, key[depth])
+		}
+		child.keys = append(child.keys, key)
+		child.sizes = append(child.sizes, n.sizes[i])
+		child.weights = append(child.weights, n.weights[i])
+		child.bytes += n.sizes[i]
+		child.weight += n.weights[i]
+	}
+
+	// A byte spans two nibble levels: each child proof carries the hashes of
+	// the other high-nibble groups and of its siblings within its own group
+	groups := make(map[byte]int)
+	for b := range children {
+		groups[b>>4]++
+	}
+	total := 0.0
+	prefixes, splits, maxProof := [][]byte{}, [][]byte{n.prefix}, 0
+	for _, b := range order {
+		child := children[b]
+		childHashes := pathHashes + len(groups) - 1 + groups[b>>4] - 1
+		cost, ok := optimizeNode(child, childHashes, cfg)
+		if !ok {
+			return 0, false
+		}
+		total += cost
+		prefixes = append(prefixes, child.prefixes...)
+		splits = append(splits, child.splits...)
+		if child.maxProof > maxProof {
+			maxProof = child.maxProof
+		}
+	}
+	n.prefixes, n.splits, n.maxProof = prefixes, splits, maxProof
+	return total, true
+}
+
+// ClusterKey maps a transaction to the plan prefix covering its full key. Keys
+// outside the optimized set fall into a new cluster directly below the deepest
+// split on their path, which keeps the plan prefix-free.
+func (p *ClusterPlan) ClusterKey(tx *types.Transaction) ([]byte, error) {
+	key, err := p.Base.ClusterKey(tx)
+	if err != nil {
+		return nil, err
+	}
+	for l := 1; l <= len(key) && l <= p.maxLen; l++ {
+		if _, ok := p.clusters[string(key[:l])]; ok {
+			return key[:l], nil
+		}
+		if _, ok := p.splits[string(key[:l])]; !ok {
+			return key[:l], nil
+		}
+	}
+	return nil, fmt.Errorf("key %x is too short for the cluster plan", key)
+}
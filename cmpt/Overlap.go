@@ -0,0 +1,132 @@
+package cmpt
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// clusterIndex records which clusters hold each transaction. A transaction may
+// be a member of several clusters (e.g. its sender's and its contract's
+// cluster); the number of clusters holding it is its reference count.
+type clusterIndex struct {
+	members map[string][]common.Hash            // Member tx hashes by cluster prefix
+	refs    map[common.Hash]map[string]struct{} // Cluster prefixes by member tx hash
+}
+
+// newClusterIndex creates an empty cluster index
+func newClusterIndex() clusterIndex {
+	return clusterIndex{
+		members: make(map[string][]common.Hash),
+		refs:    make(map[common.Hash]map[string]struct{}),
+	}
+}
+
+// set replaces the members of the cluster with the given prefix
+func (idx clusterIndex) set(prefix []byte, hashes []common.Hash) {
+	idx.remove(prefix)
+	key := string(prefix)
+	idx.members[key] = hashes
+	for _, h := range hashes {
+		if idx.refs[h] == nil {
+			idx.refs[h] = make(map[string]struct{})
+		}
+		idx.refs[h][key] = struct{}{}
+	}
+}
+
+// remove drops the cluster with the given prefix, releasing its member references
+func (idx clusterIndex) remove(prefix []byte) {
+	key := string(prefix)
+	for _, h := range idx.members[key] {
+		delete(idx.refs[h], key)
+		if len(idx.refs[h]) == 0 {
+			delete(idx.refs, h)
+		}
+	}
+	delete(idx.members, key)
+}
+
+// copy returns an independent copy of the index
+func (idx clusterIndex) copy() clusterIndex {
+	cp := newClusterIndex()
+	for key, hashes := range idx.members {
+		cp.set([]byte(key), hashes)
+	}
+	return cp
+}
+
+// RefCount returns the number of clusters holding the given transaction
+func (t *Trie) RefCount(txHash common.Hash) int {
+	return len(t.index.refs[txHash])
+}
+
+// ClustersOf returns the prefixes of all clusters holding the given transaction
+func (t *Trie) ClustersOf(txHash common.Hash) [][]byte {
+	var prefixes [][]byte
+	for key := range t.index.refs[txHash] {
+		prefixes = append(prefixes, []byte(key))
+	}
+	return prefixes
+}
+
+// CoverTransactions picks a set of clusters that together hold all requested
+// transactions. With overlapping clusters several covers exist; the greedy
+// weighted set cover used here repeatedly takes the cluster with the lowest
+// body size per newly covered transaction.
+func (t *Trie) CoverTransactions(txHashes []common.Hash) ([][]byte, error) {
+	uncovered := make(map[common.Hash]struct{}, len(txHashes))
+	candidates := make(map[string]int)
+	for _, h := range txHashes {
+		if len(t.index.refs[h]) == 0 {
+			return nil, fmt.Errorf("transaction %s is not a member of any cluster", h.Hex())
+		}
+		uncovered[h] = struct{}{}
+		for key := range t.index.refs[h] {
+			if _, ok := candidates[key]; !ok {
+				leaf := t.findLeaf(t.Root, []byte(key))
+				if leaf == nil {
+					return nil, fmt.Errorf("cluster %x not found", key)
+				}
+				candidates[key] = leaf.Size
+			}
+		}
+	}
+
+	var cover [][]byte
+	for len(uncovered) > 0 {
+		bestKey, bestGain, bestSize := "", 0, 0
+		for key, size := range candidates {
+			gain := 0
+			for _, h := range t.index.members[key] {
+				if _, ok := uncovered[h]; ok {
+					gain++
+				}
+			}
+			// Compare size/gain ratios without division; ties go to the smaller prefix
+			if gain == 0 {
+				continue
+			}
+			if bestGain == 0 || size*bestGain < bestSize*gain ||
+				(size*bestGain == bestSize*gain && key < bestKey) {
+				bestKey, bestGain, bestSize = key, gain, size
+			}
+		}
+		for _, h := range t.index.members[bestKey] {
+			delete(uncovered, h)
+		}
+		delete(candidates, bestKey)
+		cover = append(cover, []byte(bestKey))
+	}
+	return cover, nil
+}
+
+// ProveTransactions builds a multiproof for the cheapest set of clusters found
+// by CoverTransactions that holds every requested transaction
+func (t *Trie) ProveTransactions(txHashes []common.Hash) (*MultiProof, error) {
+	prefixes, err := t.CoverTransactions(txHashes)
+	if err != nil {
+		return nil, err
+	}
+	return t.Prove(prefixes)
+}
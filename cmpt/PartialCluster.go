@@ -0,0 +1,208 @@
+package cmpt
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// PartialClusterProof proves a subset of one cluster's transactions. Instead of
+// the whole cluster body it carries the requested transactions plus the
+// intra-cluster hashes needed to rebuild the cluster's member root.
+type PartialClusterProof struct {
+	Prefix   []byte        // Cluster prefix
+	Indices  []uint64      // Positions of the requested members, ascending
+	Members  [][]byte      // Binary encodings of the requested members
+	Siblings []common.Hash // Member tree hashes, in verification order
+	Trie     *MultiProof   // Proof of the cluster leaf commitment
+}
+
+// SizeBytes returns the number of bytes of transactions and hashes carried by the proof
+func (p *PartialClusterProof) SizeBytes() int {
+	size := len(p.Siblings) * common.HashLength
+	for _, member := range p.Members {
+		size += len(member)
+	}
+	for _, node := range p.Trie.Nodes {
+		if node.Kind == ProofHash {
+			size += common.HashLength
+		}
+	}
+	return size
+}
+
+// ProvePartialCluster builds a proof for the given member transactions of one cluster
+func (t *Trie) ProvePartialCluster(prefix []byte, txHashes []common.Hash) (*PartialClusterProof, error) {
+	if len(txHashes) == 0 {
+		return nil, errors.New("no transactions requested")
+	}
+	leaf := t.findLeaf(t.Root, prefix)
+	if leaf == nil {
+		return nil, fmt.Errorf("cluster %x not found", prefix)
+	}
+	value, err := t.loadValue(leaf)
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := splitClusterValue(value)
+	if err != nil {
+		return nil, err
+	}
+
+	// Locate the requested members inside the cluster
+	hashes := make([]common.Hash, len(encoded))
+	positions := make(map[common.Hash]uint64, len(encoded))
+	for i, txData := range encoded {
+		hashes[i] = crypto.Keccak256Hash(txData)
+		positions[hashes[i]] = uint64(i)
+	}
+	requested := make(map[uint64]struct{}, len(txHashes))
+	for _, h := range txHashes {
+		index, ok := positions[h]
+		if !ok {
+			return nil, fmt.Errorf("transaction %s is not a member of cluster %x", h.Hex(), prefix)
+		}
+		requested[index] = struct{}{}
+	}
+	indices := make([]uint64, 0, len(requested))
+	for index := range requested {
+		indices = append(indices, index)
+	}
+	sort.Slice(indices, func(i, j int) bool { return indices[i] < indices[j] })
+
+	trieProof, err := t.proveClusters([][]byte{prefix}, false)
+	if err != nil {
+		return nil, err
+	}
+	proof := &PartialClusterProof{
+		Prefix:   prefix,
+		Indices:  indices,
+		Siblings: memberSiblings(t.hasher, hashes, indices),
+		Trie:     trieProof,
+	}
+	for _, index := range indices {
+		proof.Members = append(proof.Members, encoded[index])
+	}
+	return proof, nil
+}
+
+// VerifyPartialCluster checks the requested members of a partial cluster proof
+// against the trie root, using the optional hasher the trie was built with
+func VerifyPartialCluster(root common.Hash, proof *PartialClusterProof, hasher ...Hasher) error {
+	return verifyPartialCluster(pickHasher(hasher), plainKeyNibbles, root, proof)
+}
+
+// VerifyHexPrefixPartialCluster verifies a partial cluster proof of a trie
+// created with WithHexPrefixKeys, see VerifyPartialCluster
+func VerifyHexPrefixPartialCluster(root common.Hash, proof *PartialClusterProof, hasher ...Hasher) error {
+	return verifyPartialCluster(pickHasher(hasher), hexPrefixToNibbles, root, proof)
+}
+
+// verifyPartialCluster checks a partial cluster proof with the given key encoding
+func verifyPartialCluster(hash Hasher, keyNibbles func([]byte) ([]byte, error), root common.Hash, proof *PartialClusterProof) error {
+	if len(proof.Indices) == 0 || len(proof.Indices) != len(proof.Members) {
+		return errors.New("malformed partial cluster proof")
+	}
+	leaves, err := verifyMultiProof(hash, keyNibbles, root, proof.Trie)
+	if err != nil {
+		return err
+	}
+	leaf, ok := leaves[string(proof.Prefix)]
+	if !ok {
+		return fmt.Errorf("cluster %x missing from proof", proof.Prefix)
+	}
+
+	known := make(map[uint64]common.Hash, len(proof.Indices))
+	for i, index := range proof.Indices {
+		if index >= leaf.MemberCount || (i > 0 && index <= proof.Indices[i-1]) {
+			return fmt.Errorf("invalid member index %d", index)
+		}
+		known[index] = crypto.Keccak256Hash(proof.Members[i])
+	}
+	memberRoot, err := rebuildMemberRoot(hash, leaf.MemberCount, known, proof.Siblings)
+	if err != nil {
+		return err
+	}
+	if memberRoot != leaf.MemberRoot {
+		return errors.New("cluster member root mismatch")
+	}
+	return nil
+}
+
+// memberSiblings collects the member tree hashes needed to rebuild the member
+// root from the members at the given ascending indices
+func memberSiblings(hash Hasher, hashes []common.Hash, indices []uint64) []common.Hash {
+	var siblings []common.Hash
+	level := hashes
+	known := indices
+	for len(level) > 1 {
+		var next []common.Hash
+		for i := 0; i < len(level); i += 2 {
+			right := level[i]
+			if i+1 < len(level) {
+				right = level[i+1]
+			}
+			next = append(next, hash(level[i].Bytes(), right.Bytes()))
+		}
+		var parents []uint64
+		for k := 0; k < len(known); k++ {
+			index := known[k]
+			sibling := index ^ 1
+			switch {
+			case k+1 < len(known) && known[k+1] == sibling:
+				k++ // Both children are known
+			case sibling < uint64(len(level)):
+				siblings = append(siblings, level[sibling])
+			}
+			parents = append(parents, index/2)
+		}
+		level, known = next, parents
+	}
+	return siblings
+}
+
+// rebuildMemberRoot recomputes the member root of a cluster with count members
+// from the known member hashes and the siblings produced by memberSiblings
+func rebuildMemberRoot(hash Hasher, count uint64, known map[uint64]common.Hash, siblings []common.Hash) (common.Hash, error) {
+	width := count
+	for width > 1 {
+		indices := make([]uint64, 0, len(known))
+		for index := range known {
+			indices = append(indices, index)
+		}
+		sort.Slice(indices, func(i, j int) bool { return indices[i] < indices[j] })
+
+		parents := make(map[uint64]common.Hash, len(indices))
+		for k := 0; k < len(indices); k++ {
+			index := indices[k]
+			sibling := index ^ 1
+			var siblingHash common.Hash
+			switch {
+			case k+1 < len(indices) && indices[k+1] == sibling:
+				siblingHash = known[sibling]
+				k++
+			case sibling >= width:
+				siblingHash = known[index] // Odd level: the last node is paired with itself
+			default:
+				if len(siblings) == 0 {
+					return common.Hash{}, errors.New("not enough member siblings")
+				}
+				siblingHash, siblings = siblings[0], siblings[1:]
+			}
+			if index%2 == 0 {
+				parents[index/2] = hash(known[index].Bytes(), siblingHash.Bytes())
+			} else {
+				parents[index/2] = hash(siblingHash.Bytes(), known[index].Bytes())
+			}
+		}
+		known = parents
+		width = (width + 1) / 2
+	}
+	if len(siblings) != 0 {
+		return common.Hash{}, errors.New("unused member siblings")
+	}
+	return known[0], nil
+}
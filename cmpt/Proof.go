@@ -0,0 +1,248 @@
+package cmpt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Kinds of nodes that can appear in a multiproof
+const (
+	ProofHash       byte = iota // Pruned subtree, represented only by its hash
+	ProofLeaf                   // Requested cluster leaf, including its value
+	ProofShort                  // Short node on the path to a requested leaf
+	ProofFull                   // Full node on the path to a requested leaf
+	ProofCommitment             // Requested cluster leaf, commitment only (no value)
+)
+
+// ProofNode is a single node of a multiproof. Nodes are listed in pre-order.
+type ProofNode struct {
+	Kind  byte
+	Key   []byte      // Short node key nibbles, or cluster prefix of a leaf
+	Pre   []byte      // Leaf prefix nibbles covered by the leaf hash
+	Mask  uint32      // Present children of a full node (bit i = child i)
+	Hash  common.Hash // Hash of a pruned subtree
+	Value []byte      // Cluster value of a requested leaf
+	ClusterCommitment
+}
+
+// MultiProof proves the values of a set of clusters against a trie root
+type MultiProof struct {
+	Prefixes [][]byte    // Requested cluster prefixes
+	Nodes    []ProofNode // Pruned trie in pre-order
+}
+
+// HashCount returns the number of pruned subtree hashes carried by the proof
+func (p *MultiProof) HashCount() int {
+	count := 0
+	for _, node := range p.Nodes {
+		if node.Kind == ProofHash {
+			count++
+		}
+	}
+	return count
+}
+
+// Prove builds a multiproof for the clusters with the given prefixes. Cluster
+// values held in a cluster store are loaded only for the requested leaves.
+// The trie must have been hashed with ComputeHash beforehand.
+func (t *Trie) Prove(prefixes [][]byte) (*MultiProof, error) {
+	return t.proveClusters(prefixes, true)
+}
+
+// proveClusters builds a multiproof, carrying the requested cluster values only if withValues is set
+func (t *Trie) proveClusters(prefixes [][]byte, withValues bool) (*MultiProof, error) {
+	if t.Root == nil {
+		return nil, errors.New("empty trie")
+	}
+	targets := make(map[string]struct{}, len(prefixes))
+	for _, prefix := range prefixes {
+		targets[string(prefix)] = struct{}{}
+	}
+
+	proof := &MultiProof{Prefixes: prefixes}
+	found, err := t.prove(t.Root, targets, withValues, proof)
+	if err != nil {
+		return nil, err
+	}
+	if found != len(targets) {
+		return nil, fmt.Errorf("only %d of %d requested clusters exist", found, len(targets))
+	}
+	return proof, nil
+}
+
+// prove appends the pruned subtree rooted at node and returns the number of targets it contains
+func (t *Trie) prove(node TrieNode, targets map[string]struct{}, withValues bool, proof *MultiProof) (int, error) {
+	start := len(proof.Nodes)
+	found := 0
+
+	switch n := node.(type) {
+	case *HashNode:
+		if _, ok := targets[string(n.Key)]; ok {
+			if !withValues {
+				proof.Nodes = append(proof.Nodes, ProofNode{
+					Kind:              ProofCommitment,
+					Key:               n.Key,
+					Pre:               n.Pre,
+					ClusterCommitment: n.ClusterCommitment,
+				})
+				return 1, nil
+			}
+			value, err := t.loadValue(n)
+			if err != nil {
+				return 0, err
+			}
+			proof.Nodes = append(proof.Nodes, ProofNode{
+				Kind:              ProofLeaf,
+				Key:               n.Key,
+				Pre:               n.Pre,
+				Value:             value,
+				ClusterCommitment: n.ClusterCommitment,
+			})
+			return 1, nil
+		}
+	case *ShortNode:
+		proof.Nodes = append(proof.Nodes, ProofNode{Kind: ProofShort, Key: n.Key})
+		count, err := t.prove(n.Val, targets, withValues, proof)
+		if err != nil {
+			return 0, err
+		}
+		found += count
+	case *FullNode:
+		proof.Nodes = append(proof.Nodes, ProofNode{Kind: ProofFull})
+		for i, child := range n.Children {
+			if child == nil {
+				continue
+			}
+			proof.Nodes[start].Mask |= 1 << i
+			count, err := t.prove(child, targets, withValues, proof)
+			if err != nil {
+				return 0, err
+			}
+			found += count
+		}
+	}
+
+	// Subtrees without any target collapse into their hash
+	if found == 0 {
+		proof.Nodes = append(proof.Nodes[:start], ProofNode{Kind: ProofHash, Hash: node.GetHash()})
+	}
+	return found, nil
+}
+
+// VerifyMultiProof recomputes the root from a multiproof, checks it against the
+// expected root and checks that every requested cluster is present. An optional
+// hasher must be given when the trie does not use the default Keccak256.
+func VerifyMultiProof(root common.Hash, proof *MultiProof, hasher ...Hasher) error {
+	_, err := verifyMultiProof(pickHasher(hasher), plainKeyNibbles, root, proof)
+	return err
+}
+
+// VerifyHexPrefixMultiProof verifies a multiproof of a trie created with
+// WithHexPrefixKeys, see VerifyMultiProof
+func VerifyHexPrefixMultiProof(root common.Hash, proof *MultiProof, hasher ...Hasher) error {
+	_, err := verifyMultiProof(pickHasher(hasher), hexPrefixToNibbles, root, proof)
+	return err
+}
+
+// plainKeyNibbles decodes a raw cluster key into its trie path
+func plainKeyNibbles(key []byte) ([]byte, error) { return keyToNibbles(key), nil }
+
+// proofVerifier recomputes the hashes of a multiproof and collects its leaves
+type proofVerifier struct {
+	hasher     Hasher
+	keyNibbles func(key []byte) ([]byte, error) // Trie path of a cluster key
+	leaves     map[string]ProofNode
+}
+
+// verifyMultiProof verifies a multiproof and returns the proven leaves by cluster prefix
+func verifyMultiProof(hasher Hasher, keyNibbles func([]byte) ([]byte, error), root common.Hash, proof *MultiProof) (map[string]ProofNode, error) {
+	v := &proofVerifier{hasher: hasher, keyNibbles: keyNibbles, leaves: make(map[string]ProofNode)}
+	hash, rest, err := v.verifyNode(proof.Nodes, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("%d trailing proof nodes", len(rest))
+	}
+	if hash != root {
+		return nil, fmt.Errorf("root mismatch: have %s, want %s", hash.Hex(), root.Hex())
+	}
+	for _, prefix := range proof.Prefixes {
+		if _, ok := v.leaves[string(prefix)]; !ok {
+			return nil, fmt.Errorf("cluster %x missing from proof", prefix)
+		}
+	}
+	return v.leaves, nil
+}
+
+// verifyNode hashes the first subtree of nodes and returns the unconsumed
+// remainder. path holds the nibbles leading to the subtree.
+func (v *proofVerifier) verifyNode(nodes []ProofNode, path []byte) (common.Hash, []ProofNode, error) {
+	if len(nodes) == 0 {
+		return common.Hash{}, nil, errors.New("truncated proof")
+	}
+	node, rest := nodes[0], nodes[1:]
+
+	switch node.Kind {
+	case ProofHash:
+		return node.Hash, rest, nil
+	case ProofLeaf:
+		if v.hasher(node.Value) != node.ValueHash {
+			return common.Hash{}, nil, fmt.Errorf("cluster %x value does not match its hash", node.Key)
+		}
+		// Leaves built from transactions also commit to their member list
+		if node.MemberCount != 0 {
+			if err := node.ClusterCommitment.Verify(node.Value, v.hasher); err != nil {
+				return common.Hash{}, nil, fmt.Errorf("cluster %x: %w", node.Key, err)
+			}
+		}
+		return v.verifyLeaf(node, path, rest)
+	case ProofCommitment:
+		return v.verifyLeaf(node, path, rest)
+	case ProofShort:
+		childHash, rest, err := v.verifyNode(rest, concat(path, node.Key))
+		if err != nil {
+			return common.Hash{}, nil, err
+		}
+		return v.hasher(node.Key, childHash.Bytes()), rest, nil
+	case ProofFull:
+		var data []byte
+		for i := 0; i < 17; i++ {
+			if node.Mask&(1<<i) == 0 {
+				continue
+			}
+			childPath := path
+			if i < 16 {
+				childPath = concat(path, []byte{byte(i)})
+			}
+			var childHash common.Hash
+			var err error
+			childHash, rest, err = v.verifyNode(rest, childPath)
+			if err != nil {
+				return common.Hash{}, nil, err
+			}
+			data = append(data, byte(i))
+			data = append(data, childHash.Bytes()...)
+		}
+		return v.hasher(data), rest, nil
+	default:
+		return common.Hash{}, nil, fmt.Errorf("invalid proof node kind %d", node.Kind)
+	}
+}
+
+// verifyLeaf records a proven leaf after checking that its cluster key decodes
+// to the trie path the leaf sits on, so a leaf cannot be relabelled
+func (v *proofVerifier) verifyLeaf(node ProofNode, path []byte, rest []ProofNode) (common.Hash, []ProofNode, error) {
+	want, err := v.keyNibbles(node.Key)
+	if err != nil {
+		return common.Hash{}, nil, fmt.Errorf("cluster %x: %w", node.Key, err)
+	}
+	if !bytes.Equal(concat(path, node.Pre), want) {
+		return common.Hash{}, nil, fmt.Errorf("cluster %x does not match its trie path", node.Key)
+	}
+	v.leaves[string(node.Key)] = node
+	return hashLeaf(v.hasher, node.Pre, node.ClusterCommitment), rest, nil
+}
@@ -0,0 +1,218 @@
+package cmpt
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// proofEncodingVersion is the leading byte of an encoded multiproof
+const proofEncodingVersion byte = 1
+
+// errShortProof is returned when an encoded proof ends unexpectedly
+var errShortProof = errors.New("encoded proof is truncated")
+
+// MarshalBinary encodes the multiproof in a compact wire format:
+//
+//	version byte
+//	uvarint prefix count, then each prefix as uvarint length + bytes
+//	uvarint node count, then each node as a kind byte followed by
+//	  ProofHash:       32-byte hash
+//	  ProofShort:      packed key nibbles
+//	  ProofFull:       3-byte big-endian child mask
+//	  ProofLeaf:       key bytes, packed pre nibbles, commitment, value bytes
+//	  ProofCommitment: key bytes, packed pre nibbles, commitment
+//
+// Byte strings are length-prefixed with a uvarint, nibble strings with their
+// uvarint nibble count followed by two nibbles per byte, and a commitment is
+// the uvarint member count followed by the member root and value hash.
+func (p *MultiProof) MarshalBinary() ([]byte, error) {
+	out := []byte{proofEncodingVersion}
+	out = binary.AppendUvarint(out, uint64(len(p.Prefixes)))
+	for _, prefix := range p.Prefixes {
+		out = appendBytes(out, prefix)
+	}
+	out = binary.AppendUvarint(out, uint64(len(p.Nodes)))
+	for _, node := range p.Nodes {
+		out = append(out, node.Kind)
+		switch node.Kind {
+		case ProofHash:
+			out = append(out, node.Hash.Bytes()...)
+		case ProofShort:
+			var err error
+			if out, err = appendNibbles(out, node.Key); err != nil {
+				return nil, err
+			}
+		case ProofFull:
+			out = append(out, byte(node.Mask>>16), byte(node.Mask>>8), byte(node.Mask))
+		case ProofLeaf, ProofCommitment:
+			out = appendBytes(out, node.Key)
+			var err error
+			if out, err = appendNibbles(out, node.Pre); err != nil {
+				return nil, err
+			}
+			out = binary.AppendUvarint(out, node.MemberCount)
+			out = append(out, node.MemberRoot.Bytes()...)
+			out = append(out, node.ValueHash.Bytes()...)
+			if node.Kind == ProofLeaf {
+				out = appendBytes(out, node.Value)
+			}
+		default:
+			return nil, fmt.Errorf("invalid proof node kind %d", node.Kind)
+		}
+	}
+	return out, nil
+}
+
+// UnmarshalBinary decodes a multiproof produced by MarshalBinary
+func (p *MultiProof) UnmarshalBinary(data []byte) error {
+	if len(data) == 0 || data[0] != proofEncodingVersion {
+		return errors.New("unsupported proof encoding version")
+	}
+	r := &proofReader{data: data[1:]}
+
+	count := r.uvarint()
+	var prefixes [][]byte
+	for i := uint64(0); i < count && r.err == nil; i++ {
+		prefixes = append(prefixes, r.bytes())
+	}
+	count = r.uvarint()
+	var nodes []ProofNode
+	for i := uint64(0); i < count && r.err == nil; i++ {
+		node := ProofNode{Kind: r.byte()}
+		switch node.Kind {
+		case ProofHash:
+			node.Hash = r.hash()
+		case ProofShort:
+			node.Key = r.nibbles()
+		case ProofFull:
+			mask := r.take(3)
+			if mask != nil {
+				node.Mask = uint32(mask[0])<<16 | uint32(mask[1])<<8 | uint32(mask[2])
+			}
+		case ProofLeaf, ProofCommitment:
+			node.Key = r.bytes()
+			node.Pre = r.nibbles()
+			node.MemberCount = r.uvarint()
+			node.MemberRoot = r.hash()
+			node.ValueHash = r.hash()
+			if node.Kind == ProofLeaf {
+				node.Value = r.bytes()
+			}
+		default:
+			if r.err == nil {
+				r.err = fmt.Errorf("invalid proof node kind %d", node.Kind)
+			}
+		}
+		nodes = append(nodes, node)
+	}
+	if r.err != nil {
+		return r.err
+	}
+	if len(r.data) != 0 {
+		return fmt.Errorf("%d trailing bytes after proof", len(r.data))
+	}
+	p.Prefixes, p.Nodes = prefixes, nodes
+	return nil
+}
+
+// appendBytes appends a uvarint length-prefixed byte string
+func appendBytes(out, b []byte) []byte {
+	out = binary.AppendUvarint(out, uint64(len(b)))
+	return append(out, b...)
+}
+
+// appendNibbles appends a nibble count followed by the nibbles packed two per byte
+func appendNibbles(out, nibbles []byte) ([]byte, error) {
+	out = binary.AppendUvarint(out, uint64(len(nibbles)))
+	for i := 0; i < len(nibbles); i += 2 {
+		hi, lo := nibbles[i], byte(0)
+		if i+1 < len(nibbles) {
+			lo = nibbles[i+1]
+		}
+		if hi > 0x0f || lo > 0x0f {
+			return nil, errors.New("invalid nibble in proof key")
+		}
+		out = append(out, hi<<4|lo)
+	}
+	return out, nil
+}
+
+// proofReader consumes an encoded proof, remembering the first error
+type proofReader struct {
+	data []byte
+	err  error
+}
+
+// take consumes n bytes, or returns nil once the input is exhausted
+func (r *proofReader) take(n uint64) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if uint64(len(r.data)) < n {
+		r.err = errShortProof
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+// byte consumes a single byte
+func (r *proofReader) byte() byte {
+	if b := r.take(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+// uvarint consumes a uvarint
+func (r *proofReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		r.err = errShortProof
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+// hash consumes a 32-byte hash
+func (r *proofReader) hash() common.Hash {
+	return common.BytesToHash(r.take(common.HashLength))
+}
+
+// bytes consumes a length-prefixed byte string
+func (r *proofReader) bytes() []byte {
+	b := r.take(r.uvarint())
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
+
+// nibbles consumes a packed nibble string
+func (r *proofReader) nibbles() []byte {
+	count := r.uvarint()
+	if r.err == nil && count > 2*uint64(len(r.data)) {
+		r.err = errShortProof // Also keeps (count+1)/2 from overflowing
+	}
+	packed := r.take((count + 1) / 2)
+	if packed == nil {
+		return nil
+	}
+	nibbles := make([]byte, count)
+	for i := range nibbles {
+		if i%2 == 0 {
+			nibbles[i] = packed[i/2] >> 4
+		} else {
+			nibbles[i] = packed[i/2] & 0x0f
+		}
+	}
+	return nibbles
+}
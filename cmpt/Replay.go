@@ -0,0 +1,91 @@
+package cmpt
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Replayer pushes decoded chain blocks through a ClusterStrategy. Senders are
+// recovered with each block's own signer and cached by transaction hash, so
+// sender-based strategies never repeat signature recovery.
+type Replayer struct {
+	Config    *params.ChainConfig // Chain configuration selecting the signer per block
+	Strategy  ClusterStrategy     // Strategy applied to every transaction
+	Recovered int                 // Signature recoveries performed
+	CacheHits int                 // Sender lookups served from the cache
+
+	senders map[common.Hash]common.Address
+}
+
+// NewReplayer creates a replayer for the given chain. A nil strategy defaults to
+// clustering by the first four bytes of the cached sender.
+func NewReplayer(config *params.ChainConfig, strategy ClusterStrategy) *Replayer {
+	r := &Replayer{
+		Config:  config,
+		senders: make(map[common.Hash]common.Address),
+	}
+	if strategy == nil {
+		strategy = r.SenderStrategy(4)
+	}
+	r.Strategy = strategy
+	return r
+}
+
+// ClusterBlocks recovers the senders of all block transactions and groups the
+// transactions into the clusters map expected by BuildCMPTTree
+func (r *Replayer) ClusterBlocks(blocks []*types.Block) (map[string][]*types.Transaction, error) {
+	clusters := make(map[string][]*types.Transaction)
+	for _, block := range blocks {
+		signer := types.MakeSigner(r.Config, block.Number(), block.Time())
+		for _, tx := range block.Transactions() {
+			if _, err := r.recover(signer, tx); err != nil {
+				return nil, fmt.Errorf("block %d: %w", block.NumberU64(), err)
+			}
+			key, err := r.Strategy.ClusterKey(tx)
+			if err != nil {
+				return nil, fmt.Errorf("block %d: %w", block.NumberU64(), err)
+			}
+			clusters[string(key)] = append(clusters[string(key)], tx)
+		}
+	}
+	return clusters, nil
+}
+
+// Sender returns the cached sender of a transaction, recovering it with the
+// latest signer of the chain if it was not seen in a replayed block
+func (r *Replayer) Sender(tx *types.Transaction) (common.Address, error) {
+	return r.recover(types.LatestSigner(r.Config), tx)
+}
+
+// recover returns the sender of tx, consulting the cache first
+func (r *Replayer) recover(signer types.Signer, tx *types.Transaction) (common.Address, error) {
+	if from, ok := r.senders[tx.Hash()]; ok {
+		r.CacheHits++
+		return from, nil
+	}
+	from, err := types.Sender(signer, tx)
+	if err != nil {
+		return common.Address{}, err
+	}
+	r.Recovered++
+	r.senders[tx.Hash()] = from
+	return from, nil
+}
+
+// SenderStrategy clusters by the first length bytes of the cached sender
+func (r *Replayer) SenderStrategy(length int) ClusterStrategy {
+	return ClusterStrategyFunc(func(tx *types.Transaction) ([]byte, error) {
+		if length <= 0 || length > common.AddressLength {
+			return nil, errors.New("sender prefix length must be between 1 and 20")
+		}
+		from, err := r.Sender(tx)
+		if err != nil {
+			return nil, err
+		}
+		return from.Bytes()[:length], nil
+	})
+}
@@ -2,10 +2,16 @@ package cmpt
 
 import (
 	_ "bytes"
+	"encoding/binary"
+	"fmt"
 	"github.com/ethereum/go-ethereum/crypto"
+	"math"
 	"math/big"
 	_ "math/big"
 	"math/rand"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 	_ "time"
@@ -13,6 +19,7 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	_ "github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
 	"github.com/ethereum/go-ethereum/params"
 )
 
@@ -78,9 +85,12 @@ func TestCalculateRequiredHashes_Clustered(t *testing.T) {
 	// Build the clustered MPT
 	t.Log("Building clustered MPT using BuildCMPTTree...")
 	trie := NewTrie()
-	builtTrie, duration := BuildCMPTTree(trie, clusters)
+	builtTrie, result := BuildCMPTTree(trie, clusters)
+	if err := result.Err(); err != nil {
+		t.Fatalf("Failed to build trie: %v", err)
+	}
 	trie = builtTrie // Use the constructed Trie
-	t.Logf("MPT built in %v with %d leaves (one for each cluster).", duration, len(clusters))
+	t.Logf("MPT built in %v (packing %v, hashing %v) with %d leaves (one for each cluster).", result.Duration, result.PackTime, result.HashTime, result.Inserted)
 	t.Logf("Tree root hash: %s", trie.Root.GetHash().Hex())
 
 	// Define test cases (based on number of clusters requested)
@@ -95,6 +105,7 @@ func TestCalculateRequiredHashes_Clustered(t *testing.T) {
 		{"Requesting txs from 8 cluster", 8},
 		{"Requesting txs from 16 cluster", 16},
 		{"Requesting txs from 32 cluster", 32},
+		{"Requesting txs from all clusters", clusterCount},
 	}
 
 	// Execute and assert
@@ -120,8 +131,8 @@ func TestCalculateRequiredHashes_Clustered(t *testing.T) {
 
 			var requestedKeys [][]byte
 			for prefixStr := range uniquePrefixes {
-				// Need to pass nibble-encoded keys
-				requestedKeys = append(requestedKeys, keyToNibbles([]byte(prefixStr)))
+				// Raw prefixes, exactly as used for insertion
+				requestedKeys = append(requestedKeys, []byte(prefixStr))
 			}
 
 			// Call the function and perform assertions
@@ -142,3 +153,1146 @@ func TestCalculateRequiredHashes_Clustered(t *testing.T) {
 		})
 	}
 }
+
+// newTestClusters generates txCount transactions spread randomly over clusterCount 8-byte prefixes
+func newTestClusters(t *testing.T, txCount, clusterCount int) ([][]byte, map[string][]*types.Transaction) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	prefixes := make([][]byte, clusterCount)
+	for i := range prefixes {
+		prefixes[i] = make([]byte, 8)
+		if _, err := rand.Read(prefixes[i]); err != nil {
+			t.Fatalf("Failed to generate random prefix: %v", err)
+		}
+	}
+	clusters := make(map[string][]*types.Transaction)
+	for i := 0; i < txCount; i++ {
+		prefixStr := string(prefixes[rand.Intn(clusterCount)])
+		clusters[prefixStr] = append(clusters[prefixStr], newTestTx(signer, uint64(i), 100))
+	}
+	return prefixes, clusters
+}
+
+// TestConcurrentTrie_ReadersDuringWrites runs required-hash readers while a writer keeps adding clusters
+func TestConcurrentTrie_ReadersDuringWrites(t *testing.T) {
+	const batchCount = 8
+	prefixes, clusters := newTestClusters(t, 2000, 256)
+
+	// Split the clusters into batches that the writer publishes one at a time
+	batches := make([]map[string][]*types.Transaction, batchCount)
+	for i := range batches {
+		batches[i] = make(map[string][]*types.Transaction)
+	}
+	i := 0
+	for prefixStr, txs := range clusters {
+		batches[i%batchCount][prefixStr] = txs
+		i++
+	}
+
+	ct := NewConcurrentTrie()
+	ct.AddClusters(batches[0])
+	first := ct.Snapshot()
+	firstRoot := first.Root.GetHash()
+	firstNeeds := first.CalculateRequiredHashes2([][]byte{prefixes[0]})
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				snap := ct.Snapshot()
+				if needs := snap.CalculateRequiredHashes2([][]byte{prefixes[0]}); needs >= len(clusters) {
+					t.Errorf("Error: Required hashes (%d) should be smaller than the cluster count (%d)", needs, len(clusters))
+					return
+				}
+			}
+		}()
+	}
+
+	for _, batch := range batches[1:] {
+		result := ct.AddClusters(batch)
+		t.Logf("Published %d clusters in %v, root %s", len(batch), result.Duration, ct.RootHash().Hex())
+	}
+	close(done)
+	wg.Wait()
+
+	// The first snapshot must be untouched by later writes
+	if first.Root.GetHash() != firstRoot {
+		t.Errorf("Error: Snapshot root changed from %s to %s after later writes", firstRoot.Hex(), first.Root.GetHash().Hex())
+	}
+	if needs := first.CalculateRequiredHashes2([][]byte{prefixes[0]}); needs != firstNeeds {
+		t.Errorf("Error: Snapshot required hashes changed from %d to %d after later writes", firstNeeds, needs)
+	}
+	if ct.RootHash() == firstRoot {
+		t.Errorf("Error: Expected the published root to change after adding more clusters")
+	}
+
+	// Requesting every cluster from the final snapshot needs no extra hashes
+	var allPrefixes [][]byte
+	for prefixStr := range clusters {
+		allPrefixes = append(allPrefixes, []byte(prefixStr))
+	}
+	if needs := ct.CalculateRequiredHashes2(allPrefixes); needs != 0 {
+		t.Errorf("Expected 0 required hashes when all clusters are requested, but got %d", needs)
+	}
+}
+
+// TestClusterStore_LazyProof checks that a store-backed trie commits to the same root and serves proofs from the store
+func TestClusterStore_LazyProof(t *testing.T) {
+	_, generated := newTestClusters(t, 1000, 16)
+
+	// Re-key the clusters so every prefix starts with a distinct nibble
+	var prefixes [][]byte
+	clusters := make(map[string][]*types.Transaction)
+	for prefixStr, txs := range generated {
+		prefix := []byte(prefixStr)
+		prefix[0] = byte(len(prefixes)<<4) | prefix[0]&0x0F
+		prefixes = append(prefixes, prefix)
+		clusters[string(prefix)] = txs
+	}
+
+	// Pack clusters in a fixed order so both tries see identical insertions
+	memTrie := NewTrie()
+	db := memorydb.New()
+	storeTrie := NewTrie(WithStore(db))
+	for _, prefix := range prefixes {
+		var value []byte
+		for _, tx := range clusters[string(prefix)] {
+			txData, _ := tx.MarshalBinary()
+			value = append(value, txData...)
+		}
+		if err := memTrie.Insert(prefix, value); err != nil {
+			t.Fatalf("Failed to insert cluster: %v", err)
+		}
+		if err := storeTrie.Insert(prefix, value); err != nil {
+			t.Fatalf("Failed to insert cluster: %v", err)
+		}
+	}
+	memTrie.ComputeHash(memTrie.Root)
+	storeTrie.ComputeHash(storeTrie.Root)
+
+	if memTrie.Root.GetHash() != storeTrie.Root.GetHash() {
+		t.Fatalf("Error: Store-backed root %s differs from in-memory root %s", storeTrie.Root.GetHash().Hex(), memTrie.Root.GetHash().Hex())
+	}
+	if leaf := storeTrie.findLeaf(storeTrie.Root, prefixes[0]); leaf == nil || leaf.Value != nil {
+		t.Fatalf("Error: Expected store-backed leaf to hold no value in memory")
+	}
+	t.Logf("Cluster store holds %d values", db.Len())
+
+	// Generate a proof for a few clusters, loading their values lazily
+	requested := prefixes[:4]
+	proof, err := storeTrie.Prove(requested)
+	if err != nil {
+		t.Fatalf("Failed to generate proof: %v", err)
+	}
+	t.Logf("Proof for %d clusters carries %d nodes and %d hashes", len(requested), len(proof.Nodes), proof.HashCount())
+	if err := VerifyMultiProof(storeTrie.Root.GetHash(), proof); err != nil {
+		t.Errorf("Error: Valid proof rejected: %v", err)
+	}
+
+	// Tampering with a served cluster value must be detected
+	for i := range proof.Nodes {
+		if proof.Nodes[i].Kind == ProofLeaf {
+			proof.Nodes[i].Value = append([]byte{0}, proof.Nodes[i].Value...)
+			break
+		}
+	}
+	if err := VerifyMultiProof(storeTrie.Root.GetHash(), proof); err == nil {
+		t.Errorf("Error: Proof with a tampered cluster value was accepted")
+	}
+}
+
+// TestClusteredChain_IncrementalBlocks checks that block-by-block updates end at the same root as a one-shot build
+func TestClusteredChain_IncrementalBlocks(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	const blockCount = 5
+	const txsPerBlock = 200
+
+	// Cluster by the first byte of the recipient address
+	strategy := ClusterStrategyFunc(func(tx *types.Transaction) ([]byte, error) {
+		return tx.To().Bytes()[:1], nil
+	})
+	chain := NewClusteredChain(strategy)
+
+	var allTxs []*types.Transaction
+	for b := 0; b < blockCount; b++ {
+		var blockTxs []*types.Transaction
+		for i := 0; i < txsPerBlock; i++ {
+			blockTxs = append(blockTxs, newTestTx(signer, uint64(b*txsPerBlock+i), 100))
+		}
+		allTxs = append(allTxs, blockTxs...)
+
+		record, err := chain.AddBlock(blockTxs)
+		if err != nil {
+			t.Fatalf("Failed to add block %d: %v", b, err)
+		}
+		t.Logf("Block %d: root %s, %d new and %d updated clusters, witness %d bytes (delta %d), took %v",
+			record.Number, record.Root.Hex(), record.NewClusters, record.UpdatedClusters, record.WitnessBytes, record.WitnessDelta, record.Duration)
+		if record.NewClusters+record.UpdatedClusters == 0 {
+			t.Errorf("Error: Block %d touched no clusters", b)
+		}
+	}
+
+	// Rebuilding all clusters at once must give the same root
+	clusters, err := ClusterTransactions(allTxs, strategy)
+	if err != nil {
+		t.Fatalf("Failed to cluster transactions: %v", err)
+	}
+	if len(clusters) != chain.ClusterCount() {
+		t.Errorf("Error: Expected %d clusters, chain holds %d", len(clusters), chain.ClusterCount())
+	}
+	trie, _ := BuildCMPTTree(NewTrie(), clusters)
+	if root := chain.Blocks[blockCount-1].Root; root != trie.Root.GetHash() {
+		t.Errorf("Error: Incremental root %s differs from one-shot root %s", root.Hex(), trie.Root.GetHash().Hex())
+	}
+}
+
+// TestClusteredChain_FailedBlockLeavesChainUntouched checks that a block failing on one cluster changes neither the trie nor the store
+func TestClusteredChain_FailedBlockLeavesChainUntouched(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	// The first block fills clusters 0 and 1, the second touches all four and
+	// routes nonce 99 to a key that is no valid hex prefix
+	strategy := ClusterStrategyFunc(func(tx *types.Transaction) ([]byte, error) {
+		switch {
+		case tx.Nonce() == 99:
+			return []byte{0x20}, nil
+		case tx.Nonce() < 6:
+			return HexPrefix([]byte{byte(tx.Nonce() % 2)})
+		default:
+			return HexPrefix([]byte{byte(tx.Nonce() % 4)})
+		}
+	})
+	db := memorydb.New()
+	chain := NewClusteredChain(strategy, WithHexPrefixKeys(), WithStore(db))
+	var txs []*types.Transaction
+	for i := 0; i < 12; i++ {
+		txs = append(txs, newTestTx(signer, uint64(i), 100))
+	}
+	record, err := chain.AddBlock(txs[:6])
+	if err != nil {
+		t.Fatalf("Failed to add block: %v", err)
+	}
+	clusterCount := chain.ClusterCount()
+
+	// The valid clusters of the block may be written before the bad one fails
+	if _, err := chain.AddBlock(append(txs[6:], newTestTx(signer, 99, 100))); err == nil {
+		t.Fatalf("Error: Block with an invalid cluster key accepted")
+	}
+	if root, _ := chain.Trie.Rehash(); root != record.Root {
+		t.Errorf("Error: Failed block changed the root to %s", root.Hex())
+	}
+	if chain.ClusterCount() != clusterCount || len(chain.Blocks) != 1 {
+		t.Errorf("Error: Failed block changed the chain to %d clusters and %d blocks", chain.ClusterCount(), len(chain.Blocks))
+	}
+	for _, nibble := range []byte{0, 1, 2, 3} {
+		prefix, _ := HexPrefix([]byte{nibble})
+		members, err := chain.Trie.GetCluster(prefix)
+		if nibble > 1 && err == nil {
+			t.Errorf("Error: Cluster %x of the failed block is present", prefix)
+		}
+		if nibble <= 1 && (err != nil || len(members) != 3) {
+			t.Errorf("Error: Cluster %x holds %d members after the failed block: %v", prefix, len(members), err)
+		}
+		if has, _ := db.Has(clusterStoreKey(prefix)); has != (nibble <= 1) {
+			t.Errorf("Error: Store entry of cluster %x present: %v", prefix, has)
+		}
+	}
+}
+
+// TestClusterCommitment_DetectsIncompleteBody checks that truncated or reordered cluster bodies fail verification
+func TestClusterCommitment_DetectsIncompleteBody(t *testing.T) {
+	prefixes, clusters := newTestClusters(t, 500, 8)
+	trie, _ := BuildCMPTTree(NewTrie(), clusters)
+
+	members := clusters[string(prefixes[0])]
+	leaf := trie.findLeaf(trie.Root, prefixes[0])
+	if leaf == nil {
+		t.Fatalf("Cluster %x not found", prefixes[0])
+	}
+	if leaf.MemberCount != uint64(len(members)) {
+		t.Errorf("Error: Expected member count %d, got %d", len(members), leaf.MemberCount)
+	}
+
+	// The honest body verifies
+	body, err := EncodeClusterValue(members)
+	if err != nil {
+		t.Fatalf("Failed to encode cluster: %v", err)
+	}
+	if err := leaf.ClusterCommitment.Verify(body); err != nil {
+		t.Errorf("Error: Honest cluster body rejected: %v", err)
+	}
+
+	// A body missing its last member is rejected
+	truncated, _ := EncodeClusterValue(members[:len(members)-1])
+	if err := leaf.ClusterCommitment.Verify(truncated); err == nil {
+		t.Errorf("Error: Truncated cluster body was accepted")
+	}
+
+	// A body whose value hash matches but member list does not is rejected as well
+	forged := leaf.ClusterCommitment
+	forged.ValueHash = crypto.Keccak256Hash(truncated)
+	if err := forged.Verify(truncated); err == nil {
+		t.Errorf("Error: Cluster body with a wrong member count was accepted")
+	}
+}
+
+// TestPartialCluster_VerifySubset proves subsets of a cluster without sending the whole body
+func TestPartialCluster_VerifySubset(t *testing.T) {
+	prefixes, clusters := newTestClusters(t, 2000, 64)
+	trie, _ := BuildCMPTTree(NewTrie(), clusters)
+	root := trie.Root.GetHash()
+
+	members := clusters[string(prefixes[0])]
+	fullProof, err := trie.Prove([][]byte{prefixes[0]})
+	if err != nil {
+		t.Fatalf("Failed to prove full cluster: %v", err)
+	}
+	fullSize := fullProof.HashCount() * common.HashLength
+	for _, node := range fullProof.Nodes {
+		fullSize += len(node.Value)
+	}
+
+	// Request subsets of growing size (members are drawn with replacement)
+	for _, count := range []int{1, 2, 3, len(members) / 2, len(members)} {
+		var requested []common.Hash
+		for i := 0; i < count; i++ {
+			requested = append(requested, members[rand.Intn(len(members))].Hash())
+		}
+		proof, err := trie.ProvePartialCluster(prefixes[0], requested)
+		if err != nil {
+			t.Fatalf("Failed to prove %d members: %v", count, err)
+		}
+		if err := VerifyPartialCluster(root, proof); err != nil {
+			t.Errorf("Error: Valid partial proof for %d members rejected: %v", count, err)
+		}
+		t.Logf("Proving %d of %d members takes %d bytes, the full cluster takes %d bytes", len(proof.Indices), len(members), proof.SizeBytes(), fullSize)
+	}
+
+	// A substituted member must be rejected
+	proof, err := trie.ProvePartialCluster(prefixes[0], []common.Hash{members[0].Hash()})
+	if err != nil {
+		t.Fatalf("Failed to prove member: %v", err)
+	}
+	proof.Members[0], _ = clusters[string(prefixes[1])][0].MarshalBinary()
+	if err := VerifyPartialCluster(root, proof); err == nil {
+		t.Errorf("Error: Partial proof with a substituted member was accepted")
+	}
+
+	// A member proven against another cluster's prefix must be rejected
+	proof, err = trie.ProvePartialCluster(prefixes[0], []common.Hash{members[0].Hash()})
+	if err != nil {
+		t.Fatalf("Failed to prove member: %v", err)
+	}
+	proof.Prefix = prefixes[1]
+	proof.Trie.Prefixes = [][]byte{prefixes[1]}
+	for i := range proof.Trie.Nodes {
+		if proof.Trie.Nodes[i].Kind == ProofCommitment {
+			proof.Trie.Nodes[i].Key = prefixes[1]
+		}
+	}
+	if err := VerifyPartialCluster(root, proof); err == nil {
+		t.Errorf("Error: Partial proof relabelled to cluster %x was accepted", prefixes[1])
+	}
+}
+
+// TestCollectGarbage_RemovesEmptyClusters empties some clusters and checks the collapsed trie matches a fresh build
+func TestCollectGarbage_RemovesEmptyClusters(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	strategy := ClusterStrategyFunc(func(tx *types.Transaction) ([]byte, error) {
+		return tx.To().Bytes()[:1], nil
+	})
+	chain := NewClusteredChain(strategy)
+
+	var txs []*types.Transaction
+	for i := 0; i < 600; i++ {
+		txs = append(txs, newTestTx(signer, uint64(i), 100))
+	}
+	if _, err := chain.AddBlock(txs); err != nil {
+		t.Fatalf("Failed to add block: %v", err)
+	}
+	clusterCount := chain.ClusterCount()
+
+	// Empty a quarter of the clusters by removing all of their transactions
+	clusters, _ := ClusterTransactions(txs, strategy)
+	var dropped []common.Hash
+	emptied := 0
+	for prefixStr, members := range clusters {
+		if emptied == clusterCount/4 {
+			break
+		}
+		for _, tx := range members {
+			dropped = append(dropped, tx.Hash())
+		}
+		delete(clusters, prefixStr)
+		emptied++
+	}
+	if _, err := chain.RemoveTransactions(dropped); err != nil {
+		t.Fatalf("Failed to remove transactions: %v", err)
+	}
+
+	stats, err := chain.CollectGarbage()
+	if err != nil {
+		t.Fatalf("Failed to collect garbage: %v", err)
+	}
+	t.Logf("GC removed %d clusters, nodes %d -> %d (%d reclaimed)", stats.RemovedClusters, stats.NodesBefore, stats.NodesAfter, stats.ReclaimedNodes)
+	if stats.RemovedClusters != emptied {
+		t.Errorf("Error: Expected %d removed clusters, got %d", emptied, stats.RemovedClusters)
+	}
+	if stats.ReclaimedNodes < stats.RemovedClusters {
+		t.Errorf("Error: Expected at least %d reclaimed nodes, got %d", stats.RemovedClusters, stats.ReclaimedNodes)
+	}
+
+	// The collapsed trie must be identical to one built from the surviving clusters
+	trie, _ := BuildCMPTTree(NewTrie(), clusters)
+	if chain.Trie.Root.GetHash() != trie.Root.GetHash() {
+		t.Errorf("Error: Collected root %s differs from rebuilt root %s", chain.Trie.Root.GetHash().Hex(), trie.Root.GetHash().Hex())
+	}
+}
+
+func TestHasher_ProofsFollowTrieHasher(t *testing.T) {
+	prefixes, clusters := newTestClusters(t, 500, 32)
+	keccakTrie, _ := BuildCMPTTree(NewTrie(), clusters)
+
+	for name, hasher := range map[string]Hasher{"sha256": SHA256Hasher, "blake3": Blake3Hasher} {
+		trie, _ := BuildCMPTTree(NewTrie(WithHasher(hasher)), clusters)
+		root := trie.Root.GetHash()
+		if root == keccakTrie.Root.GetHash() {
+			t.Errorf("Error: %s root equals the Keccak256 root", name)
+		}
+
+		proof, err := trie.Prove(prefixes[:4])
+		if err != nil {
+			t.Fatalf("Failed to build %s proof: %v", name, err)
+		}
+		if err := VerifyMultiProof(root, proof, hasher); err != nil {
+			t.Errorf("Error: Valid %s proof rejected: %v", name, err)
+		}
+		if err := VerifyMultiProof(root, proof); err == nil {
+			t.Errorf("Error: %s proof accepted with the Keccak256 hasher", name)
+		}
+
+		partial, err := trie.ProvePartialCluster(prefixes[0], []common.Hash{clusters[string(prefixes[0])][0].Hash()})
+		if err != nil {
+			t.Fatalf("Failed to build %s partial proof: %v", name, err)
+		}
+		if err := VerifyPartialCluster(root, partial, hasher); err != nil {
+			t.Errorf("Error: Valid %s partial proof rejected: %v", name, err)
+		}
+	}
+}
+
+func TestWriteDOT_AnnotatesClusters(t *testing.T) {
+	prefixes, clusters := newTestClusters(t, 300, 16)
+	trie, _ := BuildCMPTTree(NewTrie(), clusters)
+
+	var buf strings.Builder
+	if err := trie.WriteDOT(&buf); err != nil {
+		t.Fatalf("Failed to write DOT: %v", err)
+	}
+	dot := buf.String()
+	if !strings.HasPrefix(dot, "digraph cmpt {") || !strings.HasSuffix(dot, "}\n") {
+		t.Errorf("Error: Output is not a digraph")
+	}
+	for _, prefix := range prefixes {
+		label := fmt.Sprintf("%x\\n%d members", prefix, len(clusters[string(prefix)]))
+		if !strings.Contains(dot, label) {
+			t.Errorf("Error: Cluster %x is missing its annotation", prefix)
+		}
+	}
+	if !strings.Contains(dot, "fillcolor=\"#ff0000\"") {
+		t.Errorf("Error: Largest cluster is not rendered at full intensity")
+	}
+}
+
+func TestClusterBloom_FindCluster(t *testing.T) {
+	prefixes, clusters := newTestClusters(t, 1000, 32)
+	trie, _ := BuildCMPTTree(NewTrie(WithStore(memorydb.New())), clusters)
+
+	for _, prefix := range prefixes {
+		leaf := trie.findLeaf(trie.Root, prefix)
+		for _, tx := range clusters[string(prefix)] {
+			if !leaf.MightContain(tx.Hash()) {
+				t.Fatalf("Error: Bloom filter of cluster %x misses member %s", prefix, tx.Hash().Hex())
+			}
+			found, err := trie.FindCluster(tx.Hash())
+			if err != nil {
+				t.Fatalf("Failed to find cluster of %s: %v", tx.Hash().Hex(), err)
+			}
+			if string(found) != string(prefix) {
+				t.Errorf("Error: Transaction %s routed to %x, want %x", tx.Hash().Hex(), found, prefix)
+			}
+		}
+	}
+	if _, err := trie.FindCluster(common.HexToHash("0x1234")); err == nil {
+		t.Errorf("Error: Unknown transaction was routed to a cluster")
+	}
+}
+
+func TestOverlappingClusters_CheapestCover(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	var txs []*types.Transaction
+	for i := 0; i < 40; i++ {
+		txs = append(txs, newTestTx(signer, uint64(i), 100))
+	}
+
+	// A large sender cluster holds everything, a small contract cluster the first 4 txs
+	trie := NewTrie()
+	sender, contract := []byte{0x10, 0x01}, []byte{0x20, 0x02}
+	if err := trie.InsertCluster(sender, txs); err != nil {
+		t.Fatalf("Failed to insert sender cluster: %v", err)
+	}
+	if err := trie.InsertCluster(contract, txs[:4]); err != nil {
+		t.Fatalf("Failed to insert contract cluster: %v", err)
+	}
+	trie.fixedPath(trie.Root, []byte{})
+	root := trie.ComputeHash(trie.Root)
+
+	if trie.RefCount(txs[0].Hash()) != 2 || trie.RefCount(txs[10].Hash()) != 1 {
+		t.Errorf("Error: Unexpected reference counts %d and %d", trie.RefCount(txs[0].Hash()), trie.RefCount(txs[10].Hash()))
+	}
+
+	// Txs held by both clusters are proven with the smaller one
+	cover, err := trie.CoverTransactions([]common.Hash{txs[0].Hash(), txs[3].Hash()})
+	if err != nil {
+		t.Fatalf("Failed to cover transactions: %v", err)
+	}
+	if len(cover) != 1 || string(cover[0]) != string(contract) {
+		t.Errorf("Error: Expected the contract cluster alone, got %x", cover)
+	}
+	proof, err := trie.ProveTransactions([]common.Hash{txs[0].Hash(), txs[10].Hash()})
+	if err != nil {
+		t.Fatalf("Failed to prove transactions: %v", err)
+	}
+	if err := VerifyMultiProof(root, proof); err != nil {
+		t.Errorf("Error: Valid cover proof rejected: %v", err)
+	}
+
+	// Dropping a cluster releases its references
+	if err := trie.Delete(contract); err != nil {
+		t.Fatalf("Failed to delete contract cluster: %v", err)
+	}
+	if trie.RefCount(txs[0].Hash()) != 1 {
+		t.Errorf("Error: Reference count after delete is %d, want 1", trie.RefCount(txs[0].Hash()))
+	}
+}
+
+func TestEpochStrategy_OldClustersStayProvable(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	old := &EpochStrategy{Epoch: 0, Strategy: &SenderStrategy{Signer: signer, Length: 4}}
+	current := &EpochStrategy{Epoch: 1, Strategy: ClusterStrategyFunc(func(tx *types.Transaction) ([]byte, error) {
+		return tx.To().Bytes()[:2], nil
+	})}
+
+	chain := NewClusteredChain(old)
+	var oldTxs, newTxs []*types.Transaction
+	for i := 0; i < 50; i++ {
+		oldTxs = append(oldTxs, newTestTx(signer, uint64(i), 100))
+		newTxs = append(newTxs, newTestTx(signer, uint64(1000+i), 100))
+	}
+	if _, err := chain.AddBlock(oldTxs); err != nil {
+		t.Fatalf("Failed to add epoch 0 block: %v", err)
+	}
+	chain.Strategy = current
+	record, err := chain.AddBlock(newTxs)
+	if err != nil {
+		t.Fatalf("Failed to add epoch 1 block: %v", err)
+	}
+
+	requests, err := chain.Trie.EpochRequests([]common.Hash{oldTxs[0].Hash(), newTxs[0].Hash(), newTxs[1].Hash()})
+	if err != nil {
+		t.Fatalf("Failed to build epoch requests: %v", err)
+	}
+	if len(requests[0]) != 1 || len(requests[1]) == 0 {
+		t.Fatalf("Error: Unexpected per-epoch requests %x", requests)
+	}
+	for epoch, keys := range requests {
+		proof, err := chain.Trie.Prove(keys)
+		if err != nil {
+			t.Fatalf("Failed to prove epoch %d clusters: %v", epoch, err)
+		}
+		if err := VerifyMultiProof(record.Root, proof); err != nil {
+			t.Errorf("Error: Epoch %d proof rejected: %v", epoch, err)
+		}
+	}
+}
+
+func TestGetCluster_DecodesMembers(t *testing.T) {
+	prefixes, clusters := newTestClusters(t, 200, 8)
+	trie, _ := BuildCMPTTree(NewTrie(WithStore(memorydb.New())), clusters)
+
+	for _, prefix := range prefixes {
+		members, err := trie.GetCluster(prefix)
+		if err != nil {
+			t.Fatalf("Failed to get cluster %x: %v", prefix, err)
+		}
+		want := clusters[string(prefix)]
+		if len(members) != len(want) {
+			t.Fatalf("Error: Cluster %x has %d members, want %d", prefix, len(members), len(want))
+		}
+		for i, tx := range members {
+			if tx.Hash() != want[i].Hash() {
+				t.Errorf("Error: Member %d of cluster %x differs", i, prefix)
+			}
+		}
+	}
+	if _, err := trie.GetCluster([]byte{0xde, 0xad}); err == nil {
+		t.Errorf("Error: Missing cluster was returned")
+	}
+}
+
+func TestClusterIterator_KeyOrder(t *testing.T) {
+	prefixes, clusters := newTestClusters(t, 500, 40)
+	trie, _ := BuildCMPTTree(NewTrie(), clusters)
+	// A key that is a prefix of another one must come first
+	if err := trie.InsertCluster(prefixes[0][:3], clusters[string(prefixes[0])]); err != nil {
+		t.Fatalf("Failed to insert short cluster: %v", err)
+	}
+	trie.fixedPath(trie.Root, []byte{})
+	trie.ComputeHash(trie.Root)
+
+	var keys []string
+	it := trie.NewClusterIterator()
+	for it.Next() {
+		info := it.Cluster()
+		leaf := trie.findLeaf(trie.Root, info.Prefix)
+		if info.MemberCount != leaf.MemberCount || info.ValueBytes != leaf.Size || info.LeafHash != leaf.Hash {
+			t.Errorf("Error: Iterator metadata of cluster %x does not match its leaf", info.Prefix)
+		}
+		keys = append(keys, string(info.Prefix))
+	}
+	if len(keys) != len(clusters)+1 {
+		t.Fatalf("Error: Iterated %d clusters, want %d", len(keys), len(clusters)+1)
+	}
+	if !sort.StringsAreSorted(keys) {
+		t.Errorf("Error: Clusters are not yielded in key order")
+	}
+}
+
+func TestOptimizeClusters_SplitsHotSubtrees(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	base := ClusterStrategyFunc(func(tx *types.Transaction) ([]byte, error) {
+		return tx.To().Bytes()[:4], nil
+	})
+	var txs []*types.Transaction
+	weights := make(map[common.Hash]float64)
+	for i := 0; i < 3000; i++ {
+		tx := newTestTx(signer, uint64(i), 100)
+		txs = append(txs, tx)
+		weights[tx.Hash()] = 1
+		if tx.To()[0] < 0x10 {
+			weights[tx.Hash()] = 100 // Hot destinations
+		}
+	}
+
+	cfg := OptimizerConfig{MaxProofBytes: 16 * 1024, MaxPrefixLen: 4, ClusterCost: 0.5}
+	plan, err := OptimizeClusters(txs, base, weights, cfg)
+	if err != nil {
+		t.Fatalf("Failed to optimize clusters: %v", err)
+	}
+	if plan.MaxProofBytes > cfg.MaxProofBytes {
+		t.Errorf("Error: Largest proof %d exceeds the %d byte target", plan.MaxProofBytes, cfg.MaxProofBytes)
+	}
+
+	// Hot clusters should end up with longer prefixes than cold ones
+	hotLen, hotCount, coldLen, coldCount := 0, 0, 0, 0
+	for _, prefix := range plan.Prefixes {
+		if prefix[0] < 0x10 {
+			hotLen, hotCount = hotLen+len(prefix), hotCount+1
+		} else {
+			coldLen, coldCount = coldLen+len(prefix), coldCount+1
+		}
+	}
+	if hotCount == 0 || coldCount == 0 || float64(hotLen)/float64(hotCount) <= float64(coldLen)/float64(coldCount) {
+		t.Errorf("Error: Hot prefixes are not longer than cold ones (%d/%d vs %d/%d)", hotLen, hotCount, coldLen, coldCount)
+	}
+
+	// The plan routes every transaction to one of its prefixes
+	clusters, err := ClusterTransactions(txs, plan)
+	if err != nil {
+		t.Fatalf("Failed to cluster with plan: %v", err)
+	}
+	if len(clusters) != len(plan.Prefixes) {
+		t.Errorf("Error: Plan produced %d clusters, want %d", len(clusters), len(plan.Prefixes))
+	}
+	trie, _ := BuildCMPTTree(NewTrie(), clusters)
+	proof, err := trie.Prove(plan.Prefixes[:1])
+	if err != nil {
+		t.Fatalf("Failed to prove planned cluster: %v", err)
+	}
+	if err := VerifyMultiProof(trie.Root.GetHash(), proof); err != nil {
+		t.Errorf("Error: Planned cluster proof rejected: %v", err)
+	}
+	t.Logf("%d clusters, expected proof %.0f bytes, largest %d bytes", len(plan.Prefixes), plan.ExpectedBytes, plan.MaxProofBytes)
+}
+
+func TestClusterQuality_Metrics(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	var txs []*types.Transaction
+	for i := 0; i < 64; i++ {
+		txs = append(txs, newTestTx(signer, uint64(i), 100))
+	}
+
+	// Four equal clusters against one dominant cluster with three singletons
+	even := make(map[string][]*types.Transaction)
+	skewed := make(map[string][]*types.Transaction)
+	for i, tx := range txs {
+		even[string([]byte{byte(i % 4)})] = append(even[string([]byte{byte(i % 4)})], tx)
+		key := []byte{0}
+		if i < 3 {
+			key = []byte{byte(i + 1)}
+		}
+		skewed[string(key)] = append(skewed[string(key)], tx)
+	}
+
+	evenScore, err := ScoreClustering(even, 8)
+	if err != nil {
+		t.Fatalf("Failed to score clustering: %v", err)
+	}
+	skewedScore, err := ScoreClustering(skewed, 8)
+	if err != nil {
+		t.Fatalf("Failed to score clustering: %v", err)
+	}
+	if math.Abs(evenScore.SizeEntropy-2) > 1e-9 {
+		t.Errorf("Error: Entropy of four equal clusters is %f, want 2", evenScore.SizeEntropy)
+	}
+	if evenScore.ByteGini > 0.01 || skewedScore.ByteGini < 0.5 {
+		t.Errorf("Error: Unexpected Gini coefficients %f and %f", evenScore.ByteGini, skewedScore.ByteGini)
+	}
+	if skewedScore.ExpectedTouched >= evenScore.ExpectedTouched {
+		t.Errorf("Error: Skewed clustering touches %f clusters, even one %f", skewedScore.ExpectedTouched, evenScore.ExpectedTouched)
+	}
+
+	// Requesting every transaction touches every cluster
+	all, err := ExpectedClustersTouched(even, len(txs))
+	if err != nil || math.Abs(all-4) > 1e-9 {
+		t.Errorf("Error: Full request touches %f clusters, want 4 (%v)", all, err)
+	}
+}
+
+func TestBuildResult_ReportsPartialFailures(t *testing.T) {
+	_, clusters := newTestClusters(t, 100, 4)
+	clusters[""] = clusters[string(firstKey(clusters))] // Empty prefixes cannot be inserted
+
+	trie, result := BuildCMPTTree(NewTrie(), clusters)
+	if result.Clusters != len(clusters) || result.Inserted != len(clusters)-1 {
+		t.Errorf("Error: Inserted %d of %d clusters, want %d", result.Inserted, result.Clusters, len(clusters)-1)
+	}
+	if _, ok := result.Errors[""]; !ok || result.Err() == nil {
+		t.Errorf("Error: Failed insert was not reported")
+	}
+	if result.Root != trie.Root.GetHash() {
+		t.Errorf("Error: Result root does not match the trie root")
+	}
+	if result.Duration < result.PackTime || result.Duration < result.HashTime {
+		t.Errorf("Error: Phase times exceed the total build time")
+	}
+}
+
+// firstKey returns an arbitrary key of a cluster map
+func firstKey(clusters map[string][]*types.Transaction) []byte {
+	for prefixStr := range clusters {
+		return []byte(prefixStr)
+	}
+	return nil
+}
+
+func TestFeeBandStrategy_TopBand(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	var txs []*types.Transaction
+	for i := 0; i < 100; i++ {
+		tx := types.NewTransaction(uint64(i), common.Address{}, big.NewInt(1), 21000, big.NewInt(int64(i+1)), nil)
+		signedTx, err := types.SignTx(tx, signer, testKey)
+		if err != nil {
+			t.Fatalf("Failed to sign transaction: %v", err)
+		}
+		txs = append(txs, signedTx)
+	}
+
+	strategy, err := NewFeeBandStrategy(txs, 4, nil)
+	if err != nil {
+		t.Fatalf("Failed to create fee band strategy: %v", err)
+	}
+	clusters, err := ClusterTransactions(txs, strategy)
+	if err != nil {
+		t.Fatalf("Failed to cluster transactions: %v", err)
+	}
+	if len(clusters) != 4 {
+		t.Fatalf("Error: Got %d fee bands, want 4", len(clusters))
+	}
+	for _, tx := range clusters[string([]byte{0})] {
+		if tx.GasPrice().Int64() <= 75 {
+			t.Errorf("Error: Gas price %d landed in the top band", tx.GasPrice().Int64())
+		}
+	}
+	if len(clusters[string([]byte{0})]) != 25 {
+		t.Errorf("Error: Top band holds %d transactions, want 25", len(clusters[string([]byte{0})]))
+	}
+}
+
+func TestDestinationStrategy_ContractCluster(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	contract := common.HexToAddress("0x00000000000000000000000000000000c0ffee")
+	var txs, touching []*types.Transaction
+	for i := 0; i < 200; i++ {
+		var tx *types.Transaction
+		switch i % 10 {
+		case 0:
+			tx = types.NewTransaction(uint64(i), contract, big.NewInt(1), 50000, big.NewInt(1), nil)
+		case 1:
+			tx = types.NewContractCreation(uint64(i), big.NewInt(0), 100000, big.NewInt(1), []byte{0x60, 0x00})
+		default:
+			txs = append(txs, newTestTx(signer, uint64(i), 100))
+			continue
+		}
+		signedTx, err := types.SignTx(tx, signer, testKey)
+		if err != nil {
+			t.Fatalf("Failed to sign transaction: %v", err)
+		}
+		txs = append(txs, signedTx)
+		if i%10 == 0 {
+			touching = append(touching, signedTx)
+		}
+	}
+
+	strategy := &DestinationStrategy{Length: 20}
+	clusters, err := ClusterTransactions(txs, strategy)
+	if err != nil {
+		t.Fatalf("Failed to cluster transactions: %v", err)
+	}
+	if len(clusters[string([]byte{CreationTag})]) != 20 {
+		t.Errorf("Error: Creation bucket holds %d transactions, want 20", len(clusters[string([]byte{CreationTag})]))
+	}
+
+	// All transactions touching the contract are proven by one cluster
+	trie, _ := BuildCMPTTree(NewTrie(), clusters)
+	key, err := strategy.KeyFor(contract)
+	if err != nil {
+		t.Fatalf("Failed to derive contract key: %v", err)
+	}
+	members, err := trie.GetCluster(key)
+	if err != nil {
+		t.Fatalf("Failed to get contract cluster: %v", err)
+	}
+	if len(members) != len(touching) {
+		t.Errorf("Error: Contract cluster holds %d transactions, want %d", len(members), len(touching))
+	}
+	proof, err := trie.Prove([][]byte{key})
+	if err != nil {
+		t.Fatalf("Failed to prove contract cluster: %v", err)
+	}
+	if err := VerifyMultiProof(trie.Root.GetHash(), proof); err != nil {
+		t.Errorf("Error: Contract cluster proof rejected: %v", err)
+	}
+	t.Logf("Contract cluster proof needs %d extra hashes", proof.HashCount())
+}
+
+func TestMultiProof_BinaryRoundTrip(t *testing.T) {
+	prefixes, clusters := newTestClusters(t, 300, 32)
+	trie, _ := BuildCMPTTree(NewTrie(), clusters)
+	root := trie.Root.GetHash()
+
+	for _, withValues := range []bool{true, false} {
+		proof, err := trie.proveClusters(prefixes[:3], withValues)
+		if err != nil {
+			t.Fatalf("Failed to build proof: %v", err)
+		}
+		encoded, err := proof.MarshalBinary()
+		if err != nil {
+			t.Fatalf("Failed to encode proof: %v", err)
+		}
+		decoded := new(MultiProof)
+		if err := decoded.UnmarshalBinary(encoded); err != nil {
+			t.Fatalf("Failed to decode proof: %v", err)
+		}
+		if err := VerifyMultiProof(root, decoded); err != nil {
+			t.Errorf("Error: Decoded proof rejected: %v", err)
+		}
+		reencoded, _ := decoded.MarshalBinary()
+		if string(reencoded) != string(encoded) {
+			t.Errorf("Error: Re-encoding the decoded proof changed it")
+		}
+
+		// Every truncation must be detected
+		for i := 0; i < len(encoded); i++ {
+			if err := new(MultiProof).UnmarshalBinary(encoded[:i]); err == nil {
+				t.Fatalf("Error: Proof truncated to %d of %d bytes was decoded", i, len(encoded))
+			}
+		}
+		t.Logf("Proof of 3 clusters (values: %v) encodes to %d bytes", withValues, len(encoded))
+	}
+
+	// A short node claiming MaxUint64 nibbles must fail, not panic
+	huge := binary.AppendUvarint([]byte{proofEncodingVersion, 0, 1, ProofShort}, math.MaxUint64)
+	if err := new(MultiProof).UnmarshalBinary(huge); err == nil {
+		t.Fatal("Error: Proof with an oversized nibble count was decoded")
+	}
+}
+
+func TestVerifyClusterBody_RejectsTruncatedAndPadded(t *testing.T) {
+	prefixes, clusters := newTestClusters(t, 200, 4)
+	trie, _ := BuildCMPTTree(NewTrie(), clusters)
+
+	prefix := prefixes[0]
+	members := clusters[string(prefix)]
+	claimed := make([]common.Hash, len(members))
+	for i, tx := range members {
+		claimed[i] = tx.Hash()
+	}
+	body, err := EncodeClusterValue(members)
+	if err != nil {
+		t.Fatalf("Failed to encode cluster: %v", err)
+	}
+	// The client knows the root only and takes the commitment from a verified proof
+	proof, err := trie.proveClusters([][]byte{prefix}, false)
+	if err != nil {
+		t.Fatalf("Failed to prove cluster commitment: %v", err)
+	}
+	leaves, err := verifyMultiProof(Keccak256Hasher, plainKeyNibbles, trie.Root.GetHash(), proof)
+	if err != nil {
+		t.Fatalf("Failed to verify cluster commitment: %v", err)
+	}
+	commitment := leaves[string(prefix)].ClusterCommitment
+	if err := VerifyClusterBody(commitment, body, claimed); err != nil {
+		t.Errorf("Error: Valid cluster body rejected: %v", err)
+	}
+
+	truncated, _ := EncodeClusterValue(members[:len(members)-1])
+	if err := VerifyClusterBody(commitment, truncated, claimed[:len(claimed)-1]); err == nil {
+		t.Errorf("Error: Truncated cluster body accepted")
+	}
+	extra := clusters[string(prefixes[1])][0]
+	padded, _ := EncodeClusterValue(append(append([]*types.Transaction{}, members...), extra))
+	if err := VerifyClusterBody(commitment, padded, append(append([]common.Hash{}, claimed...), extra.Hash())); err == nil {
+		t.Errorf("Error: Padded cluster body accepted")
+	}
+
+	// Swapping two members keeps the count but breaks the claimed order
+	swapped := append([]*types.Transaction{}, members...)
+	swapped[0], swapped[1] = swapped[1], swapped[0]
+	reordered, _ := EncodeClusterValue(swapped)
+	if err := VerifyClusterBody(commitment, reordered, claimed); err == nil {
+		t.Errorf("Error: Reordered cluster body accepted")
+	}
+}
+
+func TestSizeBalancedClusters_FlattensWorstCase(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	var txs []*types.Transaction
+	for i := 0; i < 400; i++ {
+		var data []byte
+		if i%20 == 0 {
+			data = make([]byte, 4000) // Large calldata
+		}
+		tx := types.NewTransaction(uint64(i), common.Address{byte(i)}, big.NewInt(1), 1000000, big.NewInt(1), data)
+		signedTx, err := types.SignTx(tx, signer, testKey)
+		if err != nil {
+			t.Fatalf("Failed to sign transaction: %v", err)
+		}
+		txs = append(txs, signedTx)
+	}
+
+	clusters, err := SizeBalancedClusters(txs, 16)
+	if err != nil {
+		t.Fatalf("Failed to balance clusters: %v", err)
+	}
+	total, largest, smallest := 0, 0, int(^uint(0)>>1)
+	largeMembers, smallMembers := 0, 0
+	for _, members := range clusters {
+		size := 0
+		for _, tx := range members {
+			size += int(tx.Size())
+		}
+		total += len(members)
+		if size > largest {
+			largest, largeMembers = size, len(members)
+		}
+		if size < smallest {
+			smallest, smallMembers = size, len(members)
+		}
+	}
+	if total != len(txs) || len(clusters) != 16 {
+		t.Fatalf("Error: Balanced %d transactions into %d clusters", total, len(clusters))
+	}
+	// Largest-first placement keeps every cluster within one transaction of the others
+	if largest-smallest > int(txs[0].Size()) {
+		t.Errorf("Error: Cluster sizes range from %d to %d bytes", smallest, largest)
+	}
+	if largeMembers >= smallMembers {
+		t.Errorf("Error: Largest cluster has %d members, smallest %d", largeMembers, smallMembers)
+	}
+	t.Logf("Cluster sizes %d-%d bytes with %d-%d members", smallest, largest, smallMembers, largeMembers)
+
+	// Balanced clusters are regular clusters
+	trie, result := BuildCMPTTree(NewTrie(), clusters)
+	if result.Err() != nil || trie.Root == nil {
+		t.Errorf("Error: Failed to build trie from balanced clusters: %v", result.Err())
+	}
+}
+
+func TestReplayer_ClustersBlocksWithCachedSenders(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	var blocks []*types.Block
+	var all []*types.Transaction
+	for n := 0; n < 3; n++ {
+		var txs []*types.Transaction
+		for i := 0; i < 50; i++ {
+			txs = append(txs, newTestTx(signer, uint64(n*50+i), 100))
+		}
+		all = append(all, txs...)
+		header := &types.Header{Number: big.NewInt(int64(n + 1)), Time: uint64(n + 1)}
+		blocks = append(blocks, types.NewBlockWithHeader(header).WithBody(types.Body{Transactions: txs}))
+	}
+
+	replayer := NewReplayer(params.TestChainConfig, nil)
+	clusters, err := replayer.ClusterBlocks(blocks)
+	if err != nil {
+		t.Fatalf("Failed to replay blocks: %v", err)
+	}
+	if replayer.Recovered != len(all) || replayer.CacheHits != len(all) {
+		t.Errorf("Error: %d recoveries and %d cache hits, want %d each", replayer.Recovered, replayer.CacheHits, len(all))
+	}
+
+	// All test transactions share one sender
+	want := crypto.PubkeyToAddress(testKey.PublicKey).Bytes()[:4]
+	if len(clusters) != 1 || len(clusters[string(want)]) != len(all) {
+		t.Errorf("Error: Expected one sender cluster with %d transactions, got %d clusters", len(all), len(clusters))
+	}
+	if _, result := BuildCMPTTree(NewTrie(), clusters); result.Err() != nil {
+		t.Errorf("Error: Failed to build trie from replayed clusters: %v", result.Err())
+	}
+}
+
+func TestRehash_ReusesUntouchedSubtrees(t *testing.T) {
+	prefixes, clusters := newTestClusters(t, 2000, 256)
+	trie, _ := BuildCMPTTree(NewTrie(), clusters)
+	if _, count := trie.Rehash(); count != 0 {
+		t.Errorf("Error: Rehashing an unchanged trie recomputed %d hashes", count)
+	}
+
+	// Update a single cluster: only its path is rehashed
+	signer := types.LatestSigner(params.TestChainConfig)
+	members := append(clusters[string(prefixes[0])], newTestTx(signer, 1<<20, 100))
+	clusters[string(prefixes[0])] = members
+	if err := trie.UpdateCluster(prefixes[0], members); err != nil {
+		t.Fatalf("Failed to update cluster: %v", err)
+	}
+	trie.fixedPath(trie.Root, []byte{})
+	root, count := trie.Rehash()
+	if count == 0 || count > 2*len(keyToNibbles(prefixes[0]))+1 {
+		t.Errorf("Error: Updating one cluster recomputed %d hashes", count)
+	}
+
+	fresh, _ := BuildCMPTTree(NewTrie(), clusters)
+	if root != fresh.Root.GetHash() {
+		t.Errorf("Error: Cached root %s differs from fresh root %s", root.Hex(), fresh.Root.GetHash().Hex())
+	}
+	t.Logf("Updating one of %d clusters recomputed %d hashes", len(clusters), count)
+}
+
+func TestHexPrefix_OddNibbleClusters(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	paths := [][]byte{{0xa, 0xb, 0xc}, {0xa, 0xb}, {0xa, 0xb, 0xd}, {0x1}, {0x1, 0x2, 0x3, 0x4, 0x5}, {0x7, 0x0, 0x0}}
+
+	trie := NewTrie(WithHexPrefixKeys())
+	var keys [][]byte
+	for i, path := range paths {
+		key, err := HexPrefix(path)
+		if err != nil {
+			t.Fatalf("Failed to encode prefix %x: %v", path, err)
+		}
+		decoded, err := hexPrefixToNibbles(key)
+		if err != nil || string(decoded) != string(path) {
+			t.Fatalf("Error: Prefix %x decodes to %x (%v)", path, decoded, err)
+		}
+		if err := trie.InsertCluster(key, []*types.Transaction{newTestTx(signer, uint64(i), 100)}); err != nil {
+			t.Fatalf("Failed to insert cluster %x: %v", path, err)
+		}
+		keys = append(keys, key)
+	}
+	trie.fixedPath(trie.Root, []byte{})
+	root := trie.ComputeHash(trie.Root)
+
+	for i, key := range keys {
+		proof, err := trie.Prove([][]byte{key})
+		if err != nil {
+			t.Fatalf("Failed to prove cluster %x: %v", paths[i], err)
+		}
+		if err := VerifyHexPrefixMultiProof(root, proof); err != nil {
+			t.Errorf("Error: Proof of odd cluster %x rejected: %v", paths[i], err)
+		}
+	}
+
+	// Partial cluster proofs follow the same key encoding
+	members, err := trie.GetCluster(keys[1])
+	if err != nil {
+		t.Fatalf("Failed to get cluster: %v", err)
+	}
+	partial, err := trie.ProvePartialCluster(keys[1], []common.Hash{members[0].Hash()})
+	if err != nil {
+		t.Fatalf("Failed to prove partial cluster: %v", err)
+	}
+	if err := VerifyHexPrefixPartialCluster(root, partial); err != nil {
+		t.Errorf("Error: Partial proof of hex-prefix cluster rejected: %v", err)
+	}
+	if err := VerifyPartialCluster(root, partial); err == nil {
+		t.Errorf("Error: Partial proof of hex-prefix cluster accepted as a plain key")
+	}
+	if need := trie.CalculateRequiredHashes2(keys); need != 0 {
+		t.Errorf("Error: Requesting every cluster needs %d hashes, want 0", need)
+	}
+	if need := trie.CalculateRequiredHashes2(keys[:1]); need == 0 {
+		t.Errorf("Error: Requesting one cluster needs no hashes")
+	}
+
+	// Deleting the odd cluster collapses the trie back to the remaining ones
+	if err := trie.Delete(keys[0]); err != nil {
+		t.Fatalf("Failed to delete cluster: %v", err)
+	}
+	if _, err := trie.Get(keys[0]); err == nil {
+		t.Errorf("Error: Deleted cluster is still present")
+	}
+	if _, err := trie.Get(keys[2]); err != nil {
+		t.Errorf("Error: Sibling cluster lost after delete: %v", err)
+	}
+	if err := trie.Insert([]byte{0x20}, []byte("bad")); err == nil {
+		t.Errorf("Error: Malformed hex-prefix key accepted")
+	}
+}
+
+func TestMultiProof_RejectsRelabelledLeaf(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	trie := NewTrie()
+	for i, prefix := range [][]byte{{0x10, 1}, {0x20, 2}, {0x30, 3}} {
+		if err := trie.InsertCluster(prefix, []*types.Transaction{newTestTx(signer, uint64(i), 100)}); err != nil {
+			t.Fatalf("Failed to insert cluster %x: %v", prefix, err)
+		}
+	}
+	trie.fixedPath(trie.Root, []byte{})
+	root := trie.ComputeHash(trie.Root)
+
+	proof, err := trie.Prove([][]byte{{0x10, 1}})
+	if err != nil {
+		t.Fatalf("Failed to prove cluster: %v", err)
+	}
+	if err := VerifyMultiProof(root, proof); err != nil {
+		t.Fatalf("Error: Valid proof rejected: %v", err)
+	}
+
+	// Claiming the proven leaf under another prefix leaves the root unchanged
+	forged := []byte{0x20, 2}
+	proof.Prefixes = [][]byte{forged}
+	for i := range proof.Nodes {
+		if proof.Nodes[i].Kind == ProofLeaf {
+			proof.Nodes[i].Key = forged
+		}
+	}
+	if err := VerifyMultiProof(root, proof); err == nil {
+		t.Errorf("Error: Relabelled leaf accepted as cluster %x", forged)
+	}
+}
@@ -0,0 +1,29 @@
+package kmerkle
+
+import (
+	"mytrees/kmerkle/verifier"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// NewBalancedFromHashes creates a Merkle tree of arity k whose last two groups
+// at every level share their children evenly instead of leaving the last group
+// with the remainder. With 17 leaves and k = 16 the leaf level is grouped as
+// 9 + 8 rather than 16 + 1.
+//
+// Effect on proofs: a single proof carries, per level, the other children of
+// its parent. In the default layout the leaf alone in a short last group gets
+// an almost empty level while every other leaf pays k-1 siblings, so proof
+// sizes are skewed by position. Balancing gives the leaves of the last two
+// groups about (k+r)/2 - 1 siblings each, r being the size of the short group,
+// so proof sizes depend less on where a leaf sits. Multiproofs record the
+// layout in MultiProof.Balanced, see verifier.Layout. Generalized indices assume full groups and do
+// not address balanced trees. An optional hasher replaces the default Keccak256.
+func NewBalancedFromHashes(leafHashes []common.Hash, k int, hasher ...verifier.Hasher) *Tree {
+	return build(leafHashes, k, false, true, nodeHasher{hash: pickHasher(hasher)})
+}
+
+// layout returns the layout of the tree
+func (t *Tree) layout() verifier.Layout {
+	return verifier.NewLayout(t.K, len(t.leaves()), t.balanced)
+}
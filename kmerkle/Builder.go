@@ -0,0 +1,96 @@
+package kmerkle
+
+import (
+	"mytrees/kmerkle/verifier"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Builder constructs a K-ary tree from leaf hashes arriving one at a time.
+// Per level it keeps only the frontier of fewer than K nodes still waiting for
+// siblings; complete groups are hashed into their parent as soon as they fill,
+// so no input needs to be buffered. Close yields the same tree as
+// NewFromHashesWithK over the same hashes.
+type Builder struct {
+	k        int
+	hasher   nodeHasher
+	frontier [][]*Node           // Nodes per level waiting for their group to fill
+	created  []int               // Nodes created per level so far
+	leaves   []*Node             // Leaves in order
+	index    map[common.Hash]int // Leaf position by hash
+}
+
+// NewBuilder creates a streaming builder for a tree of arity k. An optional
+// hasher replaces the default Keccak256.
+func NewBuilder(k int, hasher ...verifier.Hasher) *Builder {
+	return &Builder{k: k, hasher: nodeHasher{hash: pickHasher(hasher)}, index: make(map[common.Hash]int)}
+}
+
+// Add appends the next leaf hash
+func (b *Builder) Add(hash common.Hash) {
+	leaf := &Node{IsLeaf: true, TxHash: hash, Hash: b.hasher.leaf(hash)}
+	if _, dup := b.index[hash]; !dup {
+		b.index[hash] = len(b.leaves)
+	}
+	b.leaves = append(b.leaves, leaf)
+	b.push(0, leaf)
+}
+
+// push adds a node to a level, closing its group into a parent once K are waiting
+func (b *Builder) push(level int, node *Node) {
+	if level == len(b.frontier) {
+		b.frontier = append(b.frontier, nil)
+		b.created = append(b.created, 0)
+	}
+	b.frontier[level] = append(b.frontier[level], node)
+	b.created[level]++
+	if len(b.frontier[level]) == b.k {
+		b.push(level+1, b.group(level))
+	}
+}
+
+// group creates the parent of the waiting nodes of a level and clears them
+func (b *Builder) group(level int) *Node {
+	children := b.frontier[level]
+	parent := &Node{Children: children}
+	for _, child := range children {
+		child.Parent = parent
+	}
+	parent.Hash = b.hasher.interior(children, nil)
+	b.frontier[level] = nil
+	return parent
+}
+
+// Close groups the remaining partial groups bottom-up and returns the tree
+func (b *Builder) Close() *Tree {
+	t := &Tree{K: b.k, hasher: b.hasher.hash, leafNodes: b.leaves, index: b.index}
+	for level := 0; level < len(b.frontier); level++ {
+		if b.created[level] == 1 {
+			// The only node of its level is the root
+			t.Root = b.frontier[level][0]
+			break
+		}
+		if len(b.frontier[level]) > 0 {
+			b.push(level+1, b.group(level))
+		}
+	}
+	return t
+}
+
+// BuildFromChannel builds a tree of arity k from hashes received until the channel is closed
+func BuildFromChannel(hashes <-chan common.Hash, k int) *Tree {
+	b := NewBuilder(k)
+	for hash := range hashes {
+		b.Add(hash)
+	}
+	return b.Close()
+}
+
+// BuildFromFunc builds a tree of arity k from hashes returned by next until it reports false
+func BuildFromFunc(next func() (common.Hash, bool), k int) *Tree {
+	b := NewBuilder(k)
+	for hash, ok := next(); ok; hash, ok = next() {
+		b.Add(hash)
+	}
+	return b.Close()
+}
@@ -0,0 +1,25 @@
+package kmerkle
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// NewFromClusters creates a K-ary Merkle tree whose leaves are ordered cluster
+// by cluster, so the members of a cluster are contiguous and share as many
+// subtrees as possible. Verifying a whole cluster then needs the fewest
+// sibling hashes, which compares the tree fairly with a clustered trie. A
+// transaction assigned to several clusters is placed with the first of them.
+func NewFromClusters(clusters [][]*types.Transaction) *Tree {
+	var leafHashes []common.Hash
+	placed := make(map[common.Hash]bool)
+	for _, cluster := range clusters {
+		for _, tx := range cluster {
+			if hash := tx.Hash(); !placed[hash] {
+				placed[hash] = true
+				leafHashes = append(leafHashes, hash)
+			}
+		}
+	}
+	return NewFromHashes(leafHashes)
+}
@@ -0,0 +1,73 @@
+package kmerkle
+
+import (
+	"mytrees/kmerkle/verifier"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// nodeHasher hashes the nodes of a tree with pooled buffers, matching
+// verifier.LeafHash and verifier.InteriorHash. By default a leaf hashes to
+// H(0x00 || leaf) and an interior node to H(0x01 || children); legacy trees
+// use the leaf itself and H(children), as before domain separation.
+type nodeHasher struct {
+	hash   verifier.Hasher
+	legacy bool
+}
+
+// NewLegacyFromHashes creates a Merkle tree of arity k without domain
+// separation: leaves are the leaf hashes themselves and interior nodes hash
+// the bare concatenation of their children. Only use it to reproduce roots
+// computed before domain separation, and verify its proofs with
+// VerifyLegacyProof and VerifyLegacyMultiProof. An optional hasher replaces the
+// default Keccak256.
+func NewLegacyFromHashes(leafHashes []common.Hash, k int, hasher ...verifier.Hasher) *Tree {
+	return build(leafHashes, k, false, false, nodeHasher{hash: pickHasher(hasher), legacy: true})
+}
+
+// nodeHasher returns the node hasher of the tree
+func (t *Tree) nodeHasher() nodeHasher {
+	return nodeHasher{hash: pickHasher([]verifier.Hasher{t.hasher}), legacy: t.legacy}
+}
+
+// leaf returns the hash of a leaf node
+func (h nodeHasher) leaf(hash common.Hash) common.Hash {
+	if h.legacy {
+		return hash
+	}
+	b := getHashBuffer(1 + common.HashLength)
+	b.buf = append(b.buf, verifier.LeafPrefix)
+	b.buf = append(b.buf, hash[:]...)
+	return b.sum(h)
+}
+
+// interior returns the hash of an interior node with the given child hashes,
+// passed as nodes or, when nodes is nil, as hashes
+func (h nodeHasher) interior(nodes []*Node, hashes []common.Hash) common.Hash {
+	n := len(nodes) + len(hashes)
+	b := getHashBuffer(1 + n*common.HashLength)
+	if !h.legacy {
+		b.buf = append(b.buf, verifier.NodePrefix)
+	}
+	for _, child := range nodes {
+		b.buf = append(b.buf, child.Hash[:]...)
+	}
+	for _, hash := range hashes {
+		b.buf = append(b.buf, hash[:]...)
+	}
+	return b.sum(h)
+}
+
+// empty returns the canonical empty hash of a level for arity k: the zero
+// hash for leaves, and the interior hash of k empty children above
+func (h nodeHasher) empty(k, level int) common.Hash {
+	var hash common.Hash
+	children := make([]common.Hash, k)
+	for ; level > 0; level-- {
+		for i := range children {
+			children[i] = hash
+		}
+		hash = h.interior(nil, children)
+	}
+	return hash
+}
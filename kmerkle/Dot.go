@@ -0,0 +1,88 @@
+package kmerkle
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Fill colours of highlighted nodes
+const (
+	dotTargetColor = "#9be39b" // Requested leaves
+	dotProofColor  = "#ffc266" // Sibling hashes the verifier needs
+	dotPathColor   = "#cce0ff" // Nodes the verifier recomputes
+)
+
+// WriteDOT renders the tree as a Graphviz digraph, highlighting the target
+// leaves, the sibling hashes RequiredHashes lists for them and the nodes
+// recomputed on the way to the root. With maxLevels > 0 only the top maxLevels
+// levels are drawn, which keeps large trees readable. Padding nodes are drawn
+// dashed. Nodes are named l<level>_<index> with level 0 holding the leaves.
+func (t *Tree) WriteDOT(w io.Writer, targets []common.Hash, maxLevels int) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "digraph kmerkle {")
+	fmt.Fprintln(bw, "\tnode [fontname=\"monospace\", fontsize=10, style=filled, fillcolor=white];")
+	if t == nil || t.Root == nil {
+		fmt.Fprintln(bw, "}")
+		return bw.Flush()
+	}
+
+	colors := make(map[*Node]string)
+	for _, h := range targets {
+		leaf := t.Leaf(h)
+		if leaf == nil {
+			continue
+		}
+		colors[leaf] = dotTargetColor
+		for node := leaf.Parent; node != nil; node = node.Parent {
+			colors[node] = dotPathColor
+		}
+	}
+	l := t.layout()
+	proofNodes := make(map[[2]int]bool)
+	for _, n := range t.RequiredHashes(targets) {
+		first, _ := l.Children(n.Level+1, n.ParentIndex)
+		proofNodes[[2]int{n.Level, first + n.ChildIndex}] = true
+	}
+
+	top := t.height()
+	lowest := 0
+	if maxLevels > 0 && top-maxLevels+1 > 0 {
+		lowest = top - maxLevels + 1
+	}
+	level := []*Node{t.Root}
+	for depth := top; depth >= lowest; depth-- {
+		var next []*Node
+		for index, node := range level {
+			attrs := ""
+			color, ok := colors[node]
+			if proofNodes[[2]int{depth, index}] {
+				color, ok = dotProofColor, true
+			}
+			if ok {
+				attrs = fmt.Sprintf(", fillcolor=\"%s\"", color)
+			}
+			if node.padding {
+				attrs += ", style=\"filled,dashed\""
+			}
+			fmt.Fprintf(bw, "\tl%d_%d [label=\"%x\\n(%d,%d)\"%s];\n", depth, index, node.Hash[:4], depth, index, attrs)
+			if depth == lowest {
+				continue
+			}
+			first, _ := l.Children(depth, index)
+			for c, child := range node.Children {
+				style := ""
+				if child.padding {
+					style = " [style=dashed]"
+				}
+				fmt.Fprintf(bw, "\tl%d_%d -> l%d_%d%s;\n", depth, index, depth-1, first+c, style)
+			}
+			next = append(next, node.Children...)
+		}
+		level = next
+	}
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
@@ -0,0 +1,132 @@
+package kmerkle
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+
+	"mytrees/kmerkle/verifier"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// NewSortedFromHashes creates a Merkle tree of arity k whose leaves are
+// ordered by hash instead of block position. Absent hashes can then be proven
+// by their would-be neighbours with GetExclusionProof. An optional hasher
+// replaces the default Keccak256.
+func NewSortedFromHashes(leafHashes []common.Hash, k int, hasher ...verifier.Hasher) *Tree {
+	sorted := append([]common.Hash{}, leafHashes...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i].Bytes(), sorted[j].Bytes()) < 0
+	})
+	t := build(sorted, k, false, false, nodeHasher{hash: pickHasher(hasher)})
+	t.sorted = true
+	return t
+}
+
+// NeighborProof proves the leaf at a position next to an absent hash
+type NeighborProof struct {
+	Index int         // Leaf position
+	Hash  common.Hash // Leaf hash
+	Proof Proof       // Inclusion proof of the leaf
+}
+
+// ExclusionProof proves that a hash is not a leaf of a tree with sorted
+// leaves. Left is the largest smaller leaf and Right the smallest larger one;
+// either is nil when the hash lies before the first or after the last leaf.
+type ExclusionProof struct {
+	K     int // Arity of the tree, needed to derive leaf positions from proofs
+	Left  *NeighborProof
+	Right *NeighborProof
+}
+
+// GetExclusionProof proves that hash is not among the leaves. It requires a
+// tree built by NewSortedFromHashes.
+func (t *Tree) GetExclusionProof(hash common.Hash) (ExclusionProof, error) {
+	if t == nil || !t.sorted {
+		return ExclusionProof{}, errors.New("exclusion proofs need a tree with sorted leaves")
+	}
+	leaves := t.leaves()
+	if len(leaves) == 0 {
+		return ExclusionProof{}, errors.New("empty tree")
+	}
+	pos := sort.Search(len(leaves), func(i int) bool {
+		return bytes.Compare(leaves[i].TxHash.Bytes(), hash.Bytes()) >= 0
+	})
+	if pos < len(leaves) && leaves[pos].TxHash == hash {
+		return ExclusionProof{}, errors.New("hash is a leaf of the tree")
+	}
+	proof := ExclusionProof{K: t.K}
+	var err error
+	if pos > 0 {
+		if proof.Left, err = t.neighborProof(pos - 1); err != nil {
+			return ExclusionProof{}, err
+		}
+	}
+	if pos < len(leaves) {
+		if proof.Right, err = t.neighborProof(pos); err != nil {
+			return ExclusionProof{}, err
+		}
+	}
+	return proof, nil
+}
+
+// neighborProof builds the inclusion proof of the leaf at index
+func (t *Tree) neighborProof(index int) (*NeighborProof, error) {
+	hash := t.leafNodes[index].TxHash
+	proof, err := t.GetProof(hash)
+	if err != nil {
+		return nil, err
+	}
+	return &NeighborProof{Index: index, Hash: hash, Proof: proof}, nil
+}
+
+// VerifyExclusionProof checks that hash is absent from the sorted-leaf tree
+// with the given root. Both neighbours must be proven, enclose hash and sit at
+// adjacent positions, which the verifier derives from the child indices of
+// their proofs. A missing neighbour is only accepted at the edges: the right
+// one must be leaf 0, and the left one must be the last child of its parent at
+// every level. An optional hasher replaces the default Keccak256.
+func VerifyExclusionProof(root, hash common.Hash, proof ExclusionProof, hasher ...verifier.Hasher) bool {
+	left, right := proof.Left, proof.Right
+	if proof.K < 2 || (left == nil && right == nil) {
+		return false
+	}
+	if left != nil {
+		if bytes.Compare(left.Hash.Bytes(), hash.Bytes()) >= 0 || !verifyNeighbor(root, proof.K, left, hasher) {
+			return false
+		}
+	}
+	if right != nil {
+		if bytes.Compare(hash.Bytes(), right.Hash.Bytes()) >= 0 || !verifyNeighbor(root, proof.K, right, hasher) {
+			return false
+		}
+	}
+	switch {
+	case left != nil && right != nil:
+		return right.Index == left.Index+1
+	case right != nil:
+		return right.Index == 0
+	default:
+		for _, level := range left.Proof.Levels {
+			if level.Position != len(level.Siblings) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// verifyNeighbor checks the inclusion proof of a neighbour and that its child
+// indices, read as base-k digits from the leaf up, spell its claimed index
+func verifyNeighbor(root common.Hash, k int, n *NeighborProof, hasher []verifier.Hasher) bool {
+	index, scale := 0, 1
+	for _, level := range n.Proof.Levels {
+		if level.Position >= k || len(level.Siblings) >= k {
+			return false
+		}
+		index += level.Position * scale
+		scale *= k
+	}
+	return index == n.Index && VerifyProof(root, n.Hash, n.Proof, hasher...)
+}
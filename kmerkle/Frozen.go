@@ -0,0 +1,120 @@
+package kmerkle
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// FrozenTree is a read-only handle on a private copy of a tree. It exposes
+// only queries and never hands out nodes, so nothing can modify the tree
+// behind it, and any number of goroutines may generate proofs and count
+// required hashes on it at once. A Tree itself is safe for concurrent reads
+// only as long as nobody calls UpdateLeaf or ComputeHashes or writes its nodes.
+type FrozenTree struct {
+	t *Tree
+}
+
+// Freeze returns a read-only handle on a copy of the tree. Later changes to
+// the tree do not affect the handle.
+func (t *Tree) Freeze() *FrozenTree {
+	return &FrozenTree{t: t.Copy()}
+}
+
+// Copy returns a deep copy of the tree sharing no nodes with it
+func (t *Tree) Copy() *Tree {
+	if t == nil {
+		return nil
+	}
+	c := *t
+	c.index = make(map[common.Hash]int, len(t.index))
+	for hash, i := range t.index {
+		c.index[hash] = i
+	}
+	c.leafNodes = make([]*Node, 0, len(t.leafNodes))
+	c.Root = copyNode(t.Root, nil, &c.leafNodes)
+	return &c
+}
+
+// copyNode copies the subtree below node, linking it to parent and collecting
+// the copied leaves in order
+func copyNode(node, parent *Node, leaves *[]*Node) *Node {
+	if node == nil {
+		return nil
+	}
+	n := *node
+	n.Parent = parent
+	if node.IsLeaf && !node.padding {
+		*leaves = append(*leaves, &n)
+	}
+	if len(node.Children) == 0 {
+		return &n
+	}
+	n.Children = make([]*Node, len(node.Children))
+	for i, child := range node.Children {
+		n.Children[i] = copyNode(child, &n, leaves)
+	}
+	return &n
+}
+
+// Root returns the root hash
+func (f *FrozenTree) Root() common.Hash {
+	if f.t.Root == nil {
+		return common.Hash{}
+	}
+	return f.t.Root.Hash
+}
+
+// K returns the arity of the tree
+func (f *FrozenTree) K() int {
+	return f.t.K
+}
+
+// Len returns the number of leaves
+func (f *FrozenTree) Len() int {
+	return len(f.t.leaves())
+}
+
+// LeafIndex returns the position of the leaf holding the given hash
+func (f *FrozenTree) LeafIndex(hash common.Hash) (int, bool) {
+	return f.t.LeafIndex(hash)
+}
+
+// GetProof generates the single proof of the leaf holding txHash
+func (f *FrozenTree) GetProof(txHash common.Hash) (Proof, error) {
+	return f.t.GetProof(txHash)
+}
+
+// GetMultiProof generates a combined proof for the target leaf hashes
+func (f *FrozenTree) GetMultiProof(targets []common.Hash) (*MultiProof, error) {
+	return f.t.GetMultiProof(targets)
+}
+
+// GetExclusionProof proves that hash is not among the leaves of a sorted tree
+func (f *FrozenTree) GetExclusionProof(hash common.Hash) (ExclusionProof, error) {
+	return f.t.GetExclusionProof(hash)
+}
+
+// RequiredHashCount returns the number of sibling hashes needed for the targets
+func (f *FrozenTree) RequiredHashCount(targets []common.Hash) int {
+	return f.t.RequiredHashCount(targets)
+}
+
+// RequiredHashCountForTxs returns the number of sibling hashes needed for the transactions
+func (f *FrozenTree) RequiredHashCountForTxs(targetTxs []*types.Transaction) int {
+	return f.t.RequiredHashCountForTxs(targetTxs)
+}
+
+// RequiredHashes returns the sibling hashes needed for the targets
+func (f *FrozenTree) RequiredHashes(targets []common.Hash) []ProofNode {
+	return f.t.RequiredHashes(targets)
+}
+
+// ProofSizeBytes returns the encoded size of the multiproof for the targets
+func (f *FrozenTree) ProofSizeBytes(targets []common.Hash) int {
+	return f.t.ProofSizeBytes(targets)
+}
+
+// Stats reports the structure of the tree
+func (f *FrozenTree) Stats() TreeStats {
+	return f.t.Stats()
+}
@@ -0,0 +1,87 @@
+package kmerkle
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Generalized indices number the nodes of a tree of arity k breadth-first,
+// as in a k-ary heap: the root is 0 and child c of node g is k*g + 1 + c. A
+// node at depth d below the root with offset o in its level has index
+// (k^d - 1)/(k - 1) + o. Since groups are formed left to right, this also
+// addresses unpadded trees; indices of missing nodes simply do not resolve.
+// Balanced trees move children between the last two groups and are not
+// addressable.
+
+// GIndex returns the generalized index of the node at depth below the root
+// and offset within its level
+func GIndex(k, depth, offset int) uint64 {
+	return levelStart(k, depth) + uint64(offset)
+}
+
+// GIndexPosition returns the depth and offset of a generalized index
+func GIndexPosition(k int, g uint64) (depth, offset int) {
+	start, width := uint64(0), uint64(1)
+	for g >= start+width {
+		start += width
+		width *= uint64(k)
+		depth++
+	}
+	return depth, int(g - start)
+}
+
+// ParentGIndex returns the generalized index of the parent of g, which must not be the root
+func ParentGIndex(k int, g uint64) uint64 {
+	return (g - 1) / uint64(k)
+}
+
+// ChildGIndex returns the generalized index of child c of g
+func ChildGIndex(k int, g uint64, c int) uint64 {
+	return uint64(k)*g + 1 + uint64(c)
+}
+
+// levelStart returns the generalized index of the first node at a depth
+func levelStart(k, depth int) uint64 {
+	start, width := uint64(0), uint64(1)
+	for ; depth > 0; depth-- {
+		start += width
+		width *= uint64(k)
+	}
+	return start
+}
+
+// NodeAt returns the node with the given generalized index, following the
+// base-k digits of its offset from the root
+func (t *Tree) NodeAt(g uint64) (*Node, error) {
+	if t == nil || t.Root == nil {
+		return nil, errors.New("empty tree")
+	}
+	if t.balanced {
+		return nil, errors.New("balanced trees have no generalized indices")
+	}
+	depth, offset := GIndexPosition(t.K, g)
+	node := t.Root
+	for d := depth - 1; d >= 0; d-- {
+		c := offset
+		for i := 0; i < d; i++ {
+			c /= t.K
+		}
+		c %= t.K
+		if node.IsLeaf || c >= len(node.Children) {
+			return nil, fmt.Errorf("no node at generalized index %d", g)
+		}
+		node = node.Children[c]
+	}
+	return node, nil
+}
+
+// LeafGIndex returns the generalized index of the leaf holding hash
+func (t *Tree) LeafGIndex(hash common.Hash) (uint64, bool) {
+	i, ok := t.LeafIndex(hash)
+	if !ok || t.balanced {
+		return 0, false
+	}
+	return GIndex(t.K, t.height(), i), true
+}
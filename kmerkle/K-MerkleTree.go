@@ -1,6 +1,10 @@
 package kmerkle
 
 import (
+	"fmt"
+
+	"mytrees/kmerkle/verifier"
+
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
@@ -16,12 +20,22 @@ type Node struct {
 	TxHash   common.Hash // Transaction hash (only for leaf nodes)
 	Hash     common.Hash // Hash value of this node
 	Parent   *Node       // Reference to parent node
+
+	padding bool // Canonical empty node filling the last group of a level
 }
 
 // Tree represents a K-ary Merkle tree structure
 type Tree struct {
 	Root *Node // Root node of the tree
 	K    int   // Branching factor (arity) of the tree
+
+	leafNodes []*Node             // Leaves in order
+	index     map[common.Hash]int // Leaf position by hash
+	padded    bool                // Last groups are padded to K children
+	balanced  bool                // Last two groups share their children evenly
+	sorted    bool                // Leaves are ordered by hash, see NewSortedFromHashes
+	hasher    verifier.Hasher     // Hash function for all nodes
+	legacy    bool                // No domain separation, see NewLegacyFromHashes
 }
 
 // NewFromTransactions creates a new K-ary Merkle tree from a list of transactions
@@ -36,43 +50,126 @@ func NewFromTransactions(txs []*types.Transaction) *Tree {
 	return NewFromHashes(leafHashes)
 }
 
+// NewFromLeaves creates a K-ary Merkle tree over arbitrary payloads such as
+// receipts, state chunks or cluster bodies. Each payload is digested with the
+// hasher, which also hashes the nodes; proofs and lookups take the digest of
+// a payload in place of a transaction hash. A nil hasher means Keccak256.
+func NewFromLeaves(leaves [][]byte, hasher verifier.Hasher) *Tree {
+	hash := pickHasher([]verifier.Hasher{hasher})
+	leafHashes := make([]common.Hash, len(leaves))
+	for i, leaf := range leaves {
+		leafHashes[i] = hash(leaf)
+	}
+	return build(leafHashes, K, false, false, nodeHasher{hash: hash})
+}
+
 // NewFromHashes creates a new K-ary Merkle tree from a list of leaf hashes
 func NewFromHashes(leafHashes []common.Hash) *Tree {
-	t := &Tree{K: K}
+	return NewFromHashesWithK(leafHashes, K)
+}
+
+// NewFromHashesWithK creates a Merkle tree of arity k from a list of leaf hashes
+func NewFromHashesWithK(leafHashes []common.Hash, k int) *Tree {
+	return build(leafHashes, k, false, false, nodeHasher{hash: crypto.Keccak256Hash})
+}
+
+// NewFromHashesWithHasher creates a Merkle tree of arity k whose interior
+// nodes are hashed with the given hasher instead of Keccak256. Proofs of such
+// a tree must be verified with the same hasher.
+func NewFromHashesWithHasher(leafHashes []common.Hash, k int, hasher verifier.Hasher) *Tree {
+	return build(leafHashes, k, false, false, nodeHasher{hash: pickHasher([]verifier.Hasher{hasher})})
+}
+
+// NewPaddedFromHashes creates a Merkle tree of arity k whose last group at
+// every level is padded to exactly k children with the canonical empty hash of
+// that level. Every interior node then has k children, so a node's position
+// determines its path and all single proofs have k-1 siblings per level.
+// An optional hasher replaces the default Keccak256.
+func NewPaddedFromHashes(leafHashes []common.Hash, k int, hasher ...verifier.Hasher) *Tree {
+	return build(leafHashes, k, true, false, nodeHasher{hash: pickHasher(hasher)})
+}
+
+// EmptyHash returns the canonical empty hash of a level for arity k: the zero
+// hash for leaves, and the hash of k empty children above. An optional hasher
+// replaces the default Keccak256.
+func EmptyHash(k, level int, hasher ...verifier.Hasher) common.Hash {
+	return nodeHasher{hash: pickHasher(hasher)}.empty(k, level)
+}
+
+// pickHasher returns the optional hasher argument, defaulting to Keccak256
+func pickHasher(hashers []verifier.Hasher) verifier.Hasher {
+	if len(hashers) > 0 && hashers[0] != nil {
+		return hashers[0]
+	}
+	return crypto.Keccak256Hash
+}
+
+// build creates a Merkle tree of arity k, optionally padding or balancing the
+// last groups of every level
+func build(leafHashes []common.Hash, k int, padded, balanced bool, h nodeHasher) *Tree {
+	t := &Tree{K: k, padded: padded, balanced: balanced, hasher: h.hash, legacy: h.legacy}
 	if len(leafHashes) == 0 {
 		return t
 	}
 
-	// Create leaf nodes
+	// Create leaf nodes in one backing array and index them by hash
+	arena := make([]Node, len(leafHashes))
 	currentLevel := make([]*Node, len(leafHashes))
+	t.index = make(map[common.Hash]int, len(leafHashes))
 	for i := range leafHashes {
-		currentLevel[i] = &Node{IsLeaf: true, TxHash: leafHashes[i]}
+		arena[i] = Node{IsLeaf: true, TxHash: leafHashes[i]}
+		currentLevel[i] = &arena[i]
+		if _, dup := t.index[leafHashes[i]]; !dup {
+			t.index[leafHashes[i]] = i
+		}
 	}
+	t.leafNodes = currentLevel
 
 	// Build tree levels from bottom up
-	for len(currentLevel) > 1 {
-		var nextLevel []*Node
+	l := verifier.NewLayout(k, len(leafHashes), balanced)
+	empty := common.Hash{}
+	for level := 0; len(currentLevel) > 1; level++ {
+		groups := l.Widths[level+1]
+
+		// Parents of a level share one backing array. Child slices are
+		// windows of the level itself, or with padding of one slab of K
+		// slots per group, so large arities do not allocate a Children
+		// slice per node.
+		parents := make([]Node, groups)
+		slab := currentLevel
+		var pads []Node
+		if padded {
+			slab = make([]*Node, groups*t.K)
+			copy(slab, currentLevel)
+			pads = make([]Node, groups*t.K-len(currentLevel))
+		}
+		nextLevel := make([]*Node, groups)
 
 		// Group nodes into parent nodes with up to K children
-		for i := 0; i < len(currentLevel); i += t.K {
-			end := i + t.K
-			if end > len(currentLevel) {
-				end = len(currentLevel)
+		for g := range parents {
+			first, end := l.Children(level+1, g)
+			for padded && end-first < t.K {
+				pad := &pads[end-len(currentLevel)]
+				*pad = Node{IsLeaf: level == 0, Hash: empty, padding: true}
+				slab[end] = pad
+				end++
 			}
 
 			// Create parent node for this group of children
-			children := currentLevel[i:end]
-			parent := &Node{Children: make([]*Node, len(children))}
-			copy(parent.Children, children)
+			parent := &parents[g]
+			parent.Children = slab[first:end:end]
 
 			// Set parent reference for all children
-			for _, child := range children {
+			for _, child := range parent.Children {
 				child.Parent = parent
 			}
 
-			nextLevel = append(nextLevel, parent)
+			nextLevel[g] = parent
 		}
 		currentLevel = nextLevel
+		if padded {
+			empty = h.empty(t.K, level+1)
+		}
 	}
 
 	// Set the root node
@@ -88,49 +185,100 @@ func (t *Tree) ComputeHashes() {
 	if t == nil || t.Root == nil {
 		return
 	}
-	computeHashesPostOrder(t.Root)
+	computeHashesPostOrder(t.Root, t.nodeHasher())
 }
 
 // computeHashesPostOrder recursively computes node hashes using a post-order traversal
-func computeHashesPostOrder(node *Node) common.Hash {
+func computeHashesPostOrder(node *Node, h nodeHasher) common.Hash {
 	if node == nil {
 		return common.Hash{}
 	}
 
-	// Leaf node: hash is the transaction hash itself
+	// Padding node: hash is the canonical empty hash of its level
+	if node.padding {
+		return node.Hash
+	}
+
+	// Leaf node: hash of the transaction hash
 	if node.IsLeaf {
-		node.Hash = node.TxHash
+		node.Hash = h.leaf(node.TxHash)
 		return node.Hash
 	}
 
-	// Internal node: concatenate child hashes and hash the result
-	buf := make([]byte, 0, len(node.Children)*common.HashLength)
+	// Internal node: hash the children first, then hash their concatenated
+	// hashes in a pooled buffer
 	for _, child := range node.Children {
-		childHash := computeHashesPostOrder(child)
-		buf = append(buf, childHash.Bytes()...)
+		computeHashesPostOrder(child, h)
 	}
-	node.Hash = crypto.Keccak256Hash(buf)
+	node.Hash = h.interior(node.Children, nil)
 	return node.Hash
 }
 
-// RequiredHashCount calculates the number of additional hashes needed to verify the given target hashes
+// UpdateLeaf replaces the hash of the leaf at the given index and recomputes
+// only the hashes on its path to the root. The tree is modified in place, so
+// it must not run concurrently with readers. Leaves are no longer known to be
+// sorted afterwards, so a tree from NewSortedFromHashes stops giving exclusion
+// proofs.
+func (t *Tree) UpdateLeaf(index int, newHash common.Hash) error {
+	if t == nil || index < 0 || index >= len(t.leafNodes) {
+		return fmt.Errorf("leaf index %d out of range [0, %d)", index, len(t.leaves()))
+	}
+	leaf := t.leafNodes[index]
+	old := leaf.TxHash
+	h := t.nodeHasher()
+	leaf.TxHash, leaf.Hash = newHash, h.leaf(newHash)
+
+	// Keep the index pointing at the first leaf holding each hash
+	if i, ok := t.index[old]; ok && i == index {
+		delete(t.index, old)
+		for j := index + 1; j < len(t.leafNodes); j++ {
+			if t.leafNodes[j].TxHash == old {
+				t.index[old] = j
+				break
+			}
+		}
+	}
+	if i, ok := t.index[newHash]; !ok || i > index {
+		t.index[newHash] = index
+	}
+	t.sorted = false
+
+	for node := leaf.Parent; node != nil; node = node.Parent {
+		node.Hash = h.interior(node.Children, nil)
+	}
+	return nil
+}
+
+// RequiredHashCount calculates the number of additional hashes needed to verify the given target hashes.
+// Targets are located through the leaf index and only their paths to the root are visited.
 func (t *Tree) RequiredHashCount(targets []common.Hash) int {
 	if t == nil || t.Root == nil || len(targets) == 0 {
 		return 0
 	}
 
-	// Convert target hashes to a set for efficient lookup
-	set := make(map[common.Hash]struct{}, len(targets))
+	// Mark every node on a path from a target to the root
+	onPath := make(map[*Node]bool)
+	var parents []*Node
 	for _, h := range targets {
-		set[h] = struct{}{}
+		leaf := t.Leaf(h)
+		for node := leaf; node != nil && !onPath[node]; node = node.Parent {
+			onPath[node] = true
+			if !node.IsLeaf {
+				parents = append(parents, node)
+			}
+		}
 	}
 
-	// Calculate required hashes
-	flag, needs := calculateRequiredHashes(t.Root, set)
-	if flag {
-		return needs
+	// Every child off the marked paths must be supplied by the proof
+	needs := 0
+	for _, parent := range parents {
+		for _, child := range parent.Children {
+			if child != nil && !onPath[child] {
+				needs++
+			}
+		}
 	}
-	return 0
+	return needs
 }
 
 // RequiredHashCountForTxs calculates required hashes for a list of target transactions
@@ -144,42 +292,22 @@ func (t *Tree) RequiredHashCountForTxs(targetTxs []*types.Transaction) int {
 	return t.RequiredHashCount(targets)
 }
 
-// calculateRequiredHashes recursively determines which hashes are needed to verify target hashes
-func calculateRequiredHashes(node *Node, targets map[common.Hash]struct{}) (bool, int) {
-	if node == nil {
-		return false, 0
+// Leaf returns the leaf holding the given hash, or nil
+func (t *Tree) Leaf(hash common.Hash) *Node {
+	if t == nil {
+		return nil
 	}
-
-	// Leaf node: check if it's one of our targets
-	if node.IsLeaf {
-		_, present := targets[node.TxHash]
-		if present {
-			return true, 0
-		}
-		return false, 0
-	}
-
-	// Internal node: check all children
-	allFalseCount := 0   // Count of children that don't contain any targets
-	totalNeedSum := 0    // Sum of hashes needed by children that do contain targets
-	anyTrueFlag := false // Flag if any child contains targets
-
-	for _, child := range node.Children {
-		if child == nil {
-			continue
-		}
-		flag, need := calculateRequiredHashes(child, targets)
-		if flag {
-			anyTrueFlag = true
-			totalNeedSum += need
-		} else {
-			allFalseCount++
-		}
+	if i, ok := t.index[hash]; ok {
+		return t.leafNodes[i]
 	}
+	return nil
+}
 
-	// If any child contains targets, we need to include hashes of non-target children
-	if anyTrueFlag {
-		return true, totalNeedSum + allFalseCount
+// LeafIndex returns the position of the leaf holding the given hash
+func (t *Tree) LeafIndex(hash common.Hash) (int, bool) {
+	if t == nil {
+		return 0, false
 	}
-	return false, 0
+	i, ok := t.index[hash]
+	return i, ok
 }
@@ -0,0 +1,122 @@
+package kmerkle
+
+import (
+	"fmt"
+	"sort"
+
+	"mytrees/kmerkle/verifier"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ProofNode is a sibling hash together with its position, see verifier.ProofNode
+type ProofNode = verifier.ProofNode
+
+// MultiProof proves a set of leaves with the sibling hashes counted by
+// RequiredHashCount, see verifier.MultiProof
+type MultiProof = verifier.MultiProof
+
+// GetMultiProof generates a combined proof for the target leaf hashes. Every
+// target must be a leaf of the tree.
+func (t *Tree) GetMultiProof(targets []common.Hash) (*MultiProof, error) {
+	leaves := t.leaves()
+	set := make(map[*Node]struct{}, len(targets))
+	proof := &MultiProof{K: t.K, Padded: t.padded, Balanced: t.balanced, LeafCount: len(leaves)}
+	for _, h := range targets {
+		index, ok := t.LeafIndex(h)
+		if !ok {
+			return nil, fmt.Errorf("hash %s not in tree", h.Hex())
+		}
+		if _, dup := set[leaves[index]]; !dup {
+			set[leaves[index]] = struct{}{}
+			proof.Indices = append(proof.Indices, index)
+		}
+	}
+	sort.Ints(proof.Indices)
+	for _, index := range proof.Indices {
+		proof.Leaves = append(proof.Leaves, leaves[index].TxHash)
+	}
+
+	proof.Nodes = t.requiredNodes(set)
+	return proof, nil
+}
+
+// RequiredHashes returns the sibling hashes counted by RequiredHashCount, with
+// their positions, ordered by level, parent and child index. Targets not in
+// the tree are ignored, as in the counting API.
+func (t *Tree) RequiredHashes(targets []common.Hash) []ProofNode {
+	set := make(map[*Node]struct{}, len(targets))
+	for _, h := range targets {
+		if leaf := t.Leaf(h); leaf != nil {
+			set[leaf] = struct{}{}
+		}
+	}
+	return t.requiredNodes(set)
+}
+
+// requiredNodes collects and orders the sibling hashes needed for the target
+// leaves. Targets are leaf nodes rather than hashes, so a leaf repeating a
+// target's hash further along is not proven with it, matching LeafIndex.
+func (t *Tree) requiredNodes(targets map[*Node]struct{}) []ProofNode {
+	if t == nil || len(targets) == 0 {
+		return nil
+	}
+	proof := &MultiProof{}
+	collectProofNodes(t.Root, t.layout(), t.height(), 0, targets, proof)
+	sort.Slice(proof.Nodes, func(i, j int) bool {
+		a, b := proof.Nodes[i], proof.Nodes[j]
+		if a.Level != b.Level {
+			return a.Level < b.Level
+		}
+		if a.ParentIndex != b.ParentIndex {
+			return a.ParentIndex < b.ParentIndex
+		}
+		return a.ChildIndex < b.ChildIndex
+	})
+	return proof.Nodes
+}
+
+// collectProofNodes appends the hashes of target-free children of nodes with
+// targets below them, and reports whether node at (level, index) holds a target
+func collectProofNodes(node *Node, l verifier.Layout, level, index int, targets map[*Node]struct{}, proof *MultiProof) bool {
+	if node == nil {
+		return false
+	}
+	if node.IsLeaf {
+		_, present := targets[node]
+		return present
+	}
+
+	first, _ := l.Children(level, index)
+	found := make([]bool, len(node.Children))
+	anyFound := false
+	for c, child := range node.Children {
+		found[c] = collectProofNodes(child, l, level-1, first+c, targets, proof)
+		anyFound = anyFound || found[c]
+	}
+	if anyFound {
+		for c, child := range node.Children {
+			if child != nil && !found[c] {
+				proof.Nodes = append(proof.Nodes, ProofNode{Level: level - 1, ParentIndex: index, ChildIndex: c, Hash: child.Hash})
+			}
+		}
+	}
+	return anyFound
+}
+
+// leaves returns the leaf nodes in order
+func (t *Tree) leaves() []*Node {
+	if t == nil {
+		return nil
+	}
+	return t.leafNodes
+}
+
+// height returns the number of levels above the leaves
+func (t *Tree) height() int {
+	height := 0
+	for node := t.Root; node != nil && !node.IsLeaf; node = node.Children[0] {
+		height++
+	}
+	return height
+}
@@ -0,0 +1,105 @@
+package kmerkle
+
+import (
+	"encoding/binary"
+	"math/rand"
+
+	"mytrees/kmerkle/verifier"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// KEvaluation is the expected cost of verification requests for one arity
+type KEvaluation struct {
+	K              int     // Arity evaluated
+	ProofBytes     float64 // Mean encoded multiproof size per request
+	VerifierHashes float64 // Mean hash invocations to recompute the root per request
+}
+
+// OptimalK evaluates every candidate arity on a tree of txCount leaves. Each
+// entry of requestSizes is one verification request, e.g. a cluster, proving
+// that many leaves drawn at random, as cluster members are scattered over the
+// block. It returns the arity with the smallest mean proof size, fewer
+// verifier hashes breaking ties, and the evaluation of every candidate.
+func OptimalK(txCount int, requestSizes []int, candidates []int) (int, []KEvaluation) {
+	hashes := make([]common.Hash, txCount)
+	for i := range hashes {
+		var index [8]byte
+		binary.BigEndian.PutUint64(index[:], uint64(i))
+		hashes[i] = crypto.Keccak256Hash(index[:])
+	}
+
+	// Draw the requests once so every arity is measured on the same targets
+	rng := rand.New(rand.NewSource(1))
+	requests := make([][]common.Hash, 0, len(requestSizes))
+	for _, size := range requestSizes {
+		if size > txCount {
+			size = txCount
+		}
+		if size <= 0 {
+			continue
+		}
+		targets := make([]common.Hash, size)
+		for i, index := range rng.Perm(txCount)[:size] {
+			targets[i] = hashes[index]
+		}
+		requests = append(requests, targets)
+	}
+
+	best := 0
+	evaluations := make([]KEvaluation, 0, len(candidates))
+	for _, k := range candidates {
+		if k < 2 {
+			continue
+		}
+		tree := NewFromHashesWithK(hashes, k)
+		eval := KEvaluation{K: k}
+		for _, targets := range requests {
+			proof, err := tree.GetMultiProof(targets)
+			if err != nil {
+				continue
+			}
+			encoded, _ := proof.MarshalBinary()
+			eval.ProofBytes += float64(len(encoded))
+			eval.VerifierHashes += float64(verifierHashes(proof))
+		}
+		if len(requests) > 0 {
+			eval.ProofBytes /= float64(len(requests))
+			eval.VerifierHashes /= float64(len(requests))
+		}
+		evaluations = append(evaluations, eval)
+
+		if len(evaluations) == 1 {
+			continue
+		}
+		current := evaluations[best]
+		if eval.ProofBytes < current.ProofBytes || (eval.ProofBytes == current.ProofBytes && eval.VerifierHashes < current.VerifierHashes) {
+			best = len(evaluations) - 1
+		}
+	}
+	if len(evaluations) == 0 {
+		return 0, nil
+	}
+	return evaluations[best].K, evaluations
+}
+
+// verifierHashes counts the nodes a verifier recomputes for the proof: every
+// proven leaf, and every distinct ancestor of a proven leaf, each hashed once
+func verifierHashes(proof *MultiProof) int {
+	count := len(proof.Indices)
+	level := make(map[int]bool, len(proof.Indices))
+	for _, index := range proof.Indices {
+		level[index] = true
+	}
+	l := verifier.NewLayout(proof.K, proof.LeafCount, proof.Balanced)
+	for depth := 0; depth+1 < len(l.Widths); depth++ {
+		parents := make(map[int]bool, len(level))
+		for index := range level {
+			parents[l.Parent(depth, index)] = true
+		}
+		count += len(parents)
+		level = parents
+	}
+	return count
+}
@@ -0,0 +1,41 @@
+package kmerkle
+
+import (
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// hashBuffer holds a node preimage, and the argument list passed to the
+// hasher so a call does not allocate its variadic slice
+type hashBuffer struct {
+	buf  []byte
+	args [1][]byte
+}
+
+// hashBufferPool shares hash buffers, so repeated builds and rehashes do not
+// allocate one per node
+var hashBufferPool = sync.Pool{
+	New: func() interface{} {
+		return &hashBuffer{buf: make([]byte, 0, 1+K*common.HashLength)}
+	},
+}
+
+// getHashBuffer returns an empty pooled buffer with room for n bytes
+func getHashBuffer(n int) *hashBuffer {
+	b := hashBufferPool.Get().(*hashBuffer)
+	if cap(b.buf) < n {
+		b.buf = make([]byte, 0, n)
+	}
+	b.buf = b.buf[:0]
+	return b
+}
+
+// sum hashes the buffer and returns it to the pool
+func (b *hashBuffer) sum(h nodeHasher) common.Hash {
+	b.args[0] = b.buf
+	hash := h.hash(b.args[:]...)
+	b.args[0] = nil
+	hashBufferPool.Put(b)
+	return hash
+}
@@ -0,0 +1,27 @@
+package kmerkle
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ProofSizeBytes returns the encoded size of the multiproof for the targets.
+// Each level touched by a target costs up to K-1 sibling hashes plus their
+// positions, so larger K trades fewer levels for more siblings per level.
+// Targets not in the tree are ignored, as in RequiredHashCount.
+func (t *Tree) ProofSizeBytes(targets []common.Hash) int {
+	present := make([]common.Hash, 0, len(targets))
+	for _, h := range targets {
+		if _, ok := t.LeafIndex(h); ok {
+			present = append(present, h)
+		}
+	}
+	if len(present) == 0 {
+		return 0
+	}
+	proof, err := t.GetMultiProof(present)
+	if err != nil {
+		return 0
+	}
+	encoded, _ := proof.MarshalBinary()
+	return len(encoded)
+}
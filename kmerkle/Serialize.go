@@ -0,0 +1,180 @@
+package kmerkle
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"mytrees/kmerkle/verifier"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// serializeVersion is the leading byte of a serialized tree
+const serializeVersion byte = 1
+
+// Flags of a serialized tree
+const (
+	flagInterior byte = 1 << iota // Interior hashes follow the leaf hashes
+	flagPadded                    // Last groups are padded to K children
+	flagSorted                    // Leaves are ordered by hash
+	flagBalanced                  // Last two groups share their children evenly
+	flagLegacy                    // Nodes are hashed without domain separation
+)
+
+// Serialize writes the arity and leaf hashes of the tree, and optionally all
+// interior hashes so Deserialize can restore the tree without hashing.
+//
+// Format: version byte, flags byte, uvarint K, uvarint leaf count, leaf
+// hashes, then (if flagInterior) the hashes of every level above the leaves,
+// left to right. Padding nodes are canonical and never written.
+func (t *Tree) Serialize(w io.Writer, withInterior bool) error {
+	bw := bufio.NewWriter(w)
+	var flags byte
+	if withInterior {
+		flags |= flagInterior
+	}
+	if t.padded {
+		flags |= flagPadded
+	}
+	if t.sorted {
+		flags |= flagSorted
+	}
+	if t.balanced {
+		flags |= flagBalanced
+	}
+	if t.legacy {
+		flags |= flagLegacy
+	}
+	header := []byte{serializeVersion, flags}
+	header = binary.AppendUvarint(header, uint64(t.K))
+	header = binary.AppendUvarint(header, uint64(len(t.leafNodes)))
+	if _, err := bw.Write(header); err != nil {
+		return err
+	}
+	for _, leaf := range t.leafNodes {
+		if _, err := bw.Write(leaf.TxHash.Bytes()); err != nil {
+			return err
+		}
+	}
+	if withInterior {
+		for level := t.leafNodes; len(level) > 1; {
+			var next []*Node
+			for _, node := range level {
+				if len(next) > 0 && next[len(next)-1] == node.Parent {
+					continue
+				}
+				if _, err := bw.Write(node.Parent.Hash.Bytes()); err != nil {
+					return err
+				}
+				next = append(next, node.Parent)
+			}
+			level = next
+		}
+	}
+	return bw.Flush()
+}
+
+// Deserialize restores a tree written by Serialize. The hash function is not
+// part of the encoding; an optional hasher replaces the default Keccak256.
+func Deserialize(r io.Reader, hasher ...verifier.Hasher) (*Tree, error) {
+	br := bufio.NewReader(r)
+	var header [2]byte
+	if _, err := io.ReadFull(br, header[:]); err != nil {
+		return nil, err
+	}
+	if header[0] != serializeVersion {
+		return nil, fmt.Errorf("unsupported tree version %d", header[0])
+	}
+	k, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+	count, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+	if k < 2 || k > 1<<16 || count > 1<<32 {
+		return nil, fmt.Errorf("invalid tree shape: arity %d, %d leaves", k, count)
+	}
+	padded := header[1]&flagPadded != 0
+	balanced := header[1]&flagBalanced != 0
+	h := nodeHasher{hash: pickHasher(hasher), legacy: header[1]&flagLegacy != 0}
+	if padded && balanced {
+		return nil, errors.New("tree cannot be both padded and balanced")
+	}
+
+	leaves, err := readHashes(br, int(count))
+	if err != nil {
+		return nil, err
+	}
+	var t *Tree
+	if header[1]&flagInterior == 0 {
+		t = build(leaves, int(k), padded, balanced, h)
+	} else {
+		if t, err = link(br, leaves, int(k), padded, balanced, h); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := br.ReadByte(); err != io.EOF {
+		return nil, errors.New("trailing data after serialized tree")
+	}
+	t.sorted = header[1]&flagSorted != 0
+	return t, nil
+}
+
+// readHashes reads count consecutive hashes. The slice grows as hashes arrive,
+// so a forged count fails on the short input instead of allocating up front.
+func readHashes(r io.Reader, count int) ([]common.Hash, error) {
+	var hashes []common.Hash
+	for i := 0; i < count; i++ {
+		var hash common.Hash
+		if _, err := io.ReadFull(r, hash[:]); err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, hash)
+	}
+	return hashes, nil
+}
+
+// link rebuilds the node structure over the leaves, reading interior hashes
+// level by level instead of computing them
+func link(r io.Reader, leafHashes []common.Hash, k int, padded, balanced bool, h nodeHasher) (*Tree, error) {
+	t := &Tree{K: k, padded: padded, balanced: balanced, hasher: h.hash, legacy: h.legacy, index: make(map[common.Hash]int, len(leafHashes))}
+	if len(leafHashes) == 0 {
+		return t, nil
+	}
+	level := make([]*Node, len(leafHashes))
+	for i, hash := range leafHashes {
+		level[i] = &Node{IsLeaf: true, TxHash: hash, Hash: h.leaf(hash)}
+		if _, dup := t.index[hash]; !dup {
+			t.index[hash] = i
+		}
+	}
+	t.leafNodes = level
+
+	l := verifier.NewLayout(k, len(leafHashes), balanced)
+	for depth := 0; len(level) > 1; depth++ {
+		hashes, err := readHashes(r, l.Widths[depth+1])
+		if err != nil {
+			return nil, err
+		}
+		next := make([]*Node, len(hashes))
+		for i, hash := range hashes {
+			first, end := l.Children(depth+1, i)
+			parent := &Node{Hash: hash, Children: append([]*Node{}, level[first:end]...)}
+			for padded && len(parent.Children) < k {
+				parent.Children = append(parent.Children, &Node{IsLeaf: depth == 0, Hash: h.empty(k, depth), padding: true})
+			}
+			for _, child := range parent.Children {
+				child.Parent = parent
+			}
+			next[i] = parent
+		}
+		level = next
+	}
+	t.Root = level[0]
+	return t, nil
+}
@@ -0,0 +1,63 @@
+package kmerkle
+
+import (
+	"unsafe"
+)
+
+// TreeStats describes the shape of a tree
+type TreeStats struct {
+	Height        int       // Number of levels above the leaves
+	NodesPerLevel []int     // Nodes per level, leaves first, padding excluded
+	LastGroupFill []float64 // Per level above the leaves: real children of its last node divided by K
+	MemoryBytes   int       // Estimated memory of nodes and child slices, padding included
+}
+
+// Stats walks the tree level by level and reports its structure
+func (t *Tree) Stats() TreeStats {
+	var stats TreeStats
+	if t == nil || t.Root == nil {
+		return stats
+	}
+	nodeSize := int(unsafe.Sizeof(Node{}))
+	pointerSize := int(unsafe.Sizeof(&Node{}))
+
+	// Walk from the root down, recording levels in reverse
+	var perLevel []int
+	var fill []float64
+	for level := []*Node{t.Root}; len(level) > 0; {
+		perLevel = append(perLevel, len(level))
+		var next []*Node
+		for _, node := range level {
+			stats.MemoryBytes += nodeSize + cap(node.Children)*pointerSize
+			for _, child := range node.Children {
+				if child.padding {
+					stats.MemoryBytes += nodeSize
+					continue
+				}
+				next = append(next, child)
+			}
+		}
+		if len(next) > 0 {
+			last := level[len(level)-1]
+			filled := 0
+			for _, child := range last.Children {
+				if !child.padding {
+					filled++
+				}
+			}
+			fill = append(fill, float64(filled)/float64(t.K))
+		}
+		level = next
+	}
+
+	stats.Height = len(perLevel) - 1
+	stats.NodesPerLevel = make([]int, len(perLevel))
+	for i, n := range perLevel {
+		stats.NodesPerLevel[len(perLevel)-1-i] = n
+	}
+	stats.LastGroupFill = make([]float64, len(fill))
+	for i, f := range fill {
+		stats.LastGroupFill[len(fill)-1-i] = f
+	}
+	return stats
+}
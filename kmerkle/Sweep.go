@@ -0,0 +1,63 @@
+package kmerkle
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// SweepRow holds the measurements of one arity in an arity sweep
+type SweepRow struct {
+	K              int           // Arity measured
+	BuildTime      time.Duration // Time to build the tree from the transaction hashes
+	Height         int           // Number of levels above the leaves
+	RequiredHashes int           // Sibling hashes needed to verify the targets
+	RequiredBytes  int           // Bytes of those sibling hashes
+	ProofBytes     int           // Encoded multiproof size, see ProofSizeBytes
+}
+
+// SweepTable is the result of an arity sweep, one row per arity
+type SweepTable []SweepRow
+
+// SweepArity builds a tree over the same transactions for every arity in ks
+// and measures the cost of proving the same targets in each. Arities below 2
+// are skipped; targets not in the set are ignored, as in RequiredHashCount.
+func SweepArity(txs []*types.Transaction, targets []*types.Transaction, ks []int) SweepTable {
+	hashes := make([]common.Hash, len(txs))
+	for i, tx := range txs {
+		hashes[i] = tx.Hash()
+	}
+	targetHashes := make([]common.Hash, len(targets))
+	for i, tx := range targets {
+		targetHashes[i] = tx.Hash()
+	}
+
+	table := make(SweepTable, 0, len(ks))
+	for _, k := range ks {
+		if k < 2 {
+			continue
+		}
+		start := time.Now()
+		tree := NewFromHashesWithK(hashes, k)
+		row := SweepRow{K: k, BuildTime: time.Since(start), Height: tree.height()}
+		row.RequiredHashes = tree.RequiredHashCount(targetHashes)
+		row.RequiredBytes = row.RequiredHashes * common.HashLength
+		row.ProofBytes = tree.ProofSizeBytes(targetHashes)
+		table = append(table, row)
+	}
+	return table
+}
+
+// String formats the table with one line per arity
+func (t SweepTable) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%4s %12s %6s %8s %10s %10s\n", "K", "build", "height", "hashes", "hashBytes", "proofBytes")
+	for _, row := range t {
+		fmt.Fprintf(&b, "%4d %12s %6d %8d %10d %10d\n",
+			row.K, row.BuildTime, row.Height, row.RequiredHashes, row.RequiredBytes, row.ProofBytes)
+	}
+	return b.String()
+}
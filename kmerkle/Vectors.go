@@ -0,0 +1,108 @@
+package kmerkle
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Layouts covered by the test vectors
+const (
+	LayoutDefault  = "default"  // Last group of a level keeps the remainder, see NewFromHashesWithK
+	LayoutPadded   = "padded"   // Last groups padded with empty nodes, see NewPaddedFromHashes
+	LayoutBalanced = "balanced" // Last two groups split evenly, see NewBalancedFromHashes
+)
+
+// VectorProof is the expected single proof of one leaf
+type VectorProof struct {
+	Index int         `json:"index"`
+	Leaf  common.Hash `json:"leaf"`
+	Proof Proof       `json:"proof"`
+}
+
+// TestVector is one tree with its expected root and proofs, for validating
+// independent implementations of the K-ary tree
+type TestVector struct {
+	Name       string        `json:"name"`
+	K          int           `json:"k"`
+	Layout     string        `json:"layout"`
+	Leaves     []common.Hash `json:"leaves"`
+	Root       common.Hash   `json:"root"`
+	Proofs     []VectorProof `json:"proofs"`
+	MultiProof *MultiProof   `json:"multiProof,omitempty"`
+}
+
+// VectorLeaves returns the deterministic leaves of the test vectors: leaf i
+// is Keccak256 of i as an 8-byte big-endian integer
+func VectorLeaves(n int) []common.Hash {
+	leaves := make([]common.Hash, n)
+	for i := range leaves {
+		var index [8]byte
+		binary.BigEndian.PutUint64(index[:], uint64(i))
+		leaves[i] = crypto.Keccak256Hash(index[:])
+	}
+	return leaves
+}
+
+// GenerateTestVectors builds a tree for every combination of leaf count,
+// arity and layout, hashed with Keccak256 and domain separation, and records
+// its root, the single proofs of the first, middle and last leaf, and the
+// multiproof of the first and last leaf. The output only depends on the
+// arguments.
+func GenerateTestVectors(sizes, ks []int) []TestVector {
+	var vectors []TestVector
+	for _, n := range sizes {
+		leaves := VectorLeaves(n)
+		for _, k := range ks {
+			if n == 0 || k < 2 {
+				continue
+			}
+			trees := []struct {
+				layout string
+				tree   *Tree
+			}{
+				{LayoutDefault, NewFromHashesWithK(leaves, k)},
+				{LayoutPadded, NewPaddedFromHashes(leaves, k)},
+				{LayoutBalanced, NewBalancedFromHashes(leaves, k)},
+			}
+			for _, entry := range trees {
+				vector := TestVector{
+					Name:   fmt.Sprintf("%s-k%d-n%d", entry.layout, k, n),
+					K:      k,
+					Layout: entry.layout,
+					Leaves: leaves,
+					Root:   entry.tree.Root.Hash,
+				}
+				for _, i := range uniqueInts(0, n/2, n-1) {
+					proof, _ := entry.tree.GetProof(leaves[i])
+					vector.Proofs = append(vector.Proofs, VectorProof{Index: i, Leaf: leaves[i], Proof: proof})
+				}
+				vector.MultiProof, _ = entry.tree.GetMultiProof([]common.Hash{leaves[0], leaves[n-1]})
+				vectors = append(vectors, vector)
+			}
+		}
+	}
+	return vectors
+}
+
+// WriteTestVectors writes the vectors of GenerateTestVectors as indented JSON
+func WriteTestVectors(w io.Writer, sizes, ks []int) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(GenerateTestVectors(sizes, ks))
+}
+
+// uniqueInts returns the values in order without repeats
+func uniqueInts(values ...int) []int {
+	var out []int
+	for _, v := range values {
+		if len(out) == 0 || out[len(out)-1] != v {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,82 @@
+package kmerkle
+
+import (
+	"fmt"
+
+	"mytrees/kmerkle/verifier"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ProofLevel holds the siblings of a node on one level of a proof, see verifier.ProofLevel
+type ProofLevel = verifier.ProofLevel
+
+// Proof is a K-ary Merkle proof for a single leaf, see verifier.Proof
+type Proof = verifier.Proof
+
+// GetProof generates the proof of the leaf holding txHash: for every level
+// the leaf's child index and the hashes of the other children of its parent.
+// In the default layout, where children are grouped K at a time in order, the
+// child indices from the leaf up are the base-K digits of the leaf position;
+// balanced trees split their last groups evenly, so theirs are not.
+func (t *Tree) GetProof(txHash common.Hash) (Proof, error) {
+	node := t.Leaf(txHash)
+	if node == nil {
+		return Proof{}, fmt.Errorf("hash %s not in tree", txHash.Hex())
+	}
+
+	proof := Proof{K: t.K}
+	for ; node.Parent != nil; node = node.Parent {
+		level := ProofLevel{}
+		for c, child := range node.Parent.Children {
+			if child == node {
+				level.Position = c
+				continue
+			}
+			level.Siblings = append(level.Siblings, child.Hash)
+		}
+		proof.Levels = append(proof.Levels, level)
+	}
+	return proof, nil
+}
+
+// VerifyProof checks a single proof for a leaf hash against a root, see
+// verifier.VerifyProof. An optional hasher replaces the default Keccak256.
+func VerifyProof(root common.Hash, leaf common.Hash, proof Proof, hasher ...verifier.Hasher) bool {
+	return verifier.VerifyProof(root, leaf, proof, pickHasher(hasher))
+}
+
+// VerifyLegacyProof checks a single proof of a tree built by
+// NewLegacyFromHashes, see verifier.VerifyLegacyProof
+func VerifyLegacyProof(root common.Hash, leaf common.Hash, proof Proof, hasher ...verifier.Hasher) bool {
+	return verifier.VerifyLegacyProof(root, leaf, proof, pickHasher(hasher))
+}
+
+// VerifyMultiProof checks that every target is proven by the multiproof and
+// that the proof reproduces the root, see verifier.VerifyMultiProof. An
+// optional hasher replaces the default Keccak256.
+func VerifyMultiProof(root common.Hash, targets []common.Hash, proof *MultiProof, hasher ...verifier.Hasher) bool {
+	return verifier.VerifyMultiProof(root, targets, proof, pickHasher(hasher))
+}
+
+// VerifyLegacyMultiProof checks a multiproof of a tree built by
+// NewLegacyFromHashes, see verifier.VerifyLegacyMultiProof
+func VerifyLegacyMultiProof(root common.Hash, targets []common.Hash, proof *MultiProof, hasher ...verifier.Hasher) bool {
+	return verifier.VerifyLegacyMultiProof(root, targets, proof, pickHasher(hasher))
+}
+
+// BatchItem is one leaf with its single proof, see verifier.BatchItem
+type BatchItem = verifier.BatchItem
+
+// VerifyBatch checks many single proofs against one root, hashing nodes
+// shared by their paths once, see verifier.VerifyBatch. An optional hasher
+// replaces the default Keccak256.
+func VerifyBatch(root common.Hash, items []BatchItem, hasher ...verifier.Hasher) verifier.BatchResult {
+	return verifier.VerifyBatch(root, items, pickHasher(hasher))
+}
+
+// VerifyLegacyBatch checks many single proofs of a tree built by
+// NewLegacyFromHashes, see verifier.VerifyLegacyBatch
+func VerifyLegacyBatch(root common.Hash, items []BatchItem, hasher ...verifier.Hasher) verifier.BatchResult {
+	return verifier.VerifyLegacyBatch(root, items, pickHasher(hasher))
+}
@@ -1,23 +1,50 @@
 package kmerkle
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
+	"math"
 	"math/big"
 	_ "math/big"
 	"math/rand"
+	"strings"
 	"testing"
 	"time"
 
+	"mytrees/kmerkle/verifier"
+
 	_ "github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	_ "github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/params"
+	"lukechampine.com/blake3"
 )
 
 // testKey is a pre-generated private key for signing
 var testKey, _ = crypto.GenerateKey()
 
+// sha256Hasher hashes with SHA-256
+func sha256Hasher(data ...[]byte) common.Hash {
+	h := sha256.New()
+	for _, b := range data {
+		h.Write(b)
+	}
+	return common.BytesToHash(h.Sum(nil))
+}
+
+// blake3Hasher hashes with BLAKE3 using a 32-byte output
+func blake3Hasher(data ...[]byte) common.Hash {
+	h := blake3.New(common.HashLength, nil)
+	for _, b := range data {
+		h.Write(b)
+	}
+	return common.BytesToHash(h.Sum(nil))
+}
+
 // newTestTx creates a dummy signed transaction
 func newTestTx(signer types.Signer, nonce uint64, amount int64) *types.Transaction {
 	// Generate a random 20-byte address
@@ -138,3 +165,933 @@ func TestKmerkleTree_MultipleClusters(t *testing.T) {
 		})
 	}
 }
+
+// TestGetMultiProof_MatchesRequiredHashCount checks proof sizes and positions against RequiredHashCount
+func TestGetMultiProof_MatchesRequiredHashCount(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	hashes := make([]common.Hash, 300)
+	for i := range hashes {
+		hashes[i] = newTestTx(signer, uint64(i), 100).Hash()
+	}
+	tree := NewFromHashes(hashes)
+
+	for _, targets := range [][]common.Hash{
+		{hashes[0]},
+		{hashes[5], hashes[6], hashes[17]},
+		{hashes[299], hashes[100], hashes[0]},
+	} {
+		proof, err := tree.GetMultiProof(targets)
+		if err != nil {
+			t.Fatalf("Failed to get multiproof: %v", err)
+		}
+		if len(proof.Nodes) != tree.RequiredHashCount(targets) {
+			t.Errorf("Error: Multiproof has %d nodes, RequiredHashCount is %d", len(proof.Nodes), tree.RequiredHashCount(targets))
+		}
+		for _, n := range proof.Nodes {
+			if n.Level == 0 && tree.nodeHasher().leaf(hashes[n.ParentIndex*K+n.ChildIndex]) != n.Hash {
+				t.Errorf("Error: Leaf sibling at (%d,%d) has the wrong hash", n.ParentIndex, n.ChildIndex)
+			}
+		}
+	}
+	if _, err := tree.GetMultiProof([]common.Hash{{}}); err == nil {
+		t.Errorf("Error: Expected an error for a hash not in the tree")
+	}
+
+	// A later leaf repeating a target's hash is not proven with it
+	dups := append([]common.Hash(nil), hashes[:40]...)
+	dups[35] = dups[2]
+	dupTree := NewFromHashesWithK(dups, 4)
+	targets := []common.Hash{dups[2]}
+	proof, err := dupTree.GetMultiProof(targets)
+	if err != nil {
+		t.Fatalf("Failed to get multiproof: %v", err)
+	}
+	if len(proof.Nodes) != dupTree.RequiredHashCount(targets) || len(dupTree.RequiredHashes(targets)) != len(proof.Nodes) {
+		t.Errorf("Error: Multiproof has %d nodes, RequiredHashCount is %d", len(proof.Nodes), dupTree.RequiredHashCount(targets))
+	}
+	if !VerifyMultiProof(dupTree.Root.Hash, targets, proof) {
+		t.Errorf("Error: Multiproof of a duplicated leaf hash rejected")
+	}
+}
+
+// TestVerifyProof_SingleAndMultiProofs checks valid and tampered proofs against the root
+func TestVerifyProof_SingleAndMultiProofs(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	hashes := make([]common.Hash, 300)
+	for i := range hashes {
+		hashes[i] = newTestTx(signer, uint64(i), 100).Hash()
+	}
+	tree := NewFromHashes(hashes)
+	root := tree.Root.Hash
+
+	for _, i := range []int{0, 15, 16, 255, 299} {
+		proof, err := tree.GetProof(hashes[i])
+		if err != nil {
+			t.Fatalf("Failed to get proof: %v", err)
+		}
+		if !VerifyProof(root, hashes[i], proof) {
+			t.Errorf("Error: Proof for leaf %d rejected", i)
+		}
+		if VerifyProof(root, hashes[(i+1)%len(hashes)], proof) {
+			t.Errorf("Error: Proof for leaf %d accepted for another leaf", i)
+		}
+	}
+
+	targets := []common.Hash{hashes[3], hashes[4], hashes[200], hashes[299]}
+	multi, err := tree.GetMultiProof(targets)
+	if err != nil {
+		t.Fatalf("Failed to get multiproof: %v", err)
+	}
+	if !VerifyMultiProof(root, targets, multi) {
+		t.Fatalf("Error: Multiproof rejected")
+	}
+	if VerifyMultiProof(root, append(targets, hashes[5]), multi) {
+		t.Errorf("Error: Multiproof accepted for an unproven target")
+	}
+	multi.Nodes[len(multi.Nodes)-1].Hash = common.Hash{}
+	if VerifyMultiProof(root, targets, multi) {
+		t.Errorf("Error: Tampered multiproof accepted")
+	}
+}
+
+// TestProofSizeBytes_SingleTarget checks the byte model for a single target
+func TestProofSizeBytes_SingleTarget(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	hashes := make([]common.Hash, 256)
+	for i := range hashes {
+		hashes[i] = newTestTx(signer, uint64(i), 100).Hash()
+	}
+	tree := NewFromHashes(hashes)
+	target := []common.Hash{hashes[7]}
+
+	// 2 levels of 15 siblings, each with 3 one-byte positions, plus the header
+	// (K with layout flags, leaf count, leaf count of 1), and the target's
+	// index and hash
+	want := 2*15*(32+3) + (2 + 2 + 1) + (1 + 32)
+	if got := tree.ProofSizeBytes(target); got != want {
+		t.Errorf("Error: Expected %d proof bytes, got %d", want, got)
+	}
+	if tree.ProofSizeBytes(append(target, common.Hash{})) != want {
+		t.Errorf("Error: Unknown target changed the proof size")
+	}
+	if tree.ProofSizeBytes(nil) != 0 {
+		t.Errorf("Error: Expected zero bytes for no targets")
+	}
+}
+
+// TestOptimalK_ComparesArities checks that the search evaluates every candidate and returns the cheapest
+func TestOptimalK_ComparesArities(t *testing.T) {
+	best, evaluations := OptimalK(4096, []int{1, 1, 4, 16}, []int{2, 4, 16, 64, 1})
+	if len(evaluations) != 4 {
+		t.Fatalf("Error: Expected 4 valid candidates, got %d", len(evaluations))
+	}
+	for _, eval := range evaluations {
+		t.Logf("K=%d: %.1f proof bytes, %.1f verifier hashes", eval.K, eval.ProofBytes, eval.VerifierHashes)
+		if eval.K == best {
+			continue
+		}
+		var bestEval KEvaluation
+		for _, e := range evaluations {
+			if e.K == best {
+				bestEval = e
+			}
+		}
+		if eval.ProofBytes < bestEval.ProofBytes {
+			t.Errorf("Error: K=%d has smaller proofs than the chosen K=%d", eval.K, best)
+		}
+	}
+	// For sparse requests the binary tree sends the fewest siblings but hashes the most
+	if best != 2 || evaluations[0].VerifierHashes <= evaluations[3].VerifierHashes {
+		t.Errorf("Error: Expected K=2 to win on bytes and lose on verifier hashes, chose K=%d", best)
+	}
+}
+
+// TestLeafIndex_LocatesTargets checks the hash index against leaf positions
+func TestLeafIndex_LocatesTargets(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	hashes := make([]common.Hash, 40)
+	for i := range hashes {
+		hashes[i] = newTestTx(signer, uint64(i), 100).Hash()
+	}
+	tree := NewFromHashes(hashes)
+	for i, h := range hashes {
+		index, ok := tree.LeafIndex(h)
+		if !ok || index != i || tree.Leaf(h).TxHash != h {
+			t.Errorf("Error: Leaf %d not found at its position", i)
+		}
+	}
+	if tree.Leaf(common.Hash{}) != nil {
+		t.Errorf("Error: Found a leaf for an unknown hash")
+	}
+	// Two targets under the same parent of 16 leaves need its other 14 children
+	// and the 2 remaining parents one level up
+	if need := tree.RequiredHashCount([]common.Hash{hashes[1], hashes[2], {}}); need != 14+2 {
+		t.Errorf("Error: Expected 16 required hashes, got %d", need)
+	}
+}
+
+// TestBuilder_MatchesBatchConstruction compares streamed and batch trees for sizes around multiples of K
+func TestBuilder_MatchesBatchConstruction(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	hashes := make([]common.Hash, 300)
+	for i := range hashes {
+		hashes[i] = newTestTx(signer, uint64(i), 100).Hash()
+	}
+	for _, k := range []int{2, 3, 16} {
+		for _, size := range []int{1, 2, k, k + 1, k * k, k*k + 1, 300} {
+			ch := make(chan common.Hash)
+			go func() {
+				for _, h := range hashes[:size] {
+					ch <- h
+				}
+				close(ch)
+			}()
+			streamed := BuildFromChannel(ch, k)
+			batch := NewFromHashesWithK(hashes[:size], k)
+			if streamed.Root.Hash != batch.Root.Hash {
+				t.Fatalf("Error: Streamed root differs for K=%d and %d leaves", k, size)
+			}
+			if streamed.RequiredHashCount(hashes[:1]) != batch.RequiredHashCount(hashes[:1]) {
+				t.Errorf("Error: Streamed tree needs different hashes for K=%d and %d leaves", k, size)
+			}
+		}
+	}
+	if tree := NewBuilder(K).Close(); tree.Root != nil {
+		t.Errorf("Error: Expected no root for an empty stream")
+	}
+}
+
+// TestNewPaddedFromHashes_UniformProofs checks padded trees give fixed-length proofs that verify
+func TestNewPaddedFromHashes_UniformProofs(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	hashes := make([]common.Hash, 20)
+	for i := range hashes {
+		hashes[i] = newTestTx(signer, uint64(i), 100).Hash()
+	}
+	const k = 4
+	if NewPaddedFromHashes(hashes[:16], k).Root.Hash != NewFromHashesWithK(hashes[:16], k).Root.Hash {
+		t.Errorf("Error: Padding changed the root of a full tree")
+	}
+	tree := NewPaddedFromHashes(hashes, k)
+	if tree.Root.Hash == NewFromHashesWithK(hashes, k).Root.Hash {
+		t.Errorf("Error: Padding did not change the root of a partial tree")
+	}
+
+	// 20 leaves -> 5 -> 2 -> 1: every leaf has 3 siblings on each of 3 levels
+	for i, h := range hashes {
+		proof, err := tree.GetProof(h)
+		if err != nil {
+			t.Fatalf("Failed to get proof: %v", err)
+		}
+		if len(proof.Levels) != 3 {
+			t.Fatalf("Error: Proof of leaf %d has %d levels", i, len(proof.Levels))
+		}
+		for _, level := range proof.Levels {
+			if len(level.Siblings) != k-1 {
+				t.Errorf("Error: Proof of leaf %d has %d siblings on a level", i, len(level.Siblings))
+			}
+		}
+		if !VerifyProof(tree.Root.Hash, h, proof) {
+			t.Errorf("Error: Proof of leaf %d rejected", i)
+		}
+	}
+	// Above the last leaf, the fifth level-1 node is padded with three empty
+	// level-1 siblings, and the second level-2 node with two empty ones
+	proof, _ := tree.GetProof(hashes[19])
+	if proof.Levels[1].Siblings[0] != EmptyHash(k, 1) || proof.Levels[2].Siblings[1] != EmptyHash(k, 2) {
+		t.Errorf("Error: Padding siblings are not the canonical empty hashes")
+	}
+
+	targets := []common.Hash{hashes[0], hashes[19]}
+	multi, err := tree.GetMultiProof(targets)
+	if err != nil || !VerifyMultiProof(tree.Root.Hash, targets, multi) {
+		t.Errorf("Error: Padded multiproof rejected: %v", err)
+	}
+}
+
+// TestNewFromClusters_ContiguousMembers checks that contiguous clusters need fewer hashes than scattered ones
+func TestNewFromClusters_ContiguousMembers(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	const clusterCount, clusterSize = 20, 16
+	clusters := make([][]*types.Transaction, clusterCount)
+	var scattered []*types.Transaction
+	for i := 0; i < clusterCount*clusterSize; i++ {
+		tx := newTestTx(signer, uint64(i), 100)
+		clusters[i%clusterCount] = append(clusters[i%clusterCount], tx)
+		scattered = append(scattered, tx)
+	}
+	// A transaction in two clusters is placed once
+	clusters[1] = append(clusters[1], clusters[0][0])
+
+	ordered := NewFromClusters(clusters)
+	if len(ordered.leaves()) != clusterCount*clusterSize {
+		t.Fatalf("Error: Expected %d leaves, got %d", clusterCount*clusterSize, len(ordered.leaves()))
+	}
+	interleaved := NewFromTransactions(scattered)
+	orderedTotal, interleavedTotal := 0, 0
+	for _, cluster := range clusters {
+		orderedTotal += ordered.RequiredHashCountForTxs(cluster)
+		interleavedTotal += interleaved.RequiredHashCountForTxs(cluster)
+	}
+	if orderedTotal >= interleavedTotal {
+		t.Errorf("Error: Contiguous clusters need %d hashes, scattered ones %d", orderedTotal, interleavedTotal)
+	}
+	t.Logf("Required hashes: contiguous %d, scattered %d", orderedTotal, interleavedTotal)
+}
+
+// TestSerialize_RestoresTree round-trips plain and padded trees with and without interior hashes
+func TestSerialize_RestoresTree(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	hashes := make([]common.Hash, 70)
+	for i := range hashes {
+		hashes[i] = newTestTx(signer, uint64(i), 100).Hash()
+	}
+	targets := []common.Hash{hashes[3], hashes[69]}
+	for _, tree := range []*Tree{NewFromHashes(hashes), NewPaddedFromHashes(hashes, 4)} {
+		for _, withInterior := range []bool{false, true} {
+			var buf bytes.Buffer
+			if err := tree.Serialize(&buf, withInterior); err != nil {
+				t.Fatalf("Failed to serialize tree: %v", err)
+			}
+			restored, err := Deserialize(&buf)
+			if err != nil {
+				t.Fatalf("Failed to deserialize tree: %v", err)
+			}
+			if restored.Root.Hash != tree.Root.Hash || restored.K != tree.K {
+				t.Fatalf("Error: Restored tree differs (K=%d, interior: %v)", tree.K, withInterior)
+			}
+			if restored.RequiredHashCount(targets) != tree.RequiredHashCount(targets) {
+				t.Errorf("Error: Restored tree needs different hashes (K=%d, interior: %v)", tree.K, withInterior)
+			}
+			proof, err := restored.GetProof(hashes[69])
+			if err != nil || !VerifyProof(tree.Root.Hash, hashes[69], proof) {
+				t.Errorf("Error: Proof from restored tree rejected (K=%d, interior: %v)", tree.K, withInterior)
+			}
+		}
+	}
+
+	// A forged leaf count must fail on the missing hashes, not on allocation
+	forged := binary.AppendUvarint(binary.AppendUvarint([]byte{serializeVersion, 0}, 16), 1<<32)
+	if _, err := Deserialize(bytes.NewReader(forged)); err == nil {
+		t.Errorf("Error: Tree claiming 1<<32 leaves without hashes deserialized")
+	}
+}
+
+// TestGetProof_ChildIndicesAreBaseKDigits checks the child index and sibling
+// count of every proof level in the default layout, where they are base-K digits
+func TestGetProof_ChildIndicesAreBaseKDigits(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	hashes := make([]common.Hash, K*K)
+	for i := range hashes {
+		hashes[i] = newTestTx(signer, uint64(i), 100).Hash()
+	}
+	tree := NewFromHashes(hashes)
+	for _, i := range []int{0, 1, K + 3, K*K - 1} {
+		proof, err := tree.GetProof(hashes[i])
+		if err != nil {
+			t.Fatalf("Failed to get proof: %v", err)
+		}
+		for level, position := 0, i; level < len(proof.Levels); level, position = level+1, position/K {
+			if proof.Levels[level].Position != position%K || len(proof.Levels[level].Siblings) != K-1 {
+				t.Errorf("Error: Leaf %d level %d has child index %d and %d siblings",
+					i, level, proof.Levels[level].Position, len(proof.Levels[level].Siblings))
+			}
+		}
+	}
+	if _, err := tree.GetProof(common.Hash{}); err == nil {
+		t.Errorf("Error: Expected an error for a hash not in the tree")
+	}
+
+	// Balanced trees regroup the last leaves, so only check that their proofs verify
+	balanced := NewBalancedFromHashes(hashes[:K*K-K+1], K)
+	for _, i := range []int{0, K*K - 2*K, K*K - K} {
+		proof, err := balanced.GetProof(hashes[i])
+		if err != nil {
+			t.Fatalf("Failed to get proof: %v", err)
+		}
+		if !VerifyProof(balanced.Root.Hash, hashes[i], proof) {
+			t.Errorf("Error: Balanced proof of leaf %d rejected", i)
+		}
+	}
+}
+
+// TestNodeAt_GeneralizedIndices checks index math and node lookup in a partial tree
+func TestNodeAt_GeneralizedIndices(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	hashes := make([]common.Hash, 11)
+	for i := range hashes {
+		hashes[i] = newTestTx(signer, uint64(i), 100).Hash()
+	}
+	const k = 3
+	tree := NewFromHashesWithK(hashes, k) // 11 leaves -> 4 -> 2 -> 1
+
+	for i, h := range hashes {
+		g, ok := tree.LeafGIndex(h)
+		if !ok {
+			t.Fatalf("Error: Leaf %d has no generalized index", i)
+		}
+		if depth, offset := GIndexPosition(k, g); depth != 3 || offset != i {
+			t.Errorf("Error: Leaf %d at depth %d offset %d", i, depth, offset)
+		}
+		node, err := tree.NodeAt(g)
+		if err != nil || node.TxHash != h {
+			t.Errorf("Error: NodeAt(%d) does not return leaf %d: %v", g, i, err)
+		}
+		parent, _ := tree.NodeAt(ParentGIndex(k, g))
+		if parent != node.Parent {
+			t.Errorf("Error: Parent index of leaf %d resolves to another node", i)
+		}
+	}
+	if root, _ := tree.NodeAt(0); root != tree.Root || ChildGIndex(k, 0, 2) != 3 {
+		t.Errorf("Error: Root or child index math is wrong")
+	}
+	// The second depth-1 node has a single child, so its second child does not exist
+	if _, err := tree.NodeAt(ChildGIndex(k, 2, 1)); err == nil {
+		t.Errorf("Error: Expected an error for a missing node")
+	}
+}
+
+// TestStats_LevelsAndFill checks level sizes and last-group fill of a partial tree
+func TestStats_LevelsAndFill(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	hashes := make([]common.Hash, 11)
+	for i := range hashes {
+		hashes[i] = newTestTx(signer, uint64(i), 100).Hash()
+	}
+	stats := NewFromHashesWithK(hashes, 3).Stats() // 11 leaves -> 4 -> 2 -> 1
+	if stats.Height != 3 {
+		t.Errorf("Error: Expected height 3, got %d", stats.Height)
+	}
+	wantNodes := []int{11, 4, 2, 1}
+	wantFill := []float64{2.0 / 3, 1.0 / 3, 2.0 / 3}
+	for i, n := range wantNodes {
+		if stats.NodesPerLevel[i] != n {
+			t.Errorf("Error: Level %d has %d nodes, want %d", i, stats.NodesPerLevel[i], n)
+		}
+	}
+	for i, f := range wantFill {
+		if math.Abs(stats.LastGroupFill[i]-f) > 1e-9 {
+			t.Errorf("Error: Last group of level %d filled %.2f, want %.2f", i+1, stats.LastGroupFill[i], f)
+		}
+	}
+	if padded := NewPaddedFromHashes(hashes, 3).Stats(); padded.MemoryBytes <= stats.MemoryBytes || padded.NodesPerLevel[0] != 11 {
+		t.Errorf("Error: Padding should add memory but no counted leaves")
+	}
+}
+
+func TestHasher_ProofsVerifyUnderSameHasher(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	hashes := make([]common.Hash, 20)
+	for i := range hashes {
+		hashes[i] = newTestTx(signer, uint64(i), 100).Hash()
+	}
+	keccakRoot := NewFromHashesWithK(hashes, 4).Root.Hash
+	for name, hasher := range map[string]verifier.Hasher{"sha256": sha256Hasher, "blake3": blake3Hasher} {
+		tree := NewFromHashesWithHasher(hashes, 4, hasher)
+		if tree.Root.Hash == keccakRoot {
+			t.Errorf("Error: %s root equals the Keccak256 root", name)
+		}
+		b := NewBuilder(4, hasher)
+		for _, h := range hashes {
+			b.Add(h)
+		}
+		if b.Close().Root.Hash != tree.Root.Hash {
+			t.Errorf("Error: %s builder root differs from constructor root", name)
+		}
+		proof, err := tree.GetProof(hashes[13])
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if !VerifyProof(tree.Root.Hash, hashes[13], proof, hasher) {
+			t.Errorf("Error: %s proof should verify with its own hasher", name)
+		}
+		if VerifyProof(tree.Root.Hash, hashes[13], proof) {
+			t.Errorf("Error: %s proof should not verify with Keccak256", name)
+		}
+		multi, err := tree.GetMultiProof([]common.Hash{hashes[1], hashes[18]})
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if !VerifyMultiProof(tree.Root.Hash, []common.Hash{hashes[1], hashes[18]}, multi, hasher) {
+			t.Errorf("Error: %s multiproof should verify with its own hasher", name)
+		}
+		padded := NewPaddedFromHashes(hashes, 4, hasher)
+		if padded.leafNodes[0].Parent.Parent.Parent.Children[1].Children[3].Hash != EmptyHash(4, 1, hasher) {
+			t.Errorf("Error: %s padding should use the empty hash of the tree hasher", name)
+		}
+	}
+}
+
+func TestRequiredHashes_MatchCountAndVerify(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	hashes := make([]common.Hash, 70)
+	for i := range hashes {
+		hashes[i] = newTestTx(signer, uint64(i), 100).Hash()
+	}
+	missing := newTestTx(signer, 1000, 100).Hash()
+	for _, k := range []int{2, 3, 16} {
+		for _, tree := range []*Tree{NewFromHashesWithK(hashes, k), NewPaddedFromHashes(hashes, k)} {
+			targets := []common.Hash{hashes[0], hashes[5], hashes[42], hashes[69], missing}
+			required := tree.RequiredHashes(targets)
+			if len(required) != tree.RequiredHashCount(targets) {
+				t.Errorf("Error: k=%d listed %d hashes, counted %d", k, len(required), tree.RequiredHashCount(targets))
+			}
+			proof, err := tree.GetMultiProof(targets[:4])
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			proof.Nodes = required
+			if !VerifyMultiProof(tree.Root.Hash, targets[:4], proof) {
+				t.Errorf("Error: k=%d listed hashes should verify as a multiproof", k)
+			}
+		}
+	}
+	if NewFromHashes(hashes).RequiredHashes([]common.Hash{missing}) != nil {
+		t.Errorf("Error: Expected no hashes for targets outside the tree")
+	}
+}
+
+func TestSweepArity_Table(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	txs := make([]*types.Transaction, 100)
+	hashes := make([]common.Hash, len(txs))
+	for i := range txs {
+		txs[i] = newTestTx(signer, uint64(i), 100)
+		hashes[i] = txs[i].Hash()
+	}
+	targets := []*types.Transaction{txs[3], txs[50], txs[97]}
+	table := SweepArity(txs, targets, []int{1, 2, 4, 16})
+	if len(table) != 3 {
+		t.Fatalf("Error: Expected 3 rows, got %d", len(table))
+	}
+	wantHeight := []int{7, 4, 2}
+	for i, row := range table {
+		tree := NewFromHashesWithK(hashes, row.K)
+		if row.Height != wantHeight[i] {
+			t.Errorf("Error: k=%d height %d, want %d", row.K, row.Height, wantHeight[i])
+		}
+		if row.RequiredHashes != tree.RequiredHashCountForTxs(targets) || row.RequiredBytes != 32*row.RequiredHashes {
+			t.Errorf("Error: k=%d required hashes %d do not match the tree", row.K, row.RequiredHashes)
+		}
+	}
+	if lines := strings.Count(table.String(), "\n"); lines != 4 {
+		t.Errorf("Error: Expected header and 3 rows, got %d lines", lines)
+	}
+}
+
+func TestPooledBuild_FewAllocations(t *testing.T) {
+	hashes := make([]common.Hash, 4096)
+	for i := range hashes {
+		hashes[i] = crypto.Keccak256Hash(big.NewInt(int64(i)).Bytes())
+	}
+	tree := NewFromHashesWithK(hashes, 16)
+	if want := NewFromHashesWithK(hashes, 16).Root.Hash; tree.Root.Hash != want {
+		t.Fatalf("Error: Rebuild changed the root")
+	}
+
+	// A hasher that allocates nothing isolates the allocations of the tree itself
+	counting := func(data ...[]byte) common.Hash { return common.Hash{byte(len(data[0]))} }
+	interior := 256 + 16 + 1
+	if raceEnabled {
+		t.Log("Skipping allocation counts under the race detector")
+	} else {
+		if allocs := testing.AllocsPerRun(10, NewFromHashesWithHasher(hashes, 16, counting).ComputeHashes); allocs >= float64(interior) {
+			t.Errorf("Error: Rehashing %d interior nodes made %.0f allocations", interior, allocs)
+		}
+		if allocs := testing.AllocsPerRun(10, func() { NewFromHashesWithHasher(hashes, 16, counting) }); allocs >= float64(len(hashes)/4) {
+			t.Errorf("Error: Building %d leaves made %.0f allocations", len(hashes), allocs)
+		}
+	}
+	for _, k := range []int{3, 16, 64} {
+		padded := NewPaddedFromHashes(hashes[:1000], k)
+		for _, leaf := range padded.leafNodes[:5] {
+			proof, _ := padded.GetProof(leaf.TxHash)
+			if !VerifyProof(padded.Root.Hash, leaf.TxHash, proof) {
+				t.Errorf("Error: k=%d proof from pooled padded tree failed", k)
+			}
+		}
+	}
+}
+
+func TestWriteDOT_HighlightsProofNodes(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	hashes := make([]common.Hash, 10)
+	for i := range hashes {
+		hashes[i] = newTestTx(signer, uint64(i), 100).Hash()
+	}
+	tree := NewPaddedFromHashes(hashes, 4) // 10 leaves -> 3 -> 1
+	targets := []common.Hash{hashes[1], hashes[9]}
+
+	var buf bytes.Buffer
+	if err := tree.WriteDOT(&buf, targets, 0); err != nil {
+		t.Fatalf("Failed to write DOT: %v", err)
+	}
+	out := buf.String()
+	if got := strings.Count(out, dotProofColor); got != tree.RequiredHashCount(targets) {
+		t.Errorf("Error: Expected %d proof nodes highlighted, got %d", tree.RequiredHashCount(targets), got)
+	}
+	if strings.Count(out, dotTargetColor) != 2 || strings.Count(out, dotPathColor) != 3 {
+		t.Errorf("Error: Expected 2 targets and 3 recomputed nodes highlighted")
+	}
+	if !strings.Contains(out, "l1_2 -> l0_11 [style=dashed]") {
+		t.Errorf("Error: Padding leaf missing or not dashed")
+	}
+
+	buf.Reset()
+	if err := tree.WriteDOT(&buf, targets, 2); err != nil {
+		t.Fatalf("Failed to write DOT: %v", err)
+	}
+	if strings.Contains(buf.String(), "l0_") || !strings.Contains(buf.String(), "l1_2 [") {
+		t.Errorf("Error: Expected only the top 2 levels to be drawn")
+	}
+}
+
+func TestExclusionProof_SortedLeaves(t *testing.T) {
+	hashes := make([]common.Hash, 40)
+	for i := range hashes {
+		hashes[i] = crypto.Keccak256Hash(big.NewInt(int64(2 * i)).Bytes())
+	}
+	tree := NewSortedFromHashes(hashes, 4)
+	if _, err := NewFromHashesWithK(hashes, 4).GetExclusionProof(common.Hash{}); err == nil {
+		t.Errorf("Error: Expected unsorted tree to refuse exclusion proofs")
+	}
+	if _, err := tree.GetExclusionProof(hashes[7]); err == nil {
+		t.Errorf("Error: Expected a leaf to have no exclusion proof")
+	}
+
+	absent := []common.Hash{{}, common.HexToHash("0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")}
+	for i := 0; i < 20; i++ {
+		absent = append(absent, crypto.Keccak256Hash(big.NewInt(int64(2*i+1)).Bytes()))
+	}
+	for _, h := range absent {
+		proof, err := tree.GetExclusionProof(h)
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if !VerifyExclusionProof(tree.Root.Hash, h, proof) {
+			t.Errorf("Error: Exclusion proof for %s failed", h.Hex())
+		}
+	}
+
+	// Neighbours that are not adjacent leave a gap that could hide the hash
+	proof, _ := tree.GetExclusionProof(absent[5])
+	skip, _ := tree.neighborProof(proof.Right.Index + 1)
+	if VerifyExclusionProof(tree.Root.Hash, absent[5], ExclusionProof{K: 4, Left: proof.Left, Right: skip}) {
+		t.Errorf("Error: Expected non-adjacent neighbours to fail")
+	}
+	if VerifyExclusionProof(tree.Root.Hash, absent[5], ExclusionProof{K: 4, Left: proof.Left}) {
+		t.Errorf("Error: Expected a left neighbour that is not the last leaf to fail")
+	}
+	if VerifyExclusionProof(tree.Root.Hash, tree.leafNodes[proof.Right.Index].TxHash, proof) {
+		t.Errorf("Error: Expected the proof not to exclude its own neighbour")
+	}
+
+	var buf bytes.Buffer
+	if err := tree.Serialize(&buf, false); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	restored, err := Deserialize(&buf)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if _, err := restored.GetExclusionProof(absent[3]); err != nil {
+		t.Errorf("Error: Restored sorted tree should give exclusion proofs: %v", err)
+	}
+}
+
+func TestUpdateLeaf_RehashesPath(t *testing.T) {
+	hashes := make([]common.Hash, 50)
+	for i := range hashes {
+		hashes[i] = crypto.Keccak256Hash(big.NewInt(int64(i)).Bytes())
+	}
+	replacement := crypto.Keccak256Hash([]byte("amended"))
+	for _, tree := range []*Tree{NewFromHashesWithK(hashes, 3), NewPaddedFromHashes(hashes, 3), NewFromHashesWithHasher(hashes, 16, sha256Hasher)} {
+		if err := tree.UpdateLeaf(37, replacement); err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		updated := append([]common.Hash{}, hashes...)
+		updated[37] = replacement
+		var want *Tree
+		switch {
+		case tree.padded:
+			want = NewPaddedFromHashes(updated, tree.K)
+		case tree.K == 16:
+			want = NewFromHashesWithHasher(updated, 16, sha256Hasher)
+		default:
+			want = NewFromHashesWithK(updated, tree.K)
+		}
+		if tree.Root.Hash != want.Root.Hash {
+			t.Errorf("Error: k=%d root after update differs from a rebuild", tree.K)
+		}
+		if tree.Leaf(hashes[37]) != nil || tree.Leaf(replacement) == nil {
+			t.Errorf("Error: k=%d leaf index not updated", tree.K)
+		}
+	}
+	if err := NewFromHashes(hashes).UpdateLeaf(50, replacement); err == nil {
+		t.Errorf("Error: Expected out of range index to fail")
+	}
+	sorted := NewSortedFromHashes(hashes, 4)
+	sorted.UpdateLeaf(0, replacement)
+	if _, err := sorted.GetExclusionProof(common.Hash{}); err == nil {
+		t.Errorf("Error: Expected updated sorted tree to refuse exclusion proofs")
+	}
+}
+
+func TestBalanced_SplitsLastGroupsEvenly(t *testing.T) {
+	hashes := make([]common.Hash, 300)
+	for i := range hashes {
+		hashes[i] = crypto.Keccak256Hash(big.NewInt(int64(i)).Bytes())
+	}
+	tree := NewBalancedFromHashes(hashes[:17], 16)
+	if len(tree.Root.Children) != 2 || len(tree.Root.Children[0].Children) != 9 || len(tree.Root.Children[1].Children) != 8 {
+		t.Fatalf("Error: Expected 17 leaves grouped as 9 + 8")
+	}
+	if proof, _ := tree.GetProof(hashes[16]); len(proof.Levels[0].Siblings) != 7 {
+		t.Errorf("Error: Expected the last leaf to have 7 siblings, got %d", len(proof.Levels[0].Siblings))
+	}
+
+	for _, n := range []int{17, 33, 100, 257, 300} {
+		for _, k := range []int{3, 16} {
+			tree := NewBalancedFromHashes(hashes[:n], k)
+			for _, i := range []int{0, n / 2, n - 2, n - 1} {
+				proof, err := tree.GetProof(hashes[i])
+				if err != nil || !VerifyProof(tree.Root.Hash, hashes[i], proof) {
+					t.Errorf("Error: n=%d k=%d proof of leaf %d failed", n, k, i)
+				}
+			}
+			targets := []common.Hash{hashes[1], hashes[n-3], hashes[n-1]}
+			multi, err := tree.GetMultiProof(targets)
+			if err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			if !multi.Balanced || len(multi.Nodes) != tree.RequiredHashCount(targets) || !VerifyMultiProof(tree.Root.Hash, targets, multi) {
+				t.Errorf("Error: n=%d k=%d balanced multiproof failed", n, k)
+			}
+			multi.Balanced = false
+			if n%k == 1 && VerifyMultiProof(tree.Root.Hash, targets, multi) {
+				t.Errorf("Error: n=%d k=%d multiproof should fail under the default layout", n, k)
+			}
+
+			var buf bytes.Buffer
+			if err := tree.Serialize(&buf, true); err != nil {
+				t.Fatalf("Error: %v", err)
+			}
+			restored, err := Deserialize(&buf)
+			if err != nil || restored.Root.Hash != tree.Root.Hash || !restored.balanced {
+				t.Errorf("Error: n=%d k=%d balanced tree did not round-trip: %v", n, k, err)
+			}
+		}
+	}
+	if _, err := tree.NodeAt(0); err == nil {
+		t.Errorf("Error: Expected balanced trees to refuse generalized indices")
+	}
+}
+
+func TestFreeze_ConcurrentReads(t *testing.T) {
+	hashes := make([]common.Hash, 500)
+	for i := range hashes {
+		hashes[i] = crypto.Keccak256Hash(big.NewInt(int64(i)).Bytes())
+	}
+	tree := NewPaddedFromHashes(hashes, 8)
+	frozen := tree.Freeze()
+	root := frozen.Root()
+	if root != tree.Root.Hash || frozen.Len() != 500 || frozen.K() != 8 {
+		t.Fatalf("Error: Frozen handle does not match its tree")
+	}
+
+	errs := make(chan string, 16)
+	done := make(chan struct{})
+	for w := 0; w < 8; w++ {
+		go func(w int) {
+			defer func() { done <- struct{}{} }()
+			for i := w; i < len(hashes); i += 8 {
+				proof, err := frozen.GetProof(hashes[i])
+				if err != nil || !VerifyProof(root, hashes[i], proof) {
+					errs <- "single proof failed"
+					return
+				}
+				targets := []common.Hash{hashes[i], hashes[(i*7)%len(hashes)]}
+				multi, err := frozen.GetMultiProof(targets)
+				if err != nil || !VerifyMultiProof(root, targets, multi) || len(frozen.RequiredHashes(targets)) != frozen.RequiredHashCount(targets) {
+					errs <- "multiproof failed"
+					return
+				}
+			}
+		}(w)
+	}
+	// Updating the original tree meanwhile must not disturb the frozen copy
+	for i := 0; i < 50; i++ {
+		tree.UpdateLeaf(i, crypto.Keccak256Hash([]byte{byte(i)}))
+	}
+	for w := 0; w < 8; w++ {
+		<-done
+	}
+	close(errs)
+	for err := range errs {
+		t.Errorf("Error: %s", err)
+	}
+	if frozen.Root() != root || tree.Root.Hash == root {
+		t.Errorf("Error: Expected the frozen root to stay while the tree changes")
+	}
+}
+
+func TestDomainSeparation_InteriorNodeIsNoLeaf(t *testing.T) {
+	a, b := crypto.Keccak256Hash([]byte("a")), crypto.Keccak256Hash([]byte("b"))
+	separated := crypto.Keccak256Hash([]byte{0x01}, crypto.Keccak256([]byte{0x00}, a[:]), crypto.Keccak256([]byte{0x00}, b[:]))
+	if root := NewFromHashesWithK([]common.Hash{a, b}, 2).Root.Hash; root != separated {
+		t.Errorf("Error: Expected domain separated root %s, got %s", separated.Hex(), root.Hex())
+	}
+	if root := NewLegacyFromHashes([]common.Hash{a, b}, 2).Root.Hash; root != crypto.Keccak256Hash(a[:], b[:]) {
+		t.Errorf("Error: Expected legacy root to hash the bare children")
+	}
+
+	hashes := make([]common.Hash, 64)
+	for i := range hashes {
+		hashes[i] = crypto.Keccak256Hash(big.NewInt(int64(i)).Bytes())
+	}
+	for _, tree := range []*Tree{NewFromHashesWithK(hashes, 4), NewLegacyFromHashes(hashes, 4)} {
+		verify, verifyMulti := VerifyProof, VerifyMultiProof
+		if tree.legacy {
+			verify, verifyMulti = VerifyLegacyProof, VerifyLegacyMultiProof
+		}
+		proof, err := tree.GetProof(hashes[9])
+		if err != nil || !verify(tree.Root.Hash, hashes[9], proof) {
+			t.Fatalf("Error: legacy=%v leaf proof failed", tree.legacy)
+		}
+		// Claim the parent of the leaf as a leaf, with the proof from there up
+		interior := tree.Leaf(hashes[9]).Parent.Hash
+		forged := Proof{K: 4, Levels: proof.Levels[1:]}
+		if verify(tree.Root.Hash, interior, forged) != tree.legacy {
+			t.Errorf("Error: legacy=%v interior node accepted as leaf: %v", tree.legacy, !tree.legacy)
+		}
+		multi, _ := tree.GetMultiProof([]common.Hash{hashes[1], hashes[60]})
+		if !verifyMulti(tree.Root.Hash, []common.Hash{hashes[1], hashes[60]}, multi) {
+			t.Errorf("Error: legacy=%v multiproof failed", tree.legacy)
+		}
+		var buf bytes.Buffer
+		tree.Serialize(&buf, true)
+		if restored, err := Deserialize(&buf); err != nil || restored.Root.Hash != tree.Root.Hash || restored.legacy != tree.legacy {
+			t.Errorf("Error: legacy=%v tree did not round-trip", tree.legacy)
+		}
+	}
+}
+
+func TestNewFromLeaves_RawPayloads(t *testing.T) {
+	leaves := make([][]byte, 40)
+	for i := range leaves {
+		leaves[i] = []byte(strings.Repeat("chunk", i+1))
+	}
+	for _, hasher := range []verifier.Hasher{nil, sha256Hasher} {
+		tree := NewFromLeaves(leaves, hasher)
+		digest := crypto.Keccak256Hash(leaves[25])
+		if hasher != nil {
+			digest = hasher(leaves[25])
+		}
+		if i, ok := tree.LeafIndex(digest); !ok || i != 25 {
+			t.Fatalf("Error: Expected payload digest at leaf 25")
+		}
+		proof, err := tree.GetProof(digest)
+		if err != nil || !VerifyProof(tree.Root.Hash, digest, proof, hasher) {
+			t.Errorf("Error: Proof of a raw payload failed")
+		}
+	}
+	if NewFromLeaves(leaves, nil).Root.Hash == NewFromLeaves(leaves, sha256Hasher).Root.Hash {
+		t.Errorf("Error: Expected the hasher to change the root")
+	}
+}
+
+func TestGenerateTestVectors_DeterministicAndValid(t *testing.T) {
+	vectors := GenerateTestVectors([]int{1, 17, 100}, []int{2, 16})
+	if len(vectors) != 3*2*3 {
+		t.Fatalf("Error: Expected 18 vectors, got %d", len(vectors))
+	}
+	for _, v := range vectors {
+		for _, p := range v.Proofs {
+			if !VerifyProof(v.Root, p.Leaf, p.Proof) {
+				t.Errorf("Error: %s proof of leaf %d failed", v.Name, p.Index)
+			}
+		}
+		if !VerifyMultiProof(v.Root, []common.Hash{v.Leaves[0], v.Leaves[len(v.Leaves)-1]}, v.MultiProof) {
+			t.Errorf("Error: %s multiproof failed", v.Name)
+		}
+	}
+
+	// A single leaf is its own root: H(0x00 || leaf)
+	leaf := VectorLeaves(1)[0]
+	if vectors[0].Root != crypto.Keccak256Hash([]byte{0x00}, leaf[:]) {
+		t.Errorf("Error: Unexpected root of the single leaf vector")
+	}
+
+	var a, b bytes.Buffer
+	if err := WriteTestVectors(&a, []int{17}, []int{16}); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	WriteTestVectors(&b, []int{17}, []int{16})
+	if !bytes.Equal(a.Bytes(), b.Bytes()) {
+		t.Errorf("Error: Expected identical output for identical arguments")
+	}
+	var decoded []TestVector
+	if err := json.Unmarshal(a.Bytes(), &decoded); err != nil || len(decoded) != 3 || decoded[2].Root != vectors[11].Root {
+		t.Errorf("Error: Vectors did not round-trip through JSON: %v", err)
+	}
+}
+
+func TestVerifyBatch_HighAritySavings(t *testing.T) {
+	hashes := VectorLeaves(4096)
+	tree := NewFromHashesWithK(hashes, 64)
+	var items []BatchItem
+	for i := 0; i < 4096; i += 16 {
+		proof, _ := tree.GetProof(hashes[i])
+		items = append(items, BatchItem{Leaf: hashes[i], Proof: proof})
+	}
+	result := VerifyBatch(tree.Root.Hash, items)
+	for i, ok := range result.Valid {
+		if !ok {
+			t.Fatalf("Error: Item %d rejected", i)
+		}
+	}
+	// 256 leaves, their 64 parents and the root, against 3 hashes per item
+	if result.Hashes != 256+64+1 || result.NaiveHashes != 3*256 {
+		t.Errorf("Error: Expected %d batch and %d naive hashes, got %d and %d", 256+64+1, 3*256, result.Hashes, result.NaiveHashes)
+	}
+}
+
+func TestProofEncoding_RoundTrip(t *testing.T) {
+	hashes := VectorLeaves(300)
+	for _, tree := range []*Tree{NewFromHashesWithK(hashes, 16), NewBalancedFromHashes(hashes, 7), NewLegacyFromHashes(hashes, 3)} {
+		proof, _ := tree.GetProof(hashes[299])
+		encoded, err := proof.MarshalBinary()
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		siblings := 0
+		for _, level := range proof.Levels {
+			siblings += len(level.Siblings)
+		}
+		// Header and depth, then two one-byte uvarints per level and the hashes
+		if want := 2 + 2*len(proof.Levels) + 32*siblings; len(encoded) != want {
+			t.Errorf("Error: k=%d expected %d bytes, got %d", tree.K, want, len(encoded))
+		}
+		verify, verifyMulti := VerifyProof, VerifyMultiProof
+		if tree.legacy {
+			verify, verifyMulti = VerifyLegacyProof, VerifyLegacyMultiProof
+		}
+		var decoded Proof
+		if err := decoded.UnmarshalBinary(encoded); err != nil || decoded.K != tree.K {
+			t.Fatalf("Error: k=%d decode failed: %v", tree.K, err)
+		}
+		if !verify(tree.Root.Hash, hashes[299], decoded) {
+			t.Errorf("Error: k=%d decoded proof failed", tree.K)
+		}
+		if err := decoded.UnmarshalBinary(encoded[:len(encoded)-1]); err == nil {
+			t.Errorf("Error: Expected truncated proof to fail")
+		}
+
+		multi, _ := tree.GetMultiProof([]common.Hash{hashes[3], hashes[150]})
+		data, _ := multi.MarshalBinary()
+		var decodedMulti MultiProof
+		if err := decodedMulti.UnmarshalBinary(data); err != nil || !verifyMulti(tree.Root.Hash, []common.Hash{hashes[3], hashes[150]}, &decodedMulti) {
+			t.Errorf("Error: k=%d decoded multiproof failed: %v", tree.K, err)
+		}
+	}
+}
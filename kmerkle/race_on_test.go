@@ -0,0 +1,7 @@
+//go:build race
+
+package kmerkle
+
+// raceEnabled reports whether the race detector is on, which instruments
+// allocations and makes allocation counts meaningless
+const raceEnabled = true
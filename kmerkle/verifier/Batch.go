@@ -0,0 +1,85 @@
+package verifier
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// BatchItem is one leaf with its single proof
+type BatchItem struct {
+	Leaf  common.Hash
+	Proof Proof
+}
+
+// BatchResult reports the outcome of a batch verification
+type BatchResult struct {
+	Valid       []bool // Outcome per item, in input order
+	Hashes      int    // Hash invocations of the batch verifier
+	NaiveHashes int    // Hash invocations of verifying every item on its own
+}
+
+// Saved returns the fraction of hash invocations the batch saved
+func (r BatchResult) Saved() float64 {
+	if r.NaiveHashes == 0 {
+		return 0
+	}
+	return 1 - float64(r.Hashes)/float64(r.NaiveHashes)
+}
+
+// VerifyBatch checks many single proofs against one root, with the same
+// outcome as calling VerifyProof on every item. Reconstructed interior nodes
+// are cached by their preimage, i.e. their children, so a node shared by the
+// paths of several proofs is hashed only once. High-arity trees share most
+// upper levels between proofs, so the savings grow with the batch. An
+// optional hasher replaces the default Keccak256.
+func VerifyBatch(root common.Hash, items []BatchItem, hasher ...Hasher) BatchResult {
+	return verifyBatch(pickHasher(hasher), false, root, items)
+}
+
+// VerifyLegacyBatch checks many single proofs of a tree hashed without domain
+// separation, see VerifyBatch and VerifyLegacyProof
+func VerifyLegacyBatch(root common.Hash, items []BatchItem, hasher ...Hasher) BatchResult {
+	return verifyBatch(pickHasher(hasher), true, root, items)
+}
+
+// verifyBatch checks a batch of proofs, hashing nodes as a legacy tree if set
+func verifyBatch(hashFn Hasher, legacy bool, root common.Hash, items []BatchItem) BatchResult {
+	result := BatchResult{Valid: make([]bool, len(items))}
+	cache := make(map[string]common.Hash)
+	var preimage []byte
+	for i, item := range items {
+		proof := item.Proof
+		result.NaiveHashes += len(proof.Levels)
+		if !legacy {
+			result.NaiveHashes++
+			result.Hashes++
+		}
+		hash := LeafHash(hashFn, legacy, item.Leaf)
+		ok := true
+		for _, level := range proof.Levels {
+			if level.Position < 0 || level.Position > len(level.Siblings) {
+				ok = false
+				break
+			}
+			preimage = preimage[:0]
+			if !legacy {
+				preimage = append(preimage, NodePrefix)
+			}
+			for _, sibling := range level.Siblings[:level.Position] {
+				preimage = append(preimage, sibling[:]...)
+			}
+			preimage = append(preimage, hash[:]...)
+			for _, sibling := range level.Siblings[level.Position:] {
+				preimage = append(preimage, sibling[:]...)
+			}
+			if cached, hit := cache[string(preimage)]; hit {
+				hash = cached
+				continue
+			}
+			hash = hashFn(preimage)
+			cache[string(preimage)] = hash
+			result.Hashes++
+		}
+		result.Valid[i] = ok && hash == root
+	}
+	return result
+}
@@ -0,0 +1,140 @@
+package verifier
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// errShortProof is returned when an encoded proof ends early
+var errShortProof = errors.New("encoded proof is truncated")
+
+// MarshalBinary encodes the proof: uvarints K (doubled, the low bit is
+// reserved and always zero) and depth, then per level from the leaf up a uvarint child index, a uvarint
+// sibling count and the sibling hashes
+func (p Proof) MarshalBinary() ([]byte, error) {
+	if p.K < 2 {
+		return nil, fmt.Errorf("invalid proof arity %d", p.K)
+	}
+	out := binary.AppendUvarint(nil, uint64(p.K)<<1)
+	out = binary.AppendUvarint(out, uint64(len(p.Levels)))
+	for _, level := range p.Levels {
+		if level.Position < 0 || level.Position >= p.K || len(level.Siblings) >= p.K {
+			return nil, errors.New("proof level does not fit the arity")
+		}
+		out = binary.AppendUvarint(out, uint64(level.Position))
+		out = binary.AppendUvarint(out, uint64(len(level.Siblings)))
+		for _, sibling := range level.Siblings {
+			out = append(out, sibling[:]...)
+		}
+	}
+	return out, nil
+}
+
+// UnmarshalBinary decodes a proof produced by MarshalBinary
+func (p *Proof) UnmarshalBinary(data []byte) error {
+	r := &proofReader{data: data}
+	header := r.uvarint()
+	k := header >> 1
+	depth := r.uvarint()
+	if r.err == nil && header&1 != 0 {
+		return errors.New("reserved proof header bit set")
+	}
+	if r.err == nil && (k < 2 || k > 1<<16 || depth > 64) {
+		return fmt.Errorf("invalid proof shape: arity %d, depth %d", k, depth)
+	}
+	levels := make([]ProofLevel, 0, depth)
+	for i := uint64(0); i < depth && r.err == nil; i++ {
+		position, count := r.uvarint(), r.uvarint()
+		if r.err == nil && (position >= k || count >= k || position > count) {
+			return fmt.Errorf("invalid proof level %d", i)
+		}
+		level := ProofLevel{Position: int(position), Siblings: make([]common.Hash, 0, count)}
+		for j := uint64(0); j < count && r.err == nil; j++ {
+			level.Siblings = append(level.Siblings, r.hash())
+		}
+		levels = append(levels, level)
+	}
+	if r.err != nil {
+		return r.err
+	}
+	if len(r.data) != 0 {
+		return fmt.Errorf("%d trailing bytes after proof", len(r.data))
+	}
+	p.K, p.Levels = int(k), levels
+	return nil
+}
+
+// UnmarshalBinary decodes a multiproof produced by MarshalBinary
+func (p *MultiProof) UnmarshalBinary(data []byte) error {
+	r := &proofReader{data: data}
+	header := r.uvarint()
+	k := header >> 3
+	leafCount := r.uvarint()
+	count := r.uvarint()
+	if r.err == nil && header&4 != 0 {
+		return errors.New("reserved multiproof header bit set")
+	}
+	if r.err == nil && (k < 2 || k > 1<<16 || leafCount > 1<<32 || count > leafCount) {
+		return fmt.Errorf("invalid multiproof shape: arity %d, %d of %d leaves", k, count, leafCount)
+	}
+	decoded := MultiProof{
+		K:         int(k),
+		Padded:    header&1 != 0,
+		Balanced:  header&2 != 0,
+		LeafCount: int(leafCount),
+	}
+	for i := uint64(0); i < count && r.err == nil; i++ {
+		decoded.Indices = append(decoded.Indices, int(r.uvarint()))
+		decoded.Leaves = append(decoded.Leaves, r.hash())
+	}
+	for r.err == nil && len(r.data) > 0 {
+		decoded.Nodes = append(decoded.Nodes, ProofNode{
+			Level:       int(r.uvarint()),
+			ParentIndex: int(r.uvarint()),
+			ChildIndex:  int(r.uvarint()),
+			Hash:        r.hash(),
+		})
+	}
+	if r.err != nil {
+		return r.err
+	}
+	*p = decoded
+	return nil
+}
+
+// proofReader consumes an encoded proof, remembering the first error
+type proofReader struct {
+	data []byte
+	err  error
+}
+
+// uvarint consumes a uvarint
+func (r *proofReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		r.err = errShortProof
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+// hash consumes a 32-byte hash
+func (r *proofReader) hash() common.Hash {
+	if r.err != nil {
+		return common.Hash{}
+	}
+	if len(r.data) < common.HashLength {
+		r.err = errShortProof
+		return common.Hash{}
+	}
+	h := common.BytesToHash(r.data[:common.HashLength])
+	r.data = r.data[common.HashLength:]
+	return h
+}
@@ -0,0 +1,59 @@
+package verifier
+
+// Layout locates parents and children in the levels of a tree. Children are
+// grouped in order, K per parent, except that a balanced layout splits the
+// last two groups of a level evenly instead of leaving the last one short.
+type Layout struct {
+	K        int
+	Balanced bool
+	Widths   []int // Nodes per level, leaves first, padding excluded
+}
+
+// NewLayout returns the layout of a tree of arity k over leafCount leaves
+func NewLayout(k, leafCount int, balanced bool) Layout {
+	l := Layout{K: k, Balanced: balanced, Widths: []int{leafCount}}
+	for width := leafCount; width > 1; {
+		width = (width + k - 1) / k
+		l.Widths = append(l.Widths, width)
+	}
+	return l
+}
+
+// split returns, for a level of width nodes, where the last two groups start
+// and the size of the first of them; ok is false when no group is balanced
+func (l Layout) split(width int) (start, size int, ok bool) {
+	groups := (width + l.K - 1) / l.K
+	if !l.Balanced || groups < 2 {
+		return 0, 0, false
+	}
+	start = (groups - 2) * l.K
+	return start, (width - start + 1) / 2, true
+}
+
+// Parent returns the index of the parent of node i of a level
+func (l Layout) Parent(level, i int) int {
+	if start, size, ok := l.split(l.Widths[level]); ok && i >= start {
+		if i < start+size {
+			return start / l.K
+		}
+		return start/l.K + 1
+	}
+	return i / l.K
+}
+
+// Children returns the index range [first, end) of the children of node p,
+// in the level below the given one. Padding is not included.
+func (l Layout) Children(level, p int) (first, end int) {
+	width := l.Widths[level-1]
+	if start, size, ok := l.split(width); ok && p >= start/l.K {
+		if p == start/l.K {
+			return start, start + size
+		}
+		return start + size, width
+	}
+	first, end = p*l.K, (p+1)*l.K
+	if end > width {
+		end = width
+	}
+	return first, end
+}
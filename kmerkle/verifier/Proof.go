@@ -0,0 +1,223 @@
+// Package verifier reconstructs K-ary Merkle roots from proofs. It knows
+// nothing of the trees that produce the proofs and depends only on hashes, so
+// it can be embedded in a verifier process or compiled to WASM on its own.
+package verifier
+
+import (
+	"encoding/binary"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Hasher computes the digest of the concatenation of its inputs
+type Hasher func(data ...[]byte) common.Hash
+
+// Domain separation prefixes of node preimages. Without them a leaf could
+// carry the concatenated children of an interior node, proving a value that
+// is no leaf at all (a second preimage of the path).
+const (
+	LeafPrefix byte = 0x00
+	NodePrefix byte = 0x01
+)
+
+// ProofLevel holds the siblings of a node on the path to the root, in child
+// order, and the position among them where the node itself belongs
+type ProofLevel struct {
+	Position int           // Child index of the node within its parent
+	Siblings []common.Hash // The other children of the parent, up to K-1
+}
+
+// Proof is a K-ary Merkle proof for a single leaf, ordered from the leaf up
+// The proof never says how the tree hashes its nodes: the verifier picks
+// VerifyProof or VerifyLegacyProof, so a proof cannot opt out of domain
+// separation.
+type Proof struct {
+	K      int // Arity of the tree
+	Levels []ProofLevel
+}
+
+// ProofNode is a sibling hash together with its position. Level 0 holds the
+// leaves; the node is child ChildIndex of node ParentIndex one level up, so
+// its own index in its level is ParentIndex*K + ChildIndex for the tree's
+// arity K, unless the tree is balanced (see Layout).
+type ProofNode struct {
+	Level       int
+	ParentIndex int
+	ChildIndex  int
+	Hash        common.Hash
+}
+
+// MultiProof proves a set of leaves with the sibling hashes a verifier cannot
+// recompute from them
+type MultiProof struct {
+	K         int           // Arity of the tree
+	Padded    bool          // Tree pads last groups to K children with canonical empty nodes
+	Balanced  bool          // Tree splits the last two groups evenly, see Layout
+	LeafCount int           // Number of leaves in the tree
+	Indices   []int         // Leaf positions of the proven hashes, ascending
+	Leaves    []common.Hash // Proven leaf hashes, matching Indices
+	Nodes     []ProofNode   // Sibling hashes, ordered by level, parent and child index
+}
+
+// MarshalBinary encodes the multiproof: uvarints K (times eight, plus one if
+// padded and two if balanced, four is reserved), leaf count and number of
+// proven leaves, each proven leaf as uvarint index and hash, then each proof
+// node as uvarint level, parent index and child index followed by its hash
+func (p *MultiProof) MarshalBinary() ([]byte, error) {
+	header := uint64(p.K) << 3
+	if p.Padded {
+		header |= 1
+	}
+	if p.Balanced {
+		header |= 2
+	}
+	out := binary.AppendUvarint(nil, header)
+	out = binary.AppendUvarint(out, uint64(p.LeafCount))
+	out = binary.AppendUvarint(out, uint64(len(p.Indices)))
+	for i, index := range p.Indices {
+		out = binary.AppendUvarint(out, uint64(index))
+		out = append(out, p.Leaves[i].Bytes()...)
+	}
+	for _, n := range p.Nodes {
+		out = binary.AppendUvarint(out, uint64(n.Level))
+		out = binary.AppendUvarint(out, uint64(n.ParentIndex))
+		out = binary.AppendUvarint(out, uint64(n.ChildIndex))
+		out = append(out, n.Hash.Bytes()...)
+	}
+	return out, nil
+}
+
+// LeafHash returns the hash of a leaf node: H(0x00 || leaf), or the leaf
+// itself in a legacy tree
+func LeafHash(hasher Hasher, legacy bool, leaf common.Hash) common.Hash {
+	if legacy {
+		return leaf
+	}
+	return hasher([]byte{LeafPrefix}, leaf[:])
+}
+
+// InteriorHash returns the hash of an interior node: H(0x01 || children), or
+// H(children) in a legacy tree
+func InteriorHash(hasher Hasher, legacy bool, children []common.Hash) common.Hash {
+	buf := make([]byte, 0, 1+len(children)*common.HashLength)
+	if !legacy {
+		buf = append(buf, NodePrefix)
+	}
+	for _, child := range children {
+		buf = append(buf, child[:]...)
+	}
+	return hasher(buf)
+}
+
+// pickHasher returns the optional hasher argument, defaulting to Keccak256
+func pickHasher(hashers []Hasher) Hasher {
+	if len(hashers) > 0 && hashers[0] != nil {
+		return hashers[0]
+	}
+	return crypto.Keccak256Hash
+}
+
+// VerifyProof checks a single proof for a leaf hash against a root by
+// hashing the leaf, then inserting the running hash among the siblings of
+// every level and hashing the children. An optional hasher replaces the
+// default Keccak256.
+func VerifyProof(root common.Hash, leaf common.Hash, proof Proof, hasher ...Hasher) bool {
+	return verifyProof(pickHasher(hasher), false, root, leaf, proof)
+}
+
+// VerifyLegacyProof checks a single proof of a tree hashed without domain
+// separation, see VerifyProof. Such a tree cannot tell leaves from interior
+// nodes, so only use it for roots computed before domain separation.
+func VerifyLegacyProof(root common.Hash, leaf common.Hash, proof Proof, hasher ...Hasher) bool {
+	return verifyProof(pickHasher(hasher), true, root, leaf, proof)
+}
+
+// verifyProof checks a single proof, hashing nodes as a legacy tree if set
+func verifyProof(hashFn Hasher, legacy bool, root common.Hash, leaf common.Hash, proof Proof) bool {
+	hash := LeafHash(hashFn, legacy, leaf)
+	var children []common.Hash
+	for _, level := range proof.Levels {
+		if level.Position < 0 || level.Position > len(level.Siblings) {
+			return false
+		}
+		children = append(children[:0], level.Siblings[:level.Position]...)
+		children = append(children, hash)
+		children = append(children, level.Siblings[level.Position:]...)
+		hash = InteriorHash(hashFn, legacy, children)
+	}
+	return hash == root
+}
+
+// VerifyMultiProof checks that every target is proven by the multiproof and
+// that the proof reproduces the root. Each level is rebuilt parent by parent,
+// taking every child either from the recomputed nodes or from the proof, and
+// every proof node must be used exactly once. An optional hasher replaces the
+// default Keccak256.
+func VerifyMultiProof(root common.Hash, targets []common.Hash, proof *MultiProof, hasher ...Hasher) bool {
+	return verifyMultiProof(pickHasher(hasher), false, root, targets, proof)
+}
+
+// VerifyLegacyMultiProof checks a multiproof of a tree hashed without domain
+// separation, see VerifyMultiProof and VerifyLegacyProof
+func VerifyLegacyMultiProof(root common.Hash, targets []common.Hash, proof *MultiProof, hasher ...Hasher) bool {
+	return verifyMultiProof(pickHasher(hasher), true, root, targets, proof)
+}
+
+// verifyMultiProof checks a multiproof, hashing nodes as a legacy tree if set
+func verifyMultiProof(hashFn Hasher, legacy bool, root common.Hash, targets []common.Hash, proof *MultiProof) bool {
+	if proof.K < 2 || (proof.Padded && proof.Balanced) || len(proof.Indices) == 0 || len(proof.Indices) != len(proof.Leaves) {
+		return false
+	}
+	covered := make(map[common.Hash]bool, len(proof.Leaves))
+	known := make(map[int]common.Hash, len(proof.Indices))
+	for i, index := range proof.Indices {
+		if index < 0 || index >= proof.LeafCount {
+			return false
+		}
+		covered[proof.Leaves[i]] = true
+		known[index] = LeafHash(hashFn, legacy, proof.Leaves[i])
+	}
+	for _, h := range targets {
+		if !covered[h] {
+			return false
+		}
+	}
+
+	siblings := make(map[[3]int]common.Hash, len(proof.Nodes))
+	for _, n := range proof.Nodes {
+		if n.ChildIndex < 0 || n.ChildIndex >= proof.K {
+			return false
+		}
+		siblings[[3]int{n.Level, n.ParentIndex, n.ChildIndex}] = n.Hash
+	}
+	l := NewLayout(proof.K, proof.LeafCount, proof.Balanced)
+	used := 0
+	for level := 0; level+1 < len(l.Widths); level++ {
+		parents := make(map[int]common.Hash)
+		for index := range known {
+			parent := l.Parent(level, index)
+			if _, done := parents[parent]; done {
+				continue
+			}
+			first, last := l.Children(level+1, parent)
+			if proof.Padded {
+				last = first + proof.K
+			}
+			children := make([]common.Hash, 0, last-first)
+			for child := first; child < last; child++ {
+				hash, ok := known[child]
+				if !ok {
+					if hash, ok = siblings[[3]int{level, parent, child - first}]; !ok {
+						return false
+					}
+					used++
+				}
+				children = append(children, hash)
+			}
+			parents[parent] = InteriorHash(hashFn, legacy, children)
+		}
+		known = parents
+	}
+	return used == len(proof.Nodes) && known[0] == root
+}
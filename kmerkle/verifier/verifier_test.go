@@ -0,0 +1,96 @@
+package verifier
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestVerify_HandBuiltTree(t *testing.T) {
+	// Arity 2 over three leaves: the last group holds leaf c alone
+	a, b, c := crypto.Keccak256Hash([]byte("a")), crypto.Keccak256Hash([]byte("b")), crypto.Keccak256Hash([]byte("c"))
+	hasher := Hasher(crypto.Keccak256Hash)
+	la, lb, lc := LeafHash(hasher, false, a), LeafHash(hasher, false, b), LeafHash(hasher, false, c)
+	left := InteriorHash(hasher, false, []common.Hash{la, lb})
+	right := InteriorHash(hasher, false, []common.Hash{lc})
+	root := InteriorHash(hasher, false, []common.Hash{left, right})
+
+	proof := Proof{Levels: []ProofLevel{{Position: 1, Siblings: []common.Hash{la}}, {Position: 0, Siblings: []common.Hash{right}}}}
+	if !VerifyProof(root, b, proof) {
+		t.Errorf("Error: Expected proof of b to verify")
+	}
+	if VerifyProof(root, a, proof) {
+		t.Errorf("Error: Expected proof of b not to verify a")
+	}
+
+	multi := &MultiProof{K: 2, LeafCount: 3, Indices: []int{0, 2}, Leaves: []common.Hash{a, c},
+		Nodes: []ProofNode{{Level: 0, ParentIndex: 0, ChildIndex: 1, Hash: lb}}}
+	if !VerifyMultiProof(root, []common.Hash{a, c}, multi) {
+		t.Errorf("Error: Expected multiproof of a and c to verify")
+	}
+	multi.Nodes = append(multi.Nodes, ProofNode{Level: 1, ParentIndex: 0, ChildIndex: 1, Hash: right})
+	if VerifyMultiProof(root, []common.Hash{a, c}, multi) {
+		t.Errorf("Error: Expected an unused proof node to fail")
+	}
+
+	// A proof cannot opt out of domain separation: an empty proof of the root
+	// itself only verifies when the caller asks for a legacy tree
+	single := &MultiProof{K: 4, LeafCount: 1, Indices: []int{0}, Leaves: []common.Hash{root}}
+	if VerifyProof(root, root, Proof{K: 4}) || VerifyMultiProof(root, []common.Hash{root}, single) {
+		t.Errorf("Error: Expected the root not to verify as its own leaf")
+	}
+	if !VerifyLegacyProof(root, root, Proof{K: 4}) || !VerifyLegacyMultiProof(root, []common.Hash{root}, single) {
+		t.Errorf("Error: Expected a single leaf legacy tree to verify")
+	}
+
+	l := NewLayout(16, 17, true)
+	if first, end := l.Children(1, 1); first != 9 || end != 17 || l.Parent(0, 8) != 0 || l.Parent(0, 9) != 1 {
+		t.Errorf("Error: Expected 17 leaves of a balanced layout split 9 + 8")
+	}
+}
+
+func TestVerifyBatch_ReusesSharedNodes(t *testing.T) {
+	// Arity 4 over 16 leaves: four groups under one root
+	hasher := Hasher(crypto.Keccak256Hash)
+	leaves := make([]common.Hash, 16)
+	hashed := make([]common.Hash, 16)
+	for i := range leaves {
+		leaves[i] = crypto.Keccak256Hash([]byte{byte(i)})
+		hashed[i] = LeafHash(hasher, false, leaves[i])
+	}
+	parents := make([]common.Hash, 4)
+	for p := range parents {
+		parents[p] = InteriorHash(hasher, false, hashed[4*p:4*p+4])
+	}
+	root := InteriorHash(hasher, false, parents)
+	proofOf := func(i int) Proof {
+		without := func(hashes []common.Hash, skip int) []common.Hash {
+			return append(append([]common.Hash{}, hashes[:skip]...), hashes[skip+1:]...)
+		}
+		return Proof{Levels: []ProofLevel{
+			{Position: i % 4, Siblings: without(hashed[i/4*4:i/4*4+4], i%4)},
+			{Position: i / 4, Siblings: without(parents, i/4)},
+		}}
+	}
+
+	var items []BatchItem
+	for _, i := range []int{0, 1, 2, 5, 5} {
+		items = append(items, BatchItem{Leaf: leaves[i], Proof: proofOf(i)})
+	}
+	items = append(items, BatchItem{Leaf: leaves[3], Proof: proofOf(4)})
+	result := VerifyBatch(root, items)
+	for i, want := range []bool{true, true, true, true, true, false} {
+		if result.Valid[i] != want || VerifyProof(root, items[i].Leaf, items[i].Proof) != want {
+			t.Errorf("Error: Item %d valid %v, want %v", i, result.Valid[i], want)
+		}
+	}
+	// Naive: 6 items of 3 hashes. Batch: 6 leaf hashes, the two parents and
+	// the root once each, and two nodes on the path of the wrong item
+	if result.NaiveHashes != 18 || result.Hashes != 6+2+1+2 {
+		t.Errorf("Error: Expected 18 naive and 11 batch hashes, got %d and %d", result.NaiveHashes, result.Hashes)
+	}
+	if result.Saved() <= 0.3 {
+		t.Errorf("Error: Expected the batch to save over 30%% of hashes, saved %.2f", result.Saved())
+	}
+}
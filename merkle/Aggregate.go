@@ -0,0 +1,59 @@
+package merkle
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// ProofAggregate combines the single proofs of several transactions and
+// reports how much sharing saves
+type ProofAggregate struct {
+	Naive        int         // Hashes in all single proofs together
+	Deduplicated int         // Distinct sibling positions across the single proofs
+	Minimal      int         // Hashes still needed once recomputed path nodes are dropped, as in GetRequiredHashes
+	Hashes       []ProofHash // The distinct siblings, ordered by level and index
+}
+
+// AggregateProofs generates the single proof of every transaction and merges
+// them. Siblings high up the tree repeat across proofs, so Deduplicated falls
+// below Naive as requests concentrate; Minimal additionally drops siblings the
+// verifier computes itself from other proven leaves.
+func (mt *MerkleTree) AggregateProofs(txs []*types.Transaction) (ProofAggregate, error) {
+	var agg ProofAggregate
+	seen := make(map[[2]int]bool)
+	targets := make(map[common.Hash]bool, len(txs))
+	for _, tx := range txs {
+		index := mt.findLeafIndex(tx.Hash())
+		if index < 0 {
+			return ProofAggregate{}, fmt.Errorf("transaction %s not in tree", tx.Hash().Hex())
+		}
+		if targets[tx.Hash()] {
+			continue
+		}
+		targets[tx.Hash()] = true
+
+		proof := mt.proofAt(index)
+		agg.Naive += len(proof.Hashes)
+		for level, hash := range proof.Hashes {
+			// Record where the hash was taken from, a padding copy being its own node
+			position := [2]int{level, mt.siblingIndex(level, index>>level)}
+			if seen[position] {
+				continue
+			}
+			seen[position] = true
+			agg.Hashes = append(agg.Hashes, ProofHash{Level: position[0], Index: position[1], Hash: hash})
+		}
+	}
+	sort.Slice(agg.Hashes, func(i, j int) bool {
+		if agg.Hashes[i].Level != agg.Hashes[j].Level {
+			return agg.Hashes[i].Level < agg.Hashes[j].Level
+		}
+		return agg.Hashes[i].Index < agg.Hashes[j].Index
+	})
+	agg.Deduplicated = len(agg.Hashes)
+	agg.Minimal = len(mt.requiredHashSet(targets))
+	return agg, nil
+}
@@ -0,0 +1,107 @@
+package merkle
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// CompactMerkleTree retains only the leaf hashes and the root, so a tree over
+// millions of transactions needs a single hash per leaf instead of a node per
+// leaf and interior position. Interior hashes are recomputed for each proof.
+type CompactMerkleTree struct {
+	leaves []common.Hash // Leaf hashes in order
+	root   common.Hash   // Root hash, zero for an empty tree
+}
+
+// NewCompactMerkleTree builds a compact tree over the transactions. Its root
+// equals that of NewMerkleTree over the same transactions.
+func NewCompactMerkleTree(transactions []*types.Transaction) *CompactMerkleTree {
+	leaves := make([]common.Hash, len(transactions))
+	for i, tx := range transactions {
+		leaves[i] = tx.Hash()
+	}
+	return NewCompactMerkleTreeFromHashes(leaves)
+}
+
+// NewCompactMerkleTreeFromHashes builds a compact tree whose leaves are the given hashes
+func NewCompactMerkleTreeFromHashes(hashes []common.Hash) *CompactMerkleTree {
+	ct := &CompactMerkleTree{leaves: hashes}
+	if len(hashes) > 0 {
+		ct.root = ct.nodeHash(ct.height(), 0)
+	}
+	return ct
+}
+
+// Root returns the root hash of the tree
+func (ct *CompactMerkleTree) Root() common.Hash {
+	return ct.root
+}
+
+// Len returns the number of leaves
+func (ct *CompactMerkleTree) Len() int {
+	return len(ct.leaves)
+}
+
+// GetProofByIndex recomputes the sibling hashes for the leaf at index. Each
+// sibling is the root of a subtree rebuilt from the leaves, which costs O(n)
+// hashing per proof but only O(log n) extra memory.
+func (ct *CompactMerkleTree) GetProofByIndex(index int) (Proof, error) {
+	if index < 0 || index >= len(ct.leaves) {
+		return Proof{}, fmt.Errorf("leaf index %d out of range [0, %d)", index, len(ct.leaves))
+	}
+	var proof Proof
+	for level := 0; level < ct.height(); level++ {
+		position := index >> level
+		sibling := position ^ 1
+		if sibling >= ct.width(level) {
+			// The last node of an odd-sized level is paired with its own copy
+			sibling = position
+		}
+		proof.Hashes = append(proof.Hashes, ct.nodeHash(level, sibling))
+		proof.Left = append(proof.Left, position&1 == 1)
+	}
+	return proof, nil
+}
+
+// GetProof recomputes the proof for a specific transaction
+func (ct *CompactMerkleTree) GetProof(tx *types.Transaction) (Proof, error) {
+	hash := tx.Hash()
+	for i, leaf := range ct.leaves {
+		if leaf == hash {
+			return ct.GetProofByIndex(i)
+		}
+	}
+	return Proof{}, fmt.Errorf("transaction %s not in tree", hash.Hex())
+}
+
+// width returns the number of nodes at the given level
+func (ct *CompactMerkleTree) width(level int) int {
+	width := len(ct.leaves)
+	for ; level > 0; level-- {
+		width = (width + 1) / 2
+	}
+	return width
+}
+
+// height returns the number of levels above the leaves
+func (ct *CompactMerkleTree) height() int {
+	height := 0
+	for width := len(ct.leaves); width > 1; width = (width + 1) / 2 {
+		height++
+	}
+	return height
+}
+
+// nodeHash recomputes the hash of the node at (level, index)
+func (ct *CompactMerkleTree) nodeHash(level, index int) common.Hash {
+	if level == 0 {
+		return ct.leaves[index]
+	}
+	left := ct.nodeHash(level-1, 2*index)
+	if 2*index+1 >= ct.width(level-1) {
+		return combineHashes(left, left)
+	}
+	return combineHashes(left, ct.nodeHash(level-1, 2*index+1))
+}
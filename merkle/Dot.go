@@ -0,0 +1,74 @@
+package merkle
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Fill colours of highlighted nodes
+const (
+	dotTargetColor = "#9be39b" // Requested leaves
+	dotProofColor  = "#ffc266" // Sibling hashes the verifier needs
+	dotPathColor   = "#cce0ff" // Nodes the verifier recomputes
+)
+
+// WriteDOT renders the tree as a Graphviz digraph, highlighting the requested
+// transactions, the proof hashes GetRequiredHashes counts for them and the
+// nodes recomputed on the way to the root. With maxLevels > 0 only the top
+// maxLevels levels are drawn, which keeps large trees readable. Duplicated
+// padding nodes are drawn dashed.
+func (mt *MerkleTree) WriteDOT(w io.Writer, targets []*types.Transaction, maxLevels int) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "digraph merkle {")
+	fmt.Fprintln(bw, "\tnode [fontname=\"monospace\", fontsize=10, style=filled, fillcolor=white];")
+
+	colors := make(map[[2]int]string)
+	targetHashes := make(map[common.Hash]bool, len(targets))
+	for _, tx := range targets {
+		targetHashes[tx.Hash()] = true
+	}
+	for i, leaf := range mt.Nodes {
+		if !targetHashes[leaf.Hash] {
+			continue
+		}
+		colors[[2]int{0, i}] = dotTargetColor
+		for level, index := 1, i/2; level < len(mt.levels); level, index = level+1, index/2 {
+			colors[[2]int{level, index}] = dotPathColor
+		}
+	}
+	for _, h := range mt.requiredHashSet(targetHashes) {
+		colors[[2]int{h.Level, h.Index}] = dotProofColor
+	}
+
+	top := len(mt.levels) - 1
+	lowest := 0
+	if maxLevels > 0 && top-maxLevels+1 > 0 {
+		lowest = top - maxLevels + 1
+	}
+	for level := top; level >= lowest; level-- {
+		for index, node := range mt.levels[level] {
+			attrs := ""
+			if color, ok := colors[[2]int{level, index}]; ok {
+				attrs = fmt.Sprintf(", fillcolor=\"%s\"", color)
+			}
+			fmt.Fprintf(bw, "\tl%d_%d [label=\"%x\\n(%d,%d)\"%s];\n", level, index, node.Hash[:4], level, index, attrs)
+			if level == lowest {
+				continue
+			}
+			below := mt.levels[level-1]
+			fmt.Fprintf(bw, "\tl%d_%d -> l%d_%d;\n", level, index, level-1, 2*index)
+			if 2*index+1 < len(below) {
+				fmt.Fprintf(bw, "\tl%d_%d -> l%d_%d;\n", level, index, level-1, 2*index+1)
+			} else {
+				fmt.Fprintf(bw, "\tl%d_%d_dup [label=\"%x\\ncopy\", style=\"filled,dashed\"];\n", level-1, 2*index, below[2*index].Hash[:4])
+				fmt.Fprintf(bw, "\tl%d_%d -> l%d_%d_dup [style=dashed];\n", level, index, level-1, 2*index)
+			}
+		}
+	}
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
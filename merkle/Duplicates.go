@@ -0,0 +1,86 @@
+package merkle
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// DuplicatePolicy decides how construction treats transactions that occur
+// more than once. Lookups by transaction (GetProof, GetRequiredHashes,
+// GetMultiProof) find leaves by hash, so with plain duplicates they cannot
+// tell the copies apart and disagree about which leaf is meant.
+type DuplicatePolicy int
+
+const (
+	// DuplicatesAllow keeps every copy as an ordinary leaf, as NewMerkleTree does
+	DuplicatesAllow DuplicatePolicy = iota
+	// DuplicatesDeduplicate keeps only the first occurrence of each transaction
+	DuplicatesDeduplicate
+	// DuplicatesReject fails construction if any transaction occurs twice
+	DuplicatesReject
+	// DuplicatesIndexQualify keeps every copy but gives repeated occurrences the
+	// leaf hash QualifiedLeafHash(tx hash, index). The first occurrence stays the
+	// leaf all lookups by transaction resolve to; later copies are proven with
+	// GetProofByIndex and VerifyProofAt against their qualified hash.
+	DuplicatesIndexQualify
+)
+
+// NewMerkleTreeWithPolicy creates a Merkle tree applying the given policy to
+// duplicate transactions. The policy only governs construction; Append and
+// UpdateLeaf do not check for duplicates.
+func NewMerkleTreeWithPolicy(transactions []*types.Transaction, policy DuplicatePolicy) (*MerkleTree, error) {
+	seen := make(map[common.Hash]int, len(transactions))
+	switch policy {
+	case DuplicatesAllow:
+		return NewMerkleTree(transactions), nil
+
+	case DuplicatesDeduplicate:
+		unique := make([]*types.Transaction, 0, len(transactions))
+		for _, tx := range transactions {
+			if _, ok := seen[tx.Hash()]; !ok {
+				seen[tx.Hash()] = len(unique)
+				unique = append(unique, tx)
+			}
+		}
+		return NewMerkleTree(unique), nil
+
+	case DuplicatesReject:
+		for i, tx := range transactions {
+			if first, ok := seen[tx.Hash()]; ok {
+				return nil, fmt.Errorf("transaction %s at index %d duplicates index %d", tx.Hash().Hex(), i, first)
+			}
+			seen[tx.Hash()] = i
+		}
+		return NewMerkleTree(transactions), nil
+
+	case DuplicatesIndexQualify:
+		tree := &MerkleTree{Transactions: transactions}
+		nodes := make([]*MerkleTreeNode, len(transactions))
+		for i, tx := range transactions {
+			hash := tx.Hash()
+			if _, ok := seen[hash]; ok {
+				hash = QualifiedLeafHash(hash, i)
+			} else {
+				seen[hash] = i
+			}
+			nodes[i] = &MerkleTreeNode{Hash: hash, Tx: tx}
+		}
+		tree.buildTree(nodes)
+		return tree, nil
+
+	default:
+		return nil, fmt.Errorf("unknown duplicate policy %d", policy)
+	}
+}
+
+// QualifiedLeafHash returns the leaf hash of a repeated transaction at the
+// given index under DuplicatesIndexQualify: Keccak256(txHash || uint64BE(index))
+func QualifiedLeafHash(txHash common.Hash, index int) common.Hash {
+	var position [8]byte
+	binary.BigEndian.PutUint64(position[:], uint64(index))
+	return crypto.Keccak256Hash(txHash.Bytes(), position[:])
+}
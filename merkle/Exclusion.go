@@ -0,0 +1,119 @@
+package merkle
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// NewMerkleTreeWithSortedLeaves creates a Merkle tree whose leaves are ordered
+// by transaction hash instead of block position. Absent transactions can then
+// be proven by their would-be neighbours with GetExclusionProof.
+func NewMerkleTreeWithSortedLeaves(transactions []*types.Transaction) *MerkleTree {
+	sorted := append([]*types.Transaction{}, transactions...)
+	sort.Slice(sorted, func(i, j int) bool {
+		hi, hj := sorted[i].Hash(), sorted[j].Hash()
+		return bytes.Compare(hi.Bytes(), hj.Bytes()) < 0
+	})
+	tree := &MerkleTree{
+		Transactions: sorted,
+		sortedLeaves: true,
+	}
+	tree.createTree()
+	return tree
+}
+
+// NeighborProof proves the leaf at a position next to an absent hash
+type NeighborProof struct {
+	Index int         // Leaf position
+	Hash  common.Hash // Leaf hash
+	Proof Proof       // Inclusion proof of the leaf at Index
+}
+
+// ExclusionProof proves that a hash is not a leaf of a tree with sorted
+// leaves. Left is the largest smaller leaf and Right the smallest larger one;
+// either is nil when the hash lies before the first or after the last leaf.
+type ExclusionProof struct {
+	Left  *NeighborProof
+	Right *NeighborProof
+}
+
+// GetExclusionProof proves that hash is not among the leaves. It requires a
+// tree built by NewMerkleTreeWithSortedLeaves that was not modified since.
+func (mt *MerkleTree) GetExclusionProof(hash common.Hash) (ExclusionProof, error) {
+	if !mt.sortedLeaves {
+		return ExclusionProof{}, errors.New("exclusion proofs need a tree with sorted leaves")
+	}
+	if len(mt.Nodes) == 0 {
+		return ExclusionProof{}, errors.New("empty tree")
+	}
+	pos := sort.Search(len(mt.Nodes), func(i int) bool {
+		return bytes.Compare(mt.Nodes[i].Hash.Bytes(), hash.Bytes()) >= 0
+	})
+	if pos < len(mt.Nodes) && mt.Nodes[pos].Hash == hash {
+		return ExclusionProof{}, errors.New("hash is a leaf of the tree")
+	}
+	var proof ExclusionProof
+	if pos > 0 {
+		proof.Left = mt.neighborProof(pos - 1)
+	}
+	if pos < len(mt.Nodes) {
+		proof.Right = mt.neighborProof(pos)
+	}
+	return proof, nil
+}
+
+// neighborProof builds the inclusion proof of the leaf at index
+func (mt *MerkleTree) neighborProof(index int) *NeighborProof {
+	return &NeighborProof{Index: index, Hash: mt.Nodes[index].Hash, Proof: mt.proofAt(index)}
+}
+
+// VerifyExclusionProof checks that hash is absent from the sorted-leaf tree
+// with the given root. Both neighbours must be proven at adjacent positions
+// and enclose hash. A missing neighbour is only accepted at the edges: the
+// right one must be leaf 0, and the left one must be the last leaf, which its
+// proof shows by pairing with its own copy wherever it is a left child.
+func VerifyExclusionProof(root, hash common.Hash, proof ExclusionProof) bool {
+	left, right := proof.Left, proof.Right
+	if left == nil && right == nil {
+		return false
+	}
+	if left != nil {
+		if bytes.Compare(left.Hash.Bytes(), hash.Bytes()) >= 0 || !VerifyProofAt(root, left.Index, left.Hash, left.Proof) {
+			return false
+		}
+	}
+	if right != nil {
+		if bytes.Compare(hash.Bytes(), right.Hash.Bytes()) >= 0 || !VerifyProofAt(root, right.Index, right.Hash, right.Proof) {
+			return false
+		}
+	}
+	switch {
+	case left != nil && right != nil:
+		return right.Index == left.Index+1
+	case right != nil:
+		return right.Index == 0
+	default:
+		return isLastLeaf(left)
+	}
+}
+
+// isLastLeaf reports whether a proven leaf is the last of its tree: at every
+// level where the path goes through a left child, the sibling is its copy
+func isLastLeaf(n *NeighborProof) bool {
+	hash := n.Hash
+	for level, sibling := range n.Proof.Hashes {
+		if (n.Index>>level)&1 == 1 {
+			hash = combineHashes(sibling, hash)
+			continue
+		}
+		if sibling != hash {
+			return false
+		}
+		hash = combineHashes(hash, sibling)
+	}
+	return true
+}
@@ -1,6 +1,8 @@
 package merkle
 
 import (
+	"bytes"
+	"fmt"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -10,18 +12,27 @@ import (
 
 // MerkleTreeNode represents a node in the Merkle tree
 type MerkleTreeNode struct {
-	Parent *MerkleTreeNode    // Parent node in the tree
+	Parent *MerkleTreeNode    // Parent node when this node was created; not updated for shared subtrees
 	Left   *MerkleTreeNode    // Left child node
 	Right  *MerkleTreeNode    // Right child node
 	Hash   common.Hash        // Hash value of this node
 	Tx     *types.Transaction // Ethereum transaction (only for leaf nodes)
+
+	duplicate bool // Copy of the left sibling padding an odd-sized level
 }
 
-// MerkleTree represents the complete Merkle tree structure
+// MerkleTree represents the complete Merkle tree structure. Its nodes are never
+// modified after creation, so any number of goroutines may read a tree and
+// generate proofs concurrently. Append and UpdateLeaf change the tree itself
+// and need exclusive access; WithUpdatedLeaf derives a new version instead.
 type MerkleTree struct {
 	Transactions []*types.Transaction // List of transactions in the tree
 	Nodes        []*MerkleTreeNode    // All nodes in the tree
 	Root         *MerkleTreeNode      // Root node of the tree
+
+	levels       [][]*MerkleTreeNode // Nodes of every level without duplicates, leaves first
+	sorted       bool                // Pairs are sorted before hashing
+	sortedLeaves bool                // Leaves are in ascending hash order, enabling exclusion proofs
 }
 
 // NewMerkleTree creates and initializes a new Merkle tree from transactions
@@ -33,22 +44,82 @@ func NewMerkleTree(transactions []*types.Transaction) *MerkleTree {
 	return tree
 }
 
-// createTree constructs the Merkle tree and returns the time taken
-func (mt *MerkleTree) createTree() time.Duration {
+// BuildStats describes the construction of a tree
+type BuildStats struct {
+	Duration    time.Duration // Time spent hashing leaves and building levels
+	Nodes       int           // Nodes created, including duplicated padding nodes
+	Height      int           // Number of levels above the leaves
+	BytesHashed int           // Bytes fed to the hash function, leaf encodings included
+}
+
+// NewMerkleTreeWithStats creates a Merkle tree like NewMerkleTree and reports
+// how its construction went
+func NewMerkleTreeWithStats(transactions []*types.Transaction) (*MerkleTree, BuildStats) {
+	tree := &MerkleTree{
+		Transactions: transactions,
+	}
+	stats := tree.createTree()
+	return tree, stats
+}
+
+// NewMerkleTreeFromLeaves creates a Merkle tree over arbitrary data, using the
+// Keccak256 hash of each leaf, so receipts, state chunks or synthetic data can
+// reuse the tree and proof machinery
+func NewMerkleTreeFromLeaves(leaves [][]byte) *MerkleTree {
+	hashes := make([]common.Hash, len(leaves))
+	for i, leaf := range leaves {
+		hashes[i] = crypto.Keccak256Hash(leaf)
+	}
+	return NewMerkleTreeFromHashes(hashes)
+}
+
+// NewMerkleTreeFromHashes creates a Merkle tree whose leaves are the given hashes
+func NewMerkleTreeFromHashes(hashes []common.Hash) *MerkleTree {
+	tree := &MerkleTree{}
+	nodes := make([]*MerkleTreeNode, len(hashes))
+	for i, hash := range hashes {
+		nodes[i] = &MerkleTreeNode{Hash: hash}
+	}
+	tree.buildTree(nodes)
+	return tree
+}
+
+// createTree constructs the Merkle tree and returns its build statistics
+func (mt *MerkleTree) createTree() BuildStats {
 	start := time.Now()
 
 	// Create leaf nodes from transactions
-	var nodes []*MerkleTreeNode
-	for _, tx := range mt.Transactions {
+	arena := make([]MerkleTreeNode, len(mt.Transactions))
+	nodes := make([]*MerkleTreeNode, len(mt.Transactions))
+	leafBytes := 0
+	for i, tx := range mt.Transactions {
 		hash := tx.Hash() // Get transaction hash
-		node := &MerkleTreeNode{Hash: hash, Tx: tx}
-		nodes = append(nodes, node)
+		arena[i] = MerkleTreeNode{Hash: hash, Tx: tx}
+		nodes[i] = &arena[i]
+		leafBytes += int(tx.Size())
 	}
+	stats := mt.buildTree(nodes)
+	stats.BytesHashed += leafBytes
+	stats.Duration = time.Since(start)
+	return stats
+}
+
+// buildTree builds all levels above the given leaf nodes, reporting the nodes
+// created and the interior bytes hashed
+func (mt *MerkleTree) buildTree(nodes []*MerkleTreeNode) BuildStats {
 	mt.Nodes = nodes
+	mt.levels = [][]*MerkleTreeNode{nodes}
+	stats := BuildStats{Nodes: len(nodes)}
+	if len(nodes) == 0 {
+		// An empty tree has no root until the first Append
+		return stats
+	}
 
 	// Build tree structure from bottom up
 	for len(nodes) > 1 {
-		var newLevel []*MerkleTreeNode
+		// Parents of a level share one backing array instead of one allocation each
+		arena := make([]MerkleTreeNode, (len(nodes)+1)/2)
+		newLevel := make([]*MerkleTreeNode, 0, len(arena))
 
 		for i := 0; i < len(nodes); i += 2 {
 			left := nodes[i]
@@ -59,14 +130,17 @@ func (mt *MerkleTree) createTree() time.Duration {
 			} else {
 				// If odd number of nodes, duplicate the last node
 				right = &MerkleTreeNode{
-					Hash: left.Hash,
-					Tx:   left.Tx,
+					Hash:      left.Hash,
+					Tx:        left.Tx,
+					duplicate: true,
 				}
+				stats.Nodes++
 			}
 
 			// Combine left and right hashes to create parent hash
 			combinedHash := mt.computeCombinedHash(left.Hash, right.Hash)
-			parent := &MerkleTreeNode{
+			parent := &arena[i/2]
+			*parent = MerkleTreeNode{
 				Left:  left,
 				Right: right,
 				Hash:  combinedHash,
@@ -75,20 +149,173 @@ func (mt *MerkleTree) createTree() time.Duration {
 			left.Parent = parent
 			right.Parent = parent
 			newLevel = append(newLevel, parent)
+			stats.BytesHashed += 2 * common.HashLength
 		}
 
 		nodes = newLevel
+		mt.levels = append(mt.levels, nodes)
+		stats.Nodes += len(nodes)
+		stats.Height++
 	}
 
 	mt.Root = nodes[0]
-	return time.Since(start)
+	return stats
+}
+
+// Leaves returns the leaf nodes in order. The slice is a copy, the nodes are shared.
+func (mt *MerkleTree) Leaves() []*MerkleTreeNode {
+	return mt.Level(0)
+}
+
+// LeafHashes returns the leaf hashes in order
+func (mt *MerkleTree) LeafHashes() []common.Hash {
+	hashes := make([]common.Hash, len(mt.Nodes))
+	for i, node := range mt.Nodes {
+		hashes[i] = node.Hash
+	}
+	return hashes
+}
+
+// Level returns a copy of the nodes at level i, where level 0 holds the leaves
+// and the last level the root. Duplicated padding nodes are not included. It
+// returns nil for levels outside the tree.
+func (mt *MerkleTree) Level(i int) []*MerkleTreeNode {
+	if i < 0 || i >= len(mt.levels) {
+		return nil
+	}
+	return append([]*MerkleTreeNode{}, mt.levels[i]...)
+}
+
+// Append adds a transaction as the new last leaf and returns the new root.
+// Only the right spine of the tree changes, so the last node of every level is
+// replaced while all other nodes, cached per level, are kept: appending m
+// transactions costs O(m log n) hashes in total.
+func (mt *MerkleTree) Append(tx *types.Transaction) common.Hash {
+	leaf := &MerkleTreeNode{Hash: tx.Hash(), Tx: tx}
+	if n := len(mt.Nodes); n > 0 && bytes.Compare(mt.Nodes[n-1].Hash.Bytes(), leaf.Hash.Bytes()) >= 0 {
+		mt.sortedLeaves = false
+	}
+	mt.Transactions = append(mt.Transactions, tx)
+	mt.Nodes = append(mt.Nodes, leaf)
+	if len(mt.levels) == 0 {
+		mt.levels = [][]*MerkleTreeNode{nil}
+	}
+	mt.levels[0] = mt.Nodes
+
+	node := leaf
+	for level := 0; len(mt.levels[level]) > 1; level++ {
+		if level+1 == len(mt.levels) {
+			mt.levels = append(mt.levels, nil)
+		}
+		index := (len(mt.levels[level]) - 1) / 2
+		parent := mt.pairParent(mt.levels[level], index)
+		node.Parent, node = parent, parent
+		// Replace the cached parent when it exists, otherwise extend the level
+		if index < len(mt.levels[level+1]) {
+			mt.levels[level+1][index] = parent
+		} else {
+			mt.levels[level+1] = append(mt.levels[level+1], parent)
+		}
+	}
+	top := mt.levels[len(mt.levels)-1]
+	mt.Root = top[0]
+	return mt.Root.Hash
+}
+
+// AppendAll appends the transactions in order and returns the root after each
+// append, as a mempool feeding the tree would observe it
+func (mt *MerkleTree) AppendAll(txs []*types.Transaction) []common.Hash {
+	roots := make([]common.Hash, len(txs))
+	for i, tx := range txs {
+		roots[i] = mt.Append(tx)
+	}
+	return roots
+}
+
+// UpdateLeaf replaces the transaction at the given index and recomputes only
+// the hashes on the leaf's path to the root. Like Append it modifies the tree,
+// so it must not run concurrently with readers; use WithUpdatedLeaf for that.
+func (mt *MerkleTree) UpdateLeaf(index int, newTx *types.Transaction) error {
+	if index < 0 || index >= len(mt.Nodes) {
+		return fmt.Errorf("leaf index %d out of range [0, %d)", index, len(mt.Nodes))
+	}
+	if index < len(mt.Transactions) {
+		mt.Transactions[index] = newTx
+	}
+	mt.replacePath(index, newTx)
+	return nil
+}
+
+// WithUpdatedLeaf returns a copy of the tree with the transaction at the given
+// index replaced. Only the nodes on the leaf's path are new, every other node
+// is shared with the receiver, which is left untouched and may keep serving
+// proofs from other goroutines while the copy is built.
+func (mt *MerkleTree) WithUpdatedLeaf(index int, newTx *types.Transaction) (*MerkleTree, error) {
+	if index < 0 || index >= len(mt.Nodes) {
+		return nil, fmt.Errorf("leaf index %d out of range [0, %d)", index, len(mt.Nodes))
+	}
+	updated := &MerkleTree{
+		Transactions: append([]*types.Transaction{}, mt.Transactions...),
+		levels:       make([][]*MerkleTreeNode, len(mt.levels)),
+		sorted:       mt.sorted,
+	}
+	for level, nodes := range mt.levels {
+		updated.levels[level] = append([]*MerkleTreeNode{}, nodes...)
+	}
+	updated.Nodes = updated.levels[0]
+	if index < len(updated.Transactions) {
+		updated.Transactions[index] = newTx
+	}
+	updated.replacePath(index, newTx)
+	return updated, nil
+}
+
+// replacePath puts a new leaf at index and replaces every node on its path to
+// the root with a new node. Existing nodes are never modified, so subtrees
+// shared with other versions of the tree stay valid.
+func (mt *MerkleTree) replacePath(index int, tx *types.Transaction) {
+	node := &MerkleTreeNode{Hash: tx.Hash(), Tx: tx}
+	mt.levels[0][index] = node
+	mt.sortedLeaves = false // Replacing a leaf may break the hash order
+	for level := 0; level+1 < len(mt.levels); level++ {
+		index /= 2
+		parent := mt.pairParent(mt.levels[level], index)
+		mt.levels[level+1][index] = parent
+		node.Parent, node = parent, parent
+	}
+	mt.Root = mt.levels[len(mt.levels)-1][0]
+}
+
+// pairParent creates the parent of the pair at position index of a level,
+// duplicating the last node of an odd-sized level. The children are not
+// modified, callers link the child they just created themselves.
+func (mt *MerkleTree) pairParent(nodes []*MerkleTreeNode, index int) *MerkleTreeNode {
+	left := nodes[2*index]
+	var right *MerkleTreeNode
+	if 2*index+1 < len(nodes) {
+		right = nodes[2*index+1]
+	} else {
+		// If odd number of nodes, duplicate the last node
+		right = &MerkleTreeNode{Hash: left.Hash, Tx: left.Tx, duplicate: true}
+	}
+	parent := &MerkleTreeNode{
+		Left:  left,
+		Right: right,
+		Hash:  mt.computeCombinedHash(left.Hash, right.Hash),
+	}
+	if right.duplicate {
+		right.Parent = parent
+	}
+	return parent
 }
 
 // computeCombinedHash computes the hash of two combined hashes
 func (mt *MerkleTree) computeCombinedHash(hash1, hash2 common.Hash) common.Hash {
-	// Concatenate the two hashes and compute Keccak256 hash
-	data := append(hash1.Bytes(), hash2.Bytes()...)
-	return crypto.Keccak256Hash(data)
+	if mt.sorted {
+		return hashSortedPair(hash1, hash2)
+	}
+	// Hash the concatenation with a pooled Keccak256 state and buffer
+	return hashPair(hash1, hash2)
 }
 
 // GetRequiredHashes calculates the number of additional hashes needed to verify specified transactions
@@ -140,47 +367,89 @@ func (mt *MerkleTree) calculateRequiredHashes(node *MerkleTreeNode, targetHashes
 	return false, 0
 }
 
-// GetProof generates a Merkle proof for a specific transaction
-func (mt *MerkleTree) GetProof(tx *types.Transaction) []common.Hash {
-	var proof []common.Hash
-	txHash := tx.Hash()
-	node := mt.findLeafNode(txHash)
+// Proof is a Merkle proof for a single leaf. Each sibling comes with its side,
+// so the verifier hashes every pair in tree order.
+type Proof struct {
+	Hashes []common.Hash `json:"hashes"` // Sibling hashes from the leaf up to the root
+	Left   []bool        `json:"left"`   // Left[i] is true when Hashes[i] is the left sibling
+}
 
-	// Traverse up the tree to collect proof hashes
-	for node != nil && node.Parent != nil {
-		parent := node.Parent
-		if parent.Left == node {
-			// If current node is left child, add right sibling to proof
-			proof = append(proof, parent.Right.Hash)
-		} else {
-			// If current node is right child, add left sibling to proof
-			proof = append(proof, parent.Left.Hash)
-		}
-		node = parent
+// GetProof generates a Merkle proof for a specific transaction. Transactions
+// not in the tree have no proof; see GetExclusionProof for proving absence.
+func (mt *MerkleTree) GetProof(tx *types.Transaction) (Proof, error) {
+	index := mt.findLeafIndex(tx.Hash())
+	if index < 0 {
+		return Proof{}, fmt.Errorf("transaction %s not in tree", tx.Hash().Hex())
+	}
+	return mt.proofAt(index), nil
+}
+
+// GetProofByIndex generates a Merkle proof for the transaction at the given
+// position in the block
+func (mt *MerkleTree) GetProofByIndex(index int) (Proof, error) {
+	if index < 0 || index >= len(mt.Nodes) {
+		return Proof{}, fmt.Errorf("leaf index %d out of range [0, %d)", index, len(mt.Nodes))
+	}
+	return mt.proofAt(index), nil
+}
+
+// proofAt collects the sibling hashes on the path from the leaf at index to
+// the root. Siblings are looked up by position in the level cache rather than
+// through Parent links, which are not kept for subtrees shared between copies.
+func (mt *MerkleTree) proofAt(index int) Proof {
+	var proof Proof
+	for level := 0; level+1 < len(mt.levels); level++ {
+		nodes := mt.levels[level]
+		proof.Hashes = append(proof.Hashes, nodes[mt.siblingIndex(level, index)].Hash)
+		proof.Left = append(proof.Left, index&1 == 1)
+		index /= 2
 	}
 
 	return proof
 }
 
-// findLeafNode locates the leaf node containing a specific transaction hash
-func (mt *MerkleTree) findLeafNode(txHash common.Hash) *MerkleTreeNode {
-	for _, node := range mt.Nodes {
+// siblingIndex returns the position of the node paired with node index of a
+// level. The last node of an odd-sized level is paired with its own copy, so
+// its own position is returned.
+func (mt *MerkleTree) siblingIndex(level, index int) int {
+	if sibling := index ^ 1; sibling < len(mt.levels[level]) {
+		return sibling
+	}
+	return index
+}
+
+// findLeafIndex locates the leaf containing a specific transaction hash, or -1
+func (mt *MerkleTree) findLeafIndex(txHash common.Hash) int {
+	for i, node := range mt.Nodes {
 		if node.Hash == txHash {
-			return node
+			return i
 		}
 	}
-	return nil
+	return -1
 }
 
 // VerifyProof verifies a Merkle proof for a transaction
-func (mt *MerkleTree) VerifyProof(tx *types.Transaction, proof []common.Hash) bool {
-	hash := tx.Hash()
-
-	// Recompute the root hash using the proof
-	for _, proofHash := range proof {
-		hash = mt.computeCombinedHash(hash, proofHash)
+func (mt *MerkleTree) VerifyProof(tx *types.Transaction, proof Proof) bool {
+	if mt.sorted {
+		return VerifySorted(mt.Root.Hash, tx.Hash(), proof.Hashes)
 	}
+	return Verify(mt.Root.Hash, tx.Hash(), proof)
+}
 
-	// Check if the computed root matches the actual root
-	return hash == mt.Root.Hash
+// VerifyProofAt verifies that leafHash is the leaf at the given index of the
+// tree with the given root. The sibling sides follow from the index bits, so
+// a valid proof for a different position is rejected.
+func VerifyProofAt(root common.Hash, index int, leafHash common.Hash, proof Proof) bool {
+	if index < 0 || (len(proof.Hashes) < 63 && index>>len(proof.Hashes) != 0) {
+		return false
+	}
+	hash := leafHash
+	for level, proofHash := range proof.Hashes {
+		if (index>>level)&1 == 1 {
+			hash = crypto.Keccak256Hash(proofHash.Bytes(), hash.Bytes())
+		} else {
+			hash = crypto.Keccak256Hash(hash.Bytes(), proofHash.Bytes())
+		}
+	}
+	return hash == root
 }
@@ -0,0 +1,258 @@
+package merkle
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// ProofHash is a sibling hash together with its position in the tree. Level 0
+// holds the leaves; node i of a level has children 2i and 2i+1 one level below.
+type ProofHash struct {
+	Level int
+	Index int
+	Hash  common.Hash
+}
+
+// MultiProof proves a set of transactions with the minimal combined set of
+// sibling hashes, the same hashes counted by GetRequiredHashes
+type MultiProof struct {
+	LeafCount int           // Number of leaves in the tree
+	Indices   []int         // Leaf positions of the proven transactions, ascending
+	Leaves    []common.Hash // Hashes of the proven transactions, matching Indices
+	Hashes    []ProofHash   // Sibling hashes, ordered by level and index
+}
+
+// GetMultiProof generates a combined proof for the given transactions
+func (mt *MerkleTree) GetMultiProof(txs []*types.Transaction) (*MultiProof, error) {
+	positions := make(map[common.Hash]int, len(mt.Nodes))
+	for i, node := range mt.Nodes {
+		positions[node.Hash] = i
+	}
+	targets := make(map[common.Hash]bool, len(txs))
+	proof := &MultiProof{LeafCount: len(mt.Nodes)}
+	for _, tx := range txs {
+		index, ok := positions[tx.Hash()]
+		if !ok {
+			return nil, fmt.Errorf("transaction %s not in tree", tx.Hash().Hex())
+		}
+		if !targets[tx.Hash()] {
+			targets[tx.Hash()] = true
+			proof.Indices = append(proof.Indices, index)
+		}
+	}
+	sort.Ints(proof.Indices)
+	for _, index := range proof.Indices {
+		proof.Leaves = append(proof.Leaves, mt.Nodes[index].Hash)
+	}
+
+	proof.Hashes = mt.requiredHashSet(targets)
+	return proof, nil
+}
+
+// GetRequiredHashSet returns the sibling hashes counted by GetRequiredHashes,
+// with their positions, ordered by level and index. Transactions not in the
+// tree are ignored, as in the counting API.
+func (mt *MerkleTree) GetRequiredHashSet(txs []*types.Transaction) []ProofHash {
+	targets := make(map[common.Hash]bool, len(txs))
+	for _, tx := range txs {
+		targets[tx.Hash()] = true
+	}
+	return mt.requiredHashSet(targets)
+}
+
+// ProofSizeBytes returns the bytes needed to prove the transactions: the
+// multiproof as streamed by MultiProof.WriteTo, i.e. sibling hashes with their
+// positions as direction metadata, plus the binary encoding of every proven
+// transaction, which the verifier hashes itself. Transactions not in the tree
+// are ignored, as in GetRequiredHashes.
+func (mt *MerkleTree) ProofSizeBytes(txs []*types.Transaction) int {
+	leaves := make(map[common.Hash]bool, len(mt.Nodes))
+	for _, node := range mt.Nodes {
+		leaves[node.Hash] = true
+	}
+	var present []*types.Transaction
+	for _, tx := range txs {
+		if leaves[tx.Hash()] {
+			leaves[tx.Hash()] = false // Count every transaction once
+			present = append(present, tx)
+		}
+	}
+	if len(present) == 0 {
+		return 0
+	}
+	proof, err := mt.GetMultiProof(present)
+	if err != nil {
+		return 0
+	}
+	size, _ := proof.WriteTo(io.Discard)
+	for _, tx := range present {
+		size += int64(tx.Size())
+	}
+	return int(size)
+}
+
+// requiredHashSet collects and orders the sibling hashes needed for the target leaves
+func (mt *MerkleTree) requiredHashSet(targets map[common.Hash]bool) []ProofHash {
+	if len(targets) == 0 {
+		return nil
+	}
+	proof := &MultiProof{}
+	mt.collectProofHashes(mt.Root, mt.height(), 0, targets, proof)
+	sort.Slice(proof.Hashes, func(i, j int) bool {
+		if proof.Hashes[i].Level != proof.Hashes[j].Level {
+			return proof.Hashes[i].Level < proof.Hashes[j].Level
+		}
+		return proof.Hashes[i].Index < proof.Hashes[j].Index
+	})
+	return proof.Hashes
+}
+
+// height returns the number of levels above the leaves
+func (mt *MerkleTree) height() int {
+	height := 0
+	for node := mt.Root; node != nil && node.Left != nil; node = node.Left {
+		height++
+	}
+	return height
+}
+
+// collectProofHashes appends the hashes of target-free subtrees next to target
+// paths and reports whether the subtree at (level, index) contains a target.
+// As in GetRequiredHashes, the copy padding an odd level above the leaves is
+// such a subtree, while a padding copy of a proven leaf is a target itself.
+func (mt *MerkleTree) collectProofHashes(node *MerkleTreeNode, level, index int, targets map[common.Hash]bool, proof *MultiProof) bool {
+	if node == nil {
+		return false
+	}
+	if node.Left == nil && node.Right == nil {
+		return level == 0 && targets[node.Hash]
+	}
+
+	leftFound := mt.collectProofHashes(node.Left, level-1, 2*index, targets, proof)
+	rightFound := mt.collectProofHashes(node.Right, level-1, 2*index+1, targets, proof)
+	if leftFound && !rightFound {
+		proof.Hashes = append(proof.Hashes, ProofHash{Level: level - 1, Index: 2*index + 1, Hash: node.Right.Hash})
+	} else if rightFound && !leftFound {
+		proof.Hashes = append(proof.Hashes, ProofHash{Level: level - 1, Index: 2 * index, Hash: node.Left.Hash})
+	}
+	return leftFound || rightFound
+}
+
+// VerifyMultiProof checks that every given transaction is covered by the proof
+// and that the proof reproduces the root. Proofs of a tree built by
+// NewSortedMerkleTree are checked with VerifySortedMultiProof instead.
+func VerifyMultiProof(root common.Hash, txs []*types.Transaction, proof *MultiProof) bool {
+	return verifyMultiProof(root, txs, proof, combineHashes)
+}
+
+// verifyMultiProof checks a multiproof, hashing pairs with combine
+func verifyMultiProof(root common.Hash, txs []*types.Transaction, proof *MultiProof, combine func(left, right common.Hash) common.Hash) bool {
+	if len(proof.Indices) == 0 || len(proof.Indices) != len(proof.Leaves) {
+		return false
+	}
+	covered := make(map[common.Hash]bool, len(proof.Leaves))
+	known := make(map[int]common.Hash, len(proof.Indices))
+	for i, index := range proof.Indices {
+		if index < 0 || index >= proof.LeafCount {
+			return false
+		}
+		covered[proof.Leaves[i]] = true
+		known[index] = proof.Leaves[i]
+	}
+	for _, tx := range txs {
+		if !covered[tx.Hash()] {
+			return false
+		}
+	}
+
+	computed, ok := reconstructRoot(proof.LeafCount, known, proof.Hashes, combine)
+	return ok && computed == root
+}
+
+// LeafClaim claims that a leaf hash sits at a position of the tree
+type LeafClaim struct {
+	Index int         // Leaf position
+	Hash  common.Hash // Claimed leaf hash
+}
+
+// VerifyLeafClaims checks many claimed leaves against a single multiproof,
+// reconstructing the root once. Nodes shared by the paths of several claims
+// are hashed only once, so the cost grows with the union of the paths rather
+// than with the number of claims. Conflicting claims for one index fail.
+// Claims on a tree built by NewSortedMerkleTree are checked with
+// VerifySortedLeafClaims instead.
+func VerifyLeafClaims(root common.Hash, leaves []LeafClaim, proof MultiProof) bool {
+	return verifyLeafClaims(root, leaves, proof, combineHashes)
+}
+
+// verifyLeafClaims checks claimed leaves, hashing pairs with combine
+func verifyLeafClaims(root common.Hash, leaves []LeafClaim, proof MultiProof, combine func(left, right common.Hash) common.Hash) bool {
+	if len(leaves) == 0 {
+		return false
+	}
+	known := make(map[int]common.Hash, len(leaves))
+	for _, claim := range leaves {
+		if claim.Index < 0 || claim.Index >= proof.LeafCount {
+			return false
+		}
+		if hash, ok := known[claim.Index]; ok && hash != claim.Hash {
+			return false
+		}
+		known[claim.Index] = claim.Hash
+	}
+	computed, ok := reconstructRoot(proof.LeafCount, known, proof.Hashes, combine)
+	return ok && computed == root
+}
+
+// reconstructRoot hashes the known leaves up to the root with combine, taking
+// missing siblings from hashes. It fails if a sibling is missing or not every
+// proof hash was used.
+func reconstructRoot(leafCount int, known map[int]common.Hash, hashes []ProofHash, combine func(left, right common.Hash) common.Hash) (common.Hash, bool) {
+	siblings := make(map[[2]int]common.Hash, len(hashes))
+	for _, h := range hashes {
+		siblings[[2]int{h.Level, h.Index}] = h.Hash
+	}
+	used := 0
+	width := leafCount
+	for level := 0; width > 1; level++ {
+		parents := make(map[int]common.Hash, len(known))
+		for index, hash := range known {
+			if _, done := parents[index/2]; done {
+				continue
+			}
+			sibling := index ^ 1
+			siblingHash, ok := known[sibling]
+			switch {
+			case ok:
+			case sibling >= width && level == 0:
+				siblingHash = hash // Odd leaf level: the last leaf is paired with itself
+			default:
+				if siblingHash, ok = siblings[[2]int{level, sibling}]; !ok {
+					return common.Hash{}, false
+				}
+				// Higher up the proof carries the padding copy, which must match
+				if sibling >= width && siblingHash != hash {
+					return common.Hash{}, false
+				}
+				used++
+			}
+			if index%2 == 0 {
+				parents[index/2] = combine(hash, siblingHash)
+			} else {
+				parents[index/2] = combine(siblingHash, hash)
+			}
+		}
+		known = parents
+		width = (width + 1) / 2
+	}
+	return known[0], used == len(hashes)
+}
+
+// combineHashes hashes two child hashes into their parent hash
+func combineHashes(left, right common.Hash) common.Hash {
+	return hashPair(left, right)
+}
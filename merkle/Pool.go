@@ -0,0 +1,36 @@
+package merkle
+
+import (
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// pairHasher hashes two concatenated hashes with a reusable Keccak state and
+// input buffer, so hashing a pair allocates nothing
+type pairHasher struct {
+	sha crypto.KeccakState
+	buf [2 * common.HashLength]byte
+	out common.Hash
+}
+
+// pairHasherPool shares pair hashers between goroutines building or verifying trees
+var pairHasherPool = sync.Pool{
+	New: func() interface{} {
+		return &pairHasher{sha: crypto.NewKeccakState()}
+	},
+}
+
+// hashPair returns Keccak256(left || right) using a pooled hasher
+func hashPair(left, right common.Hash) common.Hash {
+	h := pairHasherPool.Get().(*pairHasher)
+	copy(h.buf[:common.HashLength], left[:])
+	copy(h.buf[common.HashLength:], right[:])
+	h.sha.Reset()
+	h.sha.Write(h.buf[:])
+	h.sha.Read(h.out[:])
+	hash := h.out
+	pairHasherPool.Put(h)
+	return hash
+}
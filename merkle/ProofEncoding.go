@@ -0,0 +1,104 @@
+package merkle
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Verify checks a proof for a leaf hash against a root without access to the
+// tree, so a separate verifier process can check proofs received over the wire
+func Verify(root common.Hash, leaf common.Hash, proof Proof) bool {
+	if len(proof.Hashes) != len(proof.Left) {
+		return false
+	}
+	hash := leaf
+
+	// Recompute the root hash using the proof, respecting each sibling's side
+	for i, proofHash := range proof.Hashes {
+		if proof.Left[i] {
+			hash = combineHashes(proofHash, hash)
+		} else {
+			hash = combineHashes(hash, proofHash)
+		}
+	}
+	return hash == root
+}
+
+// maxProofDepth is the deepest proof whose directions fit the path bitfield
+const maxProofDepth = 64
+
+// Path returns the proof's directions as a bitfield, bit i set when Hashes[i]
+// is a left sibling, together with the proof depth. For a proof generated by
+// the tree the bitfield equals the leaf index.
+func (p Proof) Path() (uint64, int, error) {
+	if len(p.Hashes) != len(p.Left) {
+		return 0, 0, errors.New("proof hashes and directions differ in length")
+	}
+	if len(p.Left) > maxProofDepth {
+		return 0, 0, fmt.Errorf("proof depth %d exceeds %d", len(p.Left), maxProofDepth)
+	}
+	var path uint64
+	for i, left := range p.Left {
+		if left {
+			path |= 1 << i
+		}
+	}
+	return path, len(p.Left), nil
+}
+
+// ProofFromPath builds a proof from sibling hashes and a direction bitfield
+// as returned by Path. Bits at or above the depth must be zero.
+func ProofFromPath(path uint64, hashes []common.Hash) (Proof, error) {
+	depth := len(hashes)
+	if depth > maxProofDepth {
+		return Proof{}, fmt.Errorf("proof depth %d exceeds %d", depth, maxProofDepth)
+	}
+	if depth < maxProofDepth && path>>depth != 0 {
+		return Proof{}, errors.New("path has directions beyond the proof depth")
+	}
+	proof := Proof{Hashes: hashes, Left: make([]bool, depth)}
+	for i := range proof.Left {
+		proof.Left[i] = path&(1<<i) != 0
+	}
+	return proof, nil
+}
+
+// MarshalBinary encodes the proof as its depth in one byte, the direction
+// bitfield of Path as a big-endian uint64, and the sibling hashes
+func (p Proof) MarshalBinary() ([]byte, error) {
+	path, depth, err := p.Path()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 9, 9+depth*common.HashLength)
+	out[0] = byte(depth)
+	binary.BigEndian.PutUint64(out[1:9], path)
+	for _, hash := range p.Hashes {
+		out = append(out, hash.Bytes()...)
+	}
+	return out, nil
+}
+
+// UnmarshalBinary decodes a proof produced by MarshalBinary
+func (p *Proof) UnmarshalBinary(data []byte) error {
+	if len(data) < 9 {
+		return errors.New("proof too short")
+	}
+	depth := int(data[0])
+	if len(data) != 9+depth*common.HashLength {
+		return errors.New("proof length does not match its depth")
+	}
+	hashes := make([]common.Hash, depth)
+	for i := range hashes {
+		hashes[i] = common.BytesToHash(data[9+i*common.HashLength : 9+(i+1)*common.HashLength])
+	}
+	proof, err := ProofFromPath(binary.BigEndian.Uint64(data[1:9]), hashes)
+	if err != nil {
+		return err
+	}
+	*p = proof
+	return nil
+}
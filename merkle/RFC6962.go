@@ -0,0 +1,110 @@
+package merkle
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"math/bits"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Domain separation prefixes of RFC 6962 section 2.1
+const (
+	ctLeafPrefix byte = 0x00
+	ctNodePrefix byte = 0x01
+)
+
+// CTLeafHash returns the RFC 6962 hash of a leaf, SHA-256(0x00 || data)
+func CTLeafHash(data []byte) common.Hash {
+	return sha256.Sum256(append([]byte{ctLeafPrefix}, data...))
+}
+
+// CTNodeHash returns the RFC 6962 hash of an interior node, SHA-256(0x01 || left || right)
+func CTNodeHash(left, right common.Hash) common.Hash {
+	data := make([]byte, 0, 1+2*common.HashLength)
+	data = append(data, ctNodePrefix)
+	data = append(data, left.Bytes()...)
+	data = append(data, right.Bytes()...)
+	return sha256.Sum256(data)
+}
+
+// CTRoot computes the RFC 6962 Merkle Tree Hash of the leaves. Unlike
+// MerkleTree, odd nodes are not duplicated: the tree splits at the largest
+// power of two smaller than its size, so roots match Certificate Transparency
+// logs and their published test vectors.
+func CTRoot(leaves [][]byte) common.Hash {
+	return ctRoot(ctLeafHashes(leaves))
+}
+
+// CTInclusionProof returns the RFC 6962 audit path of the leaf at index,
+// ordered from the leaf up to the root
+func CTInclusionProof(leaves [][]byte, index int) ([]common.Hash, error) {
+	if index < 0 || index >= len(leaves) {
+		return nil, fmt.Errorf("leaf index %d out of range [0, %d)", index, len(leaves))
+	}
+	return ctPath(ctLeafHashes(leaves), index), nil
+}
+
+// VerifyCTInclusion checks an RFC 6962 audit path for the leaf hash at index in
+// a tree of the given size, following the algorithm of RFC 9162 section 2.1.3.2
+func VerifyCTInclusion(root common.Hash, index, size int, leafHash common.Hash, proof []common.Hash) bool {
+	if index < 0 || index >= size {
+		return false
+	}
+	fn, sn := index, size-1
+	hash := leafHash
+	for _, p := range proof {
+		if sn == 0 {
+			return false
+		}
+		if fn&1 == 1 || fn == sn {
+			hash = CTNodeHash(p, hash)
+			// Skip levels where this node is the last one without a sibling
+			for fn&1 == 0 && fn != 0 {
+				fn, sn = fn>>1, sn>>1
+			}
+		} else {
+			hash = CTNodeHash(hash, p)
+		}
+		fn, sn = fn>>1, sn>>1
+	}
+	return sn == 0 && hash == root
+}
+
+// ctLeafHashes hashes every leaf with the leaf prefix
+func ctLeafHashes(leaves [][]byte) []common.Hash {
+	hashes := make([]common.Hash, len(leaves))
+	for i, leaf := range leaves {
+		hashes[i] = CTLeafHash(leaf)
+	}
+	return hashes
+}
+
+// ctSplit returns the largest power of two smaller than n, for n > 1
+func ctSplit(n int) int {
+	return 1 << (bits.Len(uint(n-1)) - 1)
+}
+
+// ctRoot computes MTH over leaf hashes. The hash of an empty tree is SHA-256 of the empty string.
+func ctRoot(hashes []common.Hash) common.Hash {
+	switch len(hashes) {
+	case 0:
+		return sha256.Sum256(nil)
+	case 1:
+		return hashes[0]
+	}
+	k := ctSplit(len(hashes))
+	return CTNodeHash(ctRoot(hashes[:k]), ctRoot(hashes[k:]))
+}
+
+// ctPath computes PATH(m, D[n]) of RFC 6962 section 2.1.1
+func ctPath(hashes []common.Hash, m int) []common.Hash {
+	if len(hashes) <= 1 {
+		return nil
+	}
+	k := ctSplit(len(hashes))
+	if m < k {
+		return append(ctPath(hashes[:k], m), ctRoot(hashes[k:]))
+	}
+	return append(ctPath(hashes[k:], m-k), ctRoot(hashes[:k]))
+}
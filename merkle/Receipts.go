@@ -0,0 +1,71 @@
+package merkle
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// ReceiptLeafHash returns the leaf hash of a receipt: Keccak256 of its
+// consensus encoding, the same bytes committed to by the header's ReceiptHash
+func ReceiptLeafHash(receipt *types.Receipt) (common.Hash, error) {
+	encoded, err := receipt.MarshalBinary()
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return crypto.Keccak256Hash(encoded), nil
+}
+
+// LogLeafHash returns the leaf hash of a log: Keccak256 of its RLP encoding
+// (address, topics, data)
+func LogLeafHash(log *types.Log) (common.Hash, error) {
+	encoded, err := rlp.EncodeToBytes(log)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return crypto.Keccak256Hash(encoded), nil
+}
+
+// NewMerkleTreeFromReceipts creates a Merkle tree with one leaf per receipt
+func NewMerkleTreeFromReceipts(receipts types.Receipts) (*MerkleTree, error) {
+	hashes := make([]common.Hash, len(receipts))
+	for i, receipt := range receipts {
+		hash, err := ReceiptLeafHash(receipt)
+		if err != nil {
+			return nil, err
+		}
+		hashes[i] = hash
+	}
+	return NewMerkleTreeFromHashes(hashes), nil
+}
+
+// NewMerkleTreeFromLogs creates a Merkle tree with one leaf per log, taking
+// the logs of all receipts in block order
+func NewMerkleTreeFromLogs(receipts types.Receipts) (*MerkleTree, error) {
+	var hashes []common.Hash
+	for _, receipt := range receipts {
+		for _, log := range receipt.Logs {
+			hash, err := LogLeafHash(log)
+			if err != nil {
+				return nil, err
+			}
+			hashes = append(hashes, hash)
+		}
+	}
+	return NewMerkleTreeFromHashes(hashes), nil
+}
+
+// GetRequiredHashesForLeaves is GetRequiredHashes for trees whose leaves are
+// not transactions, taking the leaf hashes to prove
+func (mt *MerkleTree) GetRequiredHashesForLeaves(leaves []common.Hash) int {
+	if len(leaves) == 0 {
+		return 0
+	}
+	targetHashes := make(map[common.Hash]bool, len(leaves))
+	for _, leaf := range leaves {
+		targetHashes[leaf] = true
+	}
+	_, needs := mt.calculateRequiredHashes(mt.Root, targetHashes)
+	return needs
+}
@@ -0,0 +1,68 @@
+package merkle
+
+import (
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// NewMerkleTreeReusing builds a tree over transactions that start with the
+// same leaves as prev, as consecutive blocks built from one mempool often do.
+// Every subtree whose leaves all lie in the shared prefix is complete in both
+// trees, so its node is taken from prev instead of being rehashed. It returns
+// the tree and the number of pair hashes actually computed. Reused nodes are
+// shared with prev and neither tree is modified afterwards.
+func NewMerkleTreeReusing(prev *MerkleTree, transactions []*types.Transaction) (*MerkleTree, int) {
+	if prev == nil {
+		prev = &MerkleTree{}
+	}
+	tree := &MerkleTree{Transactions: transactions, sorted: prev.sorted}
+
+	// Length of the shared leaf prefix
+	shared := 0
+	for shared < len(transactions) && shared < len(prev.Nodes) && prev.Nodes[shared].Hash == transactions[shared].Hash() {
+		shared++
+	}
+
+	leaves := make([]*MerkleTreeNode, len(transactions))
+	for i, tx := range transactions {
+		if i < shared {
+			leaves[i] = prev.Nodes[i]
+		} else {
+			leaves[i] = &MerkleTreeNode{Hash: tx.Hash(), Tx: tx}
+		}
+	}
+	tree.Nodes = leaves
+	tree.levels = [][]*MerkleTreeNode{leaves}
+	if len(leaves) == 0 {
+		return tree, 0
+	}
+
+	// reused reports whether the node at (level, index) was taken from prev
+	reused := func(level, index int) bool {
+		return (index+1)<<level <= shared
+	}
+	fresh := 0
+	for level, nodes := 1, leaves; len(nodes) > 1; level++ {
+		next := make([]*MerkleTreeNode, (len(nodes)+1)/2)
+		for i := range next {
+			// The subtree covers leaves [i<<level, (i+1)<<level)
+			if reused(level, i) {
+				next[i] = prev.levels[level][i]
+				continue
+			}
+			parent := tree.pairParent(nodes, i)
+			fresh++
+			// Link the children built here; reused ones still belong to prev
+			if !reused(level-1, 2*i) {
+				parent.Left.Parent = parent
+			}
+			if !parent.Right.duplicate && !reused(level-1, 2*i+1) {
+				parent.Right.Parent = parent
+			}
+			next[i] = parent
+		}
+		nodes = next
+		tree.levels = append(tree.levels, nodes)
+	}
+	tree.Root = tree.levels[len(tree.levels)-1][0]
+	return tree, fresh
+}
@@ -0,0 +1,205 @@
+package merkle
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"math/bits"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// SSZTree merkleizes 32-byte chunks the way SSZ hash_tree_root does: SHA-256
+// over pairs, with the chunk count padded to a power of two by zero chunks.
+// Nodes are addressed by generalized index: the root is 1 and the children of
+// node g are 2g and 2g+1, so leaf i of a tree of depth d is 2^d + i.
+type SSZTree struct {
+	nodes []common.Hash // Nodes by generalized index, nodes[0] unused
+	width int           // Padded number of leaves, a power of two
+	count int           // Number of chunks before padding
+}
+
+// sszZeroHashes[d] is the root of a subtree of depth d over zero chunks
+var sszZeroHashes = func() []common.Hash {
+	zero := make([]common.Hash, 64)
+	for d := 1; d < len(zero); d++ {
+		zero[d] = sszHashPair(zero[d-1], zero[d-1])
+	}
+	return zero
+}()
+
+// sszHashPair returns SHA-256(left || right)
+func sszHashPair(left, right common.Hash) common.Hash {
+	return sha256.Sum256(append(left.Bytes(), right.Bytes()...))
+}
+
+// SSZChunks packs data into 32-byte chunks, zero-padding the last one
+func SSZChunks(data []byte) []common.Hash {
+	chunks := make([]common.Hash, (len(data)+common.HashLength-1)/common.HashLength)
+	for i := range chunks {
+		copy(chunks[i][:], data[i*common.HashLength:])
+	}
+	return chunks
+}
+
+// NewSSZTree merkleizes the chunks, padding them with zero chunks to the next
+// power of two. Whole padded subtrees take their root from precomputed zero
+// hashes instead of being hashed again.
+func NewSSZTree(chunks []common.Hash) *SSZTree {
+	width := 1
+	for width < len(chunks) {
+		width *= 2
+	}
+	t := &SSZTree{nodes: make([]common.Hash, 2*width), width: width, count: len(chunks)}
+	copy(t.nodes[width:], chunks)
+
+	// Nodes at or past filled are roots of zero subtrees
+	filled := len(chunks)
+	for depth, start := 1, width/2; start >= 1; depth, start = depth+1, start/2 {
+		filled = (filled + 1) / 2
+		for i := 0; i < start; i++ {
+			g := start + i
+			if i >= filled {
+				t.nodes[g] = sszZeroHashes[depth]
+				continue
+			}
+			t.nodes[g] = sszHashPair(t.nodes[2*g], t.nodes[2*g+1])
+		}
+	}
+	return t
+}
+
+// Root returns the hash tree root of the chunks
+func (t *SSZTree) Root() common.Hash {
+	return t.nodes[1]
+}
+
+// Depth returns the number of levels above the leaves
+func (t *SSZTree) Depth() int {
+	return bits.Len(uint(t.width)) - 1
+}
+
+// GeneralizedIndex returns the generalized index of chunk i
+func (t *SSZTree) GeneralizedIndex(i int) uint64 {
+	return uint64(t.width + i)
+}
+
+// Node returns the hash at a generalized index
+func (t *SSZTree) Node(gindex uint64) (common.Hash, error) {
+	if gindex == 0 || gindex >= uint64(len(t.nodes)) {
+		return common.Hash{}, fmt.Errorf("generalized index %d out of range [1, %d)", gindex, len(t.nodes))
+	}
+	return t.nodes[gindex], nil
+}
+
+// Proof returns the SSZ single proof of the node at gindex: its branch of
+// sibling hashes, ordered from the node up to the root
+func (t *SSZTree) Proof(gindex uint64) ([]common.Hash, error) {
+	if _, err := t.Node(gindex); err != nil {
+		return nil, err
+	}
+	var branch []common.Hash
+	for g := gindex; g > 1; g /= 2 {
+		branch = append(branch, t.nodes[g^1])
+	}
+	return branch, nil
+}
+
+// MultiProof returns the helper hashes proving the nodes at gindices, in the
+// order of SSZHelperIndices
+func (t *SSZTree) MultiProof(gindices []uint64) ([]common.Hash, error) {
+	for _, g := range gindices {
+		if _, err := t.Node(g); err != nil {
+			return nil, err
+		}
+	}
+	helpers := SSZHelperIndices(gindices)
+	proof := make([]common.Hash, len(helpers))
+	for i, g := range helpers {
+		proof[i] = t.nodes[g]
+	}
+	return proof, nil
+}
+
+// SSZHelperIndices returns the generalized indices whose hashes a multiproof
+// for gindices needs: all branch siblings that are not themselves on a path
+// from a proven node to the root, in descending order
+func SSZHelperIndices(gindices []uint64) []uint64 {
+	branch := make(map[uint64]bool)
+	path := make(map[uint64]bool)
+	for _, g := range gindices {
+		for ; g > 1; g /= 2 {
+			branch[g^1] = true
+			path[g] = true
+		}
+	}
+	var helpers []uint64
+	for g := range branch {
+		if !path[g] {
+			helpers = append(helpers, g)
+		}
+	}
+	sort.Slice(helpers, func(i, j int) bool { return helpers[i] > helpers[j] })
+	return helpers
+}
+
+// VerifySSZProof checks a single proof of leaf at gindex against root
+func VerifySSZProof(root, leaf common.Hash, gindex uint64, branch []common.Hash) bool {
+	if gindex == 0 || bits.Len64(gindex)-1 != len(branch) {
+		return false
+	}
+	hash := leaf
+	for _, sibling := range branch {
+		if gindex&1 == 1 {
+			hash = sszHashPair(sibling, hash)
+		} else {
+			hash = sszHashPair(hash, sibling)
+		}
+		gindex /= 2
+	}
+	return hash == root
+}
+
+// VerifySSZMultiProof checks that leaves sit at gindices of the tree with the
+// given root, using helper hashes ordered as by SSZHelperIndices
+func VerifySSZMultiProof(root common.Hash, gindices []uint64, leaves []common.Hash, proof []common.Hash) bool {
+	helpers := SSZHelperIndices(gindices)
+	if len(gindices) == 0 || len(gindices) != len(leaves) || len(proof) != len(helpers) {
+		return false
+	}
+	objects := make(map[uint64]common.Hash, len(leaves)+len(proof))
+	for i, g := range gindices {
+		if g == 0 {
+			return false
+		}
+		if hash, ok := objects[g]; ok && hash != leaves[i] {
+			return false
+		}
+		objects[g] = leaves[i]
+	}
+	for i, g := range helpers {
+		objects[g] = proof[i]
+	}
+
+	keys := make([]uint64, 0, len(objects))
+	for g := range objects {
+		keys = append(keys, g)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] > keys[j] })
+	// Hash siblings pairwise from the deepest node up, appending each parent
+	for pos := 0; pos < len(keys); pos++ {
+		g := keys[pos]
+		if g <= 1 {
+			continue
+		}
+		left, hasLeft := objects[g&^1]
+		right, hasRight := objects[g|1]
+		if _, done := objects[g/2]; done || !hasLeft || !hasRight {
+			continue
+		}
+		objects[g/2] = sszHashPair(left, right)
+		keys = append(keys, g/2)
+	}
+	computed, ok := objects[1]
+	return ok && computed == root
+}
@@ -0,0 +1,151 @@
+package merkle
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// serializeVersion is the leading byte of a serialized tree
+const serializeVersion byte = 1
+
+// Flags of a serialized tree
+const (
+	flagInterior     byte = 1 << iota // Interior hashes follow the leaf hashes
+	flagSorted                        // Tree uses sorted-pair hashing
+	flagSortedLeaves                  // Leaves are in ascending hash order
+)
+
+// Serialize writes the leaf hashes of the tree, and optionally all interior
+// hashes, so the tree can be reloaded by Deserialize without the transactions.
+// With interior hashes the reload performs no hashing at all.
+//
+// Format: version byte, flags byte, uvarint leaf count, leaf hashes, then for
+// every level above the leaves (if flagInterior) its hashes, left to right.
+func (mt *MerkleTree) Serialize(w io.Writer, withInterior bool) error {
+	bw := bufio.NewWriter(w)
+	var flags byte
+	if withInterior {
+		flags |= flagInterior
+	}
+	if mt.sorted {
+		flags |= flagSorted
+	}
+	if mt.sortedLeaves {
+		flags |= flagSortedLeaves
+	}
+	header := append([]byte{serializeVersion, flags}, binary.AppendUvarint(nil, uint64(len(mt.Nodes)))...)
+	if _, err := bw.Write(header); err != nil {
+		return err
+	}
+	levels := mt.levels
+	if !withInterior && len(levels) > 1 {
+		levels = levels[:1]
+	}
+	for _, level := range levels {
+		for _, node := range level {
+			if _, err := bw.Write(node.Hash.Bytes()); err != nil {
+				return err
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// Deserialize restores a tree written by Serialize. Leaves carry no
+// transactions, but proofs and required-hash calculations work as before.
+func Deserialize(r io.Reader) (*MerkleTree, error) {
+	br := bufio.NewReader(r)
+	var header [2]byte
+	if _, err := io.ReadFull(br, header[:]); err != nil {
+		return nil, err
+	}
+	if header[0] != serializeVersion {
+		return nil, fmt.Errorf("unsupported tree version %d", header[0])
+	}
+	count, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+
+	mt := &MerkleTree{
+		sorted:       header[1]&flagSorted != 0,
+		sortedLeaves: header[1]&flagSortedLeaves != 0,
+	}
+	leaves, err := readHashes(br, count)
+	if err != nil {
+		return nil, err
+	}
+	if header[1]&flagInterior == 0 {
+		nodes := make([]*MerkleTreeNode, len(leaves))
+		for i, hash := range leaves {
+			nodes[i] = &MerkleTreeNode{Hash: hash}
+		}
+		mt.buildTree(nodes)
+	} else {
+		levels := [][]common.Hash{leaves}
+		for width := count; width > 1; {
+			width = (width + 1) / 2
+			level, err := readHashes(br, width)
+			if err != nil {
+				return nil, err
+			}
+			levels = append(levels, level)
+		}
+		mt.linkLevels(levels)
+	}
+	if _, err := br.ReadByte(); err != io.EOF {
+		return nil, errors.New("trailing data after serialized tree")
+	}
+	return mt, nil
+}
+
+// readHashes reads count consecutive hashes. The slice grows as hashes arrive,
+// so a forged count fails on the short input instead of allocating up front.
+func readHashes(r io.Reader, count uint64) ([]common.Hash, error) {
+	if count > 1<<32 {
+		return nil, errors.New("serialized level too large")
+	}
+	var hashes []common.Hash
+	for i := uint64(0); i < count; i++ {
+		var hash common.Hash
+		if _, err := io.ReadFull(r, hash[:]); err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, hash)
+	}
+	return hashes, nil
+}
+
+// linkLevels rebuilds the node structure from stored hashes of every level
+// without recomputing any hash
+func (mt *MerkleTree) linkLevels(levels [][]common.Hash) {
+	mt.levels = make([][]*MerkleTreeNode, len(levels))
+	for l, hashes := range levels {
+		mt.levels[l] = make([]*MerkleTreeNode, len(hashes))
+		for i, hash := range hashes {
+			node := &MerkleTreeNode{Hash: hash}
+			mt.levels[l][i] = node
+			if l == 0 {
+				continue
+			}
+			below := mt.levels[l-1]
+			node.Left = below[2*i]
+			if 2*i+1 < len(below) {
+				node.Right = below[2*i+1]
+			} else {
+				// If odd number of nodes, duplicate the last node
+				node.Right = &MerkleTreeNode{Hash: node.Left.Hash, duplicate: true}
+			}
+			node.Left.Parent, node.Right.Parent = node, node
+		}
+	}
+	mt.Nodes = mt.levels[0]
+	if top := mt.levels[len(mt.levels)-1]; len(top) > 0 {
+		mt.Root = top[0]
+	}
+}
@@ -0,0 +1,55 @@
+package merkle
+
+import (
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// verifySignature is the function a verifier contract exposes around
+// OpenZeppelin's MerkleProof.verify(proof, root, leaf)
+const verifySignature = "verify(bytes32[],bytes32,bytes32)"
+
+// SolidityProof is a sorted-pair proof in the argument order of OpenZeppelin's
+// MerkleProof.verify(bytes32[] proof, bytes32 root, bytes32 leaf)
+type SolidityProof struct {
+	Proof []common.Hash
+	Root  common.Hash
+	Leaf  common.Hash
+}
+
+// GetSolidityProof exports the proof of a transaction for an on-chain
+// MerkleProof verifier. Only trees built by NewSortedMerkleTree hash pairs the
+// way the verifier does.
+func (mt *MerkleTree) GetSolidityProof(tx *types.Transaction) (SolidityProof, error) {
+	if !mt.sorted {
+		return SolidityProof{}, errors.New("solidity proofs need a sorted-pair tree")
+	}
+	proof, err := mt.GetProof(tx)
+	if err != nil {
+		return SolidityProof{}, err
+	}
+	return SolidityProof{Proof: proof.Hashes, Root: mt.Root.Hash, Leaf: tx.Hash()}, nil
+}
+
+// Calldata ABI-encodes a call to verify(bytes32[],bytes32,bytes32): the
+// function selector, the offset of the dynamic proof array, root and leaf,
+// then the array length and its elements, each in a 32-byte word
+func (p SolidityProof) Calldata() []byte {
+	word := func(v int) []byte {
+		return math.U256Bytes(big.NewInt(int64(v)))
+	}
+	data := append([]byte{}, crypto.Keccak256([]byte(verifySignature))[:4]...)
+	data = append(data, word(3*32)...) // The array follows the three head words
+	data = append(data, p.Root.Bytes()...)
+	data = append(data, p.Leaf.Bytes()...)
+	data = append(data, word(len(p.Proof))...)
+	for _, hash := range p.Proof {
+		data = append(data, hash.Bytes()...)
+	}
+	return data
+}
@@ -0,0 +1,51 @@
+package merkle
+
+import (
+	"bytes"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// NewSortedMerkleTree builds a tree that sorts every pair before hashing, as
+// OpenZeppelin's MerkleProof does. Proofs then need no direction bits, and the
+// sibling hashes of GetProof can be passed unchanged to a Solidity verifier.
+func NewSortedMerkleTree(transactions []*types.Transaction) *MerkleTree {
+	tree := &MerkleTree{
+		Transactions: transactions,
+		sorted:       true,
+	}
+	tree.createTree()
+	return tree
+}
+
+// hashSortedPair hashes two child hashes in ascending byte order
+func hashSortedPair(a, b common.Hash) common.Hash {
+	if bytes.Compare(a.Bytes(), b.Bytes()) > 0 {
+		a, b = b, a
+	}
+	return hashPair(a, b)
+}
+
+// VerifySorted checks a sorted-pair proof, mirroring OpenZeppelin's
+// MerkleProof.verify: siblings are combined in sorted order, so no direction
+// information is needed
+func VerifySorted(root common.Hash, leaf common.Hash, proof []common.Hash) bool {
+	hash := leaf
+	for _, sibling := range proof {
+		hash = hashSortedPair(hash, sibling)
+	}
+	return hash == root
+}
+
+// VerifySortedMultiProof checks a multiproof of a tree built by
+// NewSortedMerkleTree, see VerifyMultiProof
+func VerifySortedMultiProof(root common.Hash, txs []*types.Transaction, proof *MultiProof) bool {
+	return verifyMultiProof(root, txs, proof, hashSortedPair)
+}
+
+// VerifySortedLeafClaims checks claimed leaves of a tree built by
+// NewSortedMerkleTree against one multiproof, see VerifyLeafClaims
+func VerifySortedLeafClaims(root common.Hash, leaves []LeafClaim, proof MultiProof) bool {
+	return verifyLeafClaims(root, leaves, proof, hashSortedPair)
+}
@@ -0,0 +1,95 @@
+package merkle
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// StreamBuilder computes the Merkle root of a transaction stream while keeping
+// only the frontier: one pending left node per level, O(log n) memory in total.
+// The root equals that of NewMerkleTree over the same transactions.
+type StreamBuilder struct {
+	frontier []common.Hash // Pending left node per level
+	pending  []bool        // Whether frontier[level] holds a node
+	count    int           // Leaves added so far
+}
+
+// NewStreamBuilder creates an empty streaming builder
+func NewStreamBuilder() *StreamBuilder {
+	return &StreamBuilder{}
+}
+
+// Add incorporates the next transaction as a leaf
+func (b *StreamBuilder) Add(tx *types.Transaction) {
+	b.AddHash(tx.Hash())
+}
+
+// AddHash incorporates the next leaf hash, combining every completed pair
+func (b *StreamBuilder) AddHash(hash common.Hash) {
+	b.count++
+	for level := 0; ; level++ {
+		if level == len(b.frontier) {
+			b.frontier = append(b.frontier, common.Hash{})
+			b.pending = append(b.pending, false)
+		}
+		if !b.pending[level] {
+			b.frontier[level], b.pending[level] = hash, true
+			return
+		}
+		hash = combineHashes(b.frontier[level], hash)
+		b.pending[level] = false
+	}
+}
+
+// Count returns the number of leaves added so far
+func (b *StreamBuilder) Count() int {
+	return b.count
+}
+
+// Root returns the root of the leaves added so far, padding odd-sized levels by
+// duplicating their last node. It does not modify the builder, so more leaves
+// may be added afterwards. The root of an empty stream is the zero hash.
+func (b *StreamBuilder) Root() common.Hash {
+	if b.count == 0 {
+		return common.Hash{}
+	}
+	var carry common.Hash // Last node of an incomplete subtree at the current level
+	hasCarry := false
+	for level, width := 0, b.count; ; level, width = level+1, (width+1)/2 {
+		pending := level < len(b.pending) && b.pending[level]
+		if width == 1 {
+			if pending {
+				return b.frontier[level]
+			}
+			return carry
+		}
+		switch {
+		case pending && hasCarry:
+			carry = combineHashes(b.frontier[level], carry)
+		case pending:
+			carry, hasCarry = combineHashes(b.frontier[level], b.frontier[level]), true
+		case hasCarry:
+			carry = combineHashes(carry, carry)
+		}
+	}
+}
+
+// StreamRoot consumes transactions from a channel until it is closed and returns
+// the Merkle root together with the number of transactions consumed
+func StreamRoot(txs <-chan *types.Transaction) (common.Hash, int) {
+	b := NewStreamBuilder()
+	for tx := range txs {
+		b.Add(tx)
+	}
+	return b.Root(), b.Count()
+}
+
+// StreamRootFunc pulls transactions from next until it reports no more, and
+// returns the Merkle root together with the number of transactions consumed
+func StreamRootFunc(next func() (*types.Transaction, bool)) (common.Hash, int) {
+	b := NewStreamBuilder()
+	for tx, ok := next(); ok; tx, ok = next() {
+		b.Add(tx)
+	}
+	return b.Root(), b.Count()
+}
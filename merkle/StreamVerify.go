@@ -0,0 +1,171 @@
+package merkle
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// VerifyProofStream checks a single proof encoded by Proof.MarshalBinary while
+// reading it, keeping only a running hash instead of the sibling list
+func VerifyProofStream(root, leaf common.Hash, r io.Reader) (bool, error) {
+	var header [9]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return false, err
+	}
+	depth, path := int(header[0]), binary.BigEndian.Uint64(header[1:])
+	if depth > maxProofDepth || (depth < maxProofDepth && path>>depth != 0) {
+		return false, errors.New("malformed proof path")
+	}
+	hash := leaf
+	var sibling common.Hash
+	for i := 0; i < depth; i++ {
+		if _, err := io.ReadFull(r, sibling[:]); err != nil {
+			return false, err
+		}
+		if path&(1<<i) != 0 {
+			hash = combineHashes(sibling, hash)
+		} else {
+			hash = combineHashes(hash, sibling)
+		}
+	}
+	return hash == root, nil
+}
+
+// WriteTo streams the multiproof: uvarint leaf count, uvarint number of proven
+// leaves, each proven leaf as uvarint index and hash, then each sibling as
+// uvarint level, uvarint index and hash, in level and index order
+func (p *MultiProof) WriteTo(w io.Writer) (int64, error) {
+	bw := bufio.NewWriter(w)
+	var written int64
+	write := func(data []byte) error {
+		n, err := bw.Write(data)
+		written += int64(n)
+		return err
+	}
+	if err := write(binary.AppendUvarint(binary.AppendUvarint(nil, uint64(p.LeafCount)), uint64(len(p.Indices)))); err != nil {
+		return written, err
+	}
+	for i, index := range p.Indices {
+		if err := write(append(binary.AppendUvarint(nil, uint64(index)), p.Leaves[i].Bytes()...)); err != nil {
+			return written, err
+		}
+	}
+	for _, h := range p.Hashes {
+		entry := binary.AppendUvarint(binary.AppendUvarint(nil, uint64(h.Level)), uint64(h.Index))
+		if err := write(append(entry, h.Hash.Bytes()...)); err != nil {
+			return written, err
+		}
+	}
+	return written, bw.Flush()
+}
+
+// VerifyMultiProofStream checks a multiproof written by MultiProof.WriteTo as
+// it is read. Siblings are consumed one at a time in the order the level-by-
+// level reconstruction needs them, so besides the proven leaves only the
+// current level's recomputed nodes are held in memory. It returns the proven
+// leaves on success.
+func VerifyMultiProofStream(root common.Hash, r io.Reader) ([]LeafClaim, error) {
+	br := bufio.NewReader(r)
+	leafCount, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+	count, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 || count > leafCount || leafCount > 1<<32 {
+		return nil, fmt.Errorf("invalid proven leaf count %d of %d", count, leafCount)
+	}
+
+	// Leaves are appended as they arrive, so a forged count cannot force a
+	// large allocation before the stream runs dry
+	var leaves []LeafClaim
+	for i := 0; uint64(i) < count; i++ {
+		index, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, err
+		}
+		if index >= leafCount || (i > 0 && int(index) <= leaves[i-1].Index) {
+			return nil, errors.New("proven leaf indices not ascending within the tree")
+		}
+		leaf := LeafClaim{Index: int(index)}
+		if _, err := io.ReadFull(br, leaf.Hash[:]); err != nil {
+			return nil, err
+		}
+		leaves = append(leaves, leaf)
+	}
+
+	// nextSibling reads the next sibling and checks it sits where it is needed
+	nextSibling := func(level, index int) (common.Hash, error) {
+		var hash common.Hash
+		l, err := binary.ReadUvarint(br)
+		if err != nil {
+			return hash, fmt.Errorf("missing sibling (%d,%d): %w", level, index, err)
+		}
+		i, err := binary.ReadUvarint(br)
+		if err != nil {
+			return hash, err
+		}
+		if int(l) != level || int(i) != index {
+			return hash, fmt.Errorf("sibling (%d,%d) where (%d,%d) is needed", l, i, level, index)
+		}
+		_, err = io.ReadFull(br, hash[:])
+		return hash, err
+	}
+
+	level := append([]LeafClaim{}, leaves...)
+	width := int(leafCount)
+	for depth := 0; width > 1; depth++ {
+		var parents []LeafClaim
+		for k := 0; k < len(level); k++ {
+			node := level[k]
+			var left, right common.Hash
+			switch {
+			case node.Index%2 == 1:
+				sibling, err := nextSibling(depth, node.Index-1)
+				if err != nil {
+					return nil, err
+				}
+				left, right = sibling, node.Hash
+			case k+1 < len(level) && level[k+1].Index == node.Index+1:
+				left, right = node.Hash, level[k+1].Hash
+				k++
+			case node.Index+1 >= width && depth == 0:
+				left, right = node.Hash, node.Hash // Odd leaf level: the last leaf is paired with itself
+			case node.Index+1 >= width:
+				// Higher up the proof carries the padding copy, which must match
+				sibling, err := nextSibling(depth, node.Index+1)
+				if err != nil {
+					return nil, err
+				}
+				if sibling != node.Hash {
+					return nil, fmt.Errorf("padding copy (%d,%d) differs from its node", depth, node.Index+1)
+				}
+				left, right = node.Hash, sibling
+			default:
+				sibling, err := nextSibling(depth, node.Index+1)
+				if err != nil {
+					return nil, err
+				}
+				left, right = node.Hash, sibling
+			}
+			parents = append(parents, LeafClaim{Index: node.Index / 2, Hash: combineHashes(left, right)})
+		}
+		level = parents
+		width = (width + 1) / 2
+	}
+
+	if _, err := br.ReadByte(); err != io.EOF {
+		return nil, errors.New("trailing data after multiproof")
+	}
+	if level[0].Hash != root {
+		return nil, errors.New("multiproof does not reproduce the root")
+	}
+	return leaves, nil
+}
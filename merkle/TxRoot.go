@@ -0,0 +1,47 @@
+package merkle
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// TxRootComparison contrasts this package's binary root of a block's
+// transactions with the canonical transaction trie root of its header
+type TxRootComparison struct {
+	Transactions int         // Number of transactions in the block
+	BinaryRoot   common.Hash // Root of the binary Merkle tree over the tx hashes
+	HeaderRoot   common.Hash // TxHash recorded in the block header
+	DerivedRoot  common.Hash // DeriveSha over the block body, should equal HeaderRoot
+	Match        bool        // Whether BinaryRoot equals HeaderRoot
+}
+
+// CompareWithEthereumTxRoot computes the binary Merkle root of the block's
+// transactions and reports it next to the header's TxHash. The two only agree
+// by accident: the canonical root is a Merkle Patricia Trie keyed by RLP
+// indices over encoded transactions, while this tree hashes tx hashes pairwise.
+func CompareWithEthereumTxRoot(block *types.Block) TxRootComparison {
+	txs := block.Transactions()
+	c := TxRootComparison{
+		Transactions: len(txs),
+		HeaderRoot:   block.TxHash(),
+		DerivedRoot:  types.DeriveSha(txs, trie.NewStackTrie(nil)),
+	}
+	if len(txs) > 0 {
+		c.BinaryRoot = NewMerkleTree(txs).Root.Hash
+	}
+	c.Match = c.BinaryRoot == c.HeaderRoot
+	return c
+}
+
+// String summarizes the comparison for experiment output
+func (c TxRootComparison) String() string {
+	consistent := "consistent"
+	if c.DerivedRoot != c.HeaderRoot {
+		consistent = "inconsistent"
+	}
+	return fmt.Sprintf("txs=%d binary=%s header=%s (%s with body) match=%v",
+		c.Transactions, c.BinaryRoot.Hex(), c.HeaderRoot.Hex(), consistent, c.Match)
+}
@@ -1,12 +1,20 @@
 package merkle
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/trie"
 	"math/big"
 	"math/rand"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -137,3 +145,1118 @@ func TestGetRequiredHashesForTxs_MT(t *testing.T) {
 		})
 	}
 }
+
+// TestGetMultiProof_MatchesRequiredHashes checks multiproofs against GetRequiredHashes for many tree sizes
+func TestGetMultiProof_MatchesRequiredHashes(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	for _, size := range []int{1, 2, 3, 5, 7, 8, 13, 64, 100} {
+		txs := make([]*types.Transaction, size)
+		for i := range txs {
+			txs[i] = newTestTx(signer, uint64(i), 100)
+		}
+		tree := NewMerkleTree(txs)
+
+		for _, count := range []int{1, 2, size / 2, size} {
+			if count == 0 || count > size {
+				continue
+			}
+			var requested []*types.Transaction
+			for _, i := range rand.Perm(size)[:count] {
+				requested = append(requested, txs[i])
+			}
+			proof, err := tree.GetMultiProof(requested)
+			if err != nil {
+				t.Fatalf("Failed to build multiproof: %v", err)
+			}
+			if need := tree.GetRequiredHashes(requested); len(proof.Hashes) != need {
+				t.Errorf("Error: Tree of %d, %d targets: proof has %d hashes, GetRequiredHashes counts %d", size, count, len(proof.Hashes), need)
+			}
+			if !VerifyMultiProof(tree.Root.Hash, requested, proof) {
+				t.Errorf("Error: Valid multiproof rejected (tree of %d, %d targets)", size, count)
+			}
+			if len(proof.Hashes) > 0 {
+				proof.Hashes[0].Hash[0] ^= 0xff
+				if VerifyMultiProof(tree.Root.Hash, requested, proof) {
+					t.Errorf("Error: Tampered multiproof accepted (tree of %d, %d targets)", size, count)
+				}
+			}
+		}
+	}
+}
+
+// TestVerifyProof_EveryLeafPosition checks single proofs for left and right children alike
+func TestVerifyProof_EveryLeafPosition(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	for _, size := range []int{1, 2, 5, 16, 33} {
+		txs := make([]*types.Transaction, size)
+		for i := range txs {
+			txs[i] = newTestTx(signer, uint64(i), 100)
+		}
+		tree := NewMerkleTree(txs)
+		for i, tx := range txs {
+			proof, err := tree.GetProof(tx)
+			if err != nil {
+				t.Fatalf("Failed to get proof: %v", err)
+			}
+			if !tree.VerifyProof(tx, proof) {
+				t.Errorf("Error: Proof of leaf %d in a tree of %d rejected", i, size)
+			}
+			if len(proof.Left) > 0 {
+				proof.Left[0] = !proof.Left[0]
+				if proof.Hashes[0] != tx.Hash() && tree.VerifyProof(tx, proof) {
+					t.Errorf("Error: Proof with a flipped direction accepted for leaf %d", i)
+				}
+			}
+		}
+	}
+}
+
+// TestGetProofByIndex_VerifyProofAt checks index-addressed proofs for every position
+func TestGetProofByIndex_VerifyProofAt(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	txs := make([]*types.Transaction, 21)
+	for i := range txs {
+		txs[i] = newTestTx(signer, uint64(i), 100)
+	}
+	tree := NewMerkleTree(txs)
+
+	for i, tx := range txs {
+		proof, err := tree.GetProofByIndex(i)
+		if err != nil {
+			t.Fatalf("Failed to get proof for index %d: %v", i, err)
+		}
+		if !VerifyProofAt(tree.Root.Hash, i, tx.Hash(), proof) {
+			t.Errorf("Error: Proof for index %d rejected", i)
+		}
+		// The same proof must not verify the transaction at another position
+		if VerifyProofAt(tree.Root.Hash, i^1, tx.Hash(), proof) && i^1 < len(txs) {
+			t.Errorf("Error: Proof for index %d accepted at index %d", i, i^1)
+		}
+	}
+	if _, err := tree.GetProofByIndex(len(txs)); err == nil {
+		t.Errorf("Error: Out of range index accepted")
+	}
+}
+
+// TestAppend_MatchesRebuild checks that appending leaves one by one gives the same roots as full rebuilds
+func TestAppend_MatchesRebuild(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	txs := make([]*types.Transaction, 40)
+	for i := range txs {
+		txs[i] = newTestTx(signer, uint64(i), 100)
+	}
+
+	tree := NewMerkleTree(nil)
+	for i, tx := range txs {
+		tree.Append(tx)
+		rebuilt := NewMerkleTree(txs[:i+1])
+		if tree.Root.Hash != rebuilt.Root.Hash {
+			t.Fatalf("Error: Root after appending %d leaves differs from rebuild", i+1)
+		}
+	}
+	for i, tx := range txs {
+		proof, err := tree.GetProof(tx)
+		if err != nil || !tree.VerifyProof(tx, proof) {
+			t.Errorf("Error: Proof of appended leaf %d rejected", i)
+		}
+	}
+	// Only the padding copies of the odd levels 5 and 3 remain to be sent
+	if need, want := tree.GetRequiredHashes(txs), NewMerkleTree(txs).GetRequiredHashes(txs); need != 2 || need != want {
+		t.Errorf("Error: Requesting all appended leaves needs %d hashes, rebuild needs %d", need, want)
+	}
+}
+
+// TestUpdateLeaf_MatchesRebuild checks that path recomputation gives the same root as a full rebuild
+func TestUpdateLeaf_MatchesRebuild(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	txs := make([]*types.Transaction, 13)
+	for i := range txs {
+		txs[i] = newTestTx(signer, uint64(i), 100)
+	}
+	tree := NewMerkleTree(append([]*types.Transaction{}, txs...))
+
+	// Include the last leaf, which is duplicated on an odd-sized level
+	for _, index := range []int{0, 5, 12} {
+		txs[index] = newTestTx(signer, uint64(1000+index), 200)
+		if err := tree.UpdateLeaf(index, txs[index]); err != nil {
+			t.Fatalf("Failed to update leaf %d: %v", index, err)
+		}
+		if rebuilt := NewMerkleTree(txs); tree.Root.Hash != rebuilt.Root.Hash {
+			t.Errorf("Error: Root after updating leaf %d differs from rebuild", index)
+		}
+		proof, _ := tree.GetProofByIndex(index)
+		if !VerifyProofAt(tree.Root.Hash, index, txs[index].Hash(), proof) {
+			t.Errorf("Error: Proof of updated leaf %d rejected", index)
+		}
+	}
+	if err := tree.UpdateLeaf(len(txs), txs[0]); err == nil {
+		t.Errorf("Error: Out of range update accepted")
+	}
+}
+
+// TestStreamBuilder_MatchesTree checks streamed roots against materialized trees of many sizes
+func TestStreamBuilder_MatchesTree(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	txs := make([]*types.Transaction, 70)
+	for i := range txs {
+		txs[i] = newTestTx(signer, uint64(i), 100)
+	}
+
+	b := NewStreamBuilder()
+	for i, tx := range txs {
+		b.Add(tx)
+		if want := NewMerkleTree(txs[:i+1]).Root.Hash; b.Root() != want {
+			t.Fatalf("Error: Streamed root of %d leaves differs from tree root", i+1)
+		}
+	}
+
+	ch := make(chan *types.Transaction)
+	go func() {
+		for _, tx := range txs {
+			ch <- tx
+		}
+		close(ch)
+	}()
+	root, count := StreamRoot(ch)
+	if count != len(txs) || root != NewMerkleTree(txs).Root.Hash {
+		t.Errorf("Error: Channel stream of %d transactions gave a different root", count)
+	}
+}
+
+// TestProof_SerializedVerification checks binary and JSON round trips through the tree-free verifier
+func TestProof_SerializedVerification(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	txs := make([]*types.Transaction, 11)
+	for i := range txs {
+		txs[i] = newTestTx(signer, uint64(i), 100)
+	}
+	tree := NewMerkleTree(txs)
+	root := tree.Root.Hash
+
+	for i, tx := range txs {
+		proof, err := tree.GetProof(tx)
+		if err != nil {
+			t.Fatalf("Failed to get proof: %v", err)
+		}
+
+		encoded, err := proof.MarshalBinary()
+		if err != nil {
+			t.Fatalf("Failed to encode proof: %v", err)
+		}
+		var decoded Proof
+		if err := decoded.UnmarshalBinary(encoded); err != nil {
+			t.Fatalf("Failed to decode proof: %v", err)
+		}
+		if !Verify(root, tx.Hash(), decoded) {
+			t.Errorf("Error: Binary-decoded proof of leaf %d rejected", i)
+		}
+		if err := decoded.UnmarshalBinary(encoded[:len(encoded)-1]); err == nil {
+			t.Errorf("Error: Truncated proof decoded")
+		}
+
+		data, err := json.Marshal(proof)
+		if err != nil {
+			t.Fatalf("Failed to marshal proof: %v", err)
+		}
+		var fromJSON Proof
+		if err := json.Unmarshal(data, &fromJSON); err != nil {
+			t.Fatalf("Failed to unmarshal proof: %v", err)
+		}
+		if !Verify(root, tx.Hash(), fromJSON) {
+			t.Errorf("Error: JSON-decoded proof of leaf %d rejected", i)
+		}
+	}
+}
+
+// TestSortedMerkleTree_ProofsWithoutDirections checks sorted-pair proofs for every leaf
+func TestSortedMerkleTree_ProofsWithoutDirections(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	txs := make([]*types.Transaction, 19)
+	for i := range txs {
+		txs[i] = newTestTx(signer, uint64(i), 100)
+	}
+	tree := NewSortedMerkleTree(txs)
+	if tree.Root.Hash == NewMerkleTree(txs).Root.Hash {
+		t.Errorf("Error: Sorted and ordered trees share a root")
+	}
+
+	for i, tx := range txs {
+		proof, err := tree.GetProof(tx)
+		if err != nil {
+			t.Fatalf("Failed to get proof: %v", err)
+		}
+		if !VerifySorted(tree.Root.Hash, tx.Hash(), proof.Hashes) {
+			t.Errorf("Error: Sorted proof of leaf %d rejected", i)
+		}
+		if !tree.VerifyProof(tx, proof) {
+			t.Errorf("Error: Tree rejected its own sorted proof of leaf %d", i)
+		}
+	}
+
+	// Multiproofs of a sorted tree need the sorted verifiers
+	requested := []*types.Transaction{txs[2], txs[7], txs[18]}
+	multi, err := tree.GetMultiProof(requested)
+	if err != nil {
+		t.Fatalf("Failed to get multiproof: %v", err)
+	}
+	if !VerifySortedMultiProof(tree.Root.Hash, requested, multi) {
+		t.Errorf("Error: Sorted multiproof rejected")
+	}
+	if VerifyMultiProof(tree.Root.Hash, requested, multi) {
+		t.Errorf("Error: Sorted multiproof accepted by the ordered verifier")
+	}
+	claims := make([]LeafClaim, len(multi.Indices))
+	for i, index := range multi.Indices {
+		claims[i] = LeafClaim{Index: index, Hash: multi.Leaves[i]}
+	}
+	if !VerifySortedLeafClaims(tree.Root.Hash, claims, *multi) {
+		t.Errorf("Error: Sorted leaf claim rejected")
+	}
+
+	// A known pair must hash like OpenZeppelin's _hashPair
+	a, b := txs[0].Hash(), txs[1].Hash()
+	if hashSortedPair(a, b) != hashSortedPair(b, a) {
+		t.Errorf("Error: Sorted pair hashing depends on argument order")
+	}
+}
+
+// TestNewMerkleTreeFromLeaves checks trees over raw data and precomputed hashes
+func TestNewMerkleTreeFromLeaves(t *testing.T) {
+	leaves := make([][]byte, 9)
+	hashes := make([]common.Hash, len(leaves))
+	for i := range leaves {
+		leaves[i] = []byte{byte(i), 0xaa, byte(i * 7)}
+		hashes[i] = crypto.Keccak256Hash(leaves[i])
+	}
+	fromLeaves := NewMerkleTreeFromLeaves(leaves)
+	fromHashes := NewMerkleTreeFromHashes(hashes)
+	if fromLeaves.Root.Hash != fromHashes.Root.Hash {
+		t.Fatalf("Error: Trees from leaves and from their hashes differ")
+	}
+
+	// Proof machinery works without transactions
+	for i, hash := range hashes {
+		proof, err := fromLeaves.GetProofByIndex(i)
+		if err != nil {
+			t.Fatalf("Failed to get proof for leaf %d: %v", i, err)
+		}
+		if !VerifyProofAt(fromLeaves.Root.Hash, i, hash, proof) || !Verify(fromLeaves.Root.Hash, hash, proof) {
+			t.Errorf("Error: Proof of data leaf %d rejected", i)
+		}
+	}
+
+	// Transaction hashes as leaves reproduce the transaction tree
+	signer := types.LatestSigner(params.TestChainConfig)
+	txs := []*types.Transaction{newTestTx(signer, 0, 100), newTestTx(signer, 1, 100), newTestTx(signer, 2, 100)}
+	if NewMerkleTreeFromHashes([]common.Hash{txs[0].Hash(), txs[1].Hash(), txs[2].Hash()}).Root.Hash != NewMerkleTree(txs).Root.Hash {
+		t.Errorf("Error: Tree from transaction hashes differs from transaction tree")
+	}
+}
+
+// TestGetRequiredHashSet_MatchesCount checks the concrete hash set against the counting API
+func TestGetRequiredHashSet_MatchesCount(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	txs := make([]*types.Transaction, 300)
+	for i := range txs {
+		txs[i] = newTestTx(signer, uint64(i), 100)
+	}
+	tree := NewMerkleTree(txs)
+
+	for _, count := range []int{1, 10, 100, 300} {
+		requested := txs[:count]
+		set := tree.GetRequiredHashSet(requested)
+		if len(set) != tree.GetRequiredHashes(requested) {
+			t.Errorf("Error: Hash set has %d entries, counting API reports %d", len(set), tree.GetRequiredHashes(requested))
+		}
+		// Every entry sits at its claimed position, padding copies one past
+		// the last node of their level
+		for _, h := range set {
+			level := tree.levels[h.Level]
+			index := h.Index
+			if index == len(level) {
+				index--
+			}
+			if node := level[index]; node.Hash != h.Hash {
+				t.Errorf("Error: Hash at level %d index %d does not match the tree", h.Level, h.Index)
+			}
+		}
+		t.Logf("Proving %d transactions takes %d hashes (%d bytes)", count, len(set), len(set)*common.HashLength)
+	}
+}
+
+// TestSerialize_RestoresTree checks both serialized forms against the original tree
+func TestSerialize_RestoresTree(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	txs := make([]*types.Transaction, 37)
+	for i := range txs {
+		txs[i] = newTestTx(signer, uint64(i), 100)
+	}
+	tree := NewMerkleTree(txs)
+
+	for _, withInterior := range []bool{false, true} {
+		var buf bytes.Buffer
+		if err := tree.Serialize(&buf, withInterior); err != nil {
+			t.Fatalf("Failed to serialize tree: %v", err)
+		}
+		size := buf.Len()
+		restored, err := Deserialize(&buf)
+		if err != nil {
+			t.Fatalf("Failed to deserialize tree: %v", err)
+		}
+		if restored.Root.Hash != tree.Root.Hash {
+			t.Fatalf("Error: Restored root differs (interior: %v)", withInterior)
+		}
+		requested := txs[3:9]
+		if restored.GetRequiredHashes(requested) != tree.GetRequiredHashes(requested) {
+			t.Errorf("Error: Restored tree counts different required hashes")
+		}
+		proof, _ := restored.GetProofByIndex(20)
+		if !VerifyProofAt(tree.Root.Hash, 20, txs[20].Hash(), proof) {
+			t.Errorf("Error: Proof from restored tree rejected")
+		}
+		t.Logf("Serialized %d leaves in %d bytes (interior: %v)", len(txs), size, withInterior)
+	}
+
+	// A forged leaf count must fail on the missing hashes, not on allocation
+	forged := binary.AppendUvarint([]byte{serializeVersion, 0}, 1<<32)
+	if _, err := Deserialize(bytes.NewReader(forged)); err == nil {
+		t.Errorf("Error: Tree claiming 1<<32 leaves without hashes deserialized")
+	}
+}
+
+// TestCompactMerkleTree_MatchesFullTree checks roots and recomputed proofs for odd and even sizes
+func TestCompactMerkleTree_MatchesFullTree(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	for _, size := range []int{1, 2, 7, 16, 33} {
+		txs := make([]*types.Transaction, size)
+		for i := range txs {
+			txs[i] = newTestTx(signer, uint64(i), 100)
+		}
+		tree := NewMerkleTree(txs)
+		compact := NewCompactMerkleTree(txs)
+		if compact.Root() != tree.Root.Hash {
+			t.Fatalf("Error: Compact root differs for %d leaves", size)
+		}
+		for i, tx := range txs {
+			proof, err := compact.GetProofByIndex(i)
+			if err != nil {
+				t.Fatalf("Failed to get proof: %v", err)
+			}
+			if !VerifyProofAt(compact.Root(), i, tx.Hash(), proof) || !tree.VerifyProof(tx, proof) {
+				t.Errorf("Error: Compact proof for leaf %d of %d rejected", i, size)
+			}
+		}
+	}
+}
+
+// TestCTRoot_TestVectors checks roots against the RFC 6962 test vectors used by Certificate Transparency
+func TestCTRoot_TestVectors(t *testing.T) {
+	leaves := [][]byte{
+		common.FromHex(""),
+		common.FromHex("00"),
+		common.FromHex("10"),
+		common.FromHex("2021"),
+		common.FromHex("3031"),
+		common.FromHex("40414243"),
+		common.FromHex("5051525354555657"),
+		common.FromHex("606162636465666768696a6b6c6d6e6f"),
+	}
+	roots := []string{
+		"6e340b9cffb37a989ca544e6bb780a2c78901d3fb33738768511a30617afa01d",
+		"fac54203e7cc696cf0dfcb42c92a1d9dbaf70ad9e621f4bd8d98662f00e3c125",
+		"aeb6bcfe274b70a14fb067a5e5578264db0fa9b51af5e0ba159158f329e06e77",
+		"d37ee418976dd95753c1c73862b9398fa2a2cf9b4ff0fdfe8b30cd95209614b7",
+		"4e3bbb1f7b478dcfe71fb631631519a3bca12c9aefca1612bfce4c13a86264d4",
+		"76e67dadbcdf1e10e1b74ddc608abd2f98dfb16fbce75277b5232a127f2087ef",
+		"ddb89be403809e325750d3d263cd78929c2942b7942a34b77e122c9594a74c8c",
+		"5dc9da79a70659a9ad559cb701ded9a2ab9d823aad2f4960cfe370eff4604328",
+	}
+	if CTRoot(nil) != common.HexToHash("e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855") {
+		t.Errorf("Error: Wrong root for the empty tree")
+	}
+	for size := 1; size <= len(leaves); size++ {
+		root := CTRoot(leaves[:size])
+		if root != common.HexToHash(roots[size-1]) {
+			t.Fatalf("Error: Root of %d leaves is %x, want %s", size, root, roots[size-1])
+		}
+		for i := 0; i < size; i++ {
+			proof, err := CTInclusionProof(leaves[:size], i)
+			if err != nil {
+				t.Fatalf("Failed to get inclusion proof: %v", err)
+			}
+			if !VerifyCTInclusion(root, i, size, CTLeafHash(leaves[i]), proof) {
+				t.Errorf("Error: Inclusion proof for leaf %d of %d rejected", i, size)
+			}
+			if size > 1 && VerifyCTInclusion(root, (i+1)%size, size, CTLeafHash(leaves[i]), proof) {
+				t.Errorf("Error: Inclusion proof for leaf %d of %d accepted at wrong index", i, size)
+			}
+		}
+	}
+}
+
+// TestCompareWithEthereumTxRoot checks the report against a block built with a canonical tx root
+func TestCompareWithEthereumTxRoot(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	txs := make([]*types.Transaction, 5)
+	for i := range txs {
+		txs[i] = newTestTx(signer, uint64(i), 100)
+	}
+	block := types.NewBlock(&types.Header{Number: big.NewInt(1)}, &types.Body{Transactions: txs}, nil, trie.NewStackTrie(nil))
+
+	c := CompareWithEthereumTxRoot(block)
+	if c.DerivedRoot != c.HeaderRoot {
+		t.Errorf("Error: Derived root does not match header TxHash")
+	}
+	if c.BinaryRoot != NewMerkleTree(txs).Root.Hash {
+		t.Errorf("Error: Binary root differs from the tree root")
+	}
+	if c.Match {
+		t.Errorf("Error: Binary root unexpectedly equals the canonical root")
+	}
+	t.Log(c)
+}
+
+// TestNewMerkleTreeWithStats checks node count and height for an odd-sized tree
+func TestNewMerkleTreeWithStats(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	txs := make([]*types.Transaction, 5)
+	for i := range txs {
+		txs[i] = newTestTx(signer, uint64(i), 100)
+	}
+	tree, stats := NewMerkleTreeWithStats(txs)
+	if tree.Root.Hash != NewMerkleTree(txs).Root.Hash {
+		t.Fatalf("Error: Root differs from NewMerkleTree")
+	}
+	// 5 leaves + 1 duplicate -> 3 parents + 1 duplicate -> 2 parents -> 1 root
+	if stats.Nodes != 13 || stats.Height != 3 {
+		t.Errorf("Error: Expected 13 nodes over 3 levels, got %d over %d", stats.Nodes, stats.Height)
+	}
+	if stats.BytesHashed <= 6*2*common.HashLength {
+		t.Errorf("Error: Bytes hashed %d do not include leaf encodings", stats.BytesHashed)
+	}
+	t.Logf("Built tree in %v, %d bytes hashed", stats.Duration, stats.BytesHashed)
+}
+
+// TestWithUpdatedLeaf_SharesUnchangedNodes serves proofs from the original tree while deriving new versions
+func TestWithUpdatedLeaf_SharesUnchangedNodes(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	txs := make([]*types.Transaction, 11)
+	for i := range txs {
+		txs[i] = newTestTx(signer, uint64(i), 100)
+	}
+	tree := NewMerkleTree(txs)
+	root := tree.Root.Hash
+
+	// Readers keep proving against the original tree while versions are derived
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i, tx := range txs {
+				proof, _ := tree.GetProofByIndex(i)
+				if !VerifyProofAt(root, i, tx.Hash(), proof) {
+					t.Errorf("Error: Proof for leaf %d of the original tree rejected", i)
+				}
+			}
+		}()
+	}
+	version := tree
+	for i := range txs {
+		updated, err := version.WithUpdatedLeaf(i, newTestTx(signer, uint64(100+i), 1))
+		if err != nil {
+			t.Fatalf("Failed to update leaf: %v", err)
+		}
+		version = updated
+	}
+	wg.Wait()
+
+	if tree.Root.Hash != root {
+		t.Fatalf("Error: Original tree changed by WithUpdatedLeaf")
+	}
+	if version.Root.Hash != NewMerkleTree(version.Transactions).Root.Hash {
+		t.Fatalf("Error: Updated version differs from a rebuild")
+	}
+	for i, tx := range version.Transactions {
+		proof, err := version.GetProof(tx)
+		if err != nil || !version.VerifyProof(tx, proof) {
+			t.Errorf("Error: Proof for leaf %d of the updated version rejected", i)
+		}
+	}
+	if _, err := tree.WithUpdatedLeaf(len(txs), txs[0]); err == nil {
+		t.Errorf("Error: Expected an error for an out of range index")
+	}
+}
+
+// TestVerifyLeafClaims checks batch verification of claimed positions against one multiproof
+func TestVerifyLeafClaims(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	txs := make([]*types.Transaction, 21)
+	for i := range txs {
+		txs[i] = newTestTx(signer, uint64(i), 100)
+	}
+	tree := NewMerkleTree(txs)
+	positions := []int{2, 3, 9, 20}
+	requested := make([]*types.Transaction, len(positions))
+	claims := make([]LeafClaim, len(positions))
+	for i, pos := range positions {
+		requested[i] = txs[pos]
+		claims[i] = LeafClaim{Index: pos, Hash: txs[pos].Hash()}
+	}
+	proof, err := tree.GetMultiProof(requested)
+	if err != nil {
+		t.Fatalf("Failed to get multiproof: %v", err)
+	}
+
+	if !VerifyLeafClaims(tree.Root.Hash, claims, *proof) {
+		t.Fatalf("Error: Valid claims rejected")
+	}
+	if !VerifyLeafClaims(tree.Root.Hash, append(claims, claims[0]), *proof) {
+		t.Errorf("Error: Repeated identical claim rejected")
+	}
+	forged := append([]LeafClaim{}, claims...)
+	forged[1].Hash = txs[4].Hash()
+	if VerifyLeafClaims(tree.Root.Hash, forged, *proof) {
+		t.Errorf("Error: Forged leaf hash accepted")
+	}
+	moved := append([]LeafClaim{}, claims...)
+	moved[2].Index = 8
+	if VerifyLeafClaims(tree.Root.Hash, moved, *proof) {
+		t.Errorf("Error: Claim at the wrong position accepted")
+	}
+}
+
+// TestWriteDOT_HighlightsProofNodes checks highlighting and truncation of the DOT output
+func TestWriteDOT_HighlightsProofNodes(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	txs := make([]*types.Transaction, 6)
+	for i := range txs {
+		txs[i] = newTestTx(signer, uint64(i), 100)
+	}
+	tree := NewMerkleTree(txs)
+	requested := []*types.Transaction{txs[1]}
+
+	var buf bytes.Buffer
+	if err := tree.WriteDOT(&buf, requested, 0); err != nil {
+		t.Fatalf("Failed to write DOT: %v", err)
+	}
+	out := buf.String()
+	if got := strings.Count(out, dotProofColor); got != tree.GetRequiredHashes(requested) {
+		t.Errorf("Error: Expected %d proof nodes highlighted, got %d", tree.GetRequiredHashes(requested), got)
+	}
+	if !strings.Contains(out, "l0_1 [") || !strings.Contains(out, dotTargetColor) {
+		t.Errorf("Error: Target leaf missing or not highlighted")
+	}
+	if !strings.Contains(out, "_dup") {
+		t.Errorf("Error: Duplicated padding node missing")
+	}
+
+	buf.Reset()
+	if err := tree.WriteDOT(&buf, requested, 2); err != nil {
+		t.Fatalf("Failed to write DOT: %v", err)
+	}
+	if strings.Contains(buf.String(), "l0_") {
+		t.Errorf("Error: Leaves drawn in a view truncated to 2 levels")
+	}
+}
+
+// TestSSZTree_ProofsByGeneralizedIndex checks SSZ roots, single proofs and multiproofs
+func TestSSZTree_ProofsByGeneralizedIndex(t *testing.T) {
+	data := make([]byte, 5*common.HashLength-7)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	chunks := SSZChunks(data)
+	tree := NewSSZTree(chunks)
+	if len(chunks) != 5 || tree.Depth() != 3 {
+		t.Fatalf("Error: Expected 5 chunks at depth 3, got %d at depth %d", len(chunks), tree.Depth())
+	}
+
+	// Root by hand: pad to 8 chunks with zero chunks
+	var zero common.Hash
+	padded := append(append([]common.Hash{}, chunks...), zero, zero, zero)
+	for len(padded) > 1 {
+		var next []common.Hash
+		for i := 0; i < len(padded); i += 2 {
+			next = append(next, sha256.Sum256(append(padded[i].Bytes(), padded[i+1].Bytes()...)))
+		}
+		padded = next
+	}
+	if tree.Root() != padded[0] {
+		t.Fatalf("Error: SSZ root differs from the padded reference")
+	}
+
+	for i, chunk := range chunks {
+		gindex := tree.GeneralizedIndex(i)
+		branch, err := tree.Proof(gindex)
+		if err != nil {
+			t.Fatalf("Failed to get SSZ proof: %v", err)
+		}
+		if !VerifySSZProof(tree.Root(), chunk, gindex, branch) {
+			t.Errorf("Error: SSZ proof for chunk %d rejected", i)
+		}
+		if VerifySSZProof(tree.Root(), chunk, gindex^1, branch) {
+			t.Errorf("Error: SSZ proof for chunk %d accepted at sibling index", i)
+		}
+	}
+
+	gindices := []uint64{tree.GeneralizedIndex(0), tree.GeneralizedIndex(1), tree.GeneralizedIndex(4)}
+	proof, err := tree.MultiProof(gindices)
+	if err != nil {
+		t.Fatalf("Failed to get SSZ multiproof: %v", err)
+	}
+	// Chunks 0 and 1 (gindex 8, 9) need only 5; chunk 4 (gindex 12) needs 13, a zero chunk, and 7
+	if len(proof) != 3 {
+		t.Errorf("Error: Expected 3 helper hashes, got %d", len(proof))
+	}
+	leaves := []common.Hash{chunks[0], chunks[1], chunks[4]}
+	if !VerifySSZMultiProof(tree.Root(), gindices, leaves, proof) {
+		t.Errorf("Error: SSZ multiproof rejected")
+	}
+	leaves[2] = chunks[3]
+	if VerifySSZMultiProof(tree.Root(), gindices, leaves, proof) {
+		t.Errorf("Error: SSZ multiproof with a forged leaf accepted")
+	}
+}
+
+// TestAggregateProofs_DeduplicatesSharedSiblings checks naive, deduplicated and minimal proof sizes
+func TestAggregateProofs_DeduplicatesSharedSiblings(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	txs := make([]*types.Transaction, 16)
+	for i := range txs {
+		txs[i] = newTestTx(signer, uint64(i), 100)
+	}
+	tree := NewMerkleTree(txs)
+
+	// Leaves 0 and 2: each proof has 4 hashes; they share the top two siblings
+	// and each is the sibling of the other's parent
+	requested := []*types.Transaction{txs[0], txs[2]}
+	agg, err := tree.AggregateProofs(requested)
+	if err != nil {
+		t.Fatalf("Failed to aggregate proofs: %v", err)
+	}
+	if agg.Naive != 8 || agg.Deduplicated != 6 || agg.Minimal != 4 {
+		t.Errorf("Error: Expected sizes 8/6/4, got %d/%d/%d", agg.Naive, agg.Deduplicated, agg.Minimal)
+	}
+	if agg.Minimal != tree.GetRequiredHashes(requested) {
+		t.Errorf("Error: Minimal size differs from GetRequiredHashes")
+	}
+
+	// The last of five leaves is paired with copies of itself and of its
+	// parent; both are recorded at the positions the hashes come from
+	odd := NewMerkleTree(txs[:5])
+	agg, err = odd.AggregateProofs(txs[4:5])
+	if err != nil {
+		t.Fatalf("Failed to aggregate proofs: %v", err)
+	}
+	if agg.Naive != 3 || agg.Deduplicated != 3 || agg.Minimal != odd.GetRequiredHashes(txs[4:5]) {
+		t.Errorf("Error: Expected sizes 3/3/%d, got %d/%d/%d", odd.GetRequiredHashes(txs[4:5]), agg.Naive, agg.Deduplicated, agg.Minimal)
+	}
+	for _, h := range agg.Hashes {
+		if h.Index >= len(odd.levels[h.Level]) || odd.levels[h.Level][h.Index].Hash != h.Hash {
+			t.Errorf("Error: Aggregated hash at level %d index %d does not match the tree", h.Level, h.Index)
+		}
+	}
+	if _, err := tree.AggregateProofs([]*types.Transaction{newTestTx(signer, 99, 1)}); err == nil {
+		t.Errorf("Error: Expected an error for a transaction not in the tree")
+	}
+}
+
+// TestGetExclusionProof_SortedLeaves checks absence proofs inside and at both edges of the leaf range
+func TestGetExclusionProof_SortedLeaves(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	txs := make([]*types.Transaction, 7)
+	for i := range txs {
+		txs[i] = newTestTx(signer, uint64(i), 100)
+	}
+	tree := NewMerkleTreeWithSortedLeaves(txs)
+	root := tree.Root.Hash
+
+	if _, err := tree.GetProof(newTestTx(signer, 99, 1)); err == nil {
+		t.Errorf("Error: Expected an error proving a transaction not in the tree")
+	}
+	if _, err := NewMerkleTree(txs).GetExclusionProof(common.Hash{}); err == nil {
+		t.Errorf("Error: Expected an error for a tree without sorted leaves")
+	}
+
+	first, last := tree.Nodes[0].Hash, tree.Nodes[len(tree.Nodes)-1].Hash
+	absent := []common.Hash{
+		{},                   // Before the first leaf
+		common.MaxHash,       // After the last leaf
+		incrementHash(first), // Between leaves 0 and 1
+		incrementHash(tree.Nodes[3].Hash),
+	}
+	for _, hash := range absent {
+		proof, err := tree.GetExclusionProof(hash)
+		if err != nil {
+			t.Fatalf("Failed to get exclusion proof: %v", err)
+		}
+		if !VerifyExclusionProof(root, hash, proof) {
+			t.Errorf("Error: Exclusion proof for %x rejected", hash)
+		}
+	}
+	if _, err := tree.GetExclusionProof(last); err == nil {
+		t.Errorf("Error: Expected an error for a hash in the tree")
+	}
+
+	// A neighbour that is not the last leaf cannot stand alone
+	proof, _ := tree.GetExclusionProof(incrementHash(tree.Nodes[5].Hash))
+	proof.Right = nil
+	if VerifyExclusionProof(root, incrementHash(tree.Nodes[5].Hash), proof) {
+		t.Errorf("Error: Exclusion proof without right neighbour accepted")
+	}
+}
+
+// incrementHash returns the hash one larger than h
+func incrementHash(h common.Hash) common.Hash {
+	for i := len(h) - 1; i >= 0; i-- {
+		h[i]++
+		if h[i] != 0 {
+			break
+		}
+	}
+	return h
+}
+
+// TestLevelAccessors checks level widths and leaf hashes of an odd-sized tree
+func TestLevelAccessors(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	txs := make([]*types.Transaction, 5)
+	for i := range txs {
+		txs[i] = newTestTx(signer, uint64(i), 100)
+	}
+	tree := NewMerkleTree(txs)
+
+	for i, want := range []int{5, 3, 2, 1} {
+		if got := len(tree.Level(i)); got != want {
+			t.Errorf("Error: Level %d has %d nodes, want %d", i, got, want)
+		}
+	}
+	if tree.Level(4) != nil || tree.Level(-1) != nil {
+		t.Errorf("Error: Expected nil for levels outside the tree")
+	}
+	if tree.Level(3)[0] != tree.Root {
+		t.Errorf("Error: Top level does not hold the root")
+	}
+	hashes := tree.LeafHashes()
+	for i, leaf := range tree.Leaves() {
+		if leaf.Hash != txs[i].Hash() || hashes[i] != leaf.Hash {
+			t.Errorf("Error: Leaf %d does not match its transaction", i)
+		}
+	}
+}
+
+// TestProofPath_EqualsLeafIndex checks that the direction bitfield of a proof is its leaf index
+func TestProofPath_EqualsLeafIndex(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	txs := make([]*types.Transaction, 13)
+	for i := range txs {
+		txs[i] = newTestTx(signer, uint64(i), 100)
+	}
+	tree := NewMerkleTree(txs)
+	for i := range txs {
+		proof, _ := tree.GetProofByIndex(i)
+		path, depth, err := proof.Path()
+		if err != nil {
+			t.Fatalf("Failed to get proof path: %v", err)
+		}
+		if path != uint64(i) || depth != 4 {
+			t.Errorf("Error: Proof of leaf %d has path %d at depth %d", i, path, depth)
+		}
+		rebuilt, err := ProofFromPath(path, proof.Hashes)
+		if err != nil || !VerifyProofAt(tree.Root.Hash, i, txs[i].Hash(), rebuilt) {
+			t.Errorf("Error: Proof rebuilt from path for leaf %d rejected", i)
+		}
+	}
+	if _, err := ProofFromPath(1<<5, make([]common.Hash, 4)); err == nil {
+		t.Errorf("Error: Expected an error for directions beyond the depth")
+	}
+}
+
+// TestVerifyStream_SingleAndMultiProofs verifies encoded proofs while reading them
+func TestVerifyStream_SingleAndMultiProofs(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	txs := make([]*types.Transaction, 50)
+	for i := range txs {
+		txs[i] = newTestTx(signer, uint64(i), 100)
+	}
+	tree := NewMerkleTree(txs)
+	root := tree.Root.Hash
+
+	proof, _ := tree.GetProofByIndex(37)
+	encoded, _ := proof.MarshalBinary()
+	if ok, err := VerifyProofStream(root, txs[37].Hash(), bytes.NewReader(encoded)); err != nil || !ok {
+		t.Errorf("Error: Streamed single proof rejected: %v", err)
+	}
+	if ok, _ := VerifyProofStream(root, txs[36].Hash(), bytes.NewReader(encoded)); ok {
+		t.Errorf("Error: Streamed single proof accepted for the wrong leaf")
+	}
+
+	requested := []*types.Transaction{txs[0], txs[1], txs[17], txs[49]}
+	multi, err := tree.GetMultiProof(requested)
+	if err != nil {
+		t.Fatalf("Failed to get multiproof: %v", err)
+	}
+	var buf bytes.Buffer
+	if _, err := multi.WriteTo(&buf); err != nil {
+		t.Fatalf("Failed to write multiproof: %v", err)
+	}
+	stream := buf.Bytes()
+	leaves, err := VerifyMultiProofStream(root, bytes.NewReader(stream))
+	if err != nil {
+		t.Fatalf("Error: Streamed multiproof rejected: %v", err)
+	}
+	if len(leaves) != len(requested) || leaves[2].Hash != txs[17].Hash() {
+		t.Errorf("Error: Streamed multiproof returned wrong leaves")
+	}
+	if _, err := VerifyMultiProofStream(root, bytes.NewReader(stream[:len(stream)-1])); err == nil {
+		t.Errorf("Error: Truncated multiproof accepted")
+	}
+	tampered := append([]byte{}, stream...)
+	tampered[len(tampered)-1] ^= 1
+	if _, err := VerifyMultiProofStream(root, bytes.NewReader(tampered)); err == nil {
+		t.Errorf("Error: Tampered multiproof accepted")
+	}
+	// Huge claimed counts must fail on the short stream, not on allocation
+	for _, count := range []uint64{1 << 62, 1 << 32} {
+		header := binary.AppendUvarint(binary.AppendUvarint(nil, count), count)
+		if _, err := VerifyMultiProofStream(root, bytes.NewReader(header)); err == nil {
+			t.Errorf("Error: Multiproof claiming %d leaves accepted", count)
+		}
+	}
+}
+
+// TestAppendAll_IncrementalRoots checks every intermediate root against the streaming builder
+func TestAppendAll_IncrementalRoots(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	txs := make([]*types.Transaction, 40)
+	for i := range txs {
+		txs[i] = newTestTx(signer, uint64(i), 100)
+	}
+	tree := NewMerkleTree(txs[:9])
+	roots := tree.AppendAll(txs[9:])
+
+	builder := NewStreamBuilder()
+	for i, tx := range txs {
+		builder.Add(tx)
+		if i >= 9 && roots[i-9] != builder.Root() {
+			t.Fatalf("Error: Root after appending leaf %d differs from the streaming root", i)
+		}
+	}
+	if tree.Root.Hash != NewMerkleTree(txs).Root.Hash {
+		t.Errorf("Error: Final root differs from rebuild")
+	}
+}
+
+// TestProofSizeBytes checks the byte count against the streamed proof and transaction encodings
+func TestProofSizeBytes(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	txs := make([]*types.Transaction, 20)
+	for i := range txs {
+		txs[i] = newTestTx(signer, uint64(i), 100)
+	}
+	tree := NewMerkleTree(txs)
+	requested := []*types.Transaction{txs[2], txs[3], txs[15]}
+
+	proof, _ := tree.GetMultiProof(requested)
+	var buf bytes.Buffer
+	proof.WriteTo(&buf)
+	want := buf.Len()
+	for _, tx := range requested {
+		encoded, _ := tx.MarshalBinary()
+		want += len(encoded)
+	}
+	if got := tree.ProofSizeBytes(requested); got != want {
+		t.Errorf("Error: Expected %d proof bytes, got %d", want, got)
+	}
+	if got := tree.ProofSizeBytes(append(requested, newTestTx(signer, 99, 1))); got != want {
+		t.Errorf("Error: Unknown transaction changed the size to %d", got)
+	}
+	if tree.ProofSizeBytes(nil) != 0 {
+		t.Errorf("Error: Expected zero bytes for no transactions")
+	}
+}
+
+// TestHashPair_NoAllocations checks that pooled pair hashing matches Keccak256 without allocating
+func TestHashPair_NoAllocations(t *testing.T) {
+	left, right := common.HexToHash("0x01"), common.HexToHash("0x02")
+	if hashPair(left, right) != crypto.Keccak256Hash(left.Bytes(), right.Bytes()) {
+		t.Fatalf("Error: Pooled pair hash differs from Keccak256")
+	}
+	hashPair(left, right) // Warm the pool
+	if allocs := testing.AllocsPerRun(100, func() { hashPair(left, right) }); allocs > 0 {
+		t.Errorf("Error: Pair hashing allocated %.1f times per run", allocs)
+	}
+}
+
+// TestNewMerkleTreeWithPolicy_Duplicates checks every duplicate policy on a block repeating one transaction
+func TestNewMerkleTreeWithPolicy_Duplicates(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	txs := make([]*types.Transaction, 6)
+	for i := range txs {
+		txs[i] = newTestTx(signer, uint64(i), 100)
+	}
+	withDup := append(append([]*types.Transaction{}, txs...), txs[2])
+
+	if _, err := NewMerkleTreeWithPolicy(withDup, DuplicatesReject); err == nil {
+		t.Errorf("Error: Expected duplicates to be rejected")
+	}
+	if _, err := NewMerkleTreeWithPolicy(txs, DuplicatesReject); err != nil {
+		t.Errorf("Error: Unique transactions rejected: %v", err)
+	}
+
+	deduped, err := NewMerkleTreeWithPolicy(withDup, DuplicatesDeduplicate)
+	if err != nil || deduped.Root.Hash != NewMerkleTree(txs).Root.Hash {
+		t.Errorf("Error: Deduplicated tree differs from the unique tree")
+	}
+
+	qualified, err := NewMerkleTreeWithPolicy(withDup, DuplicatesIndexQualify)
+	if err != nil {
+		t.Fatalf("Failed to build qualified tree: %v", err)
+	}
+	if qualified.Nodes[2].Hash != txs[2].Hash() || qualified.Nodes[6].Hash != QualifiedLeafHash(txs[2].Hash(), 6) {
+		t.Fatalf("Error: Only the repeated occurrence should be qualified")
+	}
+	proof, err := qualified.GetProof(txs[2])
+	if err != nil || !VerifyProofAt(qualified.Root.Hash, 2, txs[2].Hash(), proof) {
+		t.Errorf("Error: Lookup by transaction does not resolve to the first occurrence")
+	}
+	proof, _ = qualified.GetProofByIndex(6)
+	if !VerifyProofAt(qualified.Root.Hash, 6, QualifiedLeafHash(txs[2].Hash(), 6), proof) {
+		t.Errorf("Error: Proof of the qualified copy rejected")
+	}
+	if need := qualified.GetRequiredHashes([]*types.Transaction{txs[2]}); need != len(proof.Hashes) {
+		t.Errorf("Error: Expected one proof path for the first occurrence, got %d hashes", need)
+	}
+}
+
+// TestNewMerkleTreeReusing_SharedPrefix checks reuse of complete subtrees from the previous block
+func TestNewMerkleTreeReusing_SharedPrefix(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	txs := make([]*types.Transaction, 24)
+	for i := range txs {
+		txs[i] = newTestTx(signer, uint64(i), 100)
+	}
+	prev := NewMerkleTree(txs[:20])
+	// Next block keeps the first 16 transactions and replaces the rest
+	next := append(append([]*types.Transaction{}, txs[:16]...), txs[20:]...)
+	prevRoot := prev.Root.Hash
+
+	tree, fresh := NewMerkleTreeReusing(prev, next)
+	if tree.Root.Hash != NewMerkleTree(next).Root.Hash {
+		t.Fatalf("Error: Reusing tree differs from rebuild")
+	}
+	// The complete subtree over leaves 0..15 is reused: only the right spine
+	// over leaves 16..19 is hashed, 2 + 1 + 1 + 1 pairs plus the root
+	if fresh != 6 {
+		t.Errorf("Error: Expected 6 fresh hashes, got %d", fresh)
+	}
+	if prev.Root.Hash != prevRoot {
+		t.Errorf("Error: Previous tree modified")
+	}
+	for i, tx := range next {
+		proof, _ := tree.GetProofByIndex(i)
+		if !VerifyProofAt(tree.Root.Hash, i, tx.Hash(), proof) {
+			t.Errorf("Error: Proof for leaf %d of the reusing tree rejected", i)
+		}
+	}
+	if _, fresh := NewMerkleTreeReusing(nil, next); fresh != 21 {
+		t.Errorf("Error: Expected 21 fresh hashes without a previous tree, got %d", fresh)
+	}
+}
+
+// TestSolidityProof_Calldata checks exported proofs against the ABI encoder and a golden calldata layout
+func TestSolidityProof_Calldata(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	txs := make([]*types.Transaction, 5)
+	for i := range txs {
+		txs[i] = newTestTx(signer, uint64(i), 100)
+	}
+	if _, err := NewMerkleTree(txs).GetSolidityProof(txs[0]); err == nil {
+		t.Errorf("Error: Expected an error for a tree without sorted pairs")
+	}
+	tree := NewSortedMerkleTree(txs)
+	proof, err := tree.GetSolidityProof(txs[3])
+	if err != nil {
+		t.Fatalf("Failed to export proof: %v", err)
+	}
+	if !VerifySorted(proof.Root, proof.Leaf, proof.Proof) {
+		t.Fatalf("Error: Exported proof rejected")
+	}
+
+	parsed, err := abi.JSON(strings.NewReader(`[{"type":"function","name":"verify","inputs":[{"name":"proof","type":"bytes32[]"},{"name":"root","type":"bytes32"},{"name":"leaf","type":"bytes32"}]}]`))
+	if err != nil {
+		t.Fatalf("Failed to parse ABI: %v", err)
+	}
+	proofWords := make([][32]byte, len(proof.Proof))
+	for i, h := range proof.Proof {
+		proofWords[i] = h
+	}
+	packed, err := parsed.Pack("verify", proofWords, [32]byte(proof.Root), [32]byte(proof.Leaf))
+	if err != nil {
+		t.Fatalf("Failed to pack call: %v", err)
+	}
+	if !bytes.Equal(proof.Calldata(), packed) {
+		t.Errorf("Error: Calldata differs from the ABI encoder")
+	}
+
+	// Golden layout for a fixed proof: selector 0x5a9a49c7, offset 0x60, root, leaf, length 2, elements
+	golden := SolidityProof{
+		Proof: []common.Hash{common.HexToHash("0x0a"), common.HexToHash("0x0b")},
+		Root:  common.HexToHash("0x01"),
+		Leaf:  common.HexToHash("0x02"),
+	}
+	want := "5a9a49c7" +
+		"0000000000000000000000000000000000000000000000000000000000000060" +
+		"0000000000000000000000000000000000000000000000000000000000000001" +
+		"0000000000000000000000000000000000000000000000000000000000000002" +
+		"0000000000000000000000000000000000000000000000000000000000000002" +
+		"000000000000000000000000000000000000000000000000000000000000000a" +
+		"000000000000000000000000000000000000000000000000000000000000000b"
+	if got := common.Bytes2Hex(golden.Calldata()); got != want {
+		t.Errorf("Error: Golden calldata mismatch:\n got %s\nwant %s", got, want)
+	}
+}
+
+// TestNewMerkleTreeFromLogs_EventInclusion checks receipt and log trees and their required hashes
+func TestNewMerkleTreeFromLogs_EventInclusion(t *testing.T) {
+	receipts := make(types.Receipts, 3)
+	for i := range receipts {
+		receipts[i] = &types.Receipt{Type: types.LegacyTxType, Status: types.ReceiptStatusSuccessful, CumulativeGasUsed: uint64(21000 * (i + 1))}
+		for j := 0; j <= i; j++ {
+			receipts[i].Logs = append(receipts[i].Logs, &types.Log{
+				Address: common.BigToAddress(big.NewInt(int64(i))),
+				Topics:  []common.Hash{common.BigToHash(big.NewInt(int64(j)))},
+				Data:    []byte{byte(i), byte(j)},
+			})
+		}
+		receipts[i].Bloom = types.CreateBloom(receipts[i])
+	}
+
+	receiptTree, err := NewMerkleTreeFromReceipts(receipts)
+	if err != nil {
+		t.Fatalf("Failed to build receipt tree: %v", err)
+	}
+	if len(receiptTree.Nodes) != 3 {
+		t.Errorf("Error: Expected 3 receipt leaves, got %d", len(receiptTree.Nodes))
+	}
+	logTree, err := NewMerkleTreeFromLogs(receipts)
+	if err != nil {
+		t.Fatalf("Failed to build log tree: %v", err)
+	}
+	if len(logTree.Nodes) != 6 {
+		t.Fatalf("Error: Expected 6 log leaves, got %d", len(logTree.Nodes))
+	}
+
+	// Logs 3..5 of the last receipt: 4 and 5 share a parent, 3 needs log 2 as
+	// its sibling, and one level up the pair (0,1) and the copy padding the
+	// odd level are needed
+	leaf, _ := LogLeafHash(receipts[2].Logs[0])
+	if logTree.Nodes[3].Hash != leaf {
+		t.Errorf("Error: Log leaves out of block order")
+	}
+	targets := []common.Hash{logTree.Nodes[3].Hash, logTree.Nodes[4].Hash, logTree.Nodes[5].Hash}
+	if need := logTree.GetRequiredHashesForLeaves(targets); need != 3 {
+		t.Errorf("Error: Expected 3 required hashes, got %d", need)
+	}
+}
@@ -0,0 +1,43 @@
+package verkle
+
+import (
+	"bytes"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ProofSizes compares the aggregated proof of a set of targets with proving
+// every target on its own
+type ProofSizes struct {
+	Targets    int // Targets proven
+	Aggregated int // Bytes of one VerkleProof with a single opening for all targets
+	Naive      int // Bytes of one VerkleProof per target, each with its own opening
+}
+
+// Saved returns the bytes saved by aggregating
+func (s ProofSizes) Saved() int {
+	return s.Naive - s.Aggregated
+}
+
+// MeasureProofSizes proves the targets together and reports the size of that
+// proof next to the total size of independent proofs, one per target. The
+// independent proofs are not generated: each carries the commitments on its
+// path below the root, its path and an opening, and an IPA opening has the same
+// size whatever it proves, so their sizes follow from the aggregated proof.
+func (t *VerkleTree) MeasureProofSizes(targets []common.Hash) (ProofSizes, error) {
+	proof, err := t.Prove(targets)
+	if err != nil {
+		return ProofSizes{}, err
+	}
+	var opening bytes.Buffer
+	if err := proof.Opening.Write(&opening); err != nil {
+		return ProofSizes{}, err
+	}
+
+	sizes := ProofSizes{Targets: len(proof.Paths), Aggregated: proof.SizeBytes()}
+	for _, path := range proof.Paths {
+		// Every node on the path but the root contributes its commitment
+		sizes.Naive += (len(path)-1)*PedersenCommitmentSize + len(path) + opening.Len()
+	}
+	return sizes, nil
+}
@@ -0,0 +1,191 @@
+package verkle
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// ClusteredVerkleTree applies the clustering of the cmpt package to Verkle
+// commitments (C-Verkle). Every cluster is packed into an inner tree with
+// commitments over its members, and an outer tree with commitments has one
+// leaf per cluster, ordered by prefix, holding ClusterLeaf of the cluster's
+// prefix and inner root. Proving transactions of a few clusters then opens the
+// outer tree only at those clusters.
+type ClusteredVerkleTree struct {
+	Outer    *VerkleTree            // Commitments over the cluster leaves
+	Clusters map[string]*VerkleTree // Inner tree of every cluster, by prefix
+
+	prefixes []string               // Cluster prefixes in outer leaf order
+	members  map[common.Hash]string // Cluster prefix of every transaction
+}
+
+// ClusterLeaf returns the outer leaf of a cluster: Keccak256 of its prefix
+// followed by the root of its inner tree, so a leaf binds both
+func ClusterLeaf(prefix []byte, innerRoot common.Hash) common.Hash {
+	return crypto.Keccak256Hash(prefix, innerRoot.Bytes())
+}
+
+// NewClusteredVerkleTree builds a C-Verkle tree of width k over the clusters,
+// as grouped by cmpt.ClusterTransactions. Empty clusters are skipped.
+func NewClusteredVerkleTree(clusters map[string][]*types.Transaction, k int) (*ClusteredVerkleTree, error) {
+	if k < 2 {
+		return nil, fmt.Errorf("verkle: width %d below 2", k)
+	}
+	c := &ClusteredVerkleTree{
+		Clusters: make(map[string]*VerkleTree, len(clusters)),
+		members:  make(map[common.Hash]string),
+	}
+	for prefix, txs := range clusters {
+		if len(txs) > 0 {
+			c.prefixes = append(c.prefixes, prefix)
+		}
+	}
+	sort.Strings(c.prefixes)
+
+	leaves := make([]*Node, len(c.prefixes))
+	for i, prefix := range c.prefixes {
+		inner, err := NewVerkleTreeWithCommitmentsK(clusters[prefix], k)
+		if err != nil {
+			return nil, fmt.Errorf("cluster %x: %w", prefix, err)
+		}
+		c.Clusters[prefix] = inner
+		for _, tx := range clusters[prefix] {
+			c.members[tx.Hash()] = prefix
+		}
+		hash := ClusterLeaf([]byte(prefix), inner.Root.Hash)
+		leaves[i] = &Node{IsLeaf: true, TxHash: hash}
+	}
+	c.Outer = buildLeaves(leaves, k)
+	if err := c.Outer.ComputeCommitments(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Root returns the root of the outer tree
+func (c *ClusteredVerkleTree) Root() common.Hash {
+	if c.Outer.Root == nil {
+		return common.Hash{}
+	}
+	return c.Outer.Root.Hash
+}
+
+// ClusteredProof proves transactions of a C-Verkle tree. Members lists the
+// proven transactions of each cluster, Inner proves them against the cluster's
+// InnerRoot and Outer proves the cluster leaves against the root. A proof is
+// nil where the tree is a single leaf, whose hash is then the root itself.
+type ClusteredProof struct {
+	Prefixes   [][]byte        // Prefixes of the clusters involved
+	InnerRoots []common.Hash   // Inner tree roots of those clusters
+	Members    [][]common.Hash // Proven transactions of each cluster
+	Inner      []*VerkleProof  // Proof of each cluster's members against its inner root
+	Outer      *VerkleProof    // Proof of the cluster leaves against the root
+}
+
+// Prove generates a proof for the transactions with the given hashes
+func (c *ClusteredVerkleTree) Prove(txHashes []common.Hash) (*ClusteredProof, error) {
+	if len(txHashes) == 0 {
+		return nil, errors.New("verkle: no transactions requested")
+	}
+	proof := &ClusteredProof{}
+	index := make(map[string]int)
+	for _, hash := range uniqueHashes(txHashes) {
+		prefix, ok := c.members[hash]
+		if !ok {
+			return nil, fmt.Errorf("verkle: transaction %s not in tree", hash.Hex())
+		}
+		i, ok := index[prefix]
+		if !ok {
+			i = len(proof.Prefixes)
+			index[prefix] = i
+			proof.Prefixes = append(proof.Prefixes, []byte(prefix))
+			proof.InnerRoots = append(proof.InnerRoots, c.Clusters[prefix].Root.Hash)
+			proof.Members = append(proof.Members, nil)
+		}
+		proof.Members[i] = append(proof.Members[i], hash)
+	}
+
+	leaves := make([]common.Hash, len(proof.Prefixes))
+	proof.Inner = make([]*VerkleProof, len(proof.Prefixes))
+	for i, prefix := range proof.Prefixes {
+		leaves[i] = ClusterLeaf(prefix, proof.InnerRoots[i])
+		inner, err := proveOrLeaf(c.Clusters[string(prefix)], proof.Members[i])
+		if err != nil {
+			return nil, err
+		}
+		proof.Inner[i] = inner
+	}
+	outer, err := proveOrLeaf(c.Outer, leaves)
+	if err != nil {
+		return nil, err
+	}
+	proof.Outer = outer
+	return proof, nil
+}
+
+// proveOrLeaf proves the targets, or returns nil if the tree is one leaf
+func proveOrLeaf(t *VerkleTree, targets []common.Hash) (*VerkleProof, error) {
+	if t.Root.IsLeaf {
+		return nil, nil
+	}
+	return t.Prove(targets)
+}
+
+// VerifyClusteredProof checks that the transactions with the given hashes,
+// and no others, are proven members of the C-Verkle tree with the given root
+func VerifyClusteredProof(root common.Hash, txHashes []common.Hash, proof *ClusteredProof) (bool, error) {
+	if proof == nil {
+		return false, nil
+	}
+	n := len(proof.Prefixes)
+	if n == 0 || len(proof.InnerRoots) != n || len(proof.Members) != n || len(proof.Inner) != n {
+		return false, nil
+	}
+	requested := make(map[common.Hash]bool, len(txHashes))
+	for _, hash := range txHashes {
+		requested[hash] = true
+	}
+	proven := make(map[common.Hash]bool, len(requested))
+	leaves := make([]common.Hash, n)
+	for i := range proof.Prefixes {
+		for _, hash := range proof.Members[i] {
+			if !requested[hash] {
+				return false, nil
+			}
+			proven[hash] = true
+		}
+		ok, err := verifyOrLeaf(proof.InnerRoots[i], proof.Members[i], proof.Inner[i])
+		if err != nil || !ok {
+			return false, err
+		}
+		leaves[i] = ClusterLeaf(proof.Prefixes[i], proof.InnerRoots[i])
+	}
+	if len(proven) != len(requested) {
+		return false, nil
+	}
+	return verifyOrLeaf(root, leaves, proof.Outer)
+}
+
+// verifyOrLeaf checks a proof of proveOrLeaf
+func verifyOrLeaf(root common.Hash, targets []common.Hash, proof *VerkleProof) (bool, error) {
+	if proof == nil {
+		return len(targets) == 1 && targets[0] == root, nil
+	}
+	return VerifyProof(root, targets, proof)
+}
+
+// SizeBytes returns the encoded size of the proof: prefixes, inner roots and
+// the inner and outer proofs. Member hashes are not counted, since the
+// verifier derives them from the transactions it receives.
+func (p *ClusteredProof) SizeBytes() int {
+	size := len(p.InnerRoots)*PedersenCommitmentSize + p.Outer.SizeBytes()
+	for i, prefix := range p.Prefixes {
+		size += len(prefix) + p.Inner[i].SizeBytes()
+	}
+	return size
+}
@@ -0,0 +1,123 @@
+package verkle
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/crate-crypto/go-ipa/bandersnatch/fr"
+	ipacommon "github.com/crate-crypto/go-ipa/common"
+	"github.com/crate-crypto/go-ipa/ipa"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// MaxCommitmentWidth is the widest node a Pedersen commitment can hold, one
+// evaluation per child
+const MaxCommitmentWidth = ipacommon.VectorLength
+
+var (
+	ipaOnce   sync.Once
+	ipaConfig *ipa.IPAConfig
+	ipaErr    error
+)
+
+// ipaSettings returns the shared IPA configuration, generated on first use
+func ipaSettings() (*ipa.IPAConfig, error) {
+	ipaOnce.Do(func() {
+		ipaConfig, ipaErr = ipa.NewIPASettings()
+	})
+	return ipaConfig, ipaErr
+}
+
+// NewVerkleTreeWithCommitments creates a Verkle tree from a list of
+// transactions whose interior nodes are Pedersen vector commitments on the
+// Banderwagon curve rather than Keccak256 hashes. An interior node commits to
+// the scalars of its children: a leaf contributes its transaction hash reduced
+// modulo the scalar field, an interior child its commitment mapped to the
+// scalar field. The hash of an interior node is its compressed commitment.
+func NewVerkleTreeWithCommitments(txs []*types.Transaction) (*VerkleTree, error) {
+	return NewVerkleTreeWithCommitmentsK(txs, K)
+}
+
+// NewVerkleTreeWithCommitmentsK creates a Verkle tree of width k with
+// commitments, see NewVerkleTreeWithCommitments. The width must lie between 2
+// and MaxCommitmentWidth; real Verkle designs use the full 256.
+func NewVerkleTreeWithCommitmentsK(txs []*types.Transaction, k int) (*VerkleTree, error) {
+	t, err := NewVerkleTreeWithK(txs, k)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.ComputeCommitments(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// ComputeCommitments replaces the hashes of all interior nodes with Pedersen
+// commitments to their children. It fails if the tree is wider than
+// MaxCommitmentWidth.
+func (t *VerkleTree) ComputeCommitments() error {
+	if t == nil {
+		return nil
+	}
+	if t.K > MaxCommitmentWidth {
+		return fmt.Errorf("verkle: width %d exceeds the commitment width %d", t.K, MaxCommitmentWidth)
+	}
+	if t.Root == nil {
+		return nil
+	}
+	conf, err := ipaSettings()
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	computeCommitmentsPostOrder(conf, t.Root)
+	t.committed = true
+	t.hashTime = time.Since(start)
+	return nil
+}
+
+// computeCommitmentsPostOrder recursively commits to the children of every
+// interior node using a post-order traversal
+func computeCommitmentsPostOrder(conf *ipa.IPAConfig, node *Node) {
+	if node.IsLeaf {
+		node.Hash = node.TxHash
+		return
+	}
+	for _, child := range node.Children {
+		if child != nil {
+			computeCommitmentsPostOrder(conf, child)
+		}
+	}
+	c := conf.Commit(childPolynomial(node))
+	node.commitment = &c
+	node.Hash = c.Bytes()
+}
+
+// childPolynomial returns the evaluations committed to by an interior node,
+// zero for empty slots and beyond its last child. A stem node also commits to
+// a marker and its stem, see NewKeyedVerkleTree.
+func childPolynomial(node *Node) []fr.Element {
+	poly := make([]fr.Element, ipacommon.VectorLength)
+	for i, child := range node.Children {
+		if child != nil {
+			poly[i] = nodeScalar(child)
+		}
+	}
+	if node.Stem != nil {
+		poly[stemMarkerIndex].SetOne()
+		poly[stemIndex].SetBytes(node.Stem)
+	}
+	return poly
+}
+
+// nodeScalar returns the value a node contributes to its parent's commitment
+func nodeScalar(node *Node) fr.Element {
+	var s fr.Element
+	if node.IsLeaf {
+		s.SetBytes(node.leafValue().Bytes())
+	} else {
+		node.commitment.MapToScalarField(&s)
+	}
+	return s
+}
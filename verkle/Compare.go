@@ -0,0 +1,98 @@
+package verkle
+
+import (
+	"errors"
+	"time"
+
+	"mytrees/mpt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// RequestComparison pairs the Verkle and MPT costs of one request
+type RequestComparison struct {
+	Targets            int           // Requested transactions found in the set
+	VerkleWitnessBytes int           // Transactions plus VerkleProof, see WitnessSizeBytes
+	MPTWitnessBytes    int           // Transactions plus the required MPT hashes
+	VerkleProveTime    time.Duration // Time to generate the VerkleProof
+	VerkleVerifyTime   time.Duration // Time to check it with VerifyProof
+	MPTProveTime       time.Duration // Time to count the required MPT hashes
+}
+
+// Comparison is the result of CompareWithMPT, one entry per request
+type Comparison struct {
+	VerkleBuildTime time.Duration // Building and committing the Verkle tree
+	MPTBuildTime    time.Duration // Building and hashing the trie, see mpt.BuildMPTTree
+	Requests        []RequestComparison
+}
+
+// CompareWithMPT builds a Verkle tree of width k with commitments and an MPT
+// over the same transactions and measures every request of the workload on
+// both. The MPT witness is modeled as in mpt.CalculateRequiredHashes2, 32
+// bytes per required hash, since the mpt package generates no proofs; for the
+// same reason its prover time only covers collecting the hashes and no MPT
+// verifier time is reported. Requested transactions outside the set are
+// ignored, and an empty request yields an empty entry.
+func CompareWithMPT(txs []*types.Transaction, requests [][]*types.Transaction, k int) (*Comparison, error) {
+	start := time.Now()
+	tree, err := NewVerkleTreeWithCommitmentsK(txs, k)
+	if err != nil {
+		return nil, err
+	}
+	cmp := &Comparison{VerkleBuildTime: time.Since(start)}
+	trie, mptBuild := mpt.BuildMPTTree(mpt.NewTrie(), txs)
+	cmp.MPTBuildTime = mptBuild
+
+	inSet := make(map[common.Hash]bool, len(txs))
+	for _, tx := range txs {
+		inSet[tx.Hash()] = true
+	}
+	for _, request := range requests {
+		var (
+			targets []common.Hash
+			present []*types.Transaction
+			payload int
+		)
+		seen := make(map[common.Hash]bool, len(request))
+		for _, tx := range request {
+			hash := tx.Hash()
+			if !inSet[hash] || seen[hash] {
+				continue
+			}
+			seen[hash] = true
+			targets = append(targets, hash)
+			present = append(present, tx)
+			payload += int(tx.Size())
+		}
+		result := RequestComparison{Targets: len(targets)}
+		if len(targets) == 0 {
+			cmp.Requests = append(cmp.Requests, result)
+			continue
+		}
+
+		start = time.Now()
+		proof, err := proveOrLeaf(tree, targets)
+		if err != nil {
+			return nil, err
+		}
+		result.VerkleProveTime = time.Since(start)
+		start = time.Now()
+		ok, err := verifyOrLeaf(tree.Root.Hash, targets, proof)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, errors.New("verkle: proof of requested transactions does not verify")
+		}
+		result.VerkleVerifyTime = time.Since(start)
+		result.VerkleWitnessBytes = payload + proof.SizeBytes()
+
+		start = time.Now()
+		hashes := trie.CalculateRequiredHashes2(present)
+		result.MPTProveTime = time.Since(start)
+		result.MPTWitnessBytes = payload + hashes*common.HashLength
+		cmp.Requests = append(cmp.Requests, result)
+	}
+	return cmp, nil
+}
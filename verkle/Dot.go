@@ -0,0 +1,78 @@
+package verkle
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Fill colours of highlighted nodes
+const (
+	dotTargetColor = "#9be39b" // Requested leaves
+	dotPathColor   = "#ffc266" // Commitments on the target paths, opened by the proof
+)
+
+// WriteDOT renders the tree as a Graphviz digraph with commitments and hashes
+// truncated to their first four bytes, highlighting the target leaves and the
+// nodes on their paths, which a Verkle proof opens instead of sending
+// siblings. Edges are labelled with child slots and stem nodes with their
+// stem. With maxDepth > 0 only the top maxDepth levels are drawn. Nodes are
+// named n<i> in pre-order.
+func (t *VerkleTree) WriteDOT(w io.Writer, targets []common.Hash, maxDepth int) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "digraph verkle {")
+	fmt.Fprintln(bw, "\tnode [fontname=\"monospace\", fontsize=10, style=filled, fillcolor=white];")
+	if t == nil || t.Root == nil {
+		fmt.Fprintln(bw, "}")
+		return bw.Flush()
+	}
+
+	colors := make(map[*Node]string)
+	leaves := make(map[common.Hash]*Node)
+	collectLeaves(t.Root, leaves)
+	for _, h := range targets {
+		leaf, ok := leaves[h]
+		if !ok {
+			continue
+		}
+		colors[leaf] = dotTargetColor
+		for node := leaf.Parent; node != nil; node = node.Parent {
+			colors[node] = dotPathColor
+		}
+	}
+	next := 0
+	writeDOTNode(bw, t.Root, 0, maxDepth, colors, &next)
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
+
+// writeDOTNode writes node and the subtree below it, returning its id
+func writeDOTNode(w io.Writer, node *Node, depth, maxDepth int, colors map[*Node]string, next *int) int {
+	id := *next
+	*next++
+	label := fmt.Sprintf("%x", node.Hash[:4])
+	if node.Stem != nil {
+		label = fmt.Sprintf("stem %x\\n%s", node.Stem[:4], label)
+	}
+	attrs := ""
+	if color, ok := colors[node]; ok {
+		attrs = fmt.Sprintf(", fillcolor=\"%s\"", color)
+	}
+	if node.IsLeaf {
+		attrs += ", shape=box"
+	}
+	fmt.Fprintf(w, "\tn%d [label=\"%s\"%s];\n", id, label, attrs)
+	if maxDepth > 0 && depth+1 >= maxDepth {
+		return id
+	}
+	for i, child := range node.Children {
+		if child == nil {
+			continue
+		}
+		childID := writeDOTNode(w, child, depth+1, maxDepth, colors, next)
+		fmt.Fprintf(w, "\tn%d -> n%d [label=\"%d\"];\n", id, childID, i)
+	}
+	return id
+}
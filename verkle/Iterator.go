@@ -0,0 +1,63 @@
+package verkle
+
+import "github.com/ethereum/go-ethereum/common"
+
+// NodeInfo describes one node as yielded by NodeIterator
+type NodeInfo struct {
+	Depth      int         // Levels below the root
+	ChildIndex int         // Slot below the parent, zero for the root
+	IsLeaf     bool        // Whether the node is a leaf
+	Hash       common.Hash // Hash, compressed commitment or leaf value of the node
+}
+
+// NodeIterator walks the nodes of a tree in pre-order, children by slot, so
+// analysis code need not recurse into Node itself. Empty slots of keyed trees
+// are skipped.
+type NodeIterator struct {
+	stack []iteratorEntry
+	info  NodeInfo
+}
+
+// iteratorEntry is a node waiting to be visited
+type iteratorEntry struct {
+	node  *Node
+	depth int
+	index int
+}
+
+// NewNodeIterator returns an iterator positioned before the root
+func (t *VerkleTree) NewNodeIterator() *NodeIterator {
+	it := &NodeIterator{}
+	if t != nil && t.Root != nil {
+		it.stack = append(it.stack, iteratorEntry{node: t.Root})
+	}
+	return it
+}
+
+// Next advances to the next node and reports whether one exists
+func (it *NodeIterator) Next() bool {
+	if len(it.stack) == 0 {
+		return false
+	}
+	entry := it.stack[len(it.stack)-1]
+	it.stack = it.stack[:len(it.stack)-1]
+
+	// Push in reverse so the lowest slot pops first
+	for i := len(entry.node.Children) - 1; i >= 0; i-- {
+		if child := entry.node.Children[i]; child != nil {
+			it.stack = append(it.stack, iteratorEntry{node: child, depth: entry.depth + 1, index: i})
+		}
+	}
+	it.info = NodeInfo{
+		Depth:      entry.depth,
+		ChildIndex: entry.index,
+		IsLeaf:     entry.node.IsLeaf,
+		Hash:       entry.node.Hash,
+	}
+	return true
+}
+
+// Node returns the node the iterator is positioned at
+func (it *NodeIterator) Node() NodeInfo {
+	return it.info
+}
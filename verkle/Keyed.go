@@ -0,0 +1,205 @@
+package verkle
+
+import (
+	"bytes"
+	"sort"
+
+	multiproof "github.com/crate-crypto/go-ipa"
+	"github.com/crate-crypto/go-ipa/bandersnatch/fr"
+	"github.com/crate-crypto/go-ipa/banderwagon"
+	ipacommon "github.com/crate-crypto/go-ipa/common"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// StemLength is the number of key bytes addressing a stem node; the last key
+// byte is the suffix selecting the leaf below it
+const StemLength = common.HashLength - 1
+
+// Slots of a stem node commitment
+const (
+	stemMarkerIndex = 0 // Always one, marking the node as a stem node
+	stemIndex       = 1 // The stem as a scalar
+	suffixIndex     = 2 // The commitment to the leaves by suffix
+)
+
+// StemSuffix splits a key into the stem and suffix of its leaf position
+func StemSuffix(key common.Hash) ([]byte, uint8) {
+	return key[:StemLength], key[StemLength]
+}
+
+// NewKeyedVerkleTree creates a Verkle tree with commitments whose leaves are
+// placed by key in the style of EIP-6800 rather than by input order. The key
+// of a transaction is its hash, split by StemSuffix. Interior nodes have
+// MaxCommitmentWidth slots and branch on successive stem bytes until the stems
+// below them differ; a stem then ends in a stem node committing to a marker
+// of one, the stem and a suffix node, which holds the leaves in the slots
+// given by their suffixes. Empty slots commit to zero. The shape of the tree
+// depends only on the set of keys, so the same transactions in any order give
+// the same root, and a key's path follows from the key and its stem depth.
+// Proofs are generated by Prove and checked with VerifyKeyedProof.
+func NewKeyedVerkleTree(txs []*types.Transaction) (*VerkleTree, error) {
+	leaves := make([]*Node, 0, len(txs))
+	seen := make(map[common.Hash]bool, len(txs))
+	for _, tx := range txs {
+		hash := tx.Hash()
+		if seen[hash] {
+			continue
+		}
+		seen[hash] = true
+		leaves = append(leaves, &Node{IsLeaf: true, TxHash: hash, Transaction: tx})
+	}
+	return newKeyedTree(leaves)
+}
+
+// newKeyedTree places leaves with distinct keys by key and commits to them
+func newKeyedTree(leaves []*Node) (*VerkleTree, error) {
+	t := &VerkleTree{K: MaxCommitmentWidth, keyed: true}
+	if len(leaves) == 0 {
+		return t, nil
+	}
+	sort.Slice(leaves, func(i, j int) bool {
+		return bytes.Compare(leaves[i].TxHash[:], leaves[j].TxHash[:]) < 0
+	})
+	t.Root = buildKeyed(leaves, 0)
+	if err := t.ComputeCommitments(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// buildKeyed builds the subtree at the given depth over leaves sorted by key.
+// The root is always an interior node.
+func buildKeyed(leaves []*Node, depth int) *Node {
+	first, last := leaves[0].TxHash, leaves[len(leaves)-1].TxHash
+	if depth > 0 && bytes.Equal(first[:StemLength], last[:StemLength]) {
+		return newStemNode(leaves)
+	}
+
+	node := &Node{Children: make([]*Node, MaxCommitmentWidth)}
+	for start := 0; start < len(leaves); {
+		b := leaves[start].TxHash[depth]
+		end := start + 1
+		for end < len(leaves) && leaves[end].TxHash[depth] == b {
+			end++
+		}
+		child := buildKeyed(leaves[start:end], depth+1)
+		child.Parent = node
+		node.Children[b] = child
+		start = end
+	}
+	return node
+}
+
+// newStemNode creates the stem node of leaves sharing one stem
+func newStemNode(leaves []*Node) *Node {
+	stem, _ := StemSuffix(leaves[0].TxHash)
+	suffixes := &Node{Children: make([]*Node, MaxCommitmentWidth)}
+	for _, leaf := range leaves {
+		_, suffix := StemSuffix(leaf.TxHash)
+		leaf.Parent = suffixes
+		suffixes.Children[suffix] = leaf
+	}
+	node := &Node{Stem: append([]byte(nil), stem...), Children: make([]*Node, suffixIndex+1)}
+	node.Children[suffixIndex] = suffixes
+	suffixes.Parent = node
+	return node
+}
+
+// VerifyKeyedProof checks that the target keys, in the order they were
+// proven, are leaves of the keyed tree whose root commitment is root. Each
+// path must follow the stem of its key down to a stem node, whose marker and
+// stem are checked against the key, and end at the key's suffix.
+func VerifyKeyedProof(root common.Hash, targets []common.Hash, proof *VerkleProof) (bool, error) {
+	return verifyKeyed(root, targets, targets, proof)
+}
+
+// verifyKeyed checks that the leaves at the target keys hold the given values
+func verifyKeyed(root common.Hash, targets, values []common.Hash, proof *VerkleProof) (bool, error) {
+	if proof == nil || proof.Opening == nil || len(targets) == 0 || len(proof.Paths) != len(targets) {
+		return false, nil
+	}
+	conf, err := ipaSettings()
+	if err != nil {
+		return false, err
+	}
+	var rootC banderwagon.Element
+	if err := rootC.SetBytes(root.Bytes()); err != nil {
+		return false, nil
+	}
+
+	// Commitments are keyed by the path leading to them, as in VerifyProof
+	commitments := map[string]*banderwagon.Element{"": &rootC}
+	opened := make(map[string]*fr.Element)
+	next := 0
+	var (
+		cs []*banderwagon.Element
+		ys []*fr.Element
+		zs []uint8
+	)
+	// open records that the node at prefix evaluates to y at z, unless done,
+	// and reports whether an earlier opening at z agrees with y
+	open := func(prefix []byte, z uint8, y *fr.Element) bool {
+		key := string(prefix) + string([]byte{z})
+		if prev, ok := opened[key]; ok {
+			return prev.Equal(y)
+		}
+		opened[key] = y
+		cs = append(cs, commitments[string(prefix)])
+		ys = append(ys, y)
+		zs = append(zs, z)
+		return true
+	}
+	// child returns the scalar of the interior child at path, taking its
+	// commitment from the proof on first use
+	child := func(path []byte) *fr.Element {
+		c, ok := commitments[string(path)]
+		if !ok {
+			if next == len(proof.Commitments) {
+				return nil
+			}
+			c = new(banderwagon.Element)
+			if err := c.SetBytes(proof.Commitments[next].Bytes()); err != nil {
+				return nil
+			}
+			next++
+			commitments[string(path)] = c
+		}
+		y := new(fr.Element)
+		c.MapToScalarField(y)
+		return y
+	}
+
+	for i, path := range proof.Paths {
+		stem, suffix := StemSuffix(targets[i])
+		depth := len(path) - 2 // Stem bytes above the stem node
+		if depth < 1 || depth > StemLength || !bytes.Equal(path[:depth], stem[:depth]) ||
+			path[depth] != suffixIndex || path[depth+1] != suffix {
+			return false, nil
+		}
+		for d := 0; d < depth; d++ {
+			y := child(path[:d+1])
+			if y == nil || !open(path[:d], path[d], y) {
+				return false, nil
+			}
+		}
+
+		one, stemScalar := new(fr.Element), new(fr.Element)
+		one.SetOne()
+		stemScalar.SetBytes(stem)
+		suffixes := child(path[:depth+1])
+		if suffixes == nil {
+			return false, nil
+		}
+		leaf := new(fr.Element)
+		leaf.SetBytes(values[i].Bytes())
+		if !open(path[:depth], stemMarkerIndex, one) || !open(path[:depth], stemIndex, stemScalar) ||
+			!open(path[:depth], suffixIndex, suffixes) || !open(path[:depth+1], suffix, leaf) {
+			return false, nil
+		}
+	}
+	if next != len(proof.Commitments) {
+		return false, nil
+	}
+	return multiproof.CheckMultiProof(ipacommon.NewTranscript(transcriptLabel), conf, proof.Opening, cs, ys, zs)
+}
@@ -0,0 +1,245 @@
+package verkle
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	multiproof "github.com/crate-crypto/go-ipa"
+	"github.com/crate-crypto/go-ipa/bandersnatch/fr"
+	"github.com/crate-crypto/go-ipa/banderwagon"
+	ipacommon "github.com/crate-crypto/go-ipa/common"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// transcriptLabel is the Fiat-Shamir domain of the opening proofs
+const transcriptLabel = "verkle"
+
+// VerkleProof proves that target leaves belong to a tree built with
+// NewVerkleTreeWithCommitments. Paths holds, per target, the child index taken
+// at every level from the root down. Commitments holds the interior commitments
+// below the root in the order they are first reached walking the paths, and
+// Opening is a single IPA multiproof that every node on those paths evaluates
+// to its child at the given index. The opening has the same size however many
+// targets it covers, so only the commitments grow with the targets.
+type VerkleProof struct {
+	Paths       [][]uint8              // Child indices from the root to each target
+	Commitments []common.Hash          // Compressed interior commitments below the root
+	Opening     *multiproof.MultiProof // Combined IPA opening of every node on the paths
+}
+
+// Prove generates a proof of membership for the target leaf hashes: the
+// commitments on their paths and one opening proving every step. Repeated
+// targets are proven once, at their first position. It fails if
+// the tree has no commitments or a target is not a leaf. Proofs of keyed trees are
+// checked with VerifyKeyedProof rather than VerifyProof.
+func (t *VerkleTree) Prove(targets []common.Hash) (*VerkleProof, error) {
+	if t == nil || t.Root == nil || !t.committed {
+		return nil, errors.New("verkle: tree has no commitments")
+	}
+	if t.Root.IsLeaf || len(targets) == 0 {
+		return nil, errors.New("verkle: nothing to open")
+	}
+	conf, err := ipaSettings()
+	if err != nil {
+		return nil, err
+	}
+
+	leaves := make(map[common.Hash]*Node)
+	collectLeaves(t.Root, leaves)
+	targets = uniqueHashes(targets)
+
+	proof := &VerkleProof{}
+	seen := make(map[*Node]bool)
+	opened := make(map[*Node]map[uint8]bool)
+	var (
+		cs []*banderwagon.Element
+		fs [][]fr.Element
+		zs []uint8
+	)
+	open := func(node *Node, z uint8) {
+		if opened[node][z] {
+			return
+		}
+		if opened[node] == nil {
+			opened[node] = make(map[uint8]bool)
+		}
+		opened[node][z] = true
+		cs = append(cs, node.commitment)
+		fs = append(fs, childPolynomial(node))
+		zs = append(zs, z)
+	}
+	for _, target := range targets {
+		leaf, ok := leaves[target]
+		if !ok {
+			return nil, fmt.Errorf("verkle: target %s not in tree", target.Hex())
+		}
+		path := leafPath(leaf)
+		proof.Paths = append(proof.Paths, path)
+
+		node := t.Root
+		for _, z := range path {
+			if node != t.Root && !seen[node] {
+				seen[node] = true
+				proof.Commitments = append(proof.Commitments, node.Hash)
+			}
+			if node.Stem != nil {
+				// Bind the stem, see VerifyKeyedProof
+				open(node, stemMarkerIndex)
+				open(node, stemIndex)
+			}
+			open(node, z)
+			node = node.Children[z]
+		}
+	}
+
+	proof.Opening, err = multiproof.CreateMultiProof(ipacommon.NewTranscript(transcriptLabel), conf, cs, fs, zs)
+	if err != nil {
+		return nil, err
+	}
+	return proof, nil
+}
+
+// ProveTxs generates a proof of membership for the target transactions
+func (t *VerkleTree) ProveTxs(targetTxs []*types.Transaction) (*VerkleProof, error) {
+	targets := make([]common.Hash, len(targetTxs))
+	for i, tx := range targetTxs {
+		targets[i] = tx.Hash()
+	}
+	return t.Prove(targets)
+}
+
+// VerifyProof checks that the targets, in the order they were
+// proven, are leaves of the tree whose root commitment is root
+func VerifyProof(root common.Hash, targets []common.Hash, proof *VerkleProof) (bool, error) {
+	if proof == nil || proof.Opening == nil || len(targets) == 0 || len(proof.Paths) != len(targets) {
+		return false, nil
+	}
+	conf, err := ipaSettings()
+	if err != nil {
+		return false, err
+	}
+	var rootC banderwagon.Element
+	if err := rootC.SetBytes(root.Bytes()); err != nil {
+		return false, nil
+	}
+
+	// Commitments are keyed by the path leading to them, the root by "". An
+	// interior child is taken from the proof when its parent is first opened
+	// at it, matching the order in which Prove records them. A path opened
+	// before must evaluate to the same value again.
+	commitments := map[string]*banderwagon.Element{"": &rootC}
+	opened := make(map[string]*fr.Element)
+	next := 0
+	var (
+		cs []*banderwagon.Element
+		ys []*fr.Element
+		zs []uint8
+	)
+	for i, path := range proof.Paths {
+		// Leaves all sit at the same depth
+		if len(path) == 0 || len(path) != len(proof.Paths[0]) {
+			return false, nil
+		}
+		for d, z := range path {
+			c := commitments[string(path[:d])]
+			key := string(path[:d+1])
+			prev, done := opened[key]
+			y := new(fr.Element)
+			if d == len(path)-1 {
+				y.SetBytes(targets[i].Bytes())
+				if done && !prev.Equal(y) {
+					return false, nil
+				}
+			}
+			if done {
+				continue
+			}
+			if d < len(path)-1 {
+				if _, ok := commitments[key]; !ok {
+					if next == len(proof.Commitments) {
+						return false, nil
+					}
+					child := new(banderwagon.Element)
+					if err := child.SetBytes(proof.Commitments[next].Bytes()); err != nil {
+						return false, nil
+					}
+					next++
+					commitments[key] = child
+				}
+				commitments[key].MapToScalarField(y)
+			}
+			opened[key] = y
+			cs = append(cs, c)
+			ys = append(ys, y)
+			zs = append(zs, z)
+		}
+	}
+	if next != len(proof.Commitments) {
+		return false, nil
+	}
+	return multiproof.CheckMultiProof(ipacommon.NewTranscript(transcriptLabel), conf, proof.Opening, cs, ys, zs)
+}
+
+// SizeBytes returns the encoded size of the proof: one byte per path step,
+// the compressed commitments and the serialized IPA multiproof
+func (p *VerkleProof) SizeBytes() int {
+	if p == nil {
+		return 0
+	}
+	size := len(p.Commitments) * PedersenCommitmentSize
+	for _, path := range p.Paths {
+		size += len(path)
+	}
+	if p.Opening != nil {
+		var buf bytes.Buffer
+		if err := p.Opening.Write(&buf); err == nil {
+			size += buf.Len()
+		}
+	}
+	return size
+}
+
+// uniqueHashes returns the hashes without repeats, keeping first occurrences
+func uniqueHashes(hashes []common.Hash) []common.Hash {
+	seen := make(map[common.Hash]bool, len(hashes))
+	unique := make([]common.Hash, 0, len(hashes))
+	for _, hash := range hashes {
+		if !seen[hash] {
+			seen[hash] = true
+			unique = append(unique, hash)
+		}
+	}
+	return unique
+}
+
+// collectLeaves indexes the leaves below node by transaction hash
+func collectLeaves(node *Node, leaves map[common.Hash]*Node) {
+	if node.IsLeaf {
+		leaves[node.TxHash] = node
+		return
+	}
+	for _, child := range node.Children {
+		if child != nil {
+			collectLeaves(child, leaves)
+		}
+	}
+}
+
+// leafPath returns the child indices leading from the root to leaf
+func leafPath(leaf *Node) []uint8 {
+	var path []uint8
+	for node := leaf; node.Parent != nil; node = node.Parent {
+		for i, child := range node.Parent.Children {
+			if child == node {
+				path = append(path, uint8(i))
+				break
+			}
+		}
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
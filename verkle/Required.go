@@ -0,0 +1,76 @@
+package verkle
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ElementKind tells what a required element is
+type ElementKind int
+
+const (
+	ElementRoot     ElementKind = iota // The root, known to the verifier
+	ElementInterior                    // An interior commitment below the root, carried by the proof
+	ElementLeaf                        // A target leaf
+	ElementOpening                     // An evaluation of a node at one slot, proven by the opening
+)
+
+// RequiredElement is one element needed to verify a set of targets
+type RequiredElement struct {
+	Kind ElementKind
+	Path []uint8     // Child slots from the root to the node; for an opening, to the slot opened
+	Hash common.Hash // Hash or commitment of the node; zero for openings of stem marker and stem
+}
+
+// RequiredElements returns the concrete elements behind GetRequiredHashes:
+// the root, the interior nodes and the leaves on the target paths, followed
+// by the openings of Prove, one per node and slot. They are listed in the order
+// Prove visits them, so the interior elements match VerkleProof.Commitments
+// one to one. Targets not in the tree are ignored, as in the counting API.
+func (t *VerkleTree) RequiredElements(targets []common.Hash) []RequiredElement {
+	if t == nil || t.Root == nil || len(targets) == 0 {
+		return nil
+	}
+	leaves := make(map[common.Hash]*Node)
+	collectLeaves(t.Root, leaves)
+
+	var nodes, openings []RequiredElement
+	seen := make(map[*Node]bool)
+	opened := make(map[string]bool)
+	open := func(path []uint8, hash common.Hash) {
+		if !opened[string(path)] {
+			opened[string(path)] = true
+			openings = append(openings, RequiredElement{Kind: ElementOpening, Path: path, Hash: hash})
+		}
+	}
+	for _, target := range targets {
+		leaf, ok := leaves[target]
+		if !ok {
+			continue
+		}
+		path := leafPath(leaf)
+		node := t.Root
+		for d := 0; d <= len(path); d++ {
+			if !seen[node] {
+				seen[node] = true
+				kind := ElementInterior
+				switch {
+				case node == t.Root:
+					kind = ElementRoot
+				case node.IsLeaf:
+					kind = ElementLeaf
+				}
+				nodes = append(nodes, RequiredElement{Kind: kind, Path: path[:d:d], Hash: node.Hash})
+			}
+			if d == len(path) {
+				break
+			}
+			if node.Stem != nil {
+				open(append(path[:d:d], stemMarkerIndex), common.Hash{})
+				open(append(path[:d:d], stemIndex), common.Hash{})
+			}
+			node = node.Children[path[d]]
+			open(path[:d+1:d+1], node.Hash)
+		}
+	}
+	return append(nodes, openings...)
+}
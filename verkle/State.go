@@ -0,0 +1,88 @@
+package verkle
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/crate-crypto/go-ipa/bandersnatch/fr"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/trie/utils"
+)
+
+// StateLeaf is one account or storage value at its tree key
+type StateLeaf struct {
+	Key   common.Hash // Tree key, see AccountKey, CodeHashKey and StorageKey
+	Value common.Hash // Value stored under the key
+}
+
+// AccountKey returns the EIP-6800 tree key of an account's basic data leaf
+// (version, code size, nonce and balance)
+func AccountKey(addr common.Address) common.Hash {
+	return common.BytesToHash(utils.BasicDataKey(addr.Bytes()))
+}
+
+// CodeHashKey returns the EIP-6800 tree key of an account's code hash leaf,
+// which shares its stem with the basic data leaf
+func CodeHashKey(addr common.Address) common.Hash {
+	return common.BytesToHash(utils.CodeHashKey(addr.Bytes()))
+}
+
+// StorageKey returns the EIP-6800 tree key of a storage slot. The first slots
+// share the account header stem, later ones are grouped 256 to a stem.
+func StorageKey(addr common.Address, slot common.Hash) common.Hash {
+	return common.BytesToHash(utils.StorageSlotKey(addr.Bytes(), slot.Bytes()))
+}
+
+// NewStateVerkleTree creates a keyed Verkle tree, see NewKeyedVerkleTree, over
+// account and storage leaves instead of transactions, so witnesses of
+// stateless state access can be modeled. Each leaf commits to its value as a
+// scalar, so values must be smaller than the scalar field modulus; a zero
+// value commits like an empty slot.
+// When a key repeats, the last leaf wins. Proofs are generated by Prove with
+// the keys as targets and checked with VerifyStateProof.
+func NewStateVerkleTree(leaves []StateLeaf) (*VerkleTree, error) {
+	index := make(map[common.Hash]int, len(leaves))
+	nodes := make([]*Node, 0, len(leaves))
+	for _, leaf := range leaves {
+		if !inScalarField(leaf.Value) {
+			return nil, fmt.Errorf("verkle: value of key %x exceeds the scalar field", leaf.Key)
+		}
+		value := leaf.Value
+		if i, ok := index[leaf.Key]; ok {
+			nodes[i].Value = &value
+			continue
+		}
+		index[leaf.Key] = len(nodes)
+		nodes = append(nodes, &Node{IsLeaf: true, TxHash: leaf.Key, Value: &value})
+	}
+	return newKeyedTree(nodes)
+}
+
+// VerifyStateProof checks that the leaves, in the order their keys were
+// proven, hold their values in the state tree with the given root
+func VerifyStateProof(root common.Hash, leaves []StateLeaf, proof *VerkleProof) (bool, error) {
+	keys := make([]common.Hash, len(leaves))
+	values := make([]common.Hash, len(leaves))
+	for i, leaf := range leaves {
+		// Larger values would alias the reduced value the tree commits to
+		if !inScalarField(leaf.Value) {
+			return false, nil
+		}
+		keys[i], values[i] = leaf.Key, leaf.Value
+	}
+	return verifyKeyed(root, keys, values, proof)
+}
+
+// leafValue returns the value a leaf commits to
+func (n *Node) leafValue() common.Hash {
+	if n.Value != nil {
+		return *n.Value
+	}
+	return n.TxHash
+}
+
+// inScalarField reports whether a value is a canonical scalar, i.e. smaller
+// than the scalar field modulus
+func inScalarField(value common.Hash) bool {
+	return new(big.Int).SetBytes(value.Bytes()).Cmp(fr.Modulus()) < 0
+}
@@ -0,0 +1,126 @@
+package verkle
+
+import (
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// BuildStats describes the construction of a tree
+type BuildStats struct {
+	Duration    time.Duration // Time spent building, hashing and committing
+	Nodes       int           // Nodes created, leaves included
+	Height      int           // Number of levels above the leaves
+	Commitments int           // Pedersen commitments computed, zero for a Keccak tree
+}
+
+// Logger receives a summary of each build, e.g. log.Printf or testing.T.Logf
+type Logger func(format string, args ...any)
+
+// NewVerkleTreeWithStats creates a Verkle tree of width k like
+// NewVerkleTreeWithK, or like NewVerkleTreeWithCommitmentsK when commit is
+// set, and reports how its construction went instead of printing it. An
+// optional logger is handed the same summary.
+func NewVerkleTreeWithStats(txs []*types.Transaction, k int, commit bool, logger ...Logger) (*VerkleTree, BuildStats, error) {
+	start := time.Now()
+	var (
+		t   *VerkleTree
+		err error
+	)
+	if commit {
+		t, err = NewVerkleTreeWithCommitmentsK(txs, k)
+	} else {
+		t, err = NewVerkleTreeWithK(txs, k)
+	}
+	if err != nil {
+		return nil, BuildStats{}, err
+	}
+
+	stats := BuildStats{Duration: time.Since(start)}
+	if t.Root != nil {
+		interior := countNodes(t.Root, &stats.Nodes)
+		if commit {
+			stats.Commitments = interior
+		}
+		for node := t.Root; !node.IsLeaf; node = node.Children[0] {
+			stats.Height++
+		}
+	}
+	for _, logf := range logger {
+		if logf != nil {
+			logf("verkle: built %d nodes of width %d, height %d, %d commitments in %v",
+				stats.Nodes, k, stats.Height, stats.Commitments, stats.Duration)
+		}
+	}
+	return t, stats, nil
+}
+
+// countNodes adds the nodes below node to total and returns how many of them
+// are interior
+func countNodes(node *Node, total *int) int {
+	*total++
+	if node.IsLeaf {
+		return 0
+	}
+	interior := 1
+	for _, child := range node.Children {
+		if child != nil {
+			interior += countNodes(child, total)
+		}
+	}
+	return interior
+}
+
+// Backends a tree can be hashed with
+const (
+	BackendKeccak   = "keccak"   // Keccak256 of the concatenated children, see ComputeHashes
+	BackendPedersen = "pedersen" // Pedersen vector commitments, see ComputeCommitments
+)
+
+// TreeStats describes the shape of a tree
+type TreeStats struct {
+	Backend       string        // BackendKeccak or BackendPedersen
+	Height        int           // Number of levels below the root down to the deepest leaf
+	NodesPerLevel []int         // Nodes per depth, root first
+	FillFactor    float64       // Occupied child slots of interior nodes divided by their K slots
+	HashTime      time.Duration // Time the last ComputeHashes or ComputeCommitments took
+}
+
+// Stats walks the tree level by level and reports its structure
+func (t *VerkleTree) Stats() TreeStats {
+	stats := TreeStats{Backend: BackendKeccak}
+	if t == nil {
+		return stats
+	}
+	if t.committed {
+		stats.Backend = BackendPedersen
+	}
+	stats.HashTime = t.hashTime
+	if t.Root == nil {
+		return stats
+	}
+
+	interior, occupied := 0, 0
+	for level := []*Node{t.Root}; len(level) > 0; {
+		stats.NodesPerLevel = append(stats.NodesPerLevel, len(level))
+		var next []*Node
+		for _, node := range level {
+			if node.IsLeaf {
+				continue
+			}
+			interior++
+			for _, child := range node.Children {
+				if child != nil {
+					occupied++
+					next = append(next, child)
+				}
+			}
+		}
+		level = next
+	}
+	stats.Height = len(stats.NodesPerLevel) - 1
+	if interior > 0 {
+		stats.FillFactor = float64(occupied) / float64(interior*t.K)
+	}
+	return stats
+}
@@ -0,0 +1,129 @@
+package verkle
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/crate-crypto/go-ipa/bandersnatch/fr"
+	"github.com/crate-crypto/go-ipa/banderwagon"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// NodeChange records a node touched by an update
+type NodeChange struct {
+	Node    *Node       // Node after the update, holding the new hash
+	Path    []int       // Child slots from the root to the node
+	OldHash common.Hash // Hash or commitment before the update
+}
+
+// UpdateLeaf replaces the value of the leaf at the given position, counted in
+// input order, and updates the nodes above it. In a tree with commitments the
+// update is a delta: a commitment is linear in its children, so when the child
+// in slot i changes from v to v' the parent commitment moves by (v' - v) times
+// the i-th basis point, and the parent's own scalar changes in turn. Only the
+// nodes on the path are touched, and no polynomial is committed again. A Keccak
+// tree rehashes the path instead. The leaf no longer holds a transaction
+// afterwards. Keyed trees place leaves by key and cannot be updated in place.
+func (t *VerkleTree) UpdateLeaf(position int, newValue common.Hash) error {
+	_, err := t.update(position, newValue, nil)
+	return err
+}
+
+// Update swaps the transaction at txIndex for newTx like UpdateLeaf and
+// returns the touched nodes from the leaf up to the root, which make up the
+// witness delta of the change
+func (t *VerkleTree) Update(txIndex int, newTx *types.Transaction) ([]NodeChange, error) {
+	if newTx == nil {
+		return nil, errors.New("verkle: nil transaction")
+	}
+	return t.update(txIndex, newTx.Hash(), newTx)
+}
+
+// update sets the leaf at position to value and tx and propagates the change
+func (t *VerkleTree) update(position int, value common.Hash, tx *types.Transaction) ([]NodeChange, error) {
+	if t == nil || t.Root == nil {
+		return nil, errors.New("verkle: empty tree")
+	}
+	if t.keyed {
+		return nil, errors.New("verkle: keyed trees place leaves by key")
+	}
+	path, err := t.positionPath(position)
+	if err != nil {
+		return nil, err
+	}
+	leaf := t.Root
+	for _, slot := range path {
+		leaf = leaf.Children[slot]
+	}
+	changes := []NodeChange{{Node: leaf, Path: path, OldHash: leaf.Hash}}
+	for d, node := len(path)-1, leaf.Parent; node != nil; d, node = d-1, node.Parent {
+		changes = append(changes, NodeChange{Node: node, Path: path[:d:d], OldHash: node.Hash})
+	}
+
+	if !t.committed {
+		leaf.TxHash, leaf.Hash, leaf.Transaction = value, value, tx
+		for _, change := range changes[1:] {
+			node := change.Node
+			buf := make([]byte, 0, len(node.Children)*common.HashLength)
+			for _, child := range node.Children {
+				buf = append(buf, child.Hash.Bytes()...)
+			}
+			node.Hash = crypto.Keccak256Hash(buf)
+		}
+		return changes, nil
+	}
+
+	conf, err := ipaSettings()
+	if err != nil {
+		return nil, err
+	}
+	oldScalar := nodeScalar(leaf)
+	leaf.TxHash, leaf.Hash, leaf.Transaction = value, value, tx
+	newScalar := nodeScalar(leaf)
+	for i, change := range changes[1:] {
+		node := change.Node
+		var delta fr.Element
+		delta.Sub(&newScalar, &oldScalar)
+		var shift banderwagon.Element
+		shift.ScalarMul(&conf.SRS[path[len(path)-1-i]], &delta)
+
+		oldScalar = nodeScalar(node)
+		c := new(banderwagon.Element)
+		c.Add(node.commitment, &shift)
+		node.commitment = c
+		node.Hash = c.Bytes()
+		newScalar = nodeScalar(node)
+	}
+	return changes, nil
+}
+
+// positionPath returns the child slots leading from the root to the leaf at
+// position. Every level groups its nodes K at a time from the left, so the
+// slot of a node below its parent is its index modulo K.
+func (t *VerkleTree) positionPath(position int) ([]int, error) {
+	depth := 0
+	for node := t.Root; !node.IsLeaf; node = node.Children[0] {
+		depth++
+	}
+	path := make([]int, depth)
+	index := position
+	for l := depth - 1; l >= 0; l-- {
+		path[l] = index % t.K
+		index /= t.K
+	}
+	if position < 0 || index != 0 {
+		return nil, fmt.Errorf("verkle: position %d out of range", position)
+	}
+
+	// Short last groups leave some slots empty
+	node := t.Root
+	for _, slot := range path {
+		if slot >= len(node.Children) {
+			return nil, fmt.Errorf("verkle: position %d out of range", position)
+		}
+		node = node.Children[slot]
+	}
+	return path, nil
+}
@@ -1,6 +1,10 @@
 package verkle
 
 import (
+	"fmt"
+	"time"
+
+	"github.com/crate-crypto/go-ipa/banderwagon"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
@@ -13,35 +17,61 @@ const K int = 16
 type Node struct {
 	Children    []*Node            // Child nodes (up to K children)
 	IsLeaf      bool               // Flag indicating if this is a leaf node
-	TxHash      common.Hash        // Transaction hash (only for leaf nodes)
+	TxHash      common.Hash        // Transaction hash, or tree key of a state leaf (only for leaf nodes)
 	Hash        common.Hash        // Hash value of this node
 	Parent      *Node              // Reference to parent node
 	Transaction *types.Transaction // Ethereum transaction (only for leaf nodes)
+	Stem        []byte             // Key stem shared by the children (only for stem nodes of keyed trees)
+	Value       *common.Hash       // Value committed in place of TxHash (only for state leaves)
+
+	commitment *banderwagon.Element // Pedersen commitment to the children, see ComputeCommitments
 }
 
 // VerkleTree represents the complete Verkle tree structure
 type VerkleTree struct {
 	Root *Node // Root node of the tree
 	K    int   // Branching factor (arity) of the tree
+
+	committed bool          // Interior hashes are commitments, see NewVerkleTreeWithCommitments
+	keyed     bool          // Leaves are placed by key, see NewKeyedVerkleTree
+	hashTime  time.Duration // Duration of the last ComputeHashes or ComputeCommitments
 }
 
 // NewVerkleTreeFromTransactions creates a new Verkle tree from a list of transactions
 func NewVerkleTreeFromTransactions(txs []*types.Transaction) *VerkleTree {
+	return build(txs, K)
+}
 
-	t := &VerkleTree{K: K}
-	if len(txs) == 0 {
-		return t
+// NewVerkleTreeWithK creates a Verkle tree of width k from a list of
+// transactions, hashed with Keccak256. Any width of at least 2 is accepted;
+// NewVerkleTreeWithCommitmentsK bounds it by the commitment backend.
+func NewVerkleTreeWithK(txs []*types.Transaction, k int) (*VerkleTree, error) {
+	if k < 2 {
+		return nil, fmt.Errorf("verkle: width %d below 2", k)
 	}
+	return build(txs, k), nil
+}
 
+// build groups the transactions into a tree of width k and hashes it
+func build(txs []*types.Transaction, k int) *VerkleTree {
 	// Create leaf nodes from transactions
-	currentLevel := make([]*Node, len(txs))
+	leaves := make([]*Node, len(txs))
 	for i, tx := range txs {
-		currentLevel[i] = &Node{
+		leaves[i] = &Node{
 			IsLeaf:      true,
 			TxHash:      tx.Hash(),
 			Transaction: tx,
 		}
 	}
+	return buildLeaves(leaves, k)
+}
+
+// buildLeaves groups the leaf nodes into a tree of width k and hashes it
+func buildLeaves(currentLevel []*Node, k int) *VerkleTree {
+	t := &VerkleTree{K: k}
+	if len(currentLevel) == 0 {
+		return t
+	}
 
 	// Build tree structure from bottom up
 	for len(currentLevel) > 1 {
@@ -76,7 +106,10 @@ func (t *VerkleTree) ComputeHashes() {
 	if t == nil || t.Root == nil {
 		return
 	}
+	start := time.Now()
 	computeHashesPostOrder_vk(t.Root)
+	t.committed = false
+	t.hashTime = time.Since(start)
 }
 
 // computeHashesPostOrder_vk recursively computes node hashes using a post-order traversal
@@ -104,6 +137,7 @@ func computeHashesPostOrder_vk(node *Node) common.Hash {
 }
 
 // GetRequiredHashes calculates the number of additional hashes needed to verify specified target hashes
+// It only counts nodes; Prove generates an actual proof for a tree with commitments.
 func (t *VerkleTree) GetRequiredHashes(targets []common.Hash) int {
 	if t == nil || t.Root == nil || len(targets) == 0 {
 		return 0
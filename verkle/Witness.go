@@ -0,0 +1,263 @@
+package verkle
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	multiproof "github.com/crate-crypto/go-ipa"
+	"github.com/crate-crypto/go-ipa/banderwagon"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Commitment sizes of the backends, in bytes
+const (
+	HashCommitmentSize     = common.HashLength          // Keccak256 interior hashes, see ComputeHashes
+	PedersenCommitmentSize = banderwagon.CompressedSize // Compressed Banderwagon points, see ComputeCommitments
+)
+
+// WitnessSizeBytes returns the bytes a verifier needs to check the targets
+// against the root, so that Verkle bandwidth compares with the MPT and CMPT
+// proof sizes. It counts the binary encoding of every proven transaction plus,
+// for a tree with commitments, the VerkleProof (commitments of
+// PedersenCommitmentSize, path indices and the IPA opening) and, for a Keccak
+// tree, the sibling hashes of HashCommitmentSize needed to recompute the root.
+// Targets not in the tree are ignored, as in GetRequiredHashes.
+func (t *VerkleTree) WitnessSizeBytes(targets []common.Hash) int {
+	if t == nil || t.Root == nil {
+		return 0
+	}
+	leaves := make(map[common.Hash]*Node)
+	collectLeaves(t.Root, leaves)
+
+	var present []common.Hash
+	payload := 0
+	for _, target := range targets {
+		leaf, ok := leaves[target]
+		if !ok {
+			continue
+		}
+		delete(leaves, target) // Count every target once
+		present = append(present, target)
+		if leaf.Transaction != nil {
+			payload += int(leaf.Transaction.Size())
+		}
+	}
+	if len(present) == 0 {
+		return 0
+	}
+
+	if !t.committed || t.Root.IsLeaf {
+		set := make(map[common.Hash]struct{}, len(present))
+		for _, h := range present {
+			set[h] = struct{}{}
+		}
+		_, siblings := countSiblings(t.Root, set)
+		return payload + siblings*HashCommitmentSize
+	}
+	proof, err := t.Prove(present)
+	if err != nil {
+		return 0
+	}
+	return payload + proof.SizeBytes()
+}
+
+// countSiblings reports whether the subtree below node holds a target and how
+// many hashes outside the target paths are needed to recompute its hash
+func countSiblings(node *Node, targets map[common.Hash]struct{}) (bool, int) {
+	if node.IsLeaf {
+		_, present := targets[node.TxHash]
+		return present, 0
+	}
+	found := false
+	siblings, missing := 0, 0
+	for _, child := range node.Children {
+		has, need := countSiblings(child, targets)
+		if has {
+			found = true
+			siblings += need
+		} else {
+			missing++
+		}
+	}
+	if !found {
+		return false, 0
+	}
+	return true, siblings + missing
+}
+
+// Witness bundles everything a stateless client needs to check requested
+// transactions against a root commitment alone: the transactions, whose
+// hashes are the leaves, and the VerkleProof with their path commitments and
+// aggregated opening. It travels as MarshalBinary output between processes.
+type Witness struct {
+	Transactions []*types.Transaction // Requested transactions, in proof order
+	Proof        *VerkleProof         // Nil when the tree is a single leaf
+}
+
+// NewWitness bundles the transactions with their proof. The tree must have
+// commitments, place leaves by position and hold every transaction.
+func (t *VerkleTree) NewWitness(txs []*types.Transaction) (*Witness, error) {
+	if t == nil || t.Root == nil {
+		return nil, errors.New("verkle: empty tree")
+	}
+	if !t.committed {
+		return nil, errors.New("verkle: tree has no commitments")
+	}
+	if t.keyed {
+		return nil, errors.New("verkle: keyed trees are checked with VerifyKeyedProof")
+	}
+	// Repeated transactions are carried once, as Prove proves them once
+	var (
+		targets []common.Hash
+		unique  []*types.Transaction
+	)
+	seen := make(map[common.Hash]bool, len(txs))
+	for _, tx := range txs {
+		hash := tx.Hash()
+		if !seen[hash] {
+			seen[hash] = true
+			targets = append(targets, hash)
+			unique = append(unique, tx)
+		}
+	}
+	proof, err := proveOrLeaf(t, targets)
+	if err != nil {
+		return nil, err
+	}
+	if proof == nil && (len(targets) != 1 || targets[0] != t.Root.Hash) {
+		return nil, errors.New("verkle: transactions not in tree")
+	}
+	return &Witness{Transactions: unique, Proof: proof}, nil
+}
+
+// Verify checks the witness against the root commitment, hashing the
+// transactions itself. A witness repeating a transaction is rejected.
+func (w *Witness) Verify(root common.Hash) (bool, error) {
+	if len(w.Transactions) == 0 {
+		return false, nil
+	}
+	targets := make([]common.Hash, len(w.Transactions))
+	seen := make(map[common.Hash]bool, len(w.Transactions))
+	for i, tx := range w.Transactions {
+		targets[i] = tx.Hash()
+		if seen[targets[i]] {
+			return false, nil
+		}
+		seen[targets[i]] = true
+	}
+	return verifyOrLeaf(root, targets, w.Proof)
+}
+
+// MarshalBinary encodes the witness: a uvarint transaction count, each
+// transaction as a uvarint length and its binary encoding, then a zero byte if
+// there is no proof, or else the uvarint path depth, the paths, a uvarint
+// commitment count, the commitments and finally the serialized opening
+func (w *Witness) MarshalBinary() ([]byte, error) {
+	out := binary.AppendUvarint(nil, uint64(len(w.Transactions)))
+	for _, tx := range w.Transactions {
+		txData, err := tx.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		out = binary.AppendUvarint(out, uint64(len(txData)))
+		out = append(out, txData...)
+	}
+	if w.Proof == nil {
+		return append(out, 0), nil
+	}
+	if len(w.Proof.Paths) != len(w.Transactions) || len(w.Proof.Paths[0]) == 0 || w.Proof.Opening == nil {
+		return nil, errors.New("verkle: proof does not match the transactions")
+	}
+	depth := len(w.Proof.Paths[0])
+	out = binary.AppendUvarint(out, uint64(depth))
+	for _, path := range w.Proof.Paths {
+		if len(path) != depth {
+			return nil, errors.New("verkle: paths of different depths")
+		}
+		out = append(out, path...)
+	}
+	out = binary.AppendUvarint(out, uint64(len(w.Proof.Commitments)))
+	for _, c := range w.Proof.Commitments {
+		out = append(out, c[:]...)
+	}
+	var opening bytes.Buffer
+	if err := w.Proof.Opening.Write(&opening); err != nil {
+		return nil, err
+	}
+	return append(out, opening.Bytes()...), nil
+}
+
+// UnmarshalBinary decodes a witness produced by MarshalBinary
+func (w *Witness) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+	count, err := binary.ReadUvarint(r)
+	if err != nil {
+		return err
+	}
+	if count > uint64(r.Len()) {
+		return fmt.Errorf("verkle: %d transactions in %d bytes", count, r.Len())
+	}
+	txs := make([]*types.Transaction, count)
+	for i := range txs {
+		size, err := binary.ReadUvarint(r)
+		if err != nil {
+			return err
+		}
+		if size > uint64(r.Len()) {
+			return errors.New("verkle: witness transaction is truncated")
+		}
+		txData := make([]byte, size)
+		if _, err := io.ReadFull(r, txData); err != nil {
+			return err
+		}
+		txs[i] = new(types.Transaction)
+		if err := txs[i].UnmarshalBinary(txData); err != nil {
+			return fmt.Errorf("verkle: malformed witness transaction %d: %w", i, err)
+		}
+	}
+
+	depth, err := binary.ReadUvarint(r)
+	if err != nil {
+		return err
+	}
+	if depth == 0 {
+		if r.Len() != 0 {
+			return fmt.Errorf("verkle: %d trailing bytes after witness", r.Len())
+		}
+		w.Transactions, w.Proof = txs, nil
+		return nil
+	}
+	if depth > 64 || count*depth > uint64(r.Len()) {
+		return fmt.Errorf("verkle: invalid witness path depth %d", depth)
+	}
+	proof := &VerkleProof{Paths: make([][]uint8, count)}
+	for i := range proof.Paths {
+		proof.Paths[i] = make([]uint8, depth)
+		if _, err := io.ReadFull(r, proof.Paths[i]); err != nil {
+			return err
+		}
+	}
+	commitments, err := binary.ReadUvarint(r)
+	if err != nil {
+		return err
+	}
+	if commitments > uint64(r.Len())/PedersenCommitmentSize {
+		return errors.New("verkle: witness commitments are truncated")
+	}
+	proof.Commitments = make([]common.Hash, commitments)
+	for i := range proof.Commitments {
+		if _, err := io.ReadFull(r, proof.Commitments[i][:]); err != nil {
+			return err
+		}
+	}
+	proof.Opening = new(multiproof.MultiProof)
+	if err := proof.Opening.Read(r); err != nil {
+		return fmt.Errorf("verkle: malformed witness opening: %w", err)
+	}
+	w.Transactions, w.Proof = txs, proof
+	return nil
+}
@@ -1,12 +1,17 @@
 package verkle
 
 import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/crate-crypto/go-ipa/bandersnatch/fr"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/params"
 	"math/big"
 	"math/rand"
+	"strings"
 	"testing"
 	"time"
 )
@@ -139,3 +144,761 @@ func contains(slice []int, value int) bool {
 	}
 	return false
 }
+
+// TestVerkleProof checks that IPA openings verify and stay constant in size
+func TestVerkleProof(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	txs := make([]*types.Transaction, 300)
+	for i := range txs {
+		txs[i] = newTestTx(signer, uint64(i), 100)
+	}
+	tree, err := NewVerkleTreeWithCommitments(txs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := tree.Root.Hash
+
+	one := []common.Hash{txs[7].Hash()}
+	many := []common.Hash{txs[0].Hash(), txs[7].Hash(), txs[150].Hash(), txs[299].Hash()}
+	sizes := make([]int, 0, 2)
+	for _, targets := range [][]common.Hash{one, many} {
+		proof, err := tree.Prove(targets)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ok, err := VerifyProof(root, targets, proof)
+		if err != nil || !ok {
+			t.Fatalf("valid proof for %d targets rejected: %v", len(targets), err)
+		}
+		sizes = append(sizes, proof.SizeBytes()-len(proof.Commitments)*common.HashLength-len(targets)*len(proof.Paths[0]))
+
+		wrong := append([]common.Hash(nil), targets...)
+		wrong[0] = txs[1].Hash()
+		if ok, _ := VerifyProof(root, wrong, proof); ok {
+			t.Fatal("proof accepted for a different leaf")
+		}
+	}
+	if sizes[0] != sizes[1] {
+		t.Fatalf("opening size grew with targets: %d vs %d", sizes[0], sizes[1])
+	}
+
+	// A repeated path must not prove a second, different target
+	proof, err := tree.Prove([]common.Hash{txs[7].Hash(), txs[7].Hash()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(proof.Paths) != 1 {
+		t.Fatalf("got %d paths for a repeated target, want 1", len(proof.Paths))
+	}
+	forged := &VerkleProof{Paths: [][]uint8{proof.Paths[0], proof.Paths[0]}, Commitments: proof.Commitments, Opening: proof.Opening}
+	if ok, _ := VerifyProof(root, []common.Hash{txs[7].Hash(), common.HexToHash("0xdeadbeef")}, forged); ok {
+		t.Fatal("repeated path accepted for a different target")
+	}
+	if ok, err := VerifyProof(root, []common.Hash{txs[7].Hash(), txs[7].Hash()}, forged); err != nil || !ok {
+		t.Fatalf("repeated path rejected for the same target: %v", err)
+	}
+
+	if _, err := NewVerkleTreeFromTransactions(txs).Prove(one); err == nil {
+		t.Fatal("keccak tree produced a commitment proof")
+	}
+}
+
+// TestProveTxs checks proofs for transactions and rejection of unknown targets
+func TestProveTxs(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	txs := make([]*types.Transaction, 40)
+	for i := range txs {
+		txs[i] = newTestTx(signer, uint64(i), 100)
+	}
+	tree, err := NewVerkleTreeWithCommitments(txs[:32])
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof, err := tree.ProveTxs([]*types.Transaction{txs[3], txs[20]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(proof.Paths) != 2 || len(proof.Commitments) != 2 {
+		t.Fatalf("got %d paths and %d commitments, want 2 and 2", len(proof.Paths), len(proof.Commitments))
+	}
+	if ok, err := VerifyProof(tree.Root.Hash, []common.Hash{txs[3].Hash(), txs[20].Hash()}, proof); err != nil || !ok {
+		t.Fatalf("valid proof rejected: %v", err)
+	}
+	if _, err := tree.ProveTxs([]*types.Transaction{txs[35]}); err == nil {
+		t.Fatal("proved a transaction outside the tree")
+	}
+}
+
+// TestWitnessSizeBytes checks the witness sizes of both backends
+func TestWitnessSizeBytes(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	txs := make([]*types.Transaction, 32)
+	for i := range txs {
+		txs[i] = newTestTx(signer, uint64(i), 100)
+	}
+	targets := []common.Hash{txs[3].Hash(), txs[3].Hash(), common.Hash{1}}
+	payload := int(txs[3].Size())
+
+	// 15 leaf siblings and the other half of the root
+	hashed := NewVerkleTreeFromTransactions(txs)
+	if got, want := hashed.WitnessSizeBytes(targets), payload+16*HashCommitmentSize; got != want {
+		t.Fatalf("keccak witness: got %d bytes, want %d", got, want)
+	}
+
+	committed, err := NewVerkleTreeWithCommitments(txs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof, err := committed.Prove(targets[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := committed.WitnessSizeBytes(targets), payload+proof.SizeBytes(); got != want {
+		t.Fatalf("pedersen witness: got %d bytes, want %d", got, want)
+	}
+	if hashed.WitnessSizeBytes([]common.Hash{{1}}) != 0 {
+		t.Fatal("witness for a missing target")
+	}
+}
+
+// TestVerkleWidth checks width validation and proofs in a width-256 tree
+func TestVerkleWidth(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	txs := make([]*types.Transaction, 600)
+	for i := range txs {
+		txs[i] = newTestTx(signer, uint64(i), 100)
+	}
+	if _, err := NewVerkleTreeWithK(txs, 1); err == nil {
+		t.Fatal("accepted width 1")
+	}
+	if _, err := NewVerkleTreeWithCommitmentsK(txs, MaxCommitmentWidth+1); err == nil {
+		t.Fatal("accepted a width beyond the commitment backend")
+	}
+	if _, err := NewVerkleTreeWithK(txs, MaxCommitmentWidth+1); err != nil {
+		t.Fatalf("keccak tree rejected width %d: %v", MaxCommitmentWidth+1, err)
+	}
+
+	tree, err := NewVerkleTreeWithCommitmentsK(txs, MaxCommitmentWidth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tree.Root.Children) != 3 {
+		t.Fatalf("root has %d children, want 3", len(tree.Root.Children))
+	}
+	targets := []common.Hash{txs[0].Hash(), txs[599].Hash()}
+	proof, err := tree.Prove(targets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := VerifyProof(tree.Root.Hash, targets, proof); err != nil || !ok {
+		t.Fatalf("valid width-256 proof rejected: %v", err)
+	}
+}
+
+// TestKeyedVerkleTree checks order-independent placement and keyed proofs
+func TestKeyedVerkleTree(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	txs := make([]*types.Transaction, 500)
+	for i := range txs {
+		txs[i] = newTestTx(signer, uint64(i), 100)
+	}
+	tree, err := NewKeyedVerkleTree(txs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reversed := make([]*types.Transaction, len(txs))
+	for i, tx := range txs {
+		reversed[len(txs)-1-i] = tx
+	}
+	other, err := NewKeyedVerkleTree(reversed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree.Root.Hash != other.Root.Hash {
+		t.Fatal("root depends on transaction order")
+	}
+
+	targets := []common.Hash{txs[0].Hash(), txs[250].Hash(), txs[499].Hash()}
+	proof, err := tree.Prove(targets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, path := range proof.Paths {
+		stem, suffix := StemSuffix(targets[i])
+		if path[0] != stem[0] || path[len(path)-1] != suffix {
+			t.Fatalf("path %v does not follow key %s", path, targets[i].Hex())
+		}
+	}
+	if ok, err := VerifyKeyedProof(tree.Root.Hash, targets, proof); err != nil || !ok {
+		t.Fatalf("valid keyed proof rejected: %v", err)
+	}
+	wrong := append([]common.Hash(nil), targets...)
+	wrong[1] = txs[1].Hash()
+	if ok, _ := VerifyKeyedProof(tree.Root.Hash, wrong, proof); ok {
+		t.Fatal("keyed proof accepted for a different key")
+	}
+
+	// A repeated path must not prove a key sharing its path but not its stem
+	forgedKey := targets[0]
+	forgedKey[StemLength-1] ^= 0xff
+	forged := &VerkleProof{Paths: append(append([][]uint8{}, proof.Paths...), proof.Paths[0]), Commitments: proof.Commitments, Opening: proof.Opening}
+	if ok, _ := VerifyKeyedProof(tree.Root.Hash, append(append([]common.Hash{}, targets...), forgedKey), forged); ok {
+		t.Fatal("repeated path accepted for a key with a different stem")
+	}
+
+	single, err := NewKeyedVerkleTree(txs[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof, err = single.Prove(targets[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := VerifyKeyedProof(single.Root.Hash, targets[:1], proof); err != nil || !ok {
+		t.Fatalf("single-leaf keyed proof rejected: %v", err)
+	}
+}
+
+// TestMeasureProofSizes checks the naive sizes against proofs of single targets
+func TestMeasureProofSizes(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	txs := make([]*types.Transaction, 300)
+	for i := range txs {
+		txs[i] = newTestTx(signer, uint64(i), 100)
+	}
+	tree, err := NewVerkleTreeWithCommitments(txs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	targets := []common.Hash{txs[0].Hash(), txs[1].Hash(), txs[200].Hash()}
+	sizes, err := tree.MeasureProofSizes(targets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	naive := 0
+	for _, target := range targets {
+		proof, err := tree.Prove([]common.Hash{target})
+		if err != nil {
+			t.Fatal(err)
+		}
+		naive += proof.SizeBytes()
+	}
+	if sizes.Naive != naive {
+		t.Fatalf("naive size %d, want %d", sizes.Naive, naive)
+	}
+	if sizes.Saved() <= 0 {
+		t.Fatalf("aggregation saved %d bytes", sizes.Saved())
+	}
+}
+
+// TestUpdateLeaf checks incremental updates against rebuilding the tree
+func TestUpdateLeaf(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	txs := make([]*types.Transaction, 300)
+	for i := range txs {
+		txs[i] = newTestTx(signer, uint64(i), 100)
+	}
+	replacement := newTestTx(signer, 1000, 100)
+	updated := append([]*types.Transaction(nil), txs...)
+	updated[257] = replacement
+
+	committed, err := NewVerkleTreeWithCommitments(txs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := committed.UpdateLeaf(257, replacement.Hash()); err != nil {
+		t.Fatal(err)
+	}
+	rebuilt, err := NewVerkleTreeWithCommitments(updated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if committed.Root.Hash != rebuilt.Root.Hash {
+		t.Fatal("delta update disagrees with a rebuilt tree")
+	}
+	targets := []common.Hash{replacement.Hash()}
+	proof, err := committed.Prove(targets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := VerifyProof(committed.Root.Hash, targets, proof); err != nil || !ok {
+		t.Fatalf("proof of the updated leaf rejected: %v", err)
+	}
+
+	hashed := NewVerkleTreeFromTransactions(txs)
+	if err := hashed.UpdateLeaf(257, replacement.Hash()); err != nil {
+		t.Fatal(err)
+	}
+	if hashed.Root.Hash != NewVerkleTreeFromTransactions(updated).Root.Hash {
+		t.Fatal("keccak update disagrees with a rebuilt tree")
+	}
+
+	for _, position := range []int{-1, 300, 4096} {
+		if err := hashed.UpdateLeaf(position, common.Hash{}); err == nil {
+			t.Fatalf("updated position %d", position)
+		}
+	}
+	keyed, err := NewKeyedVerkleTree(txs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := keyed.UpdateLeaf(0, common.Hash{}); err == nil {
+		t.Fatal("updated a keyed tree in place")
+	}
+}
+
+// TestNewVerkleTreeWithStats checks the reported counts and the injected logger
+func TestNewVerkleTreeWithStats(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	txs := make([]*types.Transaction, 300)
+	for i := range txs {
+		txs[i] = newTestTx(signer, uint64(i), 100)
+	}
+	logged := 0
+	logger := func(format string, args ...any) { logged++ }
+
+	tree, stats, err := NewVerkleTreeWithStats(txs, K, true, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 300 leaves, 19 nodes above them, 2 above those and the root
+	if stats.Nodes != 300+19+2+1 || stats.Commitments != 22 || stats.Height != 3 {
+		t.Fatalf("got %+v", stats)
+	}
+	if logged != 1 {
+		t.Fatalf("logger called %d times, want 1", logged)
+	}
+	if tree.Root.Hash == (common.Hash{}) {
+		t.Fatal("tree has no root commitment")
+	}
+
+	_, stats, err = NewVerkleTreeWithStats(txs, K, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Commitments != 0 || stats.Nodes != 322 {
+		t.Fatalf("keccak build: got %+v", stats)
+	}
+}
+
+// TestClusteredVerkleTree checks proofs across clusters, including a single-member cluster
+func TestClusteredVerkleTree(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	clusters := make(map[string][]*types.Transaction)
+	var txs []*types.Transaction
+	for i := 0; i < 400; i++ {
+		tx := newTestTx(signer, uint64(i), 100)
+		key := string([]byte{byte(i % 20)})
+		if i == 399 {
+			key = "solo"
+		}
+		clusters[key] = append(clusters[key], tx)
+		txs = append(txs, tx)
+	}
+	tree, err := NewClusteredVerkleTree(clusters, K)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	targets := []common.Hash{txs[0].Hash(), txs[20].Hash(), txs[7].Hash(), txs[399].Hash()}
+	proof, err := tree.Prove(targets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(proof.Prefixes) != 3 || proof.Inner[2] != nil {
+		t.Fatalf("got %d clusters, want 3 with the last a single leaf", len(proof.Prefixes))
+	}
+	if ok, err := VerifyClusteredProof(tree.Root(), targets, proof); err != nil || !ok {
+		t.Fatalf("valid clustered proof rejected: %v", err)
+	}
+	if ok, _ := VerifyClusteredProof(tree.Root(), append(targets, txs[1].Hash()), proof); ok {
+		t.Fatal("proof accepted for an unproven transaction")
+	}
+	if proof.SizeBytes() <= proof.Outer.SizeBytes() {
+		t.Fatalf("proof size %d does not include the inner proofs", proof.SizeBytes())
+	}
+	if _, err := tree.Prove([]common.Hash{{1}}); err == nil {
+		t.Fatal("proved a transaction outside the tree")
+	}
+	if ok, err := VerifyClusteredProof(tree.Root(), targets, nil); err != nil || ok {
+		t.Fatalf("nil proof accepted: %v", err)
+	}
+
+	// A repeated member path must not prove a made-up member of the cluster
+	evil := common.HexToHash("0xdeadbeef")
+	inner := *proof.Inner[0]
+	inner.Paths = append(append([][]uint8{}, inner.Paths...), inner.Paths[0])
+	forged := *proof
+	forged.Members = append([][]common.Hash{append(append([]common.Hash{}, proof.Members[0]...), evil)}, proof.Members[1:]...)
+	forged.Inner = append([]*VerkleProof{&inner}, proof.Inner[1:]...)
+	if ok, _ := VerifyClusteredProof(tree.Root(), append(targets, evil), &forged); ok {
+		t.Fatal("repeated member path accepted for a made-up member")
+	}
+}
+
+// TestRequiredElements checks the elements against the count and a real proof
+func TestRequiredElements(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	txs := make([]*types.Transaction, 300)
+	for i := range txs {
+		txs[i] = newTestTx(signer, uint64(i), 100)
+	}
+	tree, err := NewVerkleTreeWithCommitments(txs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	targets := []common.Hash{txs[0].Hash(), txs[5].Hash(), txs[290].Hash(), {1}}
+	elements := tree.RequiredElements(targets)
+	proof, err := tree.Prove(targets[:3])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counts := make(map[ElementKind]int)
+	var interior []common.Hash
+	for _, e := range elements {
+		counts[e.Kind]++
+		if e.Kind == ElementInterior {
+			interior = append(interior, e.Hash)
+		}
+	}
+	if got, want := counts[ElementRoot]+counts[ElementInterior]+counts[ElementLeaf], tree.GetRequiredHashes(targets); got != want {
+		t.Fatalf("got %d path elements, GetRequiredHashes counts %d", got, want)
+	}
+	if len(interior) != len(proof.Commitments) {
+		t.Fatalf("got %d interior elements, proof carries %d commitments", len(interior), len(proof.Commitments))
+	}
+	for i := range interior {
+		if interior[i] != proof.Commitments[i] {
+			t.Fatalf("interior element %d differs from the proof", i)
+		}
+	}
+	// Three openings for 0, one more for its sibling 5 and three for 290
+	if counts[ElementOpening] != 7 {
+		t.Fatalf("got %d openings", counts[ElementOpening])
+	}
+}
+
+// TestStateVerkleTree checks EIP-6800 key embedding and state proofs
+func TestStateVerkleTree(t *testing.T) {
+	alice := common.HexToAddress("0x00000000000000000000000000000000000a11ce")
+	bob := common.HexToAddress("0x0000000000000000000000000000000000000b0b")
+
+	aliceStem, _ := StemSuffix(AccountKey(alice))
+	codeStem, suffix := StemSuffix(CodeHashKey(alice))
+	if !bytes.Equal(aliceStem, codeStem) || suffix != 1 {
+		t.Fatal("code hash leaf is not next to the basic data leaf")
+	}
+	headerStem, _ := StemSuffix(StorageKey(alice, common.Hash{}))
+	mainStem, _ := StemSuffix(StorageKey(alice, common.BigToHash(big.NewInt(1000))))
+	if !bytes.Equal(headerStem, aliceStem) || bytes.Equal(mainStem, aliceStem) {
+		t.Fatal("storage slots placed on the wrong stems")
+	}
+
+	leaves := []StateLeaf{
+		{AccountKey(alice), common.Hash{1}},
+		{CodeHashKey(alice), common.Hash{2}},
+		{StorageKey(alice, common.Hash{}), common.Hash{3}},
+		{StorageKey(alice, common.BigToHash(big.NewInt(1000))), common.Hash{4}},
+		{AccountKey(bob), common.Hash{5}},
+		{AccountKey(bob), common.Hash{6}},
+	}
+	tree, err := NewStateVerkleTree(leaves)
+	if err != nil {
+		t.Fatal(err)
+	}
+	witness := []StateLeaf{leaves[0], leaves[3], leaves[5]}
+	proof, err := tree.Prove([]common.Hash{witness[0].Key, witness[1].Key, witness[2].Key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := VerifyStateProof(tree.Root.Hash, witness, proof); err != nil || !ok {
+		t.Fatalf("valid state proof rejected: %v", err)
+	}
+	stale := append([]StateLeaf(nil), witness...)
+	stale[2] = leaves[4]
+	if ok, _ := VerifyStateProof(tree.Root.Hash, stale, proof); ok {
+		t.Fatal("state proof accepted for an overwritten value")
+	}
+
+	// A value congruent to the proven one modulo the scalar field must not verify
+	forged := append([]StateLeaf(nil), witness...)
+	aliased := new(big.Int).Add(fr.Modulus(), new(big.Int).SetBytes(forged[0].Value.Bytes()))
+	forged[0].Value = common.BigToHash(aliased)
+	if ok, _ := VerifyStateProof(tree.Root.Hash, forged, proof); ok {
+		t.Fatal("state proof accepted for a value aliased modulo the scalar field")
+	}
+	if _, err := NewStateVerkleTree(forged); err == nil {
+		t.Fatal("state tree built from a value outside the scalar field")
+	}
+
+	// A repeated key must not prove a second value for it
+	duplicated := &VerkleProof{Paths: append(append([][]uint8{}, proof.Paths...), proof.Paths[0]), Commitments: proof.Commitments, Opening: proof.Opening}
+	claimed := append(append([]StateLeaf(nil), witness...), StateLeaf{witness[0].Key, common.BigToHash(big.NewInt(0x99))})
+	if ok, _ := VerifyStateProof(tree.Root.Hash, claimed, duplicated); ok {
+		t.Fatal("state proof accepted a second value for a repeated key")
+	}
+}
+
+// TestUpdate checks transaction swaps and the touched nodes they report
+func TestUpdate(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	txs := make([]*types.Transaction, 300)
+	for i := range txs {
+		txs[i] = newTestTx(signer, uint64(i), 100)
+	}
+	replacement := newTestTx(signer, 1000, 100)
+	updated := append([]*types.Transaction(nil), txs...)
+	updated[42] = replacement
+
+	tree, err := NewVerkleTreeWithCommitments(txs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldRoot := tree.Root.Hash
+	changes, err := tree.Update(42, replacement)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 4 {
+		t.Fatalf("touched %d nodes, want leaf, two interior nodes and root", len(changes))
+	}
+	leaf, root := changes[0], changes[len(changes)-1]
+	if leaf.Node.Transaction != replacement || leaf.OldHash != txs[42].Hash() || len(leaf.Path) != 3 {
+		t.Fatalf("unexpected leaf change %+v", leaf)
+	}
+	if root.Node != tree.Root || root.OldHash != oldRoot || len(root.Path) != 0 {
+		t.Fatalf("unexpected root change %+v", root)
+	}
+	rebuilt, err := NewVerkleTreeWithCommitments(updated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree.Root.Hash != rebuilt.Root.Hash {
+		t.Fatal("update disagrees with a rebuilt tree")
+	}
+	if _, err := tree.Update(0, nil); err == nil {
+		t.Fatal("accepted a nil transaction")
+	}
+}
+
+// TestNodeIterator checks the pre-order walk against the tree structure
+func TestNodeIterator(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	txs := make([]*types.Transaction, 20)
+	for i := range txs {
+		txs[i] = newTestTx(signer, uint64(i), 100)
+	}
+	tree := NewVerkleTreeFromTransactions(txs)
+
+	var nodes []NodeInfo
+	for it := tree.NewNodeIterator(); it.Next(); {
+		nodes = append(nodes, it.Node())
+	}
+	// Root, first group with 16 leaves, second group with 4 leaves
+	if len(nodes) != 1+1+16+1+4 {
+		t.Fatalf("visited %d nodes", len(nodes))
+	}
+	if nodes[0].Depth != 0 || nodes[0].Hash != tree.Root.Hash || nodes[0].IsLeaf {
+		t.Fatalf("first node %+v is not the root", nodes[0])
+	}
+	if leaf := nodes[2]; !leaf.IsLeaf || leaf.Depth != 2 || leaf.ChildIndex != 0 || leaf.Hash != txs[0].Hash() {
+		t.Fatalf("unexpected first leaf %+v", leaf)
+	}
+	if second := nodes[18]; second.IsLeaf || second.Depth != 1 || second.ChildIndex != 1 {
+		t.Fatalf("unexpected second group %+v", second)
+	}
+	if last := nodes[len(nodes)-1]; last.ChildIndex != 3 || last.Hash != txs[19].Hash() {
+		t.Fatalf("unexpected last leaf %+v", last)
+	}
+	if (&VerkleTree{}).NewNodeIterator().Next() {
+		t.Fatal("empty tree yielded a node")
+	}
+}
+
+// TestWriteDOT checks the rendered nodes, highlights and depth limit
+func TestWriteDOT(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	txs := make([]*types.Transaction, 20)
+	for i := range txs {
+		txs[i] = newTestTx(signer, uint64(i), 100)
+	}
+	tree := NewVerkleTreeFromTransactions(txs)
+
+	var buf bytes.Buffer
+	if err := tree.WriteDOT(&buf, []common.Hash{txs[17].Hash()}, 0); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if got := strings.Count(out, "label=\""); got != 23+22 {
+		t.Fatalf("got %d labels, want 23 nodes and 22 edges", got)
+	}
+	if strings.Count(out, dotTargetColor) != 1 || strings.Count(out, dotPathColor) != 2 {
+		t.Fatal("target and path not highlighted")
+	}
+	if !strings.Contains(out, fmt.Sprintf("%x", txs[17].Hash().Bytes()[:4])) {
+		t.Fatal("target leaf missing")
+	}
+
+	buf.Reset()
+	if err := tree.WriteDOT(&buf, nil, 2); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "shape=box") {
+		t.Fatal("leaves drawn below the depth limit")
+	}
+}
+
+// TestStats checks levels, fill factor and backend of both hashings
+func TestStats(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	txs := make([]*types.Transaction, 300)
+	for i := range txs {
+		txs[i] = newTestTx(signer, uint64(i), 100)
+	}
+	tree := NewVerkleTreeFromTransactions(txs)
+	stats := tree.Stats()
+	if stats.Backend != BackendKeccak || stats.Height != 3 || fmt.Sprint(stats.NodesPerLevel) != "[1 2 19 300]" {
+		t.Fatalf("got %+v", stats)
+	}
+	if want := 321.0 / (22 * 16); stats.FillFactor != want {
+		t.Fatalf("fill factor %v, want %v", stats.FillFactor, want)
+	}
+
+	if err := tree.ComputeCommitments(); err != nil {
+		t.Fatal(err)
+	}
+	stats = tree.Stats()
+	if stats.Backend != BackendPedersen || stats.HashTime <= 0 {
+		t.Fatalf("got %+v after committing", stats)
+	}
+	if (*VerkleTree)(nil).Stats().Height != 0 {
+		t.Fatal("nil tree has a height")
+	}
+}
+
+// TestCompareWithMPT checks the paired results of a small workload
+func TestCompareWithMPT(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	txs := make([]*types.Transaction, 300)
+	for i := range txs {
+		txs[i] = newTestTx(signer, uint64(i), 100)
+	}
+	outsider := newTestTx(signer, 1000, 100)
+	requests := [][]*types.Transaction{
+		{txs[3]},
+		txs[100:164],
+		{outsider},
+	}
+	cmp, err := CompareWithMPT(txs, requests, K)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cmp.Requests) != 3 {
+		t.Fatalf("got %d results", len(cmp.Requests))
+	}
+	single, bulk := cmp.Requests[0], cmp.Requests[1]
+	if single.Targets != 1 || bulk.Targets != 64 || cmp.Requests[2].Targets != 0 {
+		t.Fatalf("unexpected target counts %+v", cmp.Requests)
+	}
+	payload := int(txs[3].Size())
+	if single.VerkleWitnessBytes <= payload || single.MPTWitnessBytes <= payload {
+		t.Fatalf("witnesses carry no proof: %+v", single)
+	}
+	if bulk.VerkleWitnessBytes >= bulk.MPTWitnessBytes {
+		t.Fatalf("aggregated verkle witness of %d bytes not below mpt witness of %d bytes", bulk.VerkleWitnessBytes, bulk.MPTWitnessBytes)
+	}
+	if single.VerkleProveTime <= 0 || single.VerkleVerifyTime <= 0 {
+		t.Fatalf("timings missing: %+v", single)
+	}
+}
+
+// TestWitness checks a witness round trip through its binary encoding
+func TestWitness(t *testing.T) {
+	signer := types.LatestSigner(params.TestChainConfig)
+	txs := make([]*types.Transaction, 300)
+	for i := range txs {
+		txs[i] = newTestTx(signer, uint64(i), 100)
+	}
+	tree, err := NewVerkleTreeWithCommitments(txs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	witness, err := tree.NewWitness([]*types.Transaction{txs[9], txs[123], txs[299]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := witness.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The stateless side only knows the root
+	var received Witness
+	if err := received.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := received.Verify(tree.Root.Hash); err != nil || !ok {
+		t.Fatalf("decoded witness rejected: %v", err)
+	}
+	if ok, _ := received.Verify(NewVerkleTreeFromTransactions(txs[:299]).Root.Hash); ok {
+		t.Fatal("witness accepted against another root")
+	}
+
+	// A repeated path must not carry a made-up transaction along a real one
+	proven, err := tree.NewWitness([]*types.Transaction{txs[3], txs[3]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(proven.Transactions) != 1 {
+		t.Fatalf("witness carries %d copies of one transaction, want 1", len(proven.Transactions))
+	}
+	path := proven.Proof.Paths[0]
+	evil := newTestTx(signer, 5000, 100)
+	forged := &Witness{
+		Transactions: []*types.Transaction{txs[3], evil},
+		Proof:        &VerkleProof{Paths: [][]uint8{path, path}, Commitments: proven.Proof.Commitments, Opening: proven.Proof.Opening},
+	}
+	if ok, _ := forged.Verify(tree.Root.Hash); ok {
+		t.Fatal("witness accepted a made-up transaction on a repeated path")
+	}
+	forged.Transactions = []*types.Transaction{txs[3], txs[3]}
+	if ok, _ := forged.Verify(tree.Root.Hash); ok {
+		t.Fatal("witness accepted a repeated transaction")
+	}
+	for n := 0; n < len(data); n += 7 {
+		if err := received.UnmarshalBinary(data[:n]); err == nil {
+			t.Fatalf("decoded a witness truncated to %d of %d bytes", n, len(data))
+		}
+	}
+	if err := received.UnmarshalBinary(data[:len(data)-1]); err == nil {
+		t.Fatal("decoded a truncated witness")
+	}
+	// No transactions, a path depth of one and 1<<59 commitments
+	huge := binary.AppendUvarint([]byte{0, 1}, 1<<59)
+	if err := received.UnmarshalBinary(huge); err == nil {
+		t.Fatal("decoded a witness claiming more commitments than its bytes")
+	}
+
+	single, err := NewVerkleTreeWithCommitments(txs[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	witness, err = single.NewWitness(txs[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err = witness.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := received.UnmarshalBinary(data); err != nil || received.Proof != nil {
+		t.Fatalf("single-leaf witness decoded as %+v: %v", received, err)
+	}
+	if ok, err := received.Verify(single.Root.Hash); err != nil || !ok {
+		t.Fatalf("single-leaf witness rejected: %v", err)
+	}
+	if _, err := NewVerkleTreeFromTransactions(txs).NewWitness(txs[:1]); err == nil {
+		t.Fatal("keccak tree produced a witness")
+	}
+}